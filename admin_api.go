@@ -0,0 +1,229 @@
+package rmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminAPI is an http.Handler serving a JSON API to inspect and operate
+// queues, so tooling and dashboards don't need to know the Redis keys. Mount
+// it with http.StripPrefix, its routes are:
+//
+//	GET  /queues                    open queues with their counts
+//	GET  /queues/{queue}            queue with its connections and consumers
+//	POST /queues/{queue}/purge      purge rejected, or ready with ?list=ready
+//	POST /queues/{queue}/return     return all rejected, or ?count=n of them
+//	POST /queues/{queue}/pause      pause consumption, see Queue.Pause
+//	POST /queues/{queue}/resume     resume consumption
+//	GET  /connections               all connections with their queues
+//	POST /clean                     clean dead connections, ?dry_run=true only reports
+//
+// Errors are responded as {"error": "..."} with a matching status.
+type AdminAPI struct {
+	connection *redisConnection
+	auth       func(request *http.Request) bool
+}
+
+// NewAdminAPI returns an admin API for the given connection. If auth is not
+// nil it's called for every request and the request is refused with 401
+// Unauthorized unless it returns true.
+func NewAdminAPI(connection *redisConnection, auth func(request *http.Request) bool) *AdminAPI {
+	return &AdminAPI{
+		connection: connection,
+		auth:       auth,
+	}
+}
+
+type adminQueueView struct {
+	Name           string                `json:"name"`
+	Ready          int                   `json:"ready"`
+	Rejected       int                   `json:"rejected"`
+	Unacked        int                   `json:"unacked"`
+	Consumers      int                   `json:"consumers"`
+	Paused         bool                  `json:"paused"`
+	OldestReadyAge time.Duration         `json:"oldest_ready_age"` // -1 if unknown
+	Connections    []adminConnectionView `json:"connections,omitempty"`
+}
+
+type adminConnectionView struct {
+	Name      string              `json:"name"`
+	Active    bool                `json:"active"`
+	Unacked   int                 `json:"unacked,omitempty"`
+	Queues    []string            `json:"queues,omitempty"`
+	Consumers []adminConsumerView `json:"consumers,omitempty"`
+}
+
+type adminConsumerView struct {
+	Name  string       `json:"name"`
+	Stats ConsumerStat `json:"stats"`
+}
+
+func (api *AdminAPI) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if api.auth != nil && !api.auth(request) {
+		writeAdminError(writer, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	route := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	read := request.Method == http.MethodGet || request.Method == http.MethodHead
+	switch {
+	case len(route) == 1 && route[0] == "queues" && read:
+		api.listQueues(writer)
+	case len(route) == 2 && route[0] == "queues" && read:
+		api.showQueue(writer, route[1])
+	case len(route) == 3 && route[0] == "queues" && request.Method == http.MethodPost:
+		api.act(writer, request, route[1], route[2])
+	case len(route) == 1 && route[0] == "connections" && read:
+		api.listConnections(writer)
+	case len(route) == 1 && route[0] == "clean" && request.Method == http.MethodPost:
+		api.clean(writer, request)
+	case len(route) >= 1 && len(route) <= 3 && (route[0] == "queues" || route[0] == "connections" || route[0] == "clean"):
+		writeAdminError(writer, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeAdminError(writer, http.StatusNotFound, "not found")
+	}
+}
+
+func (api *AdminAPI) listQueues(writer http.ResponseWriter) {
+	stats := api.connection.CollectStats(api.connection.GetOpenQueues())
+	views := []adminQueueView{}
+	for _, queueName := range stats.sortedQueueNames() {
+		views = append(views, api.queueView(queueName, stats.QueueStats[queueName], false))
+	}
+	writeAdminJSON(writer, http.StatusOK, views)
+}
+
+func (api *AdminAPI) showQueue(writer http.ResponseWriter, queueName string) {
+	if !api.isOpen(queueName) {
+		writeAdminError(writer, http.StatusNotFound, "unknown queue")
+		return
+	}
+	stats := api.connection.CollectStats([]string{queueName})
+	writeAdminJSON(writer, http.StatusOK, api.queueView(queueName, stats.QueueStats[queueName], true))
+}
+
+func (api *AdminAPI) queueView(queueName string, stat QueueStat, detailed bool) adminQueueView {
+	view := adminQueueView{
+		Name:           queueName,
+		Ready:          stat.ReadyCount,
+		Rejected:       stat.RejectedCount,
+		Unacked:        stat.UnackedCount(),
+		Consumers:      stat.ConsumerCount(),
+		Paused:         api.connection.openQueue(queueName).Paused(),
+		OldestReadyAge: stat.OldestReadyAge,
+	}
+	if !detailed {
+		return view
+	}
+
+	view.Connections = []adminConnectionView{}
+	for _, connectionName := range stat.connectionStats.sortedNames() {
+		connectionStat := stat.connectionStats[connectionName]
+		connectionView := adminConnectionView{
+			Name:    connectionName,
+			Active:  connectionStat.active,
+			Unacked: connectionStat.unackedCount,
+		}
+		for _, consumer := range connectionStat.consumers {
+			connectionView.Consumers = append(connectionView.Consumers, adminConsumerView{
+				Name:  consumer,
+				Stats: connectionStat.consumerStats[consumer],
+			})
+		}
+		view.Connections = append(view.Connections, connectionView)
+	}
+	return view
+}
+
+func (api *AdminAPI) listConnections(writer http.ResponseWriter) {
+	connectionNames := api.connection.GetConnections()
+	views := make([]adminConnectionView, 0, len(connectionNames))
+	for _, connectionName := range connectionNames {
+		connection := api.connection.hijackConnection(connectionName)
+		views = append(views, adminConnectionView{
+			Name:   connectionName,
+			Active: connection.Check(),
+			Queues: connection.GetConsumingQueues(),
+		})
+	}
+	writeAdminJSON(writer, http.StatusOK, views)
+}
+
+// act performs action on the queue and responds with the affected count
+func (api *AdminAPI) act(writer http.ResponseWriter, request *http.Request, queueName, action string) {
+	if !api.isOpen(queueName) {
+		writeAdminError(writer, http.StatusNotFound, "unknown queue")
+		return
+	}
+	queue := api.connection.OpenQueue(queueName)
+
+	switch action {
+	case "purge":
+		switch list := request.FormValue("list"); list {
+		case "ready":
+			writeAdminJSON(writer, http.StatusOK, map[string]int{"purged": queue.PurgeReady()})
+		case "", "rejected":
+			writeAdminJSON(writer, http.StatusOK, map[string]int{"purged": queue.PurgeRejected()})
+		default:
+			writeAdminError(writer, http.StatusBadRequest, "invalid list")
+		}
+	case "return":
+		if value := request.FormValue("count"); value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 {
+				writeAdminError(writer, http.StatusBadRequest, "invalid count")
+				return
+			}
+			writeAdminJSON(writer, http.StatusOK, map[string]int{"returned": queue.ReturnRejected(count)})
+			return
+		}
+		writeAdminJSON(writer, http.StatusOK, map[string]int{"returned": queue.ReturnAllRejected()})
+	case "pause", "resume":
+		var ok bool
+		if action == "pause" {
+			ok = queue.Pause()
+		} else {
+			ok = queue.Resume()
+		}
+		if !ok {
+			writeAdminError(writer, http.StatusInternalServerError, "failed to "+action+" queue")
+			return
+		}
+		writeAdminJSON(writer, http.StatusOK, map[string]bool{"paused": queue.Paused()})
+	default:
+		writeAdminError(writer, http.StatusNotFound, "unknown action")
+	}
+}
+
+func (api *AdminAPI) clean(writer http.ResponseWriter, request *http.Request) {
+	cleaner := NewCleaner(api.connection)
+	cleaner.SetDryRun(request.FormValue("dry_run") == "true")
+	report, err := cleaner.CleanWithReport()
+	if err != nil {
+		writeAdminError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(writer, http.StatusOK, report)
+}
+
+func (api *AdminAPI) isOpen(queueName string) bool {
+	for _, name := range api.connection.GetOpenQueues() {
+		if name == queueName {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAdminJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeAdminError(writer http.ResponseWriter, status int, message string) {
+	writeAdminJSON(writer, status, map[string]string{"error": message})
+}
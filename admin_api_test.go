@@ -0,0 +1,90 @@
+package rmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestAdminAPISuite(t *testing.T) {
+	TestingSuiteT(&AdminAPISuite{}, t)
+}
+
+type AdminAPISuite struct{}
+
+func (suite *AdminAPISuite) TestAdminAPI(c *C) {
+	connection := OpenConnection("admin-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("admin-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.Resume()
+	queue.Publish("admin-d1")
+	queue.Publish("admin-d2")
+
+	api := NewAdminAPI(connection, nil)
+	serve := func(method, target string, response interface{}) int {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		c.Check(recorder.Header().Get("Content-Type"), Equals, "application/json")
+		if response != nil {
+			c.Check(json.Unmarshal(recorder.Body.Bytes(), response), IsNil)
+		}
+		return recorder.Code
+	}
+
+	queues := []adminQueueView{}
+	c.Check(serve("GET", "/queues", &queues), Equals, http.StatusOK)
+	found := false
+	for _, view := range queues {
+		if view.Name == "admin-q" {
+			found = true
+			c.Check(view.Ready, Equals, 2)
+			c.Check(view.Connections, HasLen, 0)
+		}
+	}
+	c.Check(found, Equals, true)
+
+	view := adminQueueView{}
+	c.Check(serve("GET", "/queues/admin-q", &view), Equals, http.StatusOK)
+	c.Check(view.Ready, Equals, 2)
+	c.Check(view.Paused, Equals, false)
+
+	paused := map[string]bool{}
+	c.Check(serve("POST", "/queues/admin-q/pause", &paused), Equals, http.StatusOK)
+	c.Check(paused["paused"], Equals, true)
+	c.Check(queue.Paused(), Equals, true)
+	c.Check(serve("POST", "/queues/admin-q/resume", &paused), Equals, http.StatusOK)
+	c.Check(paused["paused"], Equals, false)
+
+	counts := map[string]int{}
+	c.Check(serve("POST", "/queues/admin-q/purge?list=ready", &counts), Equals, http.StatusOK)
+	c.Check(counts["purged"], Equals, 2)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(serve("POST", "/queues/admin-q/return?count=x", nil), Equals, http.StatusBadRequest)
+	c.Check(serve("POST", "/queues/admin-q/return", &counts), Equals, http.StatusOK)
+	c.Check(counts["returned"], Equals, 0)
+
+	report := CleanReport{}
+	c.Check(serve("POST", "/clean?dry_run=true", &report), Equals, http.StatusOK)
+	c.Check(report.DryRun, Equals, true)
+
+	connections := []adminConnectionView{}
+	c.Check(serve("GET", "/connections", &connections), Equals, http.StatusOK)
+	c.Check(len(connections) > 0, Equals, true)
+
+	errorResponse := map[string]string{}
+	c.Check(serve("GET", "/queues/admin-unknown", &errorResponse), Equals, http.StatusNotFound)
+	c.Check(errorResponse["error"], Equals, "unknown queue")
+	c.Check(serve("DELETE", "/queues", nil), Equals, http.StatusMethodNotAllowed)
+	c.Check(serve("GET", "/other", nil), Equals, http.StatusNotFound)
+
+	denied := NewAdminAPI(connection, func(*http.Request) bool { return false })
+	recorder := httptest.NewRecorder()
+	denied.ServeHTTP(recorder, httptest.NewRequest("GET", "/queues", nil))
+	c.Check(recorder.Code, Equals, http.StatusUnauthorized)
+
+	connection.StopHeartbeat()
+}
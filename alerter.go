@@ -0,0 +1,178 @@
+package rmq
+
+import (
+	"sync"
+	"time"
+)
+
+// metrics alerts can be registered for
+const (
+	AlertMetricReady          = "ready"
+	AlertMetricRejected       = "rejected"
+	AlertMetricOldestReadyAge = "oldest_ready_age"
+)
+
+// Alert is passed to alert callbacks when a threshold was exceeded for the
+// configured period and again when the value dropped back to the threshold
+type Alert struct {
+	Queue     string
+	Metric    string    // one of the AlertMetric constants
+	Value     int64     // current value, in nanoseconds for AlertMetricOldestReadyAge
+	Threshold int64     // in nanoseconds for AlertMetricOldestReadyAge
+	Since     time.Time // when the value first exceeded the threshold
+	Resolved  bool      // true if the value is no longer above the threshold
+}
+
+type alertRule struct {
+	queue     *redisQueue
+	metric    string
+	measure   func(queue *redisQueue) (value int64, ok bool)
+	threshold int64
+	period    time.Duration
+	callback  func(Alert)
+
+	exceededSince time.Time // zero while below threshold
+	firing        bool
+}
+
+// Alerter regularly checks queue stats and calls callbacks when thresholds
+// are exceeded for a sustained period, use it to page or autoscale
+type Alerter struct {
+	connection *redisConnection
+	mutex      sync.Mutex
+	rules      []*alertRule
+	stopChan   chan struct{}
+	checkMutex sync.Mutex // serializes checks which update rule states
+}
+
+func NewAlerter(connection *redisConnection) *Alerter {
+	return &Alerter{connection: connection}
+}
+
+// OnReadyCount calls callback once the ready count of queue stayed above
+// threshold for period
+func (alerter *Alerter) OnReadyCount(queue string, threshold int, period time.Duration, callback func(Alert)) {
+	alerter.addRule(queue, AlertMetricReady, int64(threshold), period, callback, func(queue *redisQueue) (int64, bool) {
+		return int64(queue.ReadyCount()), true
+	})
+}
+
+// OnRejectedCount calls callback once the rejected count of queue stayed
+// above threshold for period
+func (alerter *Alerter) OnRejectedCount(queue string, threshold int, period time.Duration, callback func(Alert)) {
+	alerter.addRule(queue, AlertMetricRejected, int64(threshold), period, callback, func(queue *redisQueue) (int64, bool) {
+		return int64(queue.RejectedCount()), true
+	})
+}
+
+// OnOldestReadyAge calls callback once the oldest ready delivery of queue was
+// older than threshold for period. Needs envelopes, see SetEnvelope
+func (alerter *Alerter) OnOldestReadyAge(queue string, threshold time.Duration, period time.Duration, callback func(Alert)) {
+	alerter.addRule(queue, AlertMetricOldestReadyAge, int64(threshold), period, callback, func(queue *redisQueue) (int64, bool) {
+		age, ok := queue.OldestReadyAge()
+		return int64(age), ok
+	})
+}
+
+func (alerter *Alerter) addRule(queue, metric string, threshold int64, period time.Duration, callback func(Alert), measure func(*redisQueue) (int64, bool)) {
+	alerter.mutex.Lock()
+	defer alerter.mutex.Unlock()
+
+	alerter.rules = append(alerter.rules, &alertRule{
+		queue:     alerter.connection.openQueue(queue),
+		metric:    metric,
+		measure:   measure,
+		threshold: threshold,
+		period:    period,
+		callback:  callback,
+	})
+}
+
+// Start checks all thresholds every interval until Stop is called
+func (alerter *Alerter) Start(interval time.Duration) {
+	alerter.mutex.Lock()
+	defer alerter.mutex.Unlock()
+
+	if alerter.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	alerter.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				alerter.Check()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the regular checks started by Start
+func (alerter *Alerter) Stop() {
+	alerter.mutex.Lock()
+	defer alerter.mutex.Unlock()
+
+	if alerter.stopChan == nil {
+		return
+	}
+	close(alerter.stopChan)
+	alerter.stopChan = nil
+}
+
+// Check checks all thresholds once and calls the callbacks of alerts which
+// started firing or got resolved
+func (alerter *Alerter) Check() {
+	alerter.checkMutex.Lock()
+	defer alerter.checkMutex.Unlock()
+
+	alerter.mutex.Lock()
+	rules := append([]*alertRule(nil), alerter.rules...)
+	alerter.mutex.Unlock()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if alert, ok := rule.check(now); ok {
+			rule.callback(alert)
+		}
+	}
+}
+
+// check updates the rule state and returns an alert if the callback should
+// be called
+func (rule *alertRule) check(now time.Time) (alert Alert, ok bool) {
+	value, known := rule.measure(rule.queue)
+	alert = Alert{
+		Queue:     rule.queue.name,
+		Metric:    rule.metric,
+		Value:     value,
+		Threshold: rule.threshold,
+		Since:     rule.exceededSince,
+	}
+
+	if !known || value <= rule.threshold {
+		firing := rule.firing
+		rule.exceededSince = time.Time{}
+		rule.firing = false
+		alert.Resolved = true
+		return alert, firing
+	}
+
+	if rule.exceededSince.IsZero() {
+		rule.exceededSince = now
+		alert.Since = now
+	}
+
+	if rule.firing || now.Sub(rule.exceededSince) < rule.period {
+		return alert, false
+	}
+
+	rule.firing = true
+	return alert, true
+}
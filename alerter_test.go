@@ -0,0 +1,83 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestAlerterSuite(t *testing.T) {
+	TestingSuiteT(&AlerterSuite{}, t)
+}
+
+type AlerterSuite struct{}
+
+func (suite *AlerterSuite) TestReadyCount(c *C) {
+	connection := OpenConnection("alert-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("alert-q").(*redisQueue)
+	queue.PurgeReady()
+
+	alerts := []Alert{}
+	alerter := NewAlerter(connection)
+	alerter.OnReadyCount("alert-q", 1, 20*time.Millisecond, func(alert Alert) {
+		alerts = append(alerts, alert)
+	})
+
+	queue.Publish("alert-d1")
+	alerter.Check()
+	c.Check(alerts, HasLen, 0) // not above threshold
+
+	queue.Publish("alert-d2")
+	alerter.Check()
+	c.Check(alerts, HasLen, 0) // not sustained yet
+
+	time.Sleep(20 * time.Millisecond)
+	alerter.Check()
+	c.Assert(alerts, HasLen, 1)
+	c.Check(alerts[0].Queue, Equals, "alert-q")
+	c.Check(alerts[0].Metric, Equals, AlertMetricReady)
+	c.Check(alerts[0].Value, Equals, int64(2))
+	c.Check(alerts[0].Threshold, Equals, int64(1))
+	c.Check(alerts[0].Resolved, Equals, false)
+
+	alerter.Check()
+	c.Check(alerts, HasLen, 1) // fires only once
+
+	queue.PurgeReady()
+	alerter.Check()
+	c.Assert(alerts, HasLen, 2)
+	c.Check(alerts[1].Value, Equals, int64(0))
+	c.Check(alerts[1].Resolved, Equals, true)
+
+	alerter.Check()
+	c.Check(alerts, HasLen, 2)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *AlerterSuite) TestOldestReadyAge(c *C) {
+	connection := OpenConnection("alert-age-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("alert-age-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetEnvelope(true)
+
+	fired := make(chan Alert, 10)
+	alerter := NewAlerter(connection)
+	alerter.OnOldestReadyAge("alert-age-q", 5*time.Millisecond, 0, func(alert Alert) {
+		fired <- alert
+	})
+	alerter.Start(time.Millisecond)
+	defer alerter.Stop()
+
+	queue.Publish("alert-age-d1")
+	select {
+	case alert := <-fired:
+		c.Check(alert.Metric, Equals, AlertMetricOldestReadyAge)
+		c.Check(alert.Value > int64(5*time.Millisecond), Equals, true)
+	case <-time.After(time.Second):
+		c.Error("alert didn't fire")
+	}
+
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,94 @@
+// Package amqpbridge connects rmq queues with AMQP brokers like RabbitMQ, so
+// producers and consumers can be migrated between both systems one by one.
+package amqpbridge
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/adjust/rmq"
+	"github.com/streadway/amqp"
+)
+
+// Channel is the part of *amqp.Channel used by the bridge
+type Channel interface {
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+}
+
+// Forwarder is an rmq.Consumer which republishes every delivery to an AMQP
+// exchange. A delivery is only acked after the broker confirmed the publish,
+// otherwise it's rejected.
+type Forwarder struct {
+	channel    Channel
+	exchange   string
+	routingKey string
+	confirms   <-chan amqp.Confirmation
+	mutex      sync.Mutex // confirmations arrive in publish order, so publish one at a time
+}
+
+// NewForwarder puts the channel into confirm mode and returns a forwarder
+// publishing to exchange with the given routing key
+func NewForwarder(channel Channel, exchange, routingKey string) (*Forwarder, error) {
+	if err := channel.Confirm(false); err != nil {
+		return nil, fmt.Errorf("rmq amqp bridge failed to enable confirms %s", err)
+	}
+
+	return &Forwarder{
+		channel:    channel,
+		exchange:   exchange,
+		routingKey: routingKey,
+		confirms:   channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+	}, nil
+}
+
+// Consume publishes the delivery and acks it once the broker confirmed it
+func (forwarder *Forwarder) Consume(delivery rmq.Delivery) {
+	if forwarder.publish(delivery.Payload()) {
+		delivery.Ack()
+	} else {
+		delivery.Reject()
+	}
+}
+
+func (forwarder *Forwarder) publish(payload string) bool {
+	forwarder.mutex.Lock()
+	defer forwarder.mutex.Unlock()
+
+	err := forwarder.channel.Publish(forwarder.exchange, forwarder.routingKey, false, false, amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(payload),
+	})
+	if err != nil {
+		return false
+	}
+
+	confirmation, ok := <-forwarder.confirms
+	return ok && confirmation.Ack
+}
+
+// Receive consumes the AMQP queue with the given name and publishes each
+// message to the rmq queue. A message is acked after it was published to rmq,
+// otherwise it's nacked and requeued by the broker. Receive blocks until the
+// channel is closed.
+func Receive(channel Channel, amqpQueue string, queue rmq.Queue) error {
+	messages, err := channel.Consume(amqpQueue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("rmq amqp bridge failed to consume %s %s", amqpQueue, err)
+	}
+
+	for message := range messages {
+		if queue.PublishBytes(message.Body) {
+			err = message.Ack(false)
+		} else {
+			err = message.Nack(false, true)
+		}
+		if err != nil {
+			return fmt.Errorf("rmq amqp bridge failed to acknowledge message %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package amqpbridge
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+	"github.com/streadway/amqp"
+)
+
+func TestBridgeSuite(t *testing.T) {
+	TestingSuiteT(&BridgeSuite{}, t)
+}
+
+type BridgeSuite struct{}
+
+// fakeChannel confirms publishes with ack unless the body is "nack" and fails
+// them if it's "fail"
+type fakeChannel struct {
+	confirms   chan amqp.Confirmation
+	published  []string
+	deliveries chan amqp.Delivery
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{deliveries: make(chan amqp.Delivery, 10)}
+}
+
+func (channel *fakeChannel) Confirm(noWait bool) error {
+	return nil
+}
+
+func (channel *fakeChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	channel.confirms = confirm
+	return confirm
+}
+
+func (channel *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	body := string(msg.Body)
+	if body == "fail" {
+		return errors.New("channel closed")
+	}
+	channel.published = append(channel.published, exchange+"/"+key+":"+body)
+	channel.confirms <- amqp.Confirmation{DeliveryTag: uint64(len(channel.published)), Ack: body != "nack"}
+	return nil
+}
+
+func (channel *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return channel.deliveries, nil
+}
+
+// fakeAcknowledger records how deliveries were acknowledged by tag
+type fakeAcknowledger struct {
+	acks map[uint64]string
+}
+
+func (acknowledger *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	acknowledger.acks[tag] = "ack"
+	return nil
+}
+
+func (acknowledger *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		acknowledger.acks[tag] = "nack requeue"
+	} else {
+		acknowledger.acks[tag] = "nack"
+	}
+	return nil
+}
+
+func (acknowledger *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	acknowledger.acks[tag] = "reject"
+	return nil
+}
+
+// failingQueue fails to publish the payload "fail"
+type failingQueue struct {
+	*rmq.TestQueue
+}
+
+func (queue failingQueue) PublishBytes(payload []byte) bool {
+	if string(payload) == "fail" {
+		return false
+	}
+	return queue.TestQueue.PublishBytes(payload)
+}
+
+func (suite *BridgeSuite) TestForwarder(c *C) {
+	channel := newFakeChannel()
+	forwarder, err := NewForwarder(channel, "things", "new")
+	c.Assert(err, IsNil)
+
+	acked := rmq.NewTestDeliveryString("amqp-d1")
+	forwarder.Consume(acked)
+	c.Check(acked.State, Equals, rmq.Acked)
+
+	nacked := rmq.NewTestDeliveryString("nack")
+	forwarder.Consume(nacked)
+	c.Check(nacked.State, Equals, rmq.Rejected)
+
+	failed := rmq.NewTestDeliveryString("fail")
+	forwarder.Consume(failed)
+	c.Check(failed.State, Equals, rmq.Rejected)
+
+	c.Check(channel.published, DeepEquals, []string{"things/new:amqp-d1", "things/new:nack"})
+}
+
+func (suite *BridgeSuite) TestReceive(c *C) {
+	channel := newFakeChannel()
+	acknowledger := &fakeAcknowledger{acks: map[uint64]string{}}
+	channel.deliveries <- amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 1, Body: []byte("amqp-d1")}
+	channel.deliveries <- amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 2, Body: []byte("fail")}
+	channel.deliveries <- amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 3, Body: []byte("amqp-d3")}
+	close(channel.deliveries)
+
+	queue := failingQueue{rmq.NewTestQueue("amqp-q")}
+	c.Check(Receive(channel, "things", queue), IsNil)
+	c.Check(queue.LastDeliveries, DeepEquals, []string{"amqp-d1", "amqp-d3"})
+	c.Check(acknowledger.acks, DeepEquals, map[uint64]string{1: "ack", 2: "nack requeue", 3: "ack"})
+}
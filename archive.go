@@ -0,0 +1,114 @@
+package rmq
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetCloseArchive makes Close archive the ready and rejected deliveries for
+// retention instead of purging them, so a queue closed by accident can be
+// recovered with RestoreArchive until then. The lists are renamed, so
+// archiving doesn't copy deliveries. Zero makes Close purge them again.
+func (queue *redisQueue) SetCloseArchive(retention time.Duration) {
+	queue.closeArchive = retention
+}
+
+// Archives returns the names of the archives of the queue which didn't
+// expire yet, newest first
+func (queue *redisQueue) Archives() []string {
+	archivesKey := queue.archivesKey()
+	names := []string{}
+	for name, value := range queue.redisClient.HGetAll(archivesKey) {
+		expiresAt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || time.Now().UnixNano() > expiresAt {
+			queue.redisClient.HDel(archivesKey, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names
+}
+
+// RestoreArchive moves the deliveries of an archive created by Close back to
+// the queue and opens it again. They are queued behind deliveries published
+// since. Returns the number of restored deliveries, which is zero if the
+// archive expired.
+func (queue *redisQueue) RestoreArchive(archive string) int {
+	readyKey, rejectedKey, reasonsKey := queue.archiveKeys(archive)
+	restored := queue.moveRedisList(readyKey, queue.readyKey)
+	restored += queue.moveRedisList(rejectedKey, queue.rejectedKey)
+	for payload, reason := range queue.redisClient.HGetAll(reasonsKey) {
+		queue.redisClient.HSet(queue.reasonsKey, payload, reason)
+	}
+	queue.redisClient.Del(reasonsKey)
+	queue.redisClient.HDel(queue.archivesKey(), archive)
+
+	queue.redisClient.SAdd(queuesKey, queue.name)
+	queue.audit(AuditRestoreArchive, restored, "")
+	return restored
+}
+
+// archive renames the ready and rejected lists to a new archive which
+// expires after retention and returns the number of archived deliveries
+func (queue *redisQueue) archive(retention time.Duration) int {
+	now := time.Now()
+	archive := strconv.FormatInt(now.UnixNano(), 10)
+	readyKey, rejectedKey, reasonsKey := queue.archiveKeys(archive)
+
+	archived := 0
+	keys := [][2]string{
+		{queue.readyKey, readyKey},
+		{queue.rejectedKey, rejectedKey},
+		{queue.reasonsKey, reasonsKey},
+	}
+	for _, key := range keys {
+		if renamed, _ := queue.redisClient.RenameNX(key[0], key[1]); !renamed {
+			continue
+		}
+		queue.redisClient.Expire(key[1], retention)
+		if key[1] != reasonsKey {
+			count, _ := queue.redisClient.LLen(key[1])
+			archived += count
+		}
+	}
+	if archived == 0 {
+		return 0
+	}
+
+	archivesKey := queue.archivesKey()
+	queue.redisClient.HSet(archivesKey, archive, strconv.FormatInt(now.Add(retention).UnixNano(), 10))
+	// keep the hash as long as its longest living archive
+	if ttl, ok := queue.redisClient.TTL(archivesKey); !ok || ttl < retention {
+		queue.redisClient.Expire(archivesKey, retention)
+	}
+	return archived
+}
+
+// moveRedisList moves all elements of the list source to the list
+// destination in batches and returns how many were moved
+func (queue *redisQueue) moveRedisList(source, destination string) int {
+	moved := 0
+	for {
+		values := queue.redisClient.RPopLPushBatch(source, destination, purgeBatchSize)
+		if len(values) == 0 {
+			return moved
+		}
+		moved += len(values)
+	}
+}
+
+func (queue *redisQueue) archivesKey() string {
+	return strings.Replace(queueArchivesTemplate, phQueue, queue.name, 1)
+}
+
+// archiveKeys returns the keys of the ready list, rejected list and rejection
+// reasons of an archive
+func (queue *redisQueue) archiveKeys(archive string) (readyKey, rejectedKey, reasonsKey string) {
+	replacer := strings.NewReplacer(phQueue, queue.name, phArchive, archive)
+	return replacer.Replace(queueArchiveReadyTemplate),
+		replacer.Replace(queueArchiveRejectedTemplate),
+		replacer.Replace(queueArchiveReasonsTemplate)
+}
@@ -0,0 +1,72 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestArchiveSuite(t *testing.T) {
+	TestingSuiteT(&ArchiveSuite{}, t)
+}
+
+type ArchiveSuite struct{}
+
+func (suite *ArchiveSuite) TestCloseAndRestore(c *C) {
+	connection := OpenConnection("archive-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("archive-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	for _, archive := range queue.Archives() {
+		queue.RestoreArchive(archive)
+	}
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	queue.SetCloseArchive(time.Minute)
+	queue.Publish("archive-d1")
+	queue.Publish("archive-d2")
+	queue.Publish("archive-d3")
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Reject(), Equals, true)
+
+	c.Check(queue.Close(), Equals, true)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 0)
+	c.Check(connection.isOpenQueue("archive-q"), Equals, false)
+	archives := queue.Archives()
+	c.Assert(archives, HasLen, 1)
+	readyKey, _, _ := queue.archiveKeys(archives[0])
+	ttl, ok := connection.redisClient.TTL(readyKey)
+	c.Check(ok, Equals, true)
+	c.Check(ttl > 0, Equals, true)
+
+	queue.Publish("archive-d4")
+	c.Check(queue.RestoreArchive(archives[0]), Equals, 3)
+	c.Check(queue.Archives(), HasLen, 0)
+	c.Check(connection.isOpenQueue("archive-q"), Equals, true)
+	c.Check(queue.PeekReady(3), DeepEquals, []string{"archive-d4", "archive-d2", "archive-d3"})
+	c.Check(queue.PeekRejected(1), DeepEquals, []string{"archive-d1"})
+	_, ok = queue.RejectionReason("archive-d1")
+	c.Check(ok, Equals, true)
+	c.Check(queue.RestoreArchive(archives[0]), Equals, 0)
+
+	// without archive mode Close purges
+	queue.SetCloseArchive(0)
+	c.Check(queue.Close(), Equals, true)
+	c.Check(queue.Archives(), HasLen, 0)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	connection.StopHeartbeat()
+}
+
+func (suite *ArchiveSuite) TestEmpty(c *C) {
+	connection := OpenConnection("archive-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("archive-empty-q").(*redisQueue)
+	queue.SetCloseArchive(time.Minute)
+	queue.Close()
+	c.Check(queue.Archives(), HasLen, 0)
+	connection.StopHeartbeat()
+}
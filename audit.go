@@ -0,0 +1,113 @@
+package rmq
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// administrative operations recorded in audit events
+const (
+	AuditPurgeReady         = "purge_ready"
+	AuditPurgeRejected      = "purge_rejected"
+	AuditReturnRejected     = "return_rejected"
+	AuditReturnUnacked      = "return_unacked"
+	AuditMoveReady          = "move_ready"
+	AuditCloseQueue         = "close_queue"
+	AuditRestoreArchive     = "restore_archive"
+	AuditPurgePoison        = "purge_poison"
+	AuditReturnPoison       = "return_poison"
+	AuditRemoveConsumer     = "remove_consumer"
+	AuditRemoveAllConsumers = "remove_all_consumers"
+)
+
+// AuditEvent records an administrative operation on a queue
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Connection string    `json:"connection"`
+	Queue      string    `json:"queue"`
+	Operation  string    `json:"operation"`          // one of the Audit constants
+	Count      int       `json:"count"`              // number of affected deliveries or consumers
+	Consumer   string    `json:"consumer,omitempty"` // set for AuditRemoveConsumer
+}
+
+// AuditSink receives audit events, see SetAuditSink. Audit is called
+// synchronously by the operation, so it should be fast.
+type AuditSink interface {
+	Audit(event AuditEvent)
+}
+
+// AuditSinkFunc adapts a function to an AuditSink
+type AuditSinkFunc func(event AuditEvent)
+
+func (f AuditSinkFunc) Audit(event AuditEvent) {
+	f(event)
+}
+
+// SetAuditSink records purges, returns, closed queues and removed consumers
+// done through queues of this connection with actor, like the user or
+// service behind the process. Pass nil to stop auditing.
+func (connection *redisConnection) SetAuditSink(sink AuditSink, actor string) {
+	connection.auditMutex.Lock()
+	defer connection.auditMutex.Unlock()
+	connection.auditSink = sink
+	connection.auditActor = actor
+}
+
+func (connection *redisConnection) audit(queue, operation string, count int, consumer string) {
+	connection.auditMutex.RLock()
+	sink, actor := connection.auditSink, connection.auditActor
+	connection.auditMutex.RUnlock()
+	if sink == nil {
+		return
+	}
+
+	sink.Audit(AuditEvent{
+		Time:       time.Now(),
+		Actor:      actor,
+		Connection: connection.Name,
+		Queue:      queue,
+		Operation:  operation,
+		Count:      count,
+		Consumer:   consumer,
+	})
+}
+
+// audit records an operation if the queue was opened by a connection with
+// an audit sink
+func (queue *redisQueue) audit(operation string, count int, consumer string) {
+	if queue.connection != nil {
+		queue.connection.audit(queue.name, operation, count, consumer)
+	}
+}
+
+// RedisAuditSink stores audit events in a capped list in Redis, shared by
+// all connections using it
+type RedisAuditSink struct {
+	redisClient RedisClient
+	maxEvents   int
+}
+
+// NewRedisAuditSink keeps the last maxEvents events
+func NewRedisAuditSink(connection *redisConnection, maxEvents int) *RedisAuditSink {
+	return &RedisAuditSink{redisClient: connection.redisClient, maxEvents: maxEvents}
+}
+
+func (sink *RedisAuditSink) Audit(event AuditEvent) {
+	encoded, _ := json.Marshal(event)
+	sink.redisClient.LPush(auditKey, string(encoded))
+	sink.redisClient.LTrim(auditKey, 0, sink.maxEvents-1)
+}
+
+// Events returns the stored events, oldest first
+func (sink *RedisAuditSink) Events() []AuditEvent {
+	values := sink.redisClient.LRange(auditKey, 0, -1)
+	events := make([]AuditEvent, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		var event AuditEvent
+		if err := json.Unmarshal([]byte(values[i]), &event); err == nil {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestAuditSuite(t *testing.T) {
+	TestingSuiteT(&AuditSuite{}, t)
+}
+
+type AuditSuite struct{}
+
+func (suite *AuditSuite) TestAudit(c *C) {
+	connection := OpenConnection("audit-conn", "tcp", "localhost:6379", 1)
+	connection.redisClient.Del(auditKey)
+	sink := NewRedisAuditSink(connection, 10)
+	connection.SetAuditSink(sink, "alice")
+
+	queue := connection.OpenQueue("audit-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("audit-d1")
+	queue.Publish("audit-d2")
+	c.Check(queue.PurgeReady(), Equals, 2)
+
+	queue.StartConsuming(10, time.Millisecond)
+	name, _ := queue.AddConsumer("audit-cons", NewTestConsumer("audit-A"))
+	c.Check(queue.RemoveConsumer(name), Equals, true)
+	queue.StopConsuming()
+	time.Sleep(10 * time.Millisecond) // let the consumer stop, which isn't audited
+
+	events := sink.Events()
+	c.Assert(events, HasLen, 3)
+	c.Check(events[0].Operation, Equals, AuditPurgeReady)
+	c.Check(events[0].Count, Equals, 0)
+	c.Check(events[1].Operation, Equals, AuditPurgeReady)
+	c.Check(events[1].Count, Equals, 2)
+	c.Check(events[1].Actor, Equals, "alice")
+	c.Check(events[1].Queue, Equals, "audit-q")
+	c.Check(events[1].Connection, Equals, connection.Name)
+	c.Check(events[2].Operation, Equals, AuditRemoveConsumer)
+	c.Check(events[2].Consumer, Equals, name)
+
+	recorded := []AuditEvent{}
+	connection.SetAuditSink(AuditSinkFunc(func(event AuditEvent) {
+		recorded = append(recorded, event)
+	}), "bob")
+	queue.Publish("audit-d3")
+	c.Check(queue.ReturnAllRejected(), Equals, 0)
+	queue.Close()
+	c.Assert(recorded, HasLen, 2) // ReturnAllRejected is recorded once
+	c.Check(recorded[0].Operation, Equals, AuditReturnRejected)
+	c.Check(recorded[1].Operation, Equals, AuditCloseQueue)
+	c.Check(recorded[1].Count, Equals, 1)
+	c.Check(recorded[1].Actor, Equals, "bob")
+
+	connection.SetAuditSink(nil, "")
+	queue.PurgeReady()
+	c.Check(recorded, HasLen, 2)
+	connection.StopHeartbeat()
+}
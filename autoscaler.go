@@ -0,0 +1,207 @@
+package rmq
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AutoscalerOptions configure when the Autoscaler scales
+type AutoscalerOptions struct {
+	MinConsumers int // scaled up to on the first check
+	MaxConsumers int // zero means no limit
+
+	// scale up while the ready backlog would take longer than this to drain
+	// at the current processing rate, scale down while it would take less
+	// than half of it
+	TargetDrainTime time.Duration
+}
+
+// Autoscaler observes the ready backlog and processing rate of a queue and
+// calls scale hooks to adjust the number of consumers. The hooks can add or
+// remove consumer goroutines (see LocalScaler) or feed an external scaler
+// like a Kubernetes HPA metric. They return false if scaling failed.
+type Autoscaler struct {
+	connection *redisConnection
+	queue      *redisQueue
+	options    AutoscalerOptions
+	scaleUp    func() bool
+	scaleDown  func() bool
+
+	mutex        sync.Mutex
+	consumers    int       // number of successful scale ups minus scale downs
+	lastConsumed int       // consumed deliveries of all consumers at lastCheck
+	lastCheck    time.Time // zero before the first check
+	stopChan     chan struct{}
+}
+
+func NewAutoscaler(connection *redisConnection, queue string, options AutoscalerOptions, scaleUp, scaleDown func() bool) *Autoscaler {
+	return &Autoscaler{
+		connection: connection,
+		queue:      connection.openQueue(queue),
+		options:    options,
+		scaleUp:    scaleUp,
+		scaleDown:  scaleDown,
+	}
+}
+
+// Consumers returns the number of consumers the autoscaler scaled to
+func (autoscaler *Autoscaler) Consumers() int {
+	autoscaler.mutex.Lock()
+	defer autoscaler.mutex.Unlock()
+	return autoscaler.consumers
+}
+
+// Start checks every interval if scaling is needed until Stop is called
+func (autoscaler *Autoscaler) Start(interval time.Duration) {
+	autoscaler.mutex.Lock()
+	defer autoscaler.mutex.Unlock()
+
+	if autoscaler.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	autoscaler.stopChan = stopChan
+
+	go func() {
+		autoscaler.Check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				autoscaler.Check()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the regular checks started by Start, it doesn't scale down
+func (autoscaler *Autoscaler) Stop() {
+	autoscaler.mutex.Lock()
+	defer autoscaler.mutex.Unlock()
+
+	if autoscaler.stopChan == nil {
+		return
+	}
+	close(autoscaler.stopChan)
+	autoscaler.stopChan = nil
+}
+
+// Check scales up or down by one consumer if needed
+func (autoscaler *Autoscaler) Check() {
+	autoscaler.mutex.Lock()
+	defer autoscaler.mutex.Unlock()
+
+	if autoscaler.consumers < autoscaler.options.MinConsumers {
+		for autoscaler.consumers < autoscaler.options.MinConsumers && autoscaler.scaleUp() {
+			autoscaler.consumers++
+		}
+		return
+	}
+
+	backlog := autoscaler.queue.ReadyCount()
+	rate, ok := autoscaler.processingRate()
+	if !ok {
+		return // need two checks to know the rate
+	}
+
+	switch {
+	case backlog > 0 && (rate == 0 || drainTime(backlog, rate) > autoscaler.options.TargetDrainTime):
+		if autoscaler.options.MaxConsumers > 0 && autoscaler.consumers >= autoscaler.options.MaxConsumers {
+			return
+		}
+		if autoscaler.scaleUp() {
+			autoscaler.consumers++
+		}
+
+	case drainTime(backlog, rate) < autoscaler.options.TargetDrainTime/2:
+		if autoscaler.consumers <= autoscaler.options.MinConsumers {
+			return
+		}
+		if autoscaler.scaleDown() {
+			autoscaler.consumers--
+		}
+	}
+}
+
+// processingRate returns how many deliveries per second all consumers of
+// the queue consumed since the last check
+func (autoscaler *Autoscaler) processingRate() (rate float64, ok bool) {
+	stats := CollectStats([]string{autoscaler.queue.name}, autoscaler.connection)
+	consumed := stats.QueueStats[autoscaler.queue.name].ProcessingStat().Consumed
+	now := time.Now()
+
+	lastConsumed, lastCheck := autoscaler.lastConsumed, autoscaler.lastCheck
+	autoscaler.lastConsumed, autoscaler.lastCheck = consumed, now
+
+	if lastCheck.IsZero() || consumed < lastConsumed {
+		return 0, false // first check or consumers were removed
+	}
+	return float64(consumed-lastConsumed) / now.Sub(lastCheck).Seconds(), true
+}
+
+func drainTime(backlog int, rate float64) time.Duration {
+	if backlog == 0 {
+		return 0
+	}
+	return time.Duration(float64(backlog) / rate * float64(time.Second))
+}
+
+// LocalScaler adds and removes consumer goroutines on a consuming queue.
+// Use its ScaleUp and ScaleDown methods as Autoscaler hooks.
+type LocalScaler struct {
+	queue       *redisQueue
+	tag         string
+	newConsumer func() Consumer
+
+	mutex sync.Mutex
+	stops []func() // of added consumers, most recent last
+}
+
+// NewLocalScaler returns a scaler which adds consumers created by newConsumer
+// to queue. StartConsuming must have been called on queue.
+func NewLocalScaler(queue Queue, tag string, newConsumer func() Consumer) (*LocalScaler, error) {
+	redisQueue, ok := queue.(*redisQueue)
+	if !ok {
+		return nil, fmt.Errorf("rmq local scaler needs a redis queue, got %T", queue)
+	}
+
+	return &LocalScaler{
+		queue:       redisQueue,
+		tag:         tag,
+		newConsumer: newConsumer,
+	}, nil
+}
+
+// ScaleUp adds a consumer, returns false if the queue isn't consuming
+func (scaler *LocalScaler) ScaleUp() bool {
+	scaler.mutex.Lock()
+	defer scaler.mutex.Unlock()
+
+	_, stop, err := scaler.queue.addStoppableConsumer(scaler.tag, scaler.newConsumer())
+	if err != nil {
+		return false
+	}
+	scaler.stops = append(scaler.stops, stop)
+	return true
+}
+
+// ScaleDown stops the most recently added consumer after it finished its
+// current delivery
+func (scaler *LocalScaler) ScaleDown() bool {
+	scaler.mutex.Lock()
+	defer scaler.mutex.Unlock()
+
+	if len(scaler.stops) == 0 {
+		return false
+	}
+
+	last := len(scaler.stops) - 1
+	scaler.stops[last]()
+	scaler.stops = scaler.stops[:last]
+	return true
+}
@@ -0,0 +1,81 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestAutoscalerSuite(t *testing.T) {
+	TestingSuiteT(&AutoscalerSuite{}, t)
+}
+
+type AutoscalerSuite struct{}
+
+func (suite *AutoscalerSuite) TestAutoscaler(c *C) {
+	connection := OpenConnection("scale-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("scale-q").(*redisQueue)
+	queue.PurgeReady()
+
+	ups, downs := 0, 0
+	autoscaler := NewAutoscaler(connection, "scale-q", AutoscalerOptions{
+		MinConsumers:    1,
+		MaxConsumers:    3,
+		TargetDrainTime: time.Second,
+	}, func() bool { ups++; return true }, func() bool { downs++; return true })
+
+	autoscaler.Check()
+	c.Check(autoscaler.Consumers(), Equals, 1) // scaled to min
+
+	for i := 0; i < 10; i++ {
+		queue.Publish("scale-d")
+	}
+	autoscaler.Check() // measures rate
+	c.Check(autoscaler.Consumers(), Equals, 1)
+	autoscaler.Check()
+	c.Check(autoscaler.Consumers(), Equals, 2) // nothing consumed
+	autoscaler.Check()
+	autoscaler.Check()
+	c.Check(autoscaler.Consumers(), Equals, 3) // max
+	c.Check(ups, Equals, 3)
+
+	queue.PurgeReady()
+	autoscaler.Check()
+	autoscaler.Check()
+	autoscaler.Check()
+	c.Check(autoscaler.Consumers(), Equals, 1) // min
+	c.Check(downs, Equals, 2)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *AutoscalerSuite) TestLocalScaler(c *C) {
+	connection := OpenConnection("local-scale-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("local-scale-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.StartConsuming(10, time.Millisecond)
+
+	consumer := NewTestConsumer("local-scale-A")
+	scaler, err := NewLocalScaler(queue, "local-scale-cons", func() Consumer { return consumer })
+	c.Assert(err, IsNil)
+
+	c.Check(scaler.ScaleUp(), Equals, true)
+	c.Check(queue.GetConsumers(), HasLen, 1)
+	queue.Publish("local-scale-d1")
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDelivery, NotNil)
+	c.Check(consumer.LastDelivery.Payload(), Equals, "local-scale-d1")
+
+	c.Check(scaler.ScaleDown(), Equals, true)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(queue.GetConsumers(), HasLen, 0)
+	c.Check(scaler.ScaleDown(), Equals, false)
+
+	queue.Publish("local-scale-d2")
+	time.Sleep(5 * time.Millisecond)
+	c.Check(consumer.LastDelivery.Payload(), Equals, "local-scale-d1") // stopped consuming
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
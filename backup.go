@@ -0,0 +1,213 @@
+package rmq
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// BackupFormat is the file format used by Export and Import
+type BackupFormat int
+
+const (
+	// BackupLines writes one JSON object per line, easy to inspect and edit.
+	// Payloads which aren't valid UTF-8, like compressed or encrypted ones,
+	// are base64 encoded.
+	BackupLines BackupFormat = iota
+	// BackupLengthPrefixed writes a list byte, the payload length as big
+	// endian uint32 and the raw payload, more compact for binary payloads
+	BackupLengthPrefixed
+)
+
+const (
+	backupListReady    = "ready"
+	backupListRejected = "rejected"
+
+	backupChunkSize = 1000
+
+	backupEncodingBase64 = "base64"
+)
+
+type backupRecord struct {
+	List     string `json:"list"`
+	Payload  string `json:"payload"`
+	Encoding string `json:"encoding,omitempty"` // base64 for payloads which aren't valid UTF-8
+}
+
+// Export writes all ready and rejected deliveries of the queue to writer and
+// returns the number of exported deliveries. Deliveries are read in chunks
+// from oldest to newest, publishing during an export is fine but deliveries
+// consumed or returned meanwhile may be skipped. Unacked deliveries are not
+// exported.
+func Export(queue Queue, writer io.Writer, format BackupFormat) (count int, err error) {
+	redisQueue, ok := queue.(*redisQueue)
+	if !ok {
+		return 0, fmt.Errorf("rmq export needs a redis queue, got %T", queue)
+	}
+
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, list := range []string{backupListReady, backupListRejected} {
+		key := redisQueue.readyKey
+		if list == backupListRejected {
+			key = redisQueue.rejectedKey
+		}
+
+		// walk from the right (oldest) to the left (newest)
+		for offset := 0; ; offset += backupChunkSize {
+			values := redisQueue.redisClient.LRange(key, -offset-backupChunkSize, -offset-1)
+			for i := len(values) - 1; i >= 0; i-- {
+				if err := writeBackupRecord(bufferedWriter, format, backupRecord{List: list, Payload: values[i]}); err != nil {
+					return count, err
+				}
+				count++
+			}
+			if len(values) < backupChunkSize {
+				break
+			}
+		}
+	}
+
+	return count, bufferedWriter.Flush()
+}
+
+// Import reads deliveries written by Export from reader and publishes them to
+// the ready or rejected list of the queue they were exported from. It returns
+// the number of imported deliveries.
+func Import(queue Queue, reader io.Reader, format BackupFormat) (count int, err error) {
+	redisQueue, ok := queue.(*redisQueue)
+	if !ok {
+		return 0, fmt.Errorf("rmq import needs a redis queue, got %T", queue)
+	}
+
+	bufferedReader := bufio.NewReader(reader)
+	for {
+		record, err := readBackupRecord(bufferedReader, format)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		var key string
+		switch record.List {
+		case backupListReady:
+			key = redisQueue.readyKey
+		case backupListRejected:
+			key = redisQueue.rejectedKey
+		default:
+			return count, fmt.Errorf("rmq import found unknown list %q", record.List)
+		}
+
+		if ok := redisQueue.redisClient.LPush(key, record.Payload); !ok {
+			return count, fmt.Errorf("rmq import failed to push to %s", key)
+		}
+		count++
+	}
+}
+
+func writeBackupRecord(writer *bufio.Writer, format BackupFormat, record backupRecord) error {
+	switch format {
+	case BackupLines:
+		// JSON would replace invalid UTF-8 silently
+		if !utf8.ValidString(record.Payload) {
+			record.Payload = base64.StdEncoding.EncodeToString([]byte(record.Payload))
+			record.Encoding = backupEncodingBase64
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(line); err != nil {
+			return err
+		}
+		return writer.WriteByte('\n')
+
+	case BackupLengthPrefixed:
+		list := byte('r')
+		if record.List == backupListRejected {
+			list = 'x'
+		}
+		if err := writer.WriteByte(list); err != nil {
+			return err
+		}
+		if err := binary.Write(writer, binary.BigEndian, uint32(len(record.Payload))); err != nil {
+			return err
+		}
+		_, err := writer.WriteString(record.Payload)
+		return err
+
+	default:
+		return fmt.Errorf("rmq backup format %d unknown", format)
+	}
+}
+
+// readBackupRecord returns io.EOF if there are no more records
+func readBackupRecord(reader *bufio.Reader, format BackupFormat) (record backupRecord, err error) {
+	switch format {
+	case BackupLines:
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = nil // last line without newline
+		}
+		if err != nil {
+			return record, err
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return record, err
+		}
+		switch record.Encoding {
+		case "":
+		case backupEncodingBase64:
+			payload, err := base64.StdEncoding.DecodeString(record.Payload)
+			if err != nil {
+				return record, err
+			}
+			record.Payload = string(payload)
+		default:
+			return record, fmt.Errorf("rmq backup found unknown encoding %q", record.Encoding)
+		}
+		return record, nil
+
+	case BackupLengthPrefixed:
+		list, err := reader.ReadByte()
+		if err != nil {
+			return record, err
+		}
+		switch list {
+		case 'r':
+			record.List = backupListReady
+		case 'x':
+			record.List = backupListRejected
+		default:
+			return record, fmt.Errorf("rmq backup found unknown list byte %q", list)
+		}
+
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return record, unexpectedEOF(err)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return record, unexpectedEOF(err)
+		}
+		record.Payload = string(payload)
+		return record, nil
+
+	default:
+		return record, fmt.Errorf("rmq backup format %d unknown", format)
+	}
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF for reads in the
+// middle of a record
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
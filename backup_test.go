@@ -0,0 +1,51 @@
+package rmq
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestBackupSuite(t *testing.T) {
+	TestingSuiteT(&BackupSuite{}, t)
+}
+
+type BackupSuite struct{}
+
+func (suite *BackupSuite) TestExportImport(c *C) {
+	connection := OpenConnection("backup-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("backup-q").(*redisQueue)
+
+	for _, format := range []BackupFormat{BackupLines, BackupLengthPrefixed} {
+		queue.PurgeReady()
+		queue.PurgeRejected()
+		for i := 0; i < 3; i++ {
+			queue.Publish(fmt.Sprintf("backup-d%d\nline", i))
+		}
+		queue.redisClient.LPush(queue.rejectedKey, "backup-r0")
+		queue.redisClient.LPush(queue.rejectedKey, "backup-r1\xff\x00") // not UTF-8
+
+		var buffer bytes.Buffer
+		count, err := Export(queue, &buffer, format)
+		c.Check(err, IsNil)
+		c.Check(count, Equals, 5)
+		c.Check(queue.ReadyCount(), Equals, 3)
+
+		queue.PurgeReady()
+		queue.PurgeRejected()
+		count, err = Import(queue, &buffer, format)
+		c.Check(err, IsNil)
+		c.Check(count, Equals, 5)
+		c.Check(queue.PeekReady(3), DeepEquals, []string{"backup-d0\nline", "backup-d1\nline", "backup-d2\nline"})
+		c.Check(queue.PeekRejected(3), DeepEquals, []string{"backup-r0", "backup-r1\xff\x00"})
+	}
+
+	_, err := Import(queue, bytes.NewBufferString("r\x00\x00"), BackupLengthPrefixed)
+	c.Check(err, NotNil)
+	_, err = Export(NewTestQueue("backup-test"), &bytes.Buffer{}, BackupLines)
+	c.Check(err, NotNil)
+
+	connection.StopHeartbeat()
+}
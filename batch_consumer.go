@@ -1,5 +1,37 @@
 package rmq
 
+import "time"
+
 type BatchConsumer interface {
 	Consume(batch Deliveries)
 }
+
+// BatchConsumerFunc is an adapter to use ordinary functions as batch consumers
+type BatchConsumerFunc func(batch Deliveries)
+
+func (consumerFunc BatchConsumerFunc) Consume(batch Deliveries) {
+	consumerFunc(batch)
+}
+
+// BatchOptions tune how batch consumers trade latency for batch size, see
+// AddBatchConsumerWithOptions. A batch is consumed as soon as it's full, once
+// Timeout passed and it has at least MinSize deliveries, or once MaxWait
+// passed. Both durations start with the first delivery of the batch.
+type BatchOptions struct {
+	Size     int           // max number of deliveries per batch
+	MinSize  int           // number of deliveries to wait for after Timeout, zero means one
+	Timeout  time.Duration // how long to wait for a full batch, defaults to one second
+	MaxWait  time.Duration // how long to wait at most, zero means until MinSize is reached
+	MaxBytes int           // max total payload size, zero means no limit
+}
+
+// full returns true if the batch of size bytes must not grow anymore
+func (options BatchOptions) full(batch []Delivery, size int) bool {
+	return len(batch) >= options.Size || options.MaxBytes > 0 && size >= options.MaxBytes
+}
+
+// overflows returns true if a payload of payloadSize bytes doesn't fit into a
+// non-empty batch of size bytes
+func (options BatchOptions) overflows(batch []Delivery, size, payloadSize int) bool {
+	return options.MaxBytes > 0 && len(batch) > 0 && size+payloadSize > options.MaxBytes
+}
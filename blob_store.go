@@ -0,0 +1,97 @@
+package rmq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	blobKeyTemplate = "rmq::blob::{blob}" // key of a payload in a RedisBlobStore
+	phBlob          = "{blob}"
+)
+
+// BlobStore stores payloads which are too large to travel through the queue,
+// see SetBlobStore. Implementations for services like S3 only need these
+// three methods.
+type BlobStore interface {
+	Put(key string, payload []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// FileBlobStore stores payloads as files in a directory, which must be shared
+// by producers and consumers
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) *FileBlobStore {
+	return &FileBlobStore{dir: dir}
+}
+
+func (store *FileBlobStore) Put(key string, payload []byte) error {
+	// write to temp file first so Get never sees partial payloads
+	file, err := ioutil.TempFile(store.dir, "."+key)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(payload); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), store.path(key))
+}
+
+func (store *FileBlobStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(store.path(key))
+}
+
+func (store *FileBlobStore) Delete(key string) error {
+	if err := os.Remove(store.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *FileBlobStore) path(key string) string {
+	return filepath.Join(store.dir, key)
+}
+
+// RedisBlobStore stores payloads in a separate Redis, so large payloads don't
+// use memory of the queue Redis
+type RedisBlobStore struct {
+	redisClient *redis.Client
+	ttl         time.Duration // zero means payloads don't expire
+}
+
+// NewRedisBlobStore returns a store which keeps payloads for ttl or until the
+// delivery is acked
+func NewRedisBlobStore(redisClient *redis.Client, ttl time.Duration) *RedisBlobStore {
+	return &RedisBlobStore{redisClient: redisClient, ttl: ttl}
+}
+
+func (store *RedisBlobStore) Put(key string, payload []byte) error {
+	return store.redisClient.Set(blobKey(key), payload, store.ttl).Err()
+}
+
+func (store *RedisBlobStore) Get(key string) ([]byte, error) {
+	return store.redisClient.Get(blobKey(key)).Bytes()
+}
+
+func (store *RedisBlobStore) Delete(key string) error {
+	return store.redisClient.Del(blobKey(key)).Err()
+}
+
+func blobKey(key string) string {
+	return strings.Replace(blobKeyTemplate, phBlob, key, 1)
+}
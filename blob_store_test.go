@@ -0,0 +1,80 @@
+package rmq
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+	"github.com/go-redis/redis"
+)
+
+func TestBlobStoreSuite(t *testing.T) {
+	TestingSuiteT(&BlobStoreSuite{}, t)
+}
+
+type BlobStoreSuite struct {
+	dir string
+}
+
+func (suite *BlobStoreSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "rmq-blobs")
+	c.Assert(err, IsNil)
+	suite.dir = dir
+}
+
+func (suite *BlobStoreSuite) TearDownTest(c *C) {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *BlobStoreSuite) TestStores(c *C) {
+	redisClient := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	stores := []BlobStore{NewFileBlobStore(suite.dir), NewRedisBlobStore(redisClient, time.Minute)}
+
+	for _, store := range stores {
+		c.Check(store.Put("blob-1", []byte("blob-p1")), IsNil)
+		payload, err := store.Get("blob-1")
+		c.Check(err, IsNil)
+		c.Check(string(payload), Equals, "blob-p1")
+
+		c.Check(store.Delete("blob-1"), IsNil)
+		c.Check(store.Delete("blob-1"), IsNil) // already deleted
+		_, err = store.Get("blob-1")
+		c.Check(err, NotNil)
+	}
+}
+
+func (suite *BlobStoreSuite) TestQueue(c *C) {
+	connection := OpenConnection("blob-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("blob-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetBlobStore(NewFileBlobStore(suite.dir), 100)
+
+	large := strings.Repeat("blob-d1 ", 100)
+	c.Check(queue.Publish(large), Equals, true)
+	c.Check(queue.Publish("blob-d2"), Equals, true) // too small
+	values := queue.redisClient.LRange(queue.readyKey, 0, -1)
+	c.Assert(values, HasLen, 2)
+	c.Check(len(values[1]) < len(large), Equals, true)
+
+	missing := newEnvelope("")
+	missing.Blob = "missing"
+	queue.publishValue(missing.encode())
+
+	consumer := NewTestConsumer("blob-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("blob-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+	c.Check(consumer.LastDeliveries[0].Payload(), Equals, large)
+	c.Check(queue.RejectedCount(), Equals, 1) // missing blob
+
+	files, _ := ioutil.ReadDir(suite.dir)
+	c.Check(files, HasLen, 0) // deleted on ack
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
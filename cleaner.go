@@ -1,41 +1,124 @@
 package rmq
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type Cleaner struct {
 	connection *redisConnection
+	dryRun     bool
+	scheduler  scheduler
+}
+
+// CleanReport describes what a cleaner run did, or would have done in dry
+// run mode, see CleanWithReport
+type CleanReport struct {
+	DryRun        bool           `json:"dry_run"`
+	Connections   []string       `json:"connections"`    // dead connections which were cleaned
+	Returned      map[string]int `json:"returned"`       // unacked deliveries of dead connections returned to ready by queue
+	Expired       map[string]int `json:"expired"`        // unacked deliveries of live connections returned after their visibility timeout by queue
+	RemovedQueues []string       `json:"removed_queues"` // temporary queues of dead connections and idle queues which were removed
+	DeletedKeys   []string       `json:"deleted_keys"`   // keys of dead connections which were deleted
 }
 
 func NewCleaner(connection *redisConnection) *Cleaner {
 	return &Cleaner{connection: connection}
 }
 
+// SetDryRun makes the cleaner only report what it would do instead of doing
+// it, see CleanWithReport
+func (cleaner *Cleaner) SetDryRun(enabled bool) {
+	cleaner.dryRun = enabled
+}
+
 func (cleaner *Cleaner) Clean() error {
+	_, err := cleaner.CleanWithReport()
+	return err
+}
+
+// CleanWithReport is like Clean, but returns what it cleaned. In dry run
+// mode nothing is changed and the report shows what Clean would do.
+func (cleaner *Cleaner) CleanWithReport() (*CleanReport, error) {
+	report := &CleanReport{
+		DryRun:        cleaner.dryRun,
+		Connections:   []string{},
+		Returned:      map[string]int{},
+		Expired:       map[string]int{},
+		RemovedQueues: []string{},
+		DeletedKeys:   []string{},
+	}
+
 	connectionNames := cleaner.connection.GetConnections()
 	for _, connectionName := range connectionNames {
 		connection := cleaner.connection.hijackConnection(connectionName)
 		if connection.Check() {
+			cleaner.returnExpired(connection, report)
 			continue // skip active connections!
 		}
 
-		if err := cleaner.CleanConnection(connection); err != nil {
-			return err
+		if err := cleaner.cleanConnection(connection, report); err != nil {
+			return report, err
 		}
 	}
 
-	return nil
+	for _, name := range cleaner.idleQueues() {
+		if !cleaner.dryRun {
+			cleaner.connection.openQueue(name).expire()
+		}
+		report.RemovedQueues = append(report.RemovedQueues, name)
+	}
+	return report, nil
+}
+
+// ReturnExpired returns the unacked deliveries of the connection whose
+// visibility timeout expired to ready, see SetVisibilityTimeout
+func (cleaner *Cleaner) ReturnExpired(connection *redisConnection) int {
+	return cleaner.returnExpired(connection, &CleanReport{Expired: map[string]int{}})
+}
+
+func (cleaner *Cleaner) returnExpired(connection *redisConnection, report *CleanReport) int {
+	returned := 0
+	for _, queueName := range connection.GetConsumingQueues() {
+		queue := connection.openQueue(queueName)
+		var count int
+		if cleaner.dryRun {
+			count = queue.countExpiredUnacked()
+		} else {
+			count = queue.returnExpiredUnacked()
+		}
+		if count > 0 {
+			report.Expired[queueName] += count
+		}
+		returned += count
+	}
+	return returned
 }
 
 func (cleaner *Cleaner) CleanConnection(connection *redisConnection) error {
+	return cleaner.cleanConnection(connection, &CleanReport{Returned: map[string]int{}})
+}
+
+func (cleaner *Cleaner) cleanConnection(connection *redisConnection, report *CleanReport) error {
 	queueNames := connection.GetConsumingQueues()
 	for _, queueName := range queueNames {
-		queue, ok := connection.OpenQueue(queueName).(*redisQueue)
-		if !ok {
-			return fmt.Errorf("rmq cleaner failed to open queue %s", queueName)
+		queue := connection.openQueue(queueName)
+		if target := connection.resolveAlias(queueName); target != queueName {
+			queue.readyKey = connection.openQueue(target).readyKey // it was renamed
 		}
 
-		cleaner.CleanQueue(queue)
+		cleaner.cleanQueue(queue, report)
+	}
+
+	temporaryQueues := connection.redisClient.SMembers(connection.temporaryQueuesKey())
+	report.RemovedQueues = append(report.RemovedQueues, temporaryQueues...)
+	report.Connections = append(report.Connections, connection.Name)
+	report.DeletedKeys = append(report.DeletedKeys, connection.temporaryQueuesKey(), connection.queuesKey)
+	if cleaner.dryRun {
+		return nil
 	}
+	connection.closeTemporaryQueues()
 
 	if !connection.Close() {
 		return fmt.Errorf("rmq cleaner failed to close connection %s", connection)
@@ -44,14 +127,42 @@ func (cleaner *Cleaner) CleanConnection(connection *redisConnection) error {
 	if err := connection.CloseAllQueuesInConnection(); err != nil {
 		return fmt.Errorf("rmq cleaner failed to close all queues %s %s", connection, err)
 	}
-
-	// log.Printf("rmq cleaner cleaned connection %s", connection)
+	cleaner.connection.publishConnectionEvent(ConnectionEventCleaned, connection.Name)
 	return nil
 }
 
 func (cleaner *Cleaner) CleanQueue(queue *redisQueue) {
-	returned := queue.ReturnAllUnacked()
-	queue.CloseInConnection()
-	_ = returned
-	// log.Printf("rmq cleaner cleaned queue %s %d", queue, returned)
+	cleaner.cleanQueue(queue, &CleanReport{Returned: map[string]int{}})
+}
+
+func (cleaner *Cleaner) cleanQueue(queue *redisQueue, report *CleanReport) {
+	report.DeletedKeys = append(report.DeletedKeys, queue.unackedKey, queue.deadlinesKey, queue.consumersKey)
+	for _, consumer := range queue.GetConsumers() {
+		report.DeletedKeys = append(report.DeletedKeys, queue.consumerMetricsKey(consumer))
+	}
+
+	var returned int
+	if cleaner.dryRun {
+		returned = queue.UnackedCount()
+	} else {
+		returned = queue.ReturnAllUnacked()
+		queue.CloseInConnection()
+	}
+	if returned > 0 {
+		report.Returned[queue.name] += returned
+	}
+	queue.debugf("cleaner cleaned queue %s %d", queue, returned)
+}
+
+// countExpiredUnacked returns the number of unacked deliveries whose
+// visibility timeout expired, see returnExpiredUnacked
+func (queue *redisQueue) countExpiredUnacked() int {
+	expired := 0
+	now := time.Now()
+	for _, deadline := range queue.redisClient.HGetAll(queue.deadlinesKey) {
+		if nanos, err := strconv.ParseInt(deadline, 10, 64); err != nil || !time.Unix(0, nanos).After(now) {
+			expired++
+		}
+	}
+	return expired
 }
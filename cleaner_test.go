@@ -1,6 +1,7 @@
 package rmq
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -138,3 +139,87 @@ func (suite *CleanerSuite) TestCleaner(c *C) {
 	c.Check(cleaner.Clean(), IsNil)
 	cleanerConn.StopHeartbeat()
 }
+
+func (suite *CleanerSuite) TestReturnExpired(c *C) {
+	conn := OpenConnection("cleaner-expired-conn", "tcp", "localhost:6379", 1)
+	queue := conn.OpenQueue("cleaner-expired-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetVisibilityTimeout(100 * time.Millisecond)
+	queue.Publish("expired-d1")
+	queue.Publish("expired-d2")
+
+	deliveries, err := queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	c.Check(queue.UnackedCount(), Equals, 2)
+
+	cleaner := NewCleaner(conn)
+	c.Check(cleaner.Clean(), IsNil)
+	c.Check(queue.UnackedCount(), Equals, 2) // not expired yet
+
+	time.Sleep(60 * time.Millisecond)
+	c.Check(deliveries[1].Touch(), Equals, true)
+	time.Sleep(60 * time.Millisecond)
+
+	c.Check(cleaner.Clean(), IsNil)
+	c.Check(queue.UnackedCount(), Equals, 1)
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(queue.PeekReady(1), DeepEquals, []string{"expired-d1"})
+
+	c.Check(deliveries[0].Touch(), Equals, false)
+	c.Check(queue.redisClient.HGetAll(queue.deadlinesKey), HasLen, 1) // not recreated by Touch
+	c.Check(deliveries[0].Ack(), Equals, false)
+	c.Check(deliveries[1].Ack(), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.redisClient.HGetAll(queue.deadlinesKey), HasLen, 0)
+
+	conn.StopHeartbeat()
+}
+
+func (suite *CleanerSuite) TestCleanDryRun(c *C) {
+	conn := OpenConnection("cleaner-dry-conn", "tcp", "localhost:6379", 1)
+	queue := conn.OpenQueue("cleaner-dry-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("dry-d1")
+	queue.Publish("dry-d2")
+	queue.Publish("dry-d3")
+
+	deliveries, err := queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	conn.StopHeartbeat() // connection is dead now
+
+	cleanerConn := OpenConnection("cleaner-dry-cleaner", "tcp", "localhost:6379", 1)
+	cleaner := NewCleaner(cleanerConn)
+	cleaner.SetDryRun(true)
+	report, err := cleaner.CleanWithReport()
+	c.Assert(err, IsNil)
+	c.Check(report.DryRun, Equals, true)
+	c.Check(report.Returned["cleaner-dry-q"], Equals, 2)
+	c.Check(containsString(report.Connections, conn.Name), Equals, true)
+	c.Check(containsString(report.DeletedKeys, queue.unackedKey), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 2) // nothing changed
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(containsString(cleanerConn.GetConnections(), conn.Name), Equals, true)
+
+	cleaner.SetDryRun(false)
+	report, err = cleaner.CleanWithReport()
+	c.Assert(err, IsNil)
+	c.Check(report.DryRun, Equals, false)
+	c.Check(report.Returned["cleaner-dry-q"], Equals, 2)
+	c.Check(containsString(report.Connections, conn.Name), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 3)
+	c.Check(containsString(cleanerConn.GetConnections(), conn.Name), Equals, false)
+
+	cleanerConn.StopHeartbeat()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
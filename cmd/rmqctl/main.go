@@ -0,0 +1,378 @@
+// rmqctl is a command line tool to inspect and operate rmq queues without
+// having to know about the Redis key layout used by rmq.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/adjust/rmq"
+)
+
+const usage = `usage: rmqctl [flags] <command> [arguments]
+
+commands:
+    queues                              list open queues with their counts
+    connections                         list all connections
+    stats                               print full stats of all open queues
+    peek <queue> [ready|rejected] [n]   print the next n payloads with their envelope (default ready 10)
+    publish <queue> <payload>...        publish payloads to a queue
+    purge <queue> [ready|rejected]      purge ready or rejected deliveries (default rejected)
+    return <queue> [n]                  return n (default all) rejected deliveries to ready
+    clean [-dry-run]                    return unacked deliveries of dead connections
+    tail [-pretty] <queue>              print payloads published to a queue until interrupted
+    export [-binary] <queue>            write ready and rejected deliveries to stdout
+    import [-binary] <queue>            read deliveries written by export from stdin
+
+flags:
+`
+
+func main() {
+	network := flag.String("network", "tcp", "network of the Redis server")
+	address := flag.String("address", "localhost:6379", "address of the Redis server")
+	db := flag.Int("db", 0, "Redis database")
+	password := flag.String("password", "", "Redis password")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	connection := rmq.OpenConnectionWithAuth("rmqctl", *network, *address, *db, *password)
+	ctl := &ctl{
+		connection: connection,
+		cleaner:    rmq.NewCleaner(connection),
+	}
+	err := ctl.run(args[0], args[1:])
+	connection.StopHeartbeat()
+	connection.Close()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rmqctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// redisConnection is the subset of the connection returned by
+// rmq.OpenConnection that rmqctl uses
+type redisConnection interface {
+	rmq.Connection
+	GetConnections() []string
+	Tail(name string) (payloads <-chan string, stop func())
+}
+
+type ctl struct {
+	connection redisConnection
+	cleaner    *rmq.Cleaner
+}
+
+func (ctl *ctl) run(command string, args []string) error {
+	switch command {
+	case "queues":
+		return ctl.listQueues()
+	case "connections":
+		return ctl.listConnections()
+	case "stats":
+		fmt.Print(ctl.connection.CollectStats(ctl.connection.GetOpenQueues()))
+		return nil
+	case "peek":
+		return ctl.peek(args)
+	case "publish":
+		return ctl.publish(args)
+	case "purge":
+		return ctl.purge(args)
+	case "return":
+		return ctl.returnRejected(args)
+	case "clean":
+		return ctl.clean(args)
+	case "tail":
+		return ctl.tail(args)
+	case "export", "import":
+		return ctl.backup(command, args)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (ctl *ctl) listQueues() error {
+	queueNames := ctl.connection.GetOpenQueues()
+	sort.Strings(queueNames)
+	stats := ctl.connection.CollectStats(queueNames)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "QUEUE\tREADY\tREJECTED\tUNACKED\tCONSUMERS")
+	for _, queueName := range queueNames {
+		stat := stats.QueueStats[queueName]
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\n",
+			queueName, stat.ReadyCount, stat.RejectedCount, stat.UnackedCount(), stat.ConsumerCount(),
+		)
+	}
+	return writer.Flush()
+}
+
+func (ctl *ctl) listConnections() error {
+	connectionNames := ctl.connection.GetConnections()
+	sort.Strings(connectionNames)
+	for _, connectionName := range connectionNames {
+		fmt.Println(connectionName)
+	}
+	return nil
+}
+
+func (ctl *ctl) peek(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("peek needs a queue name")
+	}
+
+	list := "ready"
+	if len(args) > 1 {
+		list = args[1]
+	}
+
+	count := 10
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid count %q", args[2])
+		}
+		count = n
+	}
+
+	queue, err := ctl.openQueue(args[0])
+	if err != nil {
+		return err
+	}
+	var values []string
+	switch list {
+	case "ready":
+		values = queue.PeekReady(count)
+	case "rejected":
+		values = queue.PeekRejected(count)
+	default:
+		return fmt.Errorf("unknown list %q, use ready or rejected", list)
+	}
+
+	// enveloped payloads are printed after the JSON header of their envelope
+	for _, value := range values {
+		if header, payload, ok := rmq.SplitEnvelope(value); ok {
+			fmt.Println(header, payload)
+			continue
+		}
+		fmt.Println(value)
+	}
+	return nil
+}
+
+func (ctl *ctl) publish(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("publish needs a queue name and at least one payload")
+	}
+
+	queue := ctl.connection.OpenQueue(args[0])
+	for _, payload := range args[1:] {
+		if !queue.Publish(payload) {
+			return fmt.Errorf("failed to publish to %s", args[0])
+		}
+	}
+	fmt.Printf("published %d deliveries to %s\n", len(args)-1, args[0])
+	return nil
+}
+
+func (ctl *ctl) purge(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("purge needs a queue name")
+	}
+
+	list := "rejected"
+	if len(args) > 1 {
+		list = args[1]
+	}
+
+	queue, err := ctl.openQueue(args[0])
+	if err != nil {
+		return err
+	}
+	var purged int
+	switch list {
+	case "ready":
+		purged = queue.PurgeReady()
+	case "rejected":
+		purged = queue.PurgeRejected()
+	default:
+		return fmt.Errorf("unknown list %q, use ready or rejected", list)
+	}
+
+	fmt.Printf("purged %d %s deliveries from %s\n", purged, list, args[0])
+	return nil
+}
+
+func (ctl *ctl) returnRejected(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("return needs a queue name")
+	}
+
+	queue, err := ctl.openQueue(args[0])
+	if err != nil {
+		return err
+	}
+	var returned int
+	if len(args) > 1 {
+		count, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid count %q", args[1])
+		}
+		returned = queue.ReturnRejected(count)
+	} else {
+		returned = queue.ReturnAllRejected()
+	}
+
+	fmt.Printf("returned %d rejected deliveries of %s\n", returned, args[0])
+	return nil
+}
+
+// openQueue opens the queue if it's open already, so commands with typos
+// don't create queues
+func (ctl *ctl) openQueue(name string) (rmq.Queue, error) {
+	for _, openName := range ctl.connection.GetOpenQueues() {
+		if openName == name {
+			return ctl.connection.OpenQueue(name), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown queue %q", name)
+}
+
+func (ctl *ctl) clean(args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only print what would be cleaned")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl.cleaner.SetDryRun(*dryRun)
+	report, err := ctl.cleaner.CleanWithReport()
+	if err != nil {
+		return err
+	}
+
+	verb := "cleaned"
+	if report.DryRun {
+		verb = "would clean"
+	}
+	fmt.Printf("%s %d dead connections\n", verb, len(report.Connections))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "QUEUE\tRETURNED\tEXPIRED")
+	for _, queueName := range sortedKeys(report.Returned, report.Expired) {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", queueName, report.Returned[queueName], report.Expired[queueName])
+	}
+	writer.Flush()
+	for _, queueName := range report.RemovedQueues {
+		fmt.Printf("removed queue %s\n", queueName)
+	}
+	for _, key := range report.DeletedKeys {
+		fmt.Printf("deleted key %s\n", key)
+	}
+	return nil
+}
+
+// sortedKeys returns the sorted union of the keys of counts
+func sortedKeys(counts ...map[string]int) []string {
+	set := map[string]bool{}
+	for _, count := range counts {
+		for key := range count {
+			set[key] = true
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (ctl *ctl) tail(args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	pretty := flags.Bool("pretty", false, "pretty print JSON payloads")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("tail needs a queue name")
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	payloads, stop := ctl.connection.Tail(flags.Arg(0))
+	defer stop()
+
+	for {
+		select {
+		case payload, ok := <-payloads:
+			if !ok {
+				return nil
+			}
+			fmt.Println(format(payload, *pretty))
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// format indents JSON payloads if pretty is set, other payloads are returned unchanged
+func format(payload string, pretty bool) string {
+	if !pretty {
+		return payload
+	}
+
+	var buffer bytes.Buffer
+	if err := json.Indent(&buffer, []byte(payload), "", "  "); err != nil {
+		return payload
+	}
+	return buffer.String()
+}
+
+func (ctl *ctl) backup(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	binary := flags.Bool("binary", false, "use the length prefixed format which is more compact for binary payloads")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("%s needs a queue name", command)
+	}
+
+	format := rmq.BackupLines
+	if *binary {
+		format = rmq.BackupLengthPrefixed
+	}
+
+	if command == "export" {
+		queue, err := ctl.openQueue(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		count, err := rmq.Export(queue, os.Stdout, format)
+		fmt.Fprintf(os.Stderr, "exported %d deliveries of %s\n", count, flags.Arg(0))
+		return err
+	}
+
+	queue := ctl.connection.OpenQueue(flags.Arg(0)) // importing may create the queue
+	count, err := rmq.Import(queue, os.Stdin, format)
+	fmt.Fprintf(os.Stderr, "imported %d deliveries into %s\n", count, flags.Arg(0))
+	return err
+}
@@ -0,0 +1,62 @@
+package rmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec marshals objects to payloads, see PublishObject. Its content type is
+// stored in the envelope, so Delivery.Unmarshal can pick the codec
+// the delivery was published with, if the codec is registered.
+type Codec interface {
+	ContentType() string
+	Marshal(object interface{}) ([]byte, error)
+	Unmarshal(payload []byte, object interface{}) error
+}
+
+// JSONCodec marshals objects with encoding/json. It's registered by default
+// and used for deliveries without content type.
+var JSONCodec Codec = jsonCodec{}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{JSONCodec.ContentType(): JSONCodec}
+)
+
+// RegisterCodec makes Delivery.Unmarshal decode deliveries with the content
+// type of codec, like msgpack or protobuf implementations
+func RegisterCodec(codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+// lookupCodec returns the codec for contentType, JSONCodec if it's empty
+func lookupCodec(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("rmq codec for content type %s not registered", contentType)
+	}
+	return codec, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(object interface{}) ([]byte, error) {
+	return json.Marshal(object)
+}
+
+func (jsonCodec) Unmarshal(payload []byte, object interface{}) error {
+	return json.Unmarshal(payload, object)
+}
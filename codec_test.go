@@ -0,0 +1,82 @@
+package rmq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestCodecSuite(t *testing.T) {
+	TestingSuiteT(&CodecSuite{}, t)
+}
+
+type CodecSuite struct{}
+
+// textCodec marshals strings as plain text
+type textCodec struct{}
+
+func (textCodec) ContentType() string {
+	return "text/plain"
+}
+
+func (textCodec) Marshal(object interface{}) ([]byte, error) {
+	text, ok := object.(string)
+	if !ok {
+		return nil, fmt.Errorf("not a string")
+	}
+	return []byte(text), nil
+}
+
+func (textCodec) Unmarshal(payload []byte, object interface{}) error {
+	*object.(*string) = string(payload)
+	return nil
+}
+
+type codecTask struct {
+	Name string `json:"name"`
+}
+
+func (suite *CodecSuite) TestQueue(c *C) {
+	RegisterCodec(textCodec{})
+
+	connection := OpenConnection("codec-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("codec-q").(*redisQueue)
+	queue.PurgeReady()
+
+	c.Check(queue.PublishObject(codecTask{Name: "codec-d1"}), Equals, true)
+	queue.SetCodec(textCodec{})
+	c.Check(queue.PublishObject("codec-d2"), Equals, true)
+	c.Check(queue.PublishObject(23), Equals, false) // can't marshal
+	c.Check(queue.Publish(`{"name":"codec-d3"}`), Equals, true)
+	c.Check(queue.PublishObjectWith(JSONCodec, codecTask{Name: "codec-d4"}), Equals, true)
+
+	consumer := NewTestConsumer("codec-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("codec-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 4)
+
+	task := codecTask{}
+	c.Check(consumer.LastDeliveries[0].ContentType(), Equals, "application/json")
+	c.Check(consumer.LastDeliveries[0].Unmarshal(&task), IsNil)
+	c.Check(task.Name, Equals, "codec-d1")
+
+	text := ""
+	c.Check(consumer.LastDeliveries[1].ContentType(), Equals, "text/plain")
+	c.Check(consumer.LastDeliveries[1].Unmarshal(&text), IsNil)
+	c.Check(text, Equals, "codec-d2")
+
+	c.Check(consumer.LastDeliveries[2].ContentType(), Equals, "") // raw payload
+	c.Check(consumer.LastDeliveries[2].Unmarshal(&task), IsNil)
+	c.Check(task.Name, Equals, "codec-d3")
+
+	c.Check(consumer.LastDeliveries[3].ContentType(), Equals, "application/json")
+
+	_, err := lookupCodec("application/unknown")
+	c.Check(err, NotNil)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
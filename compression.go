@@ -0,0 +1,67 @@
+package rmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+// Compression compresses payloads. Its name is stored in the envelope of
+// compressed deliveries, so consumers can decompress them automatically if
+// the compression is registered.
+type Compression interface {
+	Name() string
+	Compress(payload []byte) ([]byte, error)
+	Decompress(compressed []byte) ([]byte, error)
+}
+
+// GzipCompression compresses payloads with gzip, it's registered by default
+var GzipCompression Compression = gzipCompression{}
+
+var (
+	compressionsMutex sync.RWMutex
+	compressions      = map[string]Compression{GzipCompression.Name(): GzipCompression}
+)
+
+// RegisterCompression makes consumers decompress deliveries compressed with
+// compression, like snappy or zstd implementations
+func RegisterCompression(compression Compression) {
+	compressionsMutex.Lock()
+	defer compressionsMutex.Unlock()
+	compressions[compression.Name()] = compression
+}
+
+func lookupCompression(name string) (Compression, bool) {
+	compressionsMutex.RLock()
+	defer compressionsMutex.RUnlock()
+	compression, ok := compressions[name]
+	return compression, ok
+}
+
+type gzipCompression struct{}
+
+func (gzipCompression) Name() string {
+	return "gzip"
+}
+
+func (gzipCompression) Compress(payload []byte) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gzipCompression) Decompress(compressed []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,62 @@
+package rmq
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestCompressionSuite(t *testing.T) {
+	TestingSuiteT(&CompressionSuite{}, t)
+}
+
+type CompressionSuite struct{}
+
+func (suite *CompressionSuite) TestGzip(c *C) {
+	payload := []byte(strings.Repeat("compress me ", 100))
+	compressed, err := GzipCompression.Compress(payload)
+	c.Assert(err, IsNil)
+	c.Check(len(compressed) < len(payload), Equals, true)
+
+	decompressed, err := GzipCompression.Decompress(compressed)
+	c.Assert(err, IsNil)
+	c.Check(decompressed, DeepEquals, payload)
+
+	_, err = GzipCompression.Decompress(payload)
+	c.Check(err, NotNil)
+}
+
+func (suite *CompressionSuite) TestQueue(c *C) {
+	connection := OpenConnection("compression-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("compression-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetCompression(GzipCompression, 100)
+
+	large := strings.Repeat("compression-d2 ", 100)
+	c.Check(queue.Publish("compression-d1"), Equals, true) // too small
+	c.Check(queue.Publish(large), Equals, true)
+
+	unknown := newEnvelope("compression-d3")
+	unknown.Encoding = "unknown"
+	queue.publishValue(unknown.encode())
+
+	values := queue.redisClient.LRange(queue.readyKey, 0, -1)
+	c.Assert(values, HasLen, 3)
+	c.Check(values[2], Equals, "compression-d1")
+	c.Check(len(values[1]) < len(large), Equals, true)
+
+	consumer := NewTestConsumer("compression-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("compression-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+	c.Check(consumer.LastDeliveries[0].Payload(), Equals, "compression-d1")
+	c.Check(consumer.LastDeliveries[1].Payload(), Equals, large)
+	c.Check(queue.RejectedCount(), Equals, 1) // can't decompress
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,84 @@
+package rmq
+
+import (
+	"strconv"
+	"time"
+)
+
+// SetGlobalConcurrency limits how many deliveries of this queue consumers
+// on all connections process at the same time. Consumers take a permit
+// after receiving a delivery and wait for a free one before calling the
+// consumer. A batch consumer takes one permit per delivery, but at most
+// limit. Permits of dead connections are freed by the cleaner. Every
+// connection consuming the queue must set the same limit. Zero means no
+// limit. Call it before adding consumers.
+func (queue *redisQueue) SetGlobalConcurrency(limit int) {
+	queue.concurrencyLimit = limit
+}
+
+// acquirePermits waits until count permits are free and takes them. Returns
+// false without taking any if stopChan was closed first.
+func (queue *redisQueue) acquirePermits(count int, stopChan <-chan struct{}) bool {
+	if count > queue.concurrencyLimit {
+		count = queue.concurrencyLimit
+	}
+
+	for {
+		// check and take in one step, so concurrent acquires can't both see
+		// room left or block each other with permits they give back
+		if acquired, _ := queue.redisClient.HIncrByLimit(queue.concurrencyKey, queue.connectionName, count, queue.concurrencyLimit); acquired {
+			return true
+		}
+
+		timer := time.NewTimer(queue.permitPollDuration())
+		select {
+		case <-stopChan:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// releasePermits frees permits taken by acquirePermits
+func (queue *redisQueue) releasePermits(count int) {
+	if count > queue.concurrencyLimit {
+		count = queue.concurrencyLimit
+	}
+	queue.redisClient.HIncrBy(queue.concurrencyKey, queue.connectionName, -count)
+}
+
+// permitsTaken returns the number of permits taken by all connections
+func (queue *redisQueue) permitsTaken() int {
+	taken := 0
+	for _, value := range queue.redisClient.HGetAll(queue.concurrencyKey) {
+		count, _ := strconv.Atoi(value)
+		taken += count
+	}
+	return taken
+}
+
+func (queue *redisQueue) permitPollDuration() time.Duration {
+	if queue.pollDuration <= 0 {
+		return defaultGetPoll
+	}
+	return queue.pollDuration
+}
+
+// consumeWithPermit calls consume once a permit for count deliveries was
+// taken. If stopChan is closed while waiting, the deliveries are returned to
+// ready instead and false is returned.
+func (queue *redisQueue) consumeWithPermit(deliveries []Delivery, stopChan <-chan struct{}, consume func()) bool {
+	if queue.concurrencyLimit <= 0 {
+		consume()
+		return true
+	}
+
+	if !queue.acquirePermits(len(deliveries), stopChan) {
+		queue.returnToReady(deliveries...)
+		return false
+	}
+	defer queue.releasePermits(len(deliveries))
+	consume()
+	return true
+}
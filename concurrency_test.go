@@ -0,0 +1,129 @@
+package rmq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestConcurrencySuite(t *testing.T) {
+	TestingSuiteT(&ConcurrencySuite{}, t)
+}
+
+type ConcurrencySuite struct{}
+
+// countingConsumer records the max number of concurrent Consume calls
+type countingConsumer struct {
+	mutex    sync.Mutex
+	running  int
+	max      int
+	consumed int
+}
+
+func (consumer *countingConsumer) Consume(delivery Delivery) {
+	consumer.mutex.Lock()
+	consumer.running++
+	if consumer.running > consumer.max {
+		consumer.max = consumer.running
+	}
+	consumer.mutex.Unlock()
+
+	time.Sleep(2 * time.Millisecond)
+	delivery.Ack()
+
+	consumer.mutex.Lock()
+	consumer.running--
+	consumer.consumed++
+	consumer.mutex.Unlock()
+}
+
+func (consumer *countingConsumer) stats() (max, consumed int) {
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	return consumer.max, consumer.consumed
+}
+
+func (suite *ConcurrencySuite) TestGlobalConcurrency(c *C) {
+	consumer := &countingConsumer{}
+	queues := []*redisQueue{}
+	for _, name := range []string{"concurrency-conn1", "concurrency-conn2"} {
+		connection := OpenConnection(name, "tcp", "localhost:6379", 1)
+		queue := connection.OpenQueue("concurrency-q").(*redisQueue)
+		queue.SetGlobalConcurrency(2)
+		queue.StartConsuming(10, time.Millisecond)
+		for i := 0; i < 3; i++ {
+			queue.AddConsumer("concurrency-cons", consumer)
+		}
+		queues = append(queues, queue)
+		defer connection.StopHeartbeat()
+	}
+	queues[0].PurgeReady()
+	queues[0].redisClient.Del(queues[0].concurrencyKey)
+
+	for i := 0; i < 20; i++ {
+		queues[0].Publish("concurrency-d")
+	}
+	for i := 0; i < 200; i++ {
+		if _, consumed := consumer.stats(); consumed == 20 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	max, consumed := consumer.stats()
+	c.Check(consumed, Equals, 20)
+	c.Check(max <= 2, Equals, true)
+	c.Check(queues[0].permitsTaken(), Equals, 0)
+
+	for _, queue := range queues {
+		queue.StopConsuming()
+	}
+}
+
+func (suite *ConcurrencySuite) TestAcquireAtLimit(c *C) {
+	connection := OpenConnection("concurrency-limit-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("concurrency-limit-q").(*redisQueue)
+	queue.redisClient.Del(queue.concurrencyKey)
+	queue.redisClient.HIncrBy(queue.concurrencyKey, "other-conn", 1)
+	queue.SetGlobalConcurrency(2)
+
+	stopChan := make(chan struct{})
+	close(stopChan)
+	c.Check(queue.acquirePermits(2, stopChan), Equals, false)
+	c.Check(queue.permitsTaken(), Equals, 1) // didn't take any on the way
+	c.Check(queue.acquirePermits(1, stopChan), Equals, true)
+	c.Check(queue.permitsTaken(), Equals, 2)
+
+	queue.redisClient.Del(queue.concurrencyKey)
+	connection.StopHeartbeat()
+}
+
+func (suite *ConcurrencySuite) TestStopWhileWaiting(c *C) {
+	connection := OpenConnection("concurrency-wait-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("concurrency-wait-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.redisClient.Del(queue.concurrencyKey)
+	queue.redisClient.HIncrBy(queue.concurrencyKey, "other-conn", 1) // holds the only permit
+
+	queue.SetGlobalConcurrency(1)
+	queue.StartConsuming(10, time.Millisecond)
+	consumer := NewTestConsumer("concurrency-wait-cons")
+	name, _ := queue.AddConsumer("concurrency-wait-cons", consumer)
+	queue.Publish("concurrency-wait-d")
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 0)
+	c.Check(queue.UnackedCount(), Equals, 1)
+
+	queue.StopConsuming() // so it isn't fetched again
+	time.Sleep(10 * time.Millisecond)
+	c.Check(queue.RemoveConsumer(name), Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(queue.permitsTaken(), Equals, 1)
+
+	queue.redisClient.Del(queue.concurrencyKey)
+	connection.StopHeartbeat()
+}
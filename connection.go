@@ -1,37 +1,85 @@
 package rmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adjust/uniuri"
 	"github.com/go-redis/redis"
 )
 
-const heartbeatDuration = time.Minute
+const (
+	defaultHeartbeatInterval = time.Second
+	defaultHeartbeatTTL      = time.Minute
+)
+
+// ErrConnectionNameInUse is returned when opening a connection with the name of
+// another live connection
+var ErrConnectionNameInUse = errors.New("rmq connection name in use")
 
 // Connection is an interface that can be used to test publishing
 type Connection interface {
 	OpenQueue(name string) Queue
+	OpenTemporaryQueue() Queue
 	CollectStats(queueList []string) Stats
 	GetOpenQueues() []string
+	GetConsumingQueues() []string
+	GetConnections() []string
+	QueueInfos() []QueueInfo
+	ConnectionInfos() []ConnectionInfo
+	Health(ctx context.Context) HealthReport
+	Shutdown(ctx context.Context) error
+	Queues() []Queue
 }
 
 // Connection is the entry point. Use a connection to access queues, consumers and deliveries
 // Each connection has a single heartbeat shared among all consumers
 type redisConnection struct {
-	Name             string
-	heartbeatKey     string // key to keep alive
-	queuesKey        string // key to list of queues consumed by this connection
-	redisClient      RedisClient
-	heartbeatStopped bool
+	Name              string
+	heartbeatKey      string // key to keep alive
+	queuesKey         string // key to list of queues consumed by this connection
+	redisClient       RedisClient
+	heartbeatStopped  int32         // atomic, 1 after StopHeartbeat
+	heartbeatStop     chan struct{} // closed by StopHeartbeat, nil without heartbeat goroutine
+	heartbeatReset    chan struct{} // signals the heartbeat goroutine that the interval changed
+	heartbeatDone     chan struct{} // closed when the heartbeat goroutine returned
+	heartbeatAt       int64         // atomic, unix nanoseconds of the last successful heartbeat
+	heartbeatMutex    sync.Mutex
+	heartbeatInterval time.Duration // time between heartbeats
+	heartbeatTTL      time.Duration // expiration of the heartbeat key
+	heartbeatJitter   time.Duration // max random deviation from the interval
+	dead              int32         // atomic, 1 once the heartbeat expired while it was running
+	deadHandler       func()        // called once the connection noticed it was considered dead, nil if unset
+
+	queuesMutex sync.Mutex
+	queues      map[string]*redisQueue // opened by OpenQueue in this process by name
+
+	consumingMutex  sync.Mutex
+	consumingQueues []*redisQueue // queues which started consuming in this process
+	bufferedQueues  []*redisQueue // queues which got a publish buffer in this process
+
+	auditMutex sync.RWMutex
+	auditSink  AuditSink // nil if administrative operations aren't audited
+	auditActor string
+
+	commandHook commandHook
+
+	namerMutex    sync.RWMutex
+	consumerNamer func(tag string) string // nil for tag and a random suffix
 }
 
 // OpenConnectionWithRedisClient opens and returns a new connection
 func OpenConnectionWithRedisClient(tag string, redisClient *redis.Client) *redisConnection {
-	return openConnectionWithRedisClient(tag, RedisWrapper{redisClient})
+	return openConnectionWithRedisClient(tag, newRedisWrapper(redisClient))
 }
 
 // OpenConnectionWithTestRedisClient opens and returns a new connection which
@@ -40,29 +88,93 @@ func OpenConnectionWithTestRedisClient(tag string) *redisConnection {
 	return openConnectionWithRedisClient(tag, NewTestRedisClient())
 }
 
+// OpenNamedConnection opens a connection with exactly the given name instead
+// of a name generated from a tag. Use it for stable process identities. It
+// returns ErrConnectionNameInUse if a connection with that name is alive.
+// If reclaimUnacked is set, unacked deliveries left by a previous process
+// with that name are returned to ready.
+func OpenNamedConnection(name string, redisClient *redis.Client, reclaimUnacked bool) (*redisConnection, error) {
+	connection, err := openNamedConnection(name, newRedisWrapper(redisClient))
+	if err != nil {
+		return nil, err
+	}
+	if reclaimUnacked {
+		connection.reclaimUnacked()
+	}
+	return connection, nil
+}
+
 func openConnectionWithRedisClient(tag string, redisClient RedisClient) *redisConnection {
+	if tag == "" {
+		tag = defaultConnectionTag()
+	}
 	name := fmt.Sprintf("%s-%s", tag, uniuri.NewLen(6))
 
+	connection, err := openNamedConnection(name, redisClient)
+	if err != nil {
+		log.Panicf("rmq connection failed to open %s: %s", name, err)
+	}
+	return connection
+}
+
+func openNamedConnection(name string, redisClient RedisClient) (*redisConnection, error) {
 	connection := &redisConnection{
 		Name:         name,
 		heartbeatKey: strings.Replace(connectionHeartbeatTemplate, phConnection, name, 1),
 		queuesKey:    strings.Replace(connectionQueuesTemplate, phConnection, name, 1),
 		redisClient:  redisClient,
+
+		heartbeatInterval: defaultHeartbeatInterval,
+		heartbeatTTL:      defaultHeartbeatTTL,
 	}
 
-	if !connection.updateHeartbeat() { // checks the connection
-		log.Panicf("rmq connection failed to update heartbeat %s", connection)
+	// two live connections with the same name would share their unacked lists,
+	// so the heartbeat is only set if no other process holds it
+	claimed, ok := connection.claimHeartbeat()
+	if !ok { // checks the connection
+		return nil, fmt.Errorf("rmq connection failed to update heartbeat %s: %s", connection, redisClient.LastError())
+	}
+	if !claimed {
+		return nil, ErrConnectionNameInUse
 	}
 
 	// add to connection set after setting heartbeat to avoid race with cleaner
 	redisClient.SAdd(connectionsKey, name)
 
+	connection.heartbeatStop = make(chan struct{})
+	connection.heartbeatReset = make(chan struct{}, 1)
+	connection.heartbeatDone = make(chan struct{})
 	go connection.heartbeat()
-	// log.Printf("rmq connection connected to %s %s:%s %d", name, network, address, db)
-	return connection
+	connection.publishConnectionEvent(ConnectionEventOpened, name)
+	return connection, nil
 }
 
-// OpenConnection opens and returns a new connection
+// reclaimUnacked returns the unacked deliveries of all queues consumed by a
+// previous connection with the same name to ready, like the cleaner does for
+// dead connections. Returns the number of returned deliveries.
+func (connection *redisConnection) reclaimUnacked() int {
+	returned := 0
+	for _, queueName := range connection.GetConsumingQueues() {
+		queue := connection.openQueue(queueName)
+		returned += queue.ReturnAllUnacked()
+		queue.CloseInConnection()
+	}
+	connection.CloseAllQueuesInConnection()
+	return returned
+}
+
+// defaultConnectionTag is used for connections opened with an empty tag, so
+// connections can be traced back to their process
+func defaultConnectionTag() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// OpenConnection opens and returns a new connection. Its name consists of
+// tag and a random token, an empty tag is replaced by hostname and PID.
 func OpenConnection(tag, network, address string, db int) *redisConnection {
 	redisClient := redis.NewClient(&redis.Options{
 		Network: network,
@@ -83,13 +195,44 @@ func OpenConnectionWithAuth(tag, network, address string, db int, password strin
 	return OpenConnectionWithRedisClient(tag, redisClient)
 }
 
-// OpenQueue opens and returns the queue with a given name
+// OpenQueue opens the queue with the given name. Opening the same name again
+// on this connection returns the same queue, so its settings, buffers and
+// consumers are shared and it can't start consuming twice. Aliases open the
+// queue they point to, see AddQueueAlias.
 func (connection *redisConnection) OpenQueue(name string) Queue {
+	name = connection.resolveAlias(name)
 	connection.redisClient.SAdd(queuesKey, name)
+
+	connection.queuesMutex.Lock()
+	defer connection.queuesMutex.Unlock()
+
+	if queue, ok := connection.queues[name]; ok {
+		return queue
+	}
+
 	queue := newQueue(name, connection.Name, connection.queuesKey, connection.redisClient)
+	queue.connection = connection
+	if connection.queues == nil {
+		connection.queues = map[string]*redisQueue{}
+	}
+	connection.queues[name] = queue
 	return queue
 }
 
+// Queues returns the queues opened by OpenQueue on this connection in this
+// process, sorted by name
+func (connection *redisConnection) Queues() []Queue {
+	connection.queuesMutex.Lock()
+	defer connection.queuesMutex.Unlock()
+
+	queues := make([]Queue, 0, len(connection.queues))
+	for _, queue := range connection.queues {
+		queues = append(queues, queue)
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].(*redisQueue).name < queues[j].(*redisQueue).name })
+	return queues
+}
+
 func (connection *redisConnection) CollectStats(queueList []string) Stats {
 	return CollectStats(queueList, connection)
 }
@@ -113,8 +256,14 @@ func (connection *redisConnection) Check() bool {
 // StopHeartbeat stops the heartbeat of the connection
 // it does not remove it from the list of connections so it can later be found by the cleaner
 func (connection *redisConnection) StopHeartbeat() bool {
-	connection.heartbeatStopped = true
+	stopped := atomic.CompareAndSwapInt32(&connection.heartbeatStopped, 0, 1) && connection.heartbeatStop != nil
+	if stopped {
+		close(connection.heartbeatStop)
+	}
 	_, ok := connection.redisClient.Del(connection.heartbeatKey)
+	if stopped && !connection.Dead() {
+		connection.publishConnectionEvent(ConnectionEventStopped, connection.Name)
+	}
 	return ok
 }
 
@@ -137,7 +286,6 @@ func (connection *redisConnection) CloseAllQueues() int {
 // CloseAllQueuesInConnection closes all queues in the associated connection by removing all related keys
 func (connection *redisConnection) CloseAllQueuesInConnection() error {
 	connection.redisClient.Del(connection.queuesKey)
-	// debug(fmt.Sprintf("connection closed all queues %s %d", connection, connection.queuesKey)) // COMMENTOUT
 	return nil
 }
 
@@ -146,25 +294,186 @@ func (connection *redisConnection) GetConsumingQueues() []string {
 	return connection.redisClient.SMembers(connection.queuesKey)
 }
 
+// SetHeartbeat changes how often the heartbeat is written and when it
+// expires, one second and one minute by default. The cleaner considers a
+// connection dead once its heartbeat expired, so a shorter ttl returns the
+// unacked deliveries of crashed processes sooner, while a longer one
+// tolerates longer pauses like stop-the-world garbage collections or network
+// hiccups. Each interval deviates randomly by up to jitter, so thousands of
+// connections don't write their heartbeats at the same time. Returns false
+// without changing anything if the heartbeat could expire between two
+// writes, so ttl must be greater than interval plus jitter.
+func (connection *redisConnection) SetHeartbeat(interval, ttl, jitter time.Duration) bool {
+	if interval <= 0 || jitter < 0 || jitter >= interval || ttl <= interval+jitter {
+		return false
+	}
+
+	connection.heartbeatMutex.Lock()
+	connection.heartbeatInterval = interval
+	connection.heartbeatTTL = ttl
+	connection.heartbeatJitter = jitter
+	connection.heartbeatMutex.Unlock()
+
+	if atomic.LoadInt32(&connection.heartbeatStopped) == 0 {
+		connection.refreshHeartbeat() // apply the new ttl right away
+	}
+	select {
+	case connection.heartbeatReset <- struct{}{}: // the pending heartbeat may be too late for the new ttl
+	default: // a reset is pending already
+	}
+	return true
+}
+
+// SetDeadHandler sets a function which is called when the connection
+// notices that its heartbeat expired, for example after the process was
+// paused for longer than the heartbeat TTL. The cleaner considers such
+// connections dead and returns their unacked deliveries to ready, so the
+// connection stops its heartbeat and all queues consuming in this process and
+// drops the prefetched deliveries to avoid processing them twice. The
+// handler runs in its own goroutine after that, for example to exit or to
+// open a new connection.
+func (connection *redisConnection) SetDeadHandler(handler func()) {
+	connection.heartbeatMutex.Lock()
+	connection.deadHandler = handler
+	connection.heartbeatMutex.Unlock()
+}
+
+// Dead returns true if the connection noticed that it was considered dead,
+// see SetDeadHandler
+func (connection *redisConnection) Dead() bool {
+	return atomic.LoadInt32(&connection.dead) == 1
+}
+
+// declareDead stops the heartbeat and consuming and calls the dead handler
+func (connection *redisConnection) declareDead() {
+	if !atomic.CompareAndSwapInt32(&connection.dead, 0, 1) {
+		return
+	}
+	logf("rmq connection %s found its heartbeat expired, stopping consumers", connection)
+	connection.publishConnectionEvent(ConnectionEventHeartbeatLost, connection.Name)
+	connection.StopHeartbeat()
+
+	connection.consumingMutex.Lock()
+	queues := append([]*redisQueue(nil), connection.consumingQueues...)
+	connection.consumingMutex.Unlock()
+	for _, queue := range queues {
+		queue.StopConsuming()
+	}
+
+	connection.heartbeatMutex.Lock()
+	handler := connection.deadHandler
+	connection.heartbeatMutex.Unlock()
+	if handler != nil {
+		go handler() // it may call Shutdown, which waits for the heartbeat goroutine
+	}
+}
+
+// nextHeartbeat returns the time until the next heartbeat
+func (connection *redisConnection) nextHeartbeat() time.Duration {
+	connection.heartbeatMutex.Lock()
+	defer connection.heartbeatMutex.Unlock()
+
+	if connection.heartbeatJitter <= 0 {
+		return connection.heartbeatInterval
+	}
+	deviation := time.Duration(rand.Int63n(int64(2*connection.heartbeatJitter))) - connection.heartbeatJitter
+	return connection.heartbeatInterval + deviation
+}
+
+// heartbeatStaleAfter returns how old the last heartbeat may be until the
+// heartbeat is considered stale
+func (connection *redisConnection) heartbeatStaleAfter() time.Duration {
+	connection.heartbeatMutex.Lock()
+	defer connection.heartbeatMutex.Unlock()
+	return heartbeatStaleIntervals * (connection.heartbeatInterval + connection.heartbeatJitter)
+}
+
 // heartbeat keeps the heartbeat key alive
 func (connection *redisConnection) heartbeat() {
+	defer close(connection.heartbeatDone)
+
+	// the first heartbeat was set on open, so a StopHeartbeat right after
+	// opening can't be overwritten by this goroutine
+	timer := time.NewTimer(connection.nextHeartbeat())
+	defer timer.Stop()
 	for {
-		if !connection.updateHeartbeat() {
-			// log.Printf("rmq connection failed to update heartbeat %s", connection)
+		select {
+		case <-connection.heartbeatStop:
+			return
+		case <-connection.heartbeatReset:
+			if !timer.Stop() {
+				select {
+				case <-timer.C: // drain the expired timer
+				default:
+				}
+			}
+			timer.Reset(connection.nextHeartbeat())
+			continue // SetHeartbeat wrote the heartbeat already
+		case <-timer.C:
+			timer.Reset(connection.nextHeartbeat())
 		}
 
-		time.Sleep(time.Second)
+		if atomic.LoadInt32(&connection.heartbeatStopped) == 1 {
+			return // stopped while the tick was pending
+		}
 
-		if connection.heartbeatStopped {
-			// log.Printf("rmq connection stopped heartbeat %s", connection)
-			return
+		connection.refreshHeartbeat() // Redis errors and expired heartbeats are logged
+	}
+}
+
+// claimHeartbeat sets the heartbeat with the configured ttl, claimed is false
+// if it's set already, so only one connection can own a name
+func (connection *redisConnection) claimHeartbeat() (claimed bool, ok bool) {
+	connection.heartbeatMutex.Lock()
+	ttl := connection.heartbeatTTL
+	connection.heartbeatMutex.Unlock()
+
+	claimed, ok = connection.redisClient.SetNX(connection.heartbeatKey, "1", ttl)
+	if claimed {
+		atomic.StoreInt64(&connection.heartbeatAt, time.Now().UnixNano())
+	}
+	return claimed, ok
+}
+
+// refreshHeartbeat sets the heartbeat again with the configured ttl, but only
+// if it didn't expire meanwhile. Otherwise the connection was considered dead.
+func (connection *redisConnection) refreshHeartbeat() bool {
+	connection.heartbeatMutex.Lock()
+	ttl := connection.heartbeatTTL
+	connection.heartbeatMutex.Unlock()
+
+	updated, ok := connection.redisClient.SetXX(connection.heartbeatKey, "1", ttl)
+	if !ok {
+		return false
+	}
+	if !updated {
+		if atomic.LoadInt32(&connection.heartbeatStopped) == 0 { // not deleted by StopHeartbeat
+			connection.declareDead()
 		}
+		return false
 	}
+	atomic.StoreInt64(&connection.heartbeatAt, time.Now().UnixNano())
+	return true
 }
 
-func (connection *redisConnection) updateHeartbeat() bool {
-	ok := connection.redisClient.Set(connection.heartbeatKey, "1", heartbeatDuration)
-	return ok
+// startedConsuming registers queue for health checks
+func (connection *redisConnection) startedConsuming(queue *redisQueue) {
+	connection.consumingMutex.Lock()
+	defer connection.consumingMutex.Unlock()
+	connection.consumingQueues = append(connection.consumingQueues, queue)
+}
+
+// startedBuffering registers queue so Shutdown flushes its publish buffer
+func (connection *redisConnection) startedBuffering(queue *redisQueue) {
+	connection.consumingMutex.Lock()
+	defer connection.consumingMutex.Unlock()
+
+	for _, buffered := range connection.bufferedQueues {
+		if buffered == queue {
+			return
+		}
+	}
+	connection.bufferedQueues = append(connection.bufferedQueues, queue)
 }
 
 // hijackConnection reopens an existing connection for inspection purposes without starting a heartbeat
@@ -0,0 +1,64 @@
+package rmq
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// types of connection events
+const (
+	ConnectionEventOpened        = "opened"         // the connection was opened
+	ConnectionEventStopped       = "stopped"        // the connection stopped its heartbeat, usually on shutdown
+	ConnectionEventHeartbeatLost = "heartbeat_lost" // the connection found its heartbeat expired, see SetDeadHandler
+	ConnectionEventCleaned       = "cleaned"        // a cleaner cleaned the dead connection
+)
+
+// ConnectionEvent describes a change in the lifecycle of a connection, see
+// SubscribeConnectionEvents
+type ConnectionEvent struct {
+	Type       string    `json:"type"` // one of the ConnectionEvent constants
+	Connection string    `json:"connection"`
+	Time       time.Time `json:"time"`
+}
+
+// SubscribeConnectionEvents returns a channel receiving lifecycle events of
+// all connections from now on, so monitoring can react to worker failures
+// right away. Crashed processes can't announce their death, their connection
+// is only reported once a cleaner cleaned it. Events are published through
+// Redis pub/sub, so they are lost while nobody is subscribed. Call
+// unsubscribe to stop receiving events, the channel is closed then.
+func (connection *redisConnection) SubscribeConnectionEvents() (events <-chan ConnectionEvent, unsubscribe func()) {
+	messages, stop := connection.redisClient.Subscribe(connectionEventsChannel)
+
+	eventChan := make(chan ConnectionEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(eventChan)
+		for message := range messages {
+			event := ConnectionEvent{}
+			if err := json.Unmarshal([]byte(message), &event); err != nil {
+				continue
+			}
+			select {
+			case eventChan <- event:
+			case <-done: // keep draining messages until they are closed
+			}
+		}
+	}()
+
+	return eventChan, func() {
+		close(done)
+		stop()
+	}
+}
+
+// publishConnectionEvent publishes an event about the connection with the
+// given name, failures are ignored
+func (connection *redisConnection) publishConnectionEvent(eventType, name string) {
+	encoded, _ := json.Marshal(ConnectionEvent{
+		Type:       eventType,
+		Connection: name,
+		Time:       time.Now(),
+	})
+	connection.redisClient.Publish(connectionEventsChannel, string(encoded))
+}
@@ -0,0 +1,48 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestConnectionEventsSuite(t *testing.T) {
+	TestingSuiteT(&ConnectionEventsSuite{}, t)
+}
+
+type ConnectionEventsSuite struct{}
+
+func (suite *ConnectionEventsSuite) TestSubscribe(c *C) {
+	subscriber := OpenConnection("events-subscriber", "tcp", "localhost:6379", 1)
+	events, unsubscribe := subscriber.SubscribeConnectionEvents()
+
+	stopped := OpenConnection("events-stopped", "tcp", "localhost:6379", 1)
+	stopped.StopHeartbeat()
+	stopped.StopHeartbeat() // only reported once
+	NewCleaner(subscriber).CleanConnection(stopped)
+
+	lost := OpenConnection("events-lost", "tcp", "localhost:6379", 1)
+	lost.declareDead()
+
+	received := map[string][]string{}
+	timeout := time.After(time.Second)
+	for len(received[stopped.Name]) < 3 || len(received[lost.Name]) < 2 {
+		select {
+		case event := <-events:
+			c.Check(event.Time.IsZero(), Equals, false)
+			received[event.Connection] = append(received[event.Connection], event.Type)
+		case <-timeout:
+			c.Fatalf("missing events, received %v", received)
+		}
+	}
+	c.Check(received[stopped.Name], DeepEquals, []string{ConnectionEventOpened, ConnectionEventStopped, ConnectionEventCleaned})
+	c.Check(received[lost.Name], DeepEquals, []string{ConnectionEventOpened, ConnectionEventHeartbeatLost})
+
+	unsubscribe()
+	for range events {
+		// drain until unsubscribe closed it
+	}
+
+	subscriber.StopHeartbeat()
+}
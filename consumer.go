@@ -1,5 +1,70 @@
 package rmq
 
+import "context"
+
 type Consumer interface {
 	Consume(delivery Delivery)
 }
+
+// ConsumerFunc is an adapter to use ordinary functions as consumers
+type ConsumerFunc func(delivery Delivery)
+
+func (consumerFunc ConsumerFunc) Consume(delivery Delivery) {
+	consumerFunc(delivery)
+}
+
+// ContextConsumer can be implemented by consumers which want to stop
+// processing when the consumer is removed or the processing timeout of the
+// queue expired, see SetProcessingTimeout. ConsumeContext is called instead
+// of Consume then.
+type ContextConsumer interface {
+	ConsumeContext(ctx context.Context, delivery Delivery)
+}
+
+// TimeoutAction decides what happens to a delivery whose processing timed out
+type TimeoutAction int
+
+const (
+	TimeoutReject TimeoutAction = iota // reject the delivery
+	TimeoutPush                        // push the delivery to the push queue
+)
+
+// Consumers and batch consumers can implement these hooks to set up and tear
+// down resources tied to their consuming lifetime. The queue calls them in the
+// consumer goroutine.
+type (
+	// ConsumerStartHook is called before the first delivery
+	ConsumerStartHook interface {
+		OnStart()
+	}
+
+	// ConsumerStopHook is called after the last delivery, when the queue
+	// stopped consuming or the consumer was removed
+	ConsumerStopHook interface {
+		OnStop()
+	}
+
+	// ConsumerRemoveHook is called after OnStop if the consumer was removed
+	// from the queue
+	ConsumerRemoveHook interface {
+		OnRemoved()
+	}
+)
+
+func callOnStart(consumer interface{}) {
+	if hook, ok := consumer.(ConsumerStartHook); ok {
+		hook.OnStart()
+	}
+}
+
+func callOnStop(consumer interface{}) {
+	if hook, ok := consumer.(ConsumerStopHook); ok {
+		hook.OnStop()
+	}
+}
+
+func callOnRemoved(consumer interface{}) {
+	if hook, ok := consumer.(ConsumerRemoveHook); ok {
+		hook.OnRemoved()
+	}
+}
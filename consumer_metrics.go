@@ -0,0 +1,330 @@
+package rmq
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const consumerMetricsFlushInterval = time.Second
+
+// consumerDurationBuckets are the upper bounds of the processing duration
+// histogram, durations above the last bound are counted separately
+var consumerDurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// latencyBuckets are the upper bounds of the end-to-end latency histogram,
+// latencies above the last bound are counted separately
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// hash fields of the consumer metrics
+const (
+	metricConsumed     = "consumed"
+	metricAcked        = "acked"
+	metricRejected     = "rejected"
+	metricPushed       = "pushed"
+	metricCalls        = "calls"       // number of Consume() calls
+	metricDuration     = "duration_us" // sum of Consume() durations
+	metricLastActivity = "last_activity"
+	metricLatencies    = "latencies"  // number of deliveries with known latency
+	metricLatency      = "latency_us" // sum of their latencies
+)
+
+// ConsumerStat holds the processing metrics of a consumer. Durations are
+// measured per Consume() call, so per batch for batch consumers.
+type ConsumerStat struct {
+	Consumed     int       `json:"consumed"`
+	Acked        int       `json:"acked"`
+	Rejected     int       `json:"rejected"`
+	Pushed       int       `json:"pushed"`
+	LastActivity time.Time `json:"last_activity"`
+
+	calls           int
+	durationSum     time.Duration
+	durationBuckets []int // counts per consumerDurationBuckets plus one for longer durations
+	latencies       int
+	latencySum      time.Duration
+	latencyBuckets  []int // counts per latencyBuckets plus one for longer latencies
+}
+
+func newConsumerStat(fields map[string]string) ConsumerStat {
+	stat := ConsumerStat{
+		Consumed:        intField(fields, metricConsumed),
+		Acked:           intField(fields, metricAcked),
+		Rejected:        intField(fields, metricRejected),
+		Pushed:          intField(fields, metricPushed),
+		calls:           intField(fields, metricCalls),
+		durationSum:     time.Duration(intField(fields, metricDuration)) * time.Microsecond,
+		durationBuckets: make([]int, len(consumerDurationBuckets)+1),
+		latencies:       intField(fields, metricLatencies),
+		latencySum:      time.Duration(intField(fields, metricLatency)) * time.Microsecond,
+		latencyBuckets:  make([]int, len(latencyBuckets)+1),
+	}
+
+	if nanos := intField(fields, metricLastActivity); nanos > 0 {
+		stat.LastActivity = time.Unix(0, int64(nanos))
+	}
+
+	for i := range stat.durationBuckets {
+		stat.durationBuckets[i] = intField(fields, durationBucketField(i))
+	}
+	for i := range stat.latencyBuckets {
+		stat.latencyBuckets[i] = intField(fields, latencyBucketField(i))
+	}
+
+	return stat
+}
+
+func (stat ConsumerStat) String() string {
+	return fmt.Sprintf("[consumed:%d acked:%d rejected:%d pushed:%d avg:%s p99:%s]",
+		stat.Consumed,
+		stat.Acked,
+		stat.Rejected,
+		stat.Pushed,
+		stat.AverageDuration(),
+		stat.DurationPercentile(0.99),
+	)
+}
+
+// AverageDuration returns the average duration of a Consume() call
+func (stat ConsumerStat) AverageDuration() time.Duration {
+	if stat.calls == 0 {
+		return 0
+	}
+	return stat.durationSum / time.Duration(stat.calls)
+}
+
+// DurationPercentile returns an estimate of the given percentile (between 0
+// and 1) of Consume() call durations. The estimate is the upper bound of the
+// histogram bucket the percentile falls into, durations above the largest
+// bucket are reported as the largest bucket.
+func (stat ConsumerStat) DurationPercentile(percentile float64) time.Duration {
+	return bucketPercentile(stat.durationBuckets, consumerDurationBuckets, percentile)
+}
+
+// AverageLatency returns the average time from publishing to consuming of
+// deliveries published with an envelope, see Delivery.Latency
+func (stat ConsumerStat) AverageLatency() time.Duration {
+	if stat.latencies == 0 {
+		return 0
+	}
+	return stat.latencySum / time.Duration(stat.latencies)
+}
+
+// LatencyPercentile returns an estimate of the given percentile of latencies
+// like DurationPercentile
+func (stat ConsumerStat) LatencyPercentile(percentile float64) time.Duration {
+	return bucketPercentile(stat.latencyBuckets, latencyBuckets, percentile)
+}
+
+// bucketPercentile returns the upper bound of the bucket the percentile falls
+// into, counts has one more bucket than bounds for values above all bounds
+func bucketPercentile(counts []int, bounds []time.Duration, percentile float64) time.Duration {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	threshold := percentile * float64(total)
+	cumulative := 0
+	for i, count := range counts {
+		cumulative += count
+		if float64(cumulative) >= threshold && i < len(bounds) {
+			return bounds[i]
+		}
+	}
+	return bounds[len(bounds)-1]
+}
+
+// add returns the sum of both stats, used to aggregate consumers of a queue
+func (stat ConsumerStat) add(other ConsumerStat) ConsumerStat {
+	sum := ConsumerStat{
+		Consumed:        stat.Consumed + other.Consumed,
+		Acked:           stat.Acked + other.Acked,
+		Rejected:        stat.Rejected + other.Rejected,
+		Pushed:          stat.Pushed + other.Pushed,
+		LastActivity:    stat.LastActivity,
+		calls:           stat.calls + other.calls,
+		durationSum:     stat.durationSum + other.durationSum,
+		durationBuckets: addBuckets(stat.durationBuckets, other.durationBuckets, len(consumerDurationBuckets)+1),
+		latencies:       stat.latencies + other.latencies,
+		latencySum:      stat.latencySum + other.latencySum,
+		latencyBuckets:  addBuckets(stat.latencyBuckets, other.latencyBuckets, len(latencyBuckets)+1),
+	}
+
+	if other.LastActivity.After(sum.LastActivity) {
+		sum.LastActivity = other.LastActivity
+	}
+
+	return sum
+}
+
+// addBuckets returns the sums of the histogram counts
+func addBuckets(a, b []int, size int) []int {
+	sum := make([]int, size)
+	for i := range sum {
+		if i < len(a) {
+			sum[i] += a[i]
+		}
+		if i < len(b) {
+			sum[i] += b[i]
+		}
+	}
+	return sum
+}
+
+// consumerMetrics collects the metrics of a single consumer in memory and
+// regularly adds them to a hash in Redis so they are visible to other processes
+type consumerMetrics struct {
+	key          string // key to hash of metrics
+	redisClient  RedisClient
+	mutex        sync.Mutex
+	deltas       map[string]int // increments not written to Redis yet
+	lastActivity time.Time
+	stopChan     chan struct{}
+	stoppedChan  chan struct{}
+}
+
+func newConsumerMetrics(key string, redisClient RedisClient) *consumerMetrics {
+	metrics := &consumerMetrics{
+		key:         key,
+		redisClient: redisClient,
+		deltas:      map[string]int{},
+		stopChan:    make(chan struct{}),
+		stoppedChan: make(chan struct{}),
+	}
+	go metrics.flushRegularly()
+	return metrics
+}
+
+// consumed records a Consume() call with the given number of deliveries
+func (metrics *consumerMetrics) consumed(count int, duration time.Duration) {
+	countVar(varConsumed, count)
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.deltas[metricConsumed] += count
+	metrics.deltas[metricCalls]++
+	metrics.deltas[metricDuration] += int(duration / time.Microsecond)
+	metrics.deltas[durationBucketField(durationBucket(duration))]++
+	metrics.lastActivity = time.Now()
+}
+
+// latency records the end-to-end latency of a delivery handed to the consumer
+func (metrics *consumerMetrics) latency(latency time.Duration) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.deltas[metricLatencies]++
+	metrics.deltas[metricLatency] += int(latency / time.Microsecond)
+	metrics.deltas[latencyBucketField(latencyBucket(latency))]++
+}
+
+// settled records an ack, reject or push
+func (metrics *consumerMetrics) settled(field string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.deltas[field]++
+	metrics.lastActivity = time.Now()
+}
+
+// stop stops the regular flushes and writes remaining metrics to Redis
+func (metrics *consumerMetrics) stop() {
+	close(metrics.stopChan)
+	<-metrics.stoppedChan
+}
+
+func (metrics *consumerMetrics) flushRegularly() {
+	defer close(metrics.stoppedChan)
+
+	ticker := time.NewTicker(consumerMetricsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			metrics.flush()
+		case <-metrics.stopChan:
+			metrics.flush()
+			return
+		}
+	}
+}
+
+func (metrics *consumerMetrics) flush() {
+	metrics.mutex.Lock()
+	deltas := metrics.deltas
+	lastActivity := metrics.lastActivity
+	metrics.deltas = map[string]int{}
+	metrics.mutex.Unlock()
+
+	if len(deltas) == 0 {
+		return // nothing happened since last flush
+	}
+
+	for field, delta := range deltas {
+		metrics.redisClient.HIncrBy(metrics.key, field, delta)
+	}
+	metrics.redisClient.HSet(metrics.key, metricLastActivity, strconv.FormatInt(lastActivity.UnixNano(), 10))
+}
+
+// durationBucket returns the index of the histogram bucket for duration
+func durationBucket(duration time.Duration) int {
+	for i, bound := range consumerDurationBuckets {
+		if duration <= bound {
+			return i
+		}
+	}
+	return len(consumerDurationBuckets)
+}
+
+func durationBucketField(bucket int) string {
+	if bucket >= len(consumerDurationBuckets) {
+		return "duration_le_inf"
+	}
+	return fmt.Sprintf("duration_le_%d_us", consumerDurationBuckets[bucket]/time.Microsecond)
+}
+
+func latencyBucket(latency time.Duration) int {
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			return i
+		}
+	}
+	return len(latencyBuckets)
+}
+
+func latencyBucketField(bucket int) string {
+	if bucket >= len(latencyBuckets) {
+		return "latency_le_inf"
+	}
+	return fmt.Sprintf("latency_le_%d_ms", latencyBuckets[bucket]/time.Millisecond)
+}
+
+func intField(fields map[string]string, field string) int {
+	value, _ := strconv.Atoi(fields[field])
+	return value
+}
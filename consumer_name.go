@@ -0,0 +1,35 @@
+package rmq
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/adjust/uniuri"
+)
+
+// SetConsumerNamer makes queues of this connection name new consumers by
+// calling namer with the tag passed to AddConsumer, instead of appending a
+// random suffix to the tag. Names must be unique per queue and connection,
+// adding a consumer with a name in use returns ErrConsumerNameInUse. Pass
+// nil to restore the default.
+func (connection *redisConnection) SetConsumerNamer(namer func(tag string) string) {
+	connection.namerMutex.Lock()
+	defer connection.namerMutex.Unlock()
+	connection.consumerNamer = namer
+}
+
+func (connection *redisConnection) getConsumerNamer() func(tag string) string {
+	connection.namerMutex.RLock()
+	defer connection.namerMutex.RUnlock()
+	return connection.consumerNamer
+}
+
+// HostnameConsumerNamer names consumers tag-hostname-suffix, so stats show
+// which host or pod runs a consumer. Pass it to SetConsumerNamer.
+func HostnameConsumerNamer(tag string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%s-%s", tag, hostname, uniuri.NewLen(6))
+}
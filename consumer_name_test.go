@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestConsumerNameSuite(t *testing.T) {
+	TestingSuiteT(&ConsumerNameSuite{}, t)
+}
+
+type ConsumerNameSuite struct{}
+
+func (suite *ConsumerNameSuite) TestNamer(c *C) {
+	connection := OpenConnection("name-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("name-q").(*redisQueue)
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+
+	connection.SetConsumerNamer(func(tag string) string { return "pod-7-" + tag })
+	name, err := queue.AddConsumer("name-cons", NewTestConsumer("name-A"))
+	c.Check(err, IsNil)
+	c.Check(name, Equals, "pod-7-name-cons")
+	_, err = queue.AddConsumer("name-cons", NewTestConsumer("name-B"))
+	c.Check(err, Equals, ErrConsumerNameInUse)
+	c.Check(queue.GetConsumers(), DeepEquals, []string{"pod-7-name-cons"})
+
+	connection.SetConsumerNamer(HostnameConsumerNamer)
+	hostname, _ := os.Hostname()
+	name, err = queue.AddConsumer("name-cons", NewTestConsumer("name-C"))
+	c.Check(err, IsNil)
+	c.Check(strings.HasPrefix(name, "name-cons-"+hostname+"-"), Equals, true)
+
+	connection.SetConsumerNamer(nil)
+	name, _ = queue.AddConsumer("name-cons", NewTestConsumer("name-D"))
+	c.Check(name, HasLen, len("name-cons-")+6)
+
+	queue.StopConsuming()
+	queue.RemoveAllConsumers()
+	connection.StopHeartbeat()
+}
+
+func (suite *ConsumerNameSuite) TestAddConsumerWithName(c *C) {
+	connection := OpenConnection("name-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("name-q").(*redisQueue)
+	c.Check(queue.AddConsumerWithName("name-cons", NewTestConsumer("name-A")), Equals, ErrNotConsuming)
+
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	c.Check(queue.AddConsumerWithName("name-cons", NewTestConsumer("name-A")), IsNil)
+	c.Check(queue.AddConsumerWithName("name-cons", NewTestConsumer("name-B")), Equals, ErrConsumerNameInUse)
+	c.Check(queue.GetConsumers(), DeepEquals, []string{"name-cons"})
+
+	c.Check(queue.RemoveConsumer("name-cons"), Equals, true)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(queue.AddConsumerWithName("name-cons", NewTestConsumer("name-C")), IsNil)
+
+	queue.StopConsuming()
+	queue.RemoveAllConsumers()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,218 @@
+package rmq
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// Dashboard is an http.Handler serving a web UI with the state of all open
+// queues and their connections. It also provides buttons to purge queues,
+// return rejected deliveries and clean dead connections. Actions posted by
+// other sites are refused, so pages visited by a logged in operator can't
+// trigger them.
+type Dashboard struct {
+	connection *redisConnection
+	cleaner    *Cleaner
+	auth       func(request *http.Request) bool
+}
+
+// NewDashboard returns a dashboard for the given connection. If auth is not
+// nil it's called for every request and the request is refused with 401
+// Unauthorized unless it returns true.
+func NewDashboard(connection *redisConnection, auth func(request *http.Request) bool) *Dashboard {
+	return &Dashboard{
+		connection: connection,
+		cleaner:    NewCleaner(connection),
+		auth:       auth,
+	}
+}
+
+func (dashboard *Dashboard) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if dashboard.auth != nil && !dashboard.auth(request) {
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+		dashboard.render(writer)
+	case http.MethodPost:
+		if !sameOrigin(request) {
+			http.Error(writer, "cross origin request", http.StatusForbidden)
+			return
+		}
+		dashboard.act(writer, request)
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (dashboard *Dashboard) render(writer http.ResponseWriter) {
+	stats := dashboard.connection.CollectStats(dashboard.connection.GetOpenQueues())
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(writer, newDashboardView(stats)); err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// act performs the action posted by one of the dashboard forms and redirects
+// back to the dashboard
+func (dashboard *Dashboard) act(writer http.ResponseWriter, request *http.Request) {
+	action := request.FormValue("action")
+	queueName := request.FormValue("queue")
+
+	switch action {
+	case "clean":
+		if err := dashboard.cleaner.Clean(); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "purge-ready", "purge-rejected", "return-rejected":
+		if queueName == "" {
+			http.Error(writer, "missing queue", http.StatusBadRequest)
+			return
+		}
+		if !dashboard.connection.isOpenQueue(queueName) {
+			http.Error(writer, "unknown queue", http.StatusNotFound)
+			return
+		}
+		queue := dashboard.connection.OpenQueue(queueName)
+		switch action {
+		case "purge-ready":
+			queue.PurgeReady()
+		case "purge-rejected":
+			queue.PurgeRejected()
+		case "return-rejected":
+			queue.ReturnAllRejected()
+		}
+	default:
+		http.Error(writer, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(writer, request, request.URL.Path, http.StatusSeeOther)
+}
+
+// sameOrigin returns false if the request was sent by a browser from another
+// site. Browsers set Sec-Fetch-Site, older ones at least Origin on posts.
+// Requests without either don't come from a browser and are allowed.
+func sameOrigin(request *http.Request) bool {
+	switch request.Header.Get("Sec-Fetch-Site") {
+	case "":
+	case "same-origin", "none":
+		return true
+	default:
+		return false
+	}
+
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == request.Host
+}
+
+type dashboardView struct {
+	Queues      []dashboardQueueView
+	Connections []dashboardConnectionView // connections which are not consuming
+}
+
+type dashboardQueueView struct {
+	Name        string
+	Ready       int
+	Rejected    int
+	Unacked     int
+	Connections []dashboardConnectionView
+}
+
+type dashboardConnectionView struct {
+	Name      string
+	Active    bool
+	Unacked   int
+	Consumers []string
+}
+
+func newDashboardView(stats Stats) dashboardView {
+	view := dashboardView{}
+	for _, queueName := range stats.sortedQueueNames() {
+		queueStat := stats.QueueStats[queueName]
+		queueView := dashboardQueueView{
+			Name:     queueName,
+			Ready:    queueStat.ReadyCount,
+			Rejected: queueStat.RejectedCount,
+			Unacked:  queueStat.UnackedCount(),
+		}
+		for _, connectionName := range queueStat.connectionStats.sortedNames() {
+			connectionStat := queueStat.connectionStats[connectionName]
+			queueView.Connections = append(queueView.Connections, dashboardConnectionView{
+				Name:      connectionName,
+				Active:    connectionStat.active,
+				Unacked:   connectionStat.unackedCount,
+				Consumers: connectionStat.consumers,
+			})
+		}
+		view.Queues = append(view.Queues, queueView)
+	}
+
+	for _, connectionName := range stats.sortedConnectionNames() {
+		view.Connections = append(view.Connections, dashboardConnectionView{
+			Name:   connectionName,
+			Active: stats.otherConnections[connectionName],
+		})
+	}
+
+	return view
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"activeSign": ActiveSign,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rmq</title>
+<style>
+body { font-family: monospace; }
+td, th { padding: 2px 12px; text-align: left; }
+tr.connection { color: grey; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<table>
+<tr><th>queue</th><th>ready</th><th>rejected</th><th>unacked</th><th>connections</th><th>consumers</th><th></th></tr>
+{{range .Queues}}
+<tr>
+<td>{{.Name}}</td><td>{{.Ready}}</td><td>{{.Rejected}}</td><td>{{.Unacked}}</td><td>{{len .Connections}}</td><td></td>
+<td>
+<form method="post"><input type="hidden" name="queue" value="{{.Name}}"><button name="action" value="purge-ready" data-confirm="purge all ready deliveries of {{.Name}}">purge ready</button></form>
+<form method="post"><input type="hidden" name="queue" value="{{.Name}}"><button name="action" value="purge-rejected" data-confirm="purge all rejected deliveries of {{.Name}}">purge rejected</button></form>
+<form method="post"><input type="hidden" name="queue" value="{{.Name}}"><button name="action" value="return-rejected" data-confirm="return all rejected deliveries of {{.Name}}">return rejected</button></form>
+</td>
+</tr>
+{{range .Connections}}
+<tr class="connection"><td>{{activeSign .Active}} {{.Name}}</td><td></td><td></td><td>{{.Unacked}}</td><td></td><td>{{range .Consumers}}{{.}} {{end}}</td><td></td></tr>
+{{end}}
+{{end}}
+</table>
+<h4>other connections</h4>
+<table>
+{{range .Connections}}
+<tr class="connection"><td>{{activeSign .Active}} {{.Name}}</td></tr>
+{{end}}
+</table>
+<form method="post"><button name="action" value="clean" data-confirm="clean all dead connections">clean dead connections</button></form>
+<script>
+document.querySelectorAll("button[data-confirm]").forEach(function(button) {
+	button.addEventListener("click", function(event) {
+		if (!confirm(button.getAttribute("data-confirm") + "?")) {
+			event.preventDefault();
+		}
+	});
+});
+</script>
+</body>
+</html>
+`))
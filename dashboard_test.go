@@ -0,0 +1,77 @@
+package rmq
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestDashboardSuite(t *testing.T) {
+	TestingSuiteT(&DashboardSuite{}, t)
+}
+
+type DashboardSuite struct{}
+
+func (suite *DashboardSuite) TestDashboard(c *C) {
+	connection := OpenConnection("dashboard-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("dashboard-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("dashboard-d1")
+
+	dashboard := NewDashboard(connection, nil)
+	recorder := httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, httptest.NewRequest("GET", "/rmq", nil))
+	c.Check(recorder.Code, Equals, http.StatusOK)
+	c.Check(strings.Contains(recorder.Body.String(), "dashboard-q"), Equals, true)
+
+	form := url.Values{"action": {"purge-ready"}, "queue": {"dashboard-q"}}
+	request := httptest.NewRequest("POST", "/rmq", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, Equals, http.StatusSeeOther)
+	c.Check(recorder.Header().Get("Location"), Equals, "/rmq")
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	// other sites can't post actions
+	request = httptest.NewRequest("POST", "/rmq", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Sec-Fetch-Site", "cross-site")
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, Equals, http.StatusForbidden)
+
+	request = httptest.NewRequest("POST", "/rmq", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", "https://evil.example")
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, Equals, http.StatusForbidden)
+
+	request = httptest.NewRequest("POST", "/rmq", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", "http://example.com") // host of httptest requests
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, Equals, http.StatusSeeOther)
+
+	// unknown queues aren't opened
+	form = url.Values{"action": {"purge-ready"}, "queue": {"dashboard-unknown-q"}}
+	request = httptest.NewRequest("POST", "/rmq", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	dashboard.ServeHTTP(recorder, request)
+	c.Check(recorder.Code, Equals, http.StatusNotFound)
+	c.Check(connection.isOpenQueue("dashboard-unknown-q"), Equals, false)
+
+	denied := NewDashboard(connection, func(*http.Request) bool { return false })
+	recorder = httptest.NewRecorder()
+	denied.ServeHTTP(recorder, httptest.NewRequest("GET", "/rmq", nil))
+	c.Check(recorder.Code, Equals, http.StatusUnauthorized)
+
+	connection.StopHeartbeat()
+}
@@ -2,6 +2,15 @@ package rmq
 
 type Deliveries []Delivery
 
+// Payloads returns the payloads of all deliveries in order
+func (deliveries Deliveries) Payloads() []string {
+	payloads := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		payloads[i] = delivery.Payload()
+	}
+	return payloads
+}
+
 func (deliveries Deliveries) Ack() int {
 	failedCount := 0
 	for _, delivery := range deliveries {
@@ -21,3 +30,119 @@ func (deliveries Deliveries) Reject() int {
 	}
 	return failedCount
 }
+
+// Push pushes all deliveries and returns how many failed
+func (deliveries Deliveries) Push() int {
+	failedCount := 0
+	for _, delivery := range deliveries {
+		if !delivery.Push() {
+			failedCount++
+		}
+	}
+	return failedCount
+}
+
+// Split returns the deliveries in chunks of at most size, for example to
+// insert a large batch in smaller bulk inserts
+func (deliveries Deliveries) Split(size int) []Deliveries {
+	if size < 1 {
+		size = 1
+	}
+
+	chunks := make([]Deliveries, 0, (len(deliveries)+size-1)/size)
+	for start := 0; start < len(deliveries); start += size {
+		end := start + size
+		if end > len(deliveries) {
+			end = len(deliveries)
+		}
+		chunks = append(chunks, deliveries[start:end:end])
+	}
+	return chunks
+}
+
+// AckExcept acks all deliveries except the ones at the failed indexes, which
+// are rejected, or pushed if push is set. Use it for batches which partly
+// failed, like a bulk insert with per-row errors. The acks and rejects of
+// each queue are done in one round trip. Returns the number of deliveries
+// which couldn't be settled.
+func (deliveries Deliveries) AckExcept(failed []int, push bool) int {
+	isFailed := map[int]bool{}
+	for _, i := range failed {
+		isFailed[i] = true
+	}
+
+	failedCount := 0
+	batches := map[string]*settleBatch{} // by unacked key
+	for i, delivery := range deliveries {
+		wrapped, ok := delivery.(*wrapDelivery)
+		// packed and auto acked deliveries have no unacked entry of their own
+		if !ok || wrapped.pack != nil || wrapped.autoAcked || isFailed[i] && push {
+			if !settleOne(delivery, isFailed[i], push) {
+				failedCount++
+			}
+			continue
+		}
+
+		batch, ok := batches[wrapped.unackedKey]
+		if !ok {
+			batch = &settleBatch{}
+			batches[wrapped.unackedKey] = batch
+		}
+		batch.add(wrapped, isFailed[i])
+	}
+
+	for _, batch := range batches {
+		failedCount += batch.settle()
+	}
+	return failedCount
+}
+
+func settleOne(delivery Delivery, failed, push bool) bool {
+	switch {
+	case !failed:
+		return delivery.Ack()
+	case push:
+		return delivery.Push()
+	default:
+		return delivery.Reject()
+	}
+}
+
+// settleBatch acks and rejects deliveries of one queue at once
+type settleBatch struct {
+	deliveries   []*wrapDelivery
+	values       []string
+	destinations []string // empty to ack
+}
+
+func (batch *settleBatch) add(delivery *wrapDelivery, reject bool) {
+	destination := ""
+	if reject {
+		destination = delivery.rejectedKey
+	}
+	batch.deliveries = append(batch.deliveries, delivery)
+	batch.values = append(batch.values, delivery.value)
+	batch.destinations = append(batch.destinations, destination)
+}
+
+// settle returns the number of deliveries which weren't unacked anymore
+func (batch *settleBatch) settle() int {
+	first := batch.deliveries[0]
+	settled := first.redisClient.SettleBatch(first.unackedKey, batch.values, batch.destinations)
+
+	failedCount := 0
+	for i, delivery := range batch.deliveries {
+		delivery.settling()
+		if !settled[i] {
+			failedCount++
+			continue
+		}
+		if batch.destinations[i] == "" {
+			delivery.acked()
+		} else {
+			delivery.release()
+			delivery.rejected("")
+		}
+	}
+	return failedCount
+}
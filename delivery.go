@@ -1,32 +1,85 @@
 package rmq
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Delivery interface {
 	Payload() string
+	PayloadBytes() []byte
+	ContentType() string
+	Header(name string) string
+	Latency() (latency time.Duration, ok bool)
+	QueueName() string
+	ConsumerName() string
+	RedeliveryCount() (count int, ok bool)
+	IsRedelivered() bool
+	Unmarshal(object interface{}) error
 	Ack() bool
 	Reject() bool
+	RejectWithReason(reason string) bool
 	Push() bool
+	Touch() bool
+}
+
+// RejectionReason describes why a delivery was rejected
+type RejectionReason struct {
+	Reason     string    `json:"reason"`             // empty if rejected without reason
+	Consumer   string    `json:"consumer,omitempty"` // empty if not rejected by a consumer
+	RejectedAt time.Time `json:"rejected_at"`
 }
 
 type wrapDelivery struct {
-	payload     string
+	value       string    // as stored in Redis, might be an envelope
+	payload     string    // unwrapped payload
+	envelope    *envelope // nil for raw payloads
 	unackedKey  string
 	rejectedKey string
+	reasonsKey  string
 	pushKey     string
 	redisClient RedisClient
+	queueName   string           // empty if not fetched by a queue
+	metrics     *consumerMetrics // nil until handed to a consumer
+	consumer    string           // name of the consumer it was handed to
+	blobStore   BlobStore        // set if the payload was loaded from it
+	consumedAt  time.Time        // when it was fetched or handed to a consumer
+	debugging   *int32           // debug flag of its queue, nil if not fetched by a queue
+
+	deadlinesKey      string // empty if the delivery has no visibility timeout
+	visibilityTimeout time.Duration
+	maxHops           int // zero means pushes aren't counted
+
+	onSettle   func() // called on the first ack, reject or push, nil if not needed
+	settleOnce sync.Once
+
+	pack        *deliveryPack // nil unless it was packed with other deliveries, see SetPackSize
+	partSettled int32         // atomic, 1 once a packed or auto acked delivery was settled
+	autoAcked   bool          // fetched without unacked entry, see SetAutoAck
 }
 
-func newDelivery(payload, unackedKey, rejectedKey, pushKey string, redisClient RedisClient) *wrapDelivery {
-	return &wrapDelivery{
-		payload:     payload,
+func newDelivery(value, unackedKey, rejectedKey, reasonsKey, pushKey string, redisClient RedisClient) *wrapDelivery {
+	delivery := &wrapDelivery{
+		value:       value,
+		payload:     value,
 		unackedKey:  unackedKey,
 		rejectedKey: rejectedKey,
+		reasonsKey:  reasonsKey,
 		pushKey:     pushKey,
 		redisClient: redisClient,
+		consumedAt:  time.Now(),
+	}
+
+	if env, ok := decodeEnvelope(value); ok {
+		delivery.payload = env.Payload // might still need decoding
+		delivery.envelope = env
 	}
+
+	return delivery
 }
 
 func (delivery *wrapDelivery) String() string {
@@ -37,34 +90,304 @@ func (delivery *wrapDelivery) Payload() string {
 	return delivery.payload
 }
 
+// PayloadBytes returns a copy of the payload which the caller may modify
+func (delivery *wrapDelivery) PayloadBytes() []byte {
+	return []byte(delivery.payload)
+}
+
+// ContentType returns the content type of the codec the payload was marshaled
+// with by PublishObject, empty for other payloads
+func (delivery *wrapDelivery) ContentType() string {
+	if delivery.envelope == nil {
+		return ""
+	}
+	return delivery.envelope.ContentType
+}
+
+// Header returns the header set by PublishWithHeaders, empty if it's not set
+func (delivery *wrapDelivery) Header(name string) string {
+	if delivery.envelope == nil {
+		return ""
+	}
+	return delivery.envelope.Headers[name]
+}
+
+// Latency returns the time from publishing until the delivery was handed to
+// the consumer, including time spent in push queues. Returns false if it
+// wasn't published with an envelope, see SetEnvelope.
+func (delivery *wrapDelivery) Latency() (time.Duration, bool) {
+	if delivery.envelope == nil {
+		return 0, false
+	}
+	return delivery.consumedAt.Sub(delivery.envelope.publishedAt()), true
+}
+
+// QueueName returns the name of the queue the delivery was fetched from
+func (delivery *wrapDelivery) QueueName() string {
+	return delivery.queueName
+}
+
+// ConsumerName returns the name of the consumer the delivery was handed to,
+// empty if it was fetched with Get
+func (delivery *wrapDelivery) ConsumerName() string {
+	return delivery.consumer
+}
+
+// RedeliveryCount returns how often the delivery was returned to ready after
+// it was fetched, by the cleaner, ReturnAllUnacked, ReturnRejected or an
+// expired visibility timeout. Returns false if it wasn't published with an
+// envelope, see SetEnvelope.
+func (delivery *wrapDelivery) RedeliveryCount() (int, bool) {
+	if delivery.envelope == nil {
+		return 0, false
+	}
+	return delivery.envelope.Redelivered, true
+}
+
+// IsRedelivered returns true if the delivery was returned to ready after it
+// was fetched, so it might have been processed before. Use it to apply
+// idempotency checks only to redelivered deliveries. Deliveries published
+// without an envelope are never marked, see SetEnvelope.
+func (delivery *wrapDelivery) IsRedelivered() bool {
+	return delivery.envelope != nil && delivery.envelope.Redelivered > 0
+}
+
+// Unmarshal decodes the payload into object with the codec registered for
+// its content type, JSON if it has none
+func (delivery *wrapDelivery) Unmarshal(object interface{}) error {
+	codec, err := lookupCodec(delivery.ContentType())
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal([]byte(delivery.payload), object)
+}
+
 func (delivery *wrapDelivery) Ack() bool {
-	// debug(fmt.Sprintf("delivery ack %s", delivery)) // COMMENTOUT
+	delivery.settling()
+	if delivery.autoAcked {
+		if !atomic.CompareAndSwapInt32(&delivery.partSettled, 0, 1) {
+			return false
+		}
+		delivery.acked()
+		return true
+	}
+	if delivery.pack != nil {
+		if !delivery.settlePart() {
+			return false
+		}
+		delivery.debugf("delivery acked %s", delivery)
+		delivery.acked()
+		return true
+	}
+
+	count, ok := delivery.redisClient.LRem(delivery.unackedKey, 1, delivery.value)
+	if !ok || count != 1 {
+		return false
+	}
+	delivery.debugf("delivery acked %s", delivery)
+	delivery.acked()
+	return true
+}
+
+// acked does the bookkeeping after the delivery was removed from unacked
+func (delivery *wrapDelivery) acked() {
+	delivery.record(metricAcked)
+	delivery.release()
 
-	count, ok := delivery.redisClient.LRem(delivery.unackedKey, 1, delivery.payload)
-	return ok && count == 1
+	if delivery.blobStore != nil {
+		delivery.blobStore.Delete(delivery.envelope.Blob) // expires or leaks on error
+	}
 }
 
 func (delivery *wrapDelivery) Reject() bool {
-	return delivery.move(delivery.rejectedKey)
+	return delivery.RejectWithReason("")
 }
 
-func (delivery *wrapDelivery) Push() bool {
-	if delivery.pushKey != "" {
-		return delivery.move(delivery.pushKey)
-	} else {
-		return delivery.move(delivery.rejectedKey)
+// RejectWithReason rejects the delivery and stores reason along with the
+// rejection time and consumer name, see Queue.RejectionReason. Deliveries
+// with the same payload share their reason.
+func (delivery *wrapDelivery) RejectWithReason(reason string) bool {
+	delivery.settling()
+	if !delivery.move(delivery.rejectedKey, delivery.value) {
+		return false
 	}
+	delivery.rejected(reason)
+	return true
+}
+
+// rejected does the bookkeeping after the delivery was moved to rejected
+func (delivery *wrapDelivery) rejected(reason string) {
+	delivery.record(metricRejected)
+	delivery.storeRejection(reason)
 }
 
-func (delivery *wrapDelivery) move(key string) bool {
-	if ok := delivery.redisClient.LPush(key, delivery.payload); !ok {
+// Push moves the delivery to the push queue, or rejects it if there is none.
+// If the queue has a hop limit, the number of pushes and the last push time
+// are recorded in the envelope and deliveries which reached the limit are
+// rejected instead.
+func (delivery *wrapDelivery) Push() bool {
+	delivery.settling()
+	if delivery.pushKey == "" {
+		if !delivery.move(delivery.rejectedKey, delivery.value) {
+			return false
+		}
+		delivery.record(metricPushed)
+		delivery.storeRejection("")
+		return true
+	}
+
+	if delivery.maxHops <= 0 {
+		if !delivery.move(delivery.pushKey, delivery.value) {
+			return false
+		}
+		delivery.record(metricPushed)
+		return true
+	}
+
+	env := delivery.envelope
+	if env == nil {
+		env = newEnvelope(delivery.value)
+	}
+	if env.Hops >= delivery.maxHops {
+		return delivery.RejectWithReason(fmt.Sprintf("hop limit %d exceeded", delivery.maxHops))
+	}
+
+	pushed := *env
+	pushed.Hops++
+	pushed.Pushed = time.Now().UnixNano()
+	if !delivery.move(delivery.pushKey, pushed.encode()) {
 		return false
 	}
+	delivery.record(metricPushed)
+	return true
+}
 
-	if _, ok := delivery.redisClient.LRem(delivery.unackedKey, 1, delivery.payload); !ok {
+// settling calls the settle hook, even if settling fails because the
+// delivery was returned meanwhile
+func (delivery *wrapDelivery) settling() {
+	if delivery.onSettle != nil {
+		delivery.settleOnce.Do(delivery.onSettle)
+	}
+}
+
+// storeRejection records why and when the delivery was rejected, which is
+// also needed for the rejected retention, see SetRejectedRetention
+func (delivery *wrapDelivery) storeRejection(reason string) {
+	rejection, _ := json.Marshal(RejectionReason{
+		Reason:     reason,
+		Consumer:   delivery.consumer,
+		RejectedAt: time.Now(),
+	})
+	delivery.redisClient.HSet(delivery.reasonsKey, delivery.value, string(rejection)) // reason is lost on error
+}
+
+// Touch extends the visibility timeout of the delivery, so it isn't returned
+// to ready while it's still being processed. It returns false if the
+// delivery was already returned because its visibility timeout expired.
+func (delivery *wrapDelivery) Touch() bool {
+	if delivery.deadlinesKey == "" {
+		return true // never expires
+	}
+
+	// the deadline is deleted when the delivery is returned
+	deadline := strconv.FormatInt(time.Now().Add(delivery.visibilityTimeout).UnixNano(), 10)
+	touched, _ := delivery.redisClient.HSetXX(delivery.deadlinesKey, delivery.unackedValue(), deadline)
+	return touched
+}
+
+// claim sets the visibility deadline of the delivery to timeout from now
+func (delivery *wrapDelivery) claim(deadlinesKey string, timeout time.Duration) bool {
+	delivery.deadlinesKey = deadlinesKey
+	delivery.visibilityTimeout = timeout
+	deadline := strconv.FormatInt(time.Now().Add(timeout).UnixNano(), 10)
+	return delivery.redisClient.HSet(deadlinesKey, delivery.unackedValue(), deadline)
+}
+
+// release deletes the visibility deadline of a settled delivery, packs
+// release theirs once all their deliveries are settled
+func (delivery *wrapDelivery) release() {
+	if delivery.deadlinesKey != "" && delivery.pack == nil {
+		delivery.redisClient.HDel(delivery.deadlinesKey, delivery.value)
+	}
+}
+
+// decode loads, verifies, decrypts and decompresses the payload as noted in
+// the envelope
+func (delivery *wrapDelivery) decode(options decodeOptions) error {
+	if delivery.envelope == nil {
+		if options.signingKey != nil {
+			return fmt.Errorf("rmq delivery not signed")
+		}
+		return nil
+	}
+
+	payload, err := delivery.envelope.decodePayload(options)
+	if err != nil {
+		return err
+	}
+	delivery.payload = payload
+	if delivery.envelope.Blob != "" {
+		delivery.blobStore = options.blobStore
+	}
+	return nil
+}
+
+func (delivery *wrapDelivery) record(field string) {
+	countVar(field, 1)
+	if delivery.metrics != nil {
+		delivery.metrics.settled(field)
+	}
+}
+
+// setDeliveryConsumer makes delivery record its ack, reject or push in the
+// metrics of the named consumer and records its latency
+func setDeliveryConsumer(delivery Delivery, name string, metrics *consumerMetrics) {
+	if wrapped, ok := delivery.(*wrapDelivery); ok {
+		wrapped.consumer = name
+		wrapped.metrics = metrics
+		wrapped.consumedAt = time.Now()
+		if latency, ok := wrapped.Latency(); ok {
+			metrics.latency(latency)
+		}
+	}
+}
+
+// setDeliverySettled makes delivery call onSettle when it gets acked,
+// rejected or pushed
+func setDeliverySettled(delivery Delivery, onSettle func()) {
+	if wrapped, ok := delivery.(*wrapDelivery); ok {
+		wrapped.onSettle = onSettle
+	}
+}
+
+// move replaces the delivery in the unacked list with value in the list at key
+func (delivery *wrapDelivery) move(key, value string) bool {
+	if delivery.autoAcked {
+		// there's no unacked entry to replace, just don't move it twice
+		if !atomic.CompareAndSwapInt32(&delivery.partSettled, 0, 1) {
+			return false
+		}
+		return delivery.redisClient.LPush(key, value)
+	}
+	if delivery.pack != nil {
+		return delivery.movePart(key, value)
+	}
+
+	// only push it if it's still unacked, so it's not duplicated if it was
+	// settled or returned already
+	if moved, _ := delivery.redisClient.LRemLPush(delivery.unackedKey, key, delivery.value, value); !moved {
 		return false
 	}
+	delivery.release()
 
-	// debug(fmt.Sprintf("delivery rejected %s", delivery)) // COMMENTOUT
+	delivery.debugf("delivery moved to %s %s", key, delivery)
 	return true
 }
+
+// pushedAt returns when the delivery was pushed to its queue, if known
+func (delivery *wrapDelivery) pushedAt() (time.Time, bool) {
+	if delivery.envelope == nil || delivery.envelope.Pushed == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, delivery.envelope.Pushed), true
+}
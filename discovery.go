@@ -0,0 +1,75 @@
+package rmq
+
+import "sort"
+
+// QueueInfo describes an open queue, see Connection.QueueInfos
+type QueueInfo struct {
+	Name          string `json:"name"`
+	ReadyCount    int    `json:"ready"`
+	RejectedCount int    `json:"rejected"`
+	Paused        bool   `json:"paused"`
+}
+
+// ConnectionInfo describes a connection and the queues it's consuming, see
+// Connection.ConnectionInfos
+type ConnectionInfo struct {
+	Name   string               `json:"name"`
+	Active bool                 `json:"active"` // false if its heartbeat expired
+	Queues []ConsumingQueueInfo `json:"queues"`
+}
+
+// ConsumingQueueInfo describes a queue consumed by a connection
+type ConsumingQueueInfo struct {
+	Name          string `json:"name"`
+	UnackedCount  int    `json:"unacked"`
+	ConsumerCount int    `json:"consumers"`
+}
+
+// QueueInfos returns all open queues with their current counts, sorted by
+// name
+func (connection *redisConnection) QueueInfos() []QueueInfo {
+	names := connection.GetOpenQueues()
+	sort.Strings(names)
+
+	infos := make([]QueueInfo, 0, len(names))
+	for _, name := range names {
+		queue := connection.openQueue(name)
+		infos = append(infos, QueueInfo{
+			Name:          name,
+			ReadyCount:    queue.ReadyCount(),
+			RejectedCount: queue.RejectedCount(),
+			Paused:        queue.Paused(),
+		})
+	}
+	return infos
+}
+
+// ConnectionInfos returns all connections with the queues they are consuming,
+// sorted by name
+func (connection *redisConnection) ConnectionInfos() []ConnectionInfo {
+	names := connection.GetConnections()
+	sort.Strings(names)
+
+	infos := make([]ConnectionInfo, 0, len(names))
+	for _, name := range names {
+		hijacked := connection.hijackConnection(name)
+		info := ConnectionInfo{
+			Name:   name,
+			Active: hijacked.Check(),
+			Queues: []ConsumingQueueInfo{},
+		}
+
+		queueNames := hijacked.GetConsumingQueues()
+		sort.Strings(queueNames)
+		for _, queueName := range queueNames {
+			queue := hijacked.openQueue(queueName)
+			info.Queues = append(info.Queues, ConsumingQueueInfo{
+				Name:          queueName,
+				UnackedCount:  queue.UnackedCount(),
+				ConsumerCount: len(queue.GetConsumers()),
+			})
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
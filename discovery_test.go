@@ -0,0 +1,53 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestDiscoverySuite(t *testing.T) {
+	TestingSuiteT(&DiscoverySuite{}, t)
+}
+
+type DiscoverySuite struct{}
+
+func (suite *DiscoverySuite) TestInfos(c *C) {
+	connection := OpenConnection("discovery-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("discovery-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.Publish("discovery-d1")
+	queue.Publish("discovery-d2")
+
+	found := false
+	for _, info := range connection.QueueInfos() {
+		if info.Name == "discovery-q" {
+			found = true
+			c.Check(info, DeepEquals, QueueInfo{Name: "discovery-q", ReadyCount: 2})
+		}
+	}
+	c.Check(found, Equals, true)
+
+	consumer := NewTestConsumer("discovery-A")
+	consumer.AutoAck = false
+	queue.StartConsuming(1, time.Millisecond)
+	queue.AddConsumer("discovery-cons", consumer)
+	time.Sleep(10 * time.Millisecond)
+
+	found = false
+	for _, info := range connection.ConnectionInfos() {
+		if info.Name == connection.Name {
+			found = true
+			c.Check(info.Active, Equals, true)
+			c.Check(info.Queues, DeepEquals, []ConsumingQueueInfo{
+				{Name: "discovery-q", UnackedCount: 2, ConsumerCount: 1},
+			})
+		}
+	}
+	c.Check(found, Equals, true)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,95 @@
+package rmq
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// KeyProvider provides AES keys to encrypt payloads with, see SetEncryption.
+// Keys have IDs which are stored in the envelope, so keys can be rotated by
+// changing the encryption key while keeping the old ones for decryption.
+type KeyProvider interface {
+	// EncryptionKey returns the key to encrypt new payloads with
+	EncryptionKey() (id string, key []byte, err error)
+	// DecryptionKey returns the key with the given ID
+	DecryptionKey(id string) (key []byte, err error)
+}
+
+// StaticKeyProvider provides keys from a fixed set
+type StaticKeyProvider struct {
+	encryptionID string
+	keys         map[string][]byte
+}
+
+// NewStaticKeyProvider returns a provider which encrypts with the key with ID
+// encryptionID and decrypts with all keys. Keys must be 16, 24 or 32 bytes
+// long to select AES-128, AES-192 or AES-256.
+func NewStaticKeyProvider(encryptionID string, keys map[string][]byte) *StaticKeyProvider {
+	return &StaticKeyProvider{encryptionID: encryptionID, keys: keys}
+}
+
+func (provider *StaticKeyProvider) EncryptionKey() (string, []byte, error) {
+	key, err := provider.DecryptionKey(provider.encryptionID)
+	return provider.encryptionID, key, err
+}
+
+func (provider *StaticKeyProvider) DecryptionKey(id string) ([]byte, error) {
+	key, ok := provider.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("rmq key provider has no key %s", id)
+	}
+	return key, nil
+}
+
+// encryptPayload encrypts payload with AES-GCM, the random nonce is prepended
+// to the returned ciphertext
+func encryptPayload(keys KeyProvider, payload []byte) (keyID string, ciphertext []byte, err error) {
+	keyID, key, err := keys.EncryptionKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return keyID, aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+func decryptPayload(keys KeyProvider, keyID string, ciphertext []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("rmq payload is encrypted, but no key provider is set")
+	}
+
+	key, err := keys.DecryptionKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("rmq encrypted payload too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,83 @@
+package rmq
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestEncryptionSuite(t *testing.T) {
+	TestingSuiteT(&EncryptionSuite{}, t)
+}
+
+type EncryptionSuite struct{}
+
+func (suite *EncryptionSuite) TestRotation(c *C) {
+	key1, key2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	old := NewStaticKeyProvider("k1", map[string][]byte{"k1": key1})
+	keyID, ciphertext, err := encryptPayload(old, []byte("secret"))
+	c.Assert(err, IsNil)
+	c.Check(keyID, Equals, "k1")
+	c.Check(bytes.Contains(ciphertext, []byte("secret")), Equals, false)
+
+	rotated := NewStaticKeyProvider("k2", map[string][]byte{"k1": key1, "k2": key2})
+	payload, err := decryptPayload(rotated, keyID, ciphertext)
+	c.Check(err, IsNil)
+	c.Check(string(payload), Equals, "secret")
+
+	keyID, _, err = encryptPayload(rotated, []byte("secret"))
+	c.Check(err, IsNil)
+	c.Check(keyID, Equals, "k2")
+
+	_, err = decryptPayload(NewStaticKeyProvider("k1", map[string][]byte{"k1": key2}), "k1", ciphertext)
+	c.Check(err, NotNil) // wrong key
+	_, err = decryptPayload(rotated, "k3", ciphertext)
+	c.Check(err, NotNil) // unknown key
+	_, err = decryptPayload(rotated, "k1", ciphertext[:5])
+	c.Check(err, NotNil)
+}
+
+func (suite *EncryptionSuite) TestQueue(c *C) {
+	connection := OpenConnection("encryption-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("encryption-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	keys := NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	queue.SetEncryption(keys)
+	queue.SetCompression(GzipCompression, 100)
+
+	large := strings.Repeat("encryption-d2 ", 100)
+	c.Check(queue.Publish("encryption-d1"), Equals, true)
+	c.Check(queue.PublishBytes([]byte(large)), Equals, true)
+	for _, value := range queue.redisClient.LRange(queue.readyKey, 0, -1) {
+		c.Check(strings.Contains(value, "encryption-d"), Equals, false)
+	}
+
+	queue.SetEncryption(nil) // consumer without keys
+	consumer := NewTestConsumer("encryption-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("encryption-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 0)
+	c.Check(queue.RejectedCount(), Equals, 2)
+	queue.StopConsuming()
+
+	connection.StopHeartbeat()
+	connection = OpenConnection("encryption-conn", "tcp", "localhost:6379", 1) // the stopped queue can't consume again
+	queue = connection.OpenQueue("encryption-q").(*redisQueue)
+	queue.SetEncryption(keys)
+	queue.ReturnAllRejected()
+	consumer = NewTestConsumer("encryption-B")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("encryption-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+	c.Check(consumer.LastDeliveries[0].Payload(), Equals, "encryption-d1")
+	c.Check(consumer.LastDeliveries[1].Payload(), Equals, large)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,190 @@
+package rmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/adjust/uniuri"
+)
+
+// envelopePrefix marks values in Redis which wrap the payload in an envelope
+// with metadata. Values without it are raw payloads.
+const envelopePrefix = "\x00rmq2:"
+
+// envelope wraps a payload with metadata. It is stored in Redis as
+// envelopePrefix followed by the JSON representation of the metadata, a
+// newline and the raw payload bytes.
+type envelope struct {
+	ID          string            `json:"id"`
+	Published   int64             `json:"published"` // unix nanoseconds
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"type,omitempty"`        // content type of the codec
+	Encoding    string            `json:"encoding,omitempty"`    // name of the payload compression
+	Blob        string            `json:"blob,omitempty"`        // key of the payload in the blob store
+	Key         string            `json:"key,omitempty"`         // ID of the encryption key
+	Signature   string            `json:"sig,omitempty"`         // see sign
+	Hops        int               `json:"hops,omitempty"`        // number of pushes, see SetMaxHops
+	Pushed      int64             `json:"pushed,omitempty"`      // unix nanoseconds of the last counted push
+	Redelivered int               `json:"redelivered,omitempty"` // number of returns to ready after it was fetched
+	Packed      int               `json:"packed,omitempty"`      // number of values packed into the payload, see SetPackSize
+	Expires     int64             `json:"expires,omitempty"`     // unix nanoseconds after which it's rejected, see SetMessageTTL
+	Payload     string            `json:"-"`                     // follows the JSON, see encode
+}
+
+func newEnvelope(payload string) *envelope {
+	return &envelope{
+		ID:        uniuri.NewLen(20),
+		Published: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// decodeEnvelope returns the envelope stored in value, returns false if value
+// is a raw payload
+func decodeEnvelope(value string) (*envelope, bool) {
+	if !strings.HasPrefix(value, envelopePrefix) {
+		return nil, false
+	}
+
+	env := &envelope{}
+	value = value[len(envelopePrefix):]
+	newline := strings.IndexByte(value, '\n') // JSON escapes newlines in strings
+	if newline < 0 {
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(value[:newline]), env); err != nil {
+		return nil, false
+	}
+	env.Payload = value[newline+1:]
+	return env, true
+}
+
+// encode returns the envelope as stored in Redis
+func (env *envelope) encode() string {
+	builder := env.encodeHeader(len(env.Payload))
+	builder.WriteString(env.Payload)
+	return builder.String()
+}
+
+// encodeBytes is like encode, but takes the payload from bytes which are
+// copied only once
+func (env *envelope) encodeBytes(payload []byte) string {
+	builder := env.encodeHeader(len(payload))
+	builder.Write(payload)
+	return builder.String()
+}
+
+// encodeHeader returns a builder with everything but the payload, grown to
+// fit a payload of payloadSize bytes
+func (env *envelope) encodeHeader(payloadSize int) *strings.Builder {
+	bytes, err := json.Marshal(env)
+	if err != nil {
+		log.Panicf("rmq failed to encode envelope %s", err) // can't happen, all fields are strings or numbers
+	}
+
+	builder := &strings.Builder{}
+	builder.Grow(len(envelopePrefix) + len(bytes) + 1 + payloadSize)
+	builder.WriteString(envelopePrefix)
+	builder.Write(bytes)
+	builder.WriteByte('\n')
+	return builder
+}
+
+// SplitEnvelope splits a value as returned by PeekReady or PeekRejected into
+// the JSON header of its envelope and the payload as stored, which may still
+// be compressed or encrypted. Returns false for payloads published without
+// envelope, which are returned as they are.
+func SplitEnvelope(value string) (header, payload string, ok bool) {
+	env, ok := decodeEnvelope(value)
+	if !ok {
+		return "", value, false
+	}
+	payload = env.Payload
+	env.Payload = ""
+	bytes, err := json.Marshal(env)
+	if err != nil {
+		return "", value, false
+	}
+	return string(bytes), payload, true
+}
+
+// deliveryID returns the ID in the envelope of value, or value itself for
+// raw payloads which have no ID
+func deliveryID(value string) string {
+	if env, ok := decodeEnvelope(value); ok {
+		return env.ID
+	}
+	return value
+}
+
+func (env *envelope) publishedAt() time.Time {
+	return time.Unix(0, env.Published)
+}
+
+// decodeOptions configure how payloads are decoded, they need to match the
+// settings of the producing queue
+type decodeOptions struct {
+	blobStore  BlobStore
+	keys       KeyProvider
+	signingKey []byte // if set, unsigned payloads can't be decoded
+}
+
+// decodePayload loads the payload from the blob store, verifies the
+// signature, decrypts and decompresses it, reverting the steps of Publish
+func (env *envelope) decodePayload(options decodeOptions) (string, error) {
+	if env.Blob == "" && env.Key == "" && env.Encoding == "" && options.signingKey == nil {
+		return env.Payload, nil
+	}
+
+	payload := []byte(env.Payload)
+	if env.Blob != "" {
+		if options.blobStore == nil {
+			return "", fmt.Errorf("rmq envelope payload is in a blob store, but none is set")
+		}
+		blob, err := options.blobStore.Get(env.Blob)
+		if err != nil {
+			return "", err
+		}
+		payload = blob
+	}
+
+	if options.signingKey != nil && !env.verify(options.signingKey, payload) {
+		return "", fmt.Errorf("rmq envelope signature invalid")
+	}
+
+	if env.Key != "" {
+		decrypted, err := decryptPayload(options.keys, env.Key, payload)
+		if err != nil {
+			return "", err
+		}
+		payload = decrypted
+	}
+
+	if env.Encoding != "" {
+		compression, ok := lookupCompression(env.Encoding)
+		if !ok {
+			return "", fmt.Errorf("rmq envelope compression %s not registered", env.Encoding)
+		}
+		decompressed, err := compression.Decompress(payload)
+		if err != nil {
+			return "", err
+		}
+		payload = decompressed
+	}
+
+	return string(payload), nil
+}
+
+// unwrapPayload returns the payload of value, no matter if it's wrapped in an
+// envelope or not. Returns value if the payload can't be decoded
+func unwrapPayload(value string) string {
+	if env, ok := decodeEnvelope(value); ok {
+		if payload, err := env.decodePayload(decodeOptions{}); err == nil {
+			return payload
+		}
+	}
+	return value
+}
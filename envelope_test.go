@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestEnvelopeSuite(t *testing.T) {
+	TestingSuiteT(&EnvelopeSuite{}, t)
+}
+
+type EnvelopeSuite struct{}
+
+func (suite *EnvelopeSuite) TestBinarySafe(c *C) {
+	payload := "\xff\x00\n{\"payload\":1}\n"
+	env, ok := decodeEnvelope(newEnvelope(payload).encode())
+	c.Assert(ok, Equals, true)
+	c.Check(env.Payload, Equals, payload)
+
+	env, ok = decodeEnvelope(newEnvelope("").encodeBytes([]byte(payload)))
+	c.Assert(ok, Equals, true)
+	c.Check(env.Payload, Equals, payload)
+
+	_, ok = decodeEnvelope(payload)
+	c.Check(ok, Equals, false)
+}
+
+func (suite *EnvelopeSuite) TestSplitEnvelope(c *C) {
+	env := newEnvelope("split-p\n")
+	env.Headers = map[string]string{"k": "v"}
+	header, payload, ok := SplitEnvelope(env.encode())
+	c.Assert(ok, Equals, true)
+	c.Check(header, Matches, `\{"id":"`+env.ID+`",.*"headers":\{"k":"v"\}\}`)
+	c.Check(payload, Equals, "split-p\n")
+
+	header, payload, ok = SplitEnvelope("split-raw")
+	c.Check(ok, Equals, false)
+	c.Check(header, Equals, "")
+	c.Check(payload, Equals, "split-raw")
+}
+
+func (suite *EnvelopeSuite) TestPublishBytes(c *C) {
+	connection := OpenConnection("envelope-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("envelope-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetEnvelope(true)
+
+	payload := []byte{0xff, 0x00, '\n', 0x80}
+	c.Check(queue.PublishBytes(payload), Equals, true)
+
+	consumer := NewTestConsumer("envelope-A")
+	consumer.AutoAck = true
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("envelope-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDelivery, NotNil)
+	c.Check(consumer.LastDelivery.PayloadBytes(), DeepEquals, payload)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -13,12 +13,20 @@ func main() {
 	connection := rmq.OpenConnection("consumer", "tcp", "localhost:6379", 2)
 
 	queue := connection.OpenQueue("things")
-	queue.StartConsuming(unackedLimit, 500*time.Millisecond)
-	queue.AddBatchConsumer("things", 111, NewBatchConsumer("things"))
+	if err := queue.StartConsuming(unackedLimit, 500*time.Millisecond); err != nil {
+		log.Fatalf("failed to start consuming: %s", err)
+	}
+	if _, err := queue.AddBatchConsumer("things", 111, NewBatchConsumer("things")); err != nil {
+		log.Fatalf("failed to add consumer: %s", err)
+	}
 
 	queue = connection.OpenQueue("balls")
-	queue.StartConsuming(unackedLimit, 500*time.Millisecond)
-	queue.AddBatchConsumer("balls", 111, NewBatchConsumer("balls"))
+	if err := queue.StartConsuming(unackedLimit, 500*time.Millisecond); err != nil {
+		log.Fatalf("failed to start consuming: %s", err)
+	}
+	if _, err := queue.AddBatchConsumer("balls", 111, NewBatchConsumer("balls")); err != nil {
+		log.Fatalf("failed to add consumer: %s", err)
+	}
 
 	select {}
 }
@@ -17,10 +17,14 @@ const (
 func main() {
 	connection := rmq.OpenConnection("consumer", "tcp", "localhost:6379", 2)
 	queue := connection.OpenQueue("things")
-	queue.StartConsuming(unackedLimit, 500*time.Millisecond)
+	if err := queue.StartConsuming(unackedLimit, 500*time.Millisecond); err != nil {
+		log.Fatalf("failed to start consuming: %s", err)
+	}
 	for i := 0; i < numConsumers; i++ {
 		name := fmt.Sprintf("consumer %d", i)
-		queue.AddConsumer(name, NewConsumer(i))
+		if _, err := queue.AddConsumer(name, NewConsumer(i)); err != nil {
+			log.Fatalf("failed to add consumer: %s", err)
+		}
 	}
 	select {}
 }
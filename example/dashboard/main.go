@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/adjust/rmq"
+)
+
+func main() {
+	connection := rmq.OpenConnection("dashboard", "tcp", "localhost:6379", 2)
+	http.Handle("/", rmq.NewDashboard(connection, localOnly))
+	http.Handle("/api/", http.StripPrefix("/api", rmq.NewAdminAPI(connection, localOnly)))
+	fmt.Printf("Dashboard listening on http://localhost:3334/\n")
+	http.ListenAndServe(":3334", nil)
+}
+
+// localOnly only allows requests from localhost
+func localOnly(request *http.Request) bool {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
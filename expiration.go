@@ -0,0 +1,113 @@
+package rmq
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const activityInterval = time.Second // queues record their activity at most this often
+
+// SetIdleExpiration makes the cleaner remove the queue with all its
+// deliveries once nobody published to it or consumed it for expiration,
+// see Cleaner.ExpireIdleQueues. Only publishers and consumers which set an
+// expiration record their activity, consumers in other processes are
+// detected by the cleaner. Zero disables expiration.
+func (queue *redisQueue) SetIdleExpiration(expiration time.Duration) {
+	queue.activityMutex.Lock()
+	queue.idleExpiration = expiration
+	queue.activeAt = time.Time{}
+	queue.activityMutex.Unlock()
+
+	if expiration <= 0 {
+		queue.redisClient.HDel(expiringQueuesKey, queue.name)
+		queue.redisClient.HDel(queuesActivityKey, queue.name)
+		return
+	}
+	queue.markActive() // first, so the cleaner doesn't expire it right away
+	queue.redisClient.HSet(expiringQueuesKey, queue.name, strconv.FormatInt(int64(expiration), 10))
+}
+
+// markActive records the activity of a queue with idle expiration, at most
+// every activityInterval to not add a round trip to every publish
+func (queue *redisQueue) markActive() {
+	queue.activityMutex.Lock()
+	defer queue.activityMutex.Unlock()
+
+	if queue.idleExpiration <= 0 {
+		return
+	}
+	interval := queue.idleExpiration / 2
+	if interval > activityInterval {
+		interval = activityInterval
+	}
+	now := time.Now()
+	if now.Sub(queue.activeAt) < interval {
+		return
+	}
+
+	if queue.redisClient.HSet(queuesActivityKey, queue.name, strconv.FormatInt(now.UnixNano(), 10)) {
+		queue.activeAt = now
+	}
+}
+
+// ExpireIdleQueues removes queues with idle expiration which had no
+// publishes and no consumers for their expiration, see SetIdleExpiration.
+// Clean calls it too. Returns the number of removed queues.
+func (cleaner *Cleaner) ExpireIdleQueues() int {
+	expired := 0
+	for _, name := range cleaner.idleQueues() {
+		cleaner.connection.openQueue(name).expire()
+		expired++
+	}
+	return expired
+}
+
+// idleQueues returns the names of queues which expired, see ExpireIdleQueues
+func (cleaner *Cleaner) idleQueues() []string {
+	redisClient := cleaner.connection.redisClient
+	activity := redisClient.HGetAll(queuesActivityKey)
+
+	names := []string{}
+	for name, value := range redisClient.HGetAll(expiringQueuesKey) {
+		expiration, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		activeAt, _ := strconv.ParseInt(activity[name], 10, 64)
+		if time.Since(time.Unix(0, activeAt)) < time.Duration(expiration) {
+			continue
+		}
+		if cleaner.hasConsumers(name) {
+			continue
+		}
+
+		names = append(names, name)
+	}
+	return names
+}
+
+// hasConsumers returns true if any connection has consumers of the queue
+func (cleaner *Cleaner) hasConsumers(name string) bool {
+	for _, connectionName := range cleaner.connection.GetConnections() {
+		consumersKey := strings.Replace(connectionQueueConsumersTemplate, phConnection, connectionName, 1)
+		consumersKey = strings.Replace(consumersKey, phQueue, name, 1)
+		if len(cleaner.connection.redisClient.SMembers(consumersKey)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// expire removes the queue with its deliveries and all keys which aren't
+// bound to a connection
+func (queue *redisQueue) expire() {
+	queue.Close()
+	queue.redisClient.Del(queue.concurrencyKey)
+	queue.redisClient.Del(queue.consumerLockKey)
+	queue.redisClient.Del(queueHistoryKey(queue.name))
+	queue.redisClient.HDel(pausedQueuesKey, queue.name)
+	queue.redisClient.HDel(expiringQueuesKey, queue.name)
+	queue.redisClient.HDel(queuesActivityKey, queue.name)
+	queue.debugf("expired idle queue %s", queue)
+}
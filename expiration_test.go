@@ -0,0 +1,64 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestExpirationSuite(t *testing.T) {
+	TestingSuiteT(&ExpirationSuite{}, t)
+}
+
+type ExpirationSuite struct{}
+
+func (suite *ExpirationSuite) TestExpireIdleQueues(c *C) {
+	connection := OpenConnection("expiration-conn", "tcp", "localhost:6379", 1)
+	cleaner := NewCleaner(connection)
+	queue := connection.OpenQueue("expiration-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetIdleExpiration(100 * time.Millisecond)
+	queue.Publish("expiration-d")
+	c.Check(cleaner.ExpireIdleQueues(), Equals, 0)
+
+	time.Sleep(60 * time.Millisecond)
+	queue.Publish("expiration-d") // refreshes after half the expiration
+	time.Sleep(60 * time.Millisecond)
+	c.Check(cleaner.ExpireIdleQueues(), Equals, 0)
+
+	time.Sleep(150 * time.Millisecond)
+	c.Check(cleaner.ExpireIdleQueues(), Equals, 1)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	for _, name := range connection.GetOpenQueues() {
+		c.Check(name, Not(Equals), "expiration-q")
+	}
+	_, ok := connection.redisClient.HGet(expiringQueuesKey, "expiration-q")
+	c.Check(ok, Equals, false)
+
+	queue.SetIdleExpiration(0)
+	connection.StopHeartbeat()
+}
+
+func (suite *ExpirationSuite) TestConsumers(c *C) {
+	connection := OpenConnection("expiration-conn", "tcp", "localhost:6379", 1)
+	cleaner := NewCleaner(connection)
+	queue := connection.OpenQueue("expiration-consumed-q").(*redisQueue)
+	queue.SetIdleExpiration(10 * time.Millisecond)
+
+	// consumers which don't refresh the activity keep it too
+	consumerConnection := OpenConnection("expiration-consumer-conn", "tcp", "localhost:6379", 1)
+	consumed := consumerConnection.OpenQueue("expiration-consumed-q").(*redisQueue)
+	c.Assert(consumed.StartConsuming(10, time.Millisecond), IsNil)
+	name, err := consumed.AddConsumer("expiration-cons", NewTestConsumer("expiration-A"))
+	c.Assert(err, IsNil)
+
+	time.Sleep(20 * time.Millisecond)
+	c.Check(cleaner.ExpireIdleQueues(), Equals, 0)
+
+	consumed.StopConsuming()
+	c.Check(consumed.RemoveConsumer(name), Equals, true)
+	c.Check(cleaner.ExpireIdleQueues(), Equals, 1)
+	consumerConnection.StopHeartbeat()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,33 @@
+package rmq
+
+import "expvar"
+
+// internal counters of this process, published via expvar so they show up
+// in /debug/vars under "rmq"
+const (
+	varPublished   = "published"      // payloads pushed to ready lists
+	varConsumed    = "consumed"       // deliveries passed to consumers
+	varAcked       = metricAcked      // deliveries acked
+	varRejected    = metricRejected   // deliveries rejected
+	varPushed      = metricPushed     // deliveries pushed
+	varRedisErrors = "redis_errors"   // failed Redis commands
+	varBufferDrops = "buffer_dropped" // payloads dropped by full publish buffers
+	varExpired     = "expired"        // deliveries rejected because they expired
+	varQuarantined = "quarantined"    // deliveries quarantined after failing too often
+)
+
+var internalVars = expvar.NewMap("rmq")
+
+func init() {
+	for _, name := range []string{varPublished, varConsumed, varAcked, varRejected, varPushed, varRedisErrors, varBufferDrops, varExpired, varQuarantined} {
+		internalVars.Add(name, 0) // show all counters from the start
+	}
+}
+
+func countVar(name string, delta int) {
+	internalVars.Add(name, int64(delta))
+}
+
+func varValue(name string) int64 {
+	return internalVars.Get(name).(*expvar.Int).Value()
+}
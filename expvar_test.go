@@ -0,0 +1,42 @@
+package rmq
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestExpvarSuite(t *testing.T) {
+	TestingSuiteT(&ExpvarSuite{}, t)
+}
+
+type ExpvarSuite struct{}
+
+func (suite *ExpvarSuite) TestExpvar(c *C) {
+	c.Check(expvar.Get("rmq").(*expvar.Map).Get(varBufferDrops), NotNil)
+
+	connection := OpenConnection("expvar-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("expvar-q").(*redisQueue)
+	queue.PurgeReady()
+
+	published := varValue(varPublished)
+	consumed := varValue(varConsumed)
+	acked := varValue(varAcked)
+
+	c.Check(queue.Publish("expvar-d1"), Equals, true)
+	c.Check(queue.Publish("expvar-d2"), Equals, true)
+	c.Check(varValue(varPublished)-published >= 2, Equals, true)
+
+	queue.StartConsuming(10, time.Millisecond)
+	consumer := NewTestConsumer("expvar-cons")
+	queue.AddConsumer("expvar-cons", consumer)
+	time.Sleep(20 * time.Millisecond)
+	queue.StopConsuming()
+
+	// other suites' consumers may still be running, so only check the lower bound
+	c.Check(varValue(varConsumed)-consumed >= 2, Equals, true)
+	c.Check(varValue(varAcked)-acked >= 2, Equals, true)
+	connection.StopHeartbeat()
+}
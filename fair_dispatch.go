@@ -0,0 +1,147 @@
+package rmq
+
+import "time"
+
+// dispatchee is a consumer which gets its deliveries from the dispatcher
+type dispatchee struct {
+	deliveries chan Delivery // holds at most the one delivery in flight
+	busy       bool          // a delivery was dispatched and isn't consumed yet
+	assigned   int           // deliveries dispatched so far
+}
+
+// SetFairDispatch makes the queue hand each delivery to an idle consumer
+// which got the fewest deliveries so far, instead of to whichever consumer
+// reads the shared channel first. This spreads deliveries evenly over
+// consumers added with AddConsumer. Batch consumers and Deliveries() still
+// read from the shared channel. Call it before StartConsuming.
+func (queue *redisQueue) SetFairDispatch(enabled bool) {
+	queue.fairDispatch = enabled
+}
+
+// dispatch forwards deliveries from the delivery channel to consumers until
+// the queue stopped consuming. Started by StartConsuming.
+func (queue *redisQueue) dispatch() {
+	defer close(queue.dispatchDone)
+	deliveryChan := queue.getDeliveryChan()
+	for {
+		delivery, ok := <-deliveryChan
+		if !ok {
+			if next, ok := queue.nextDeliveryChan(deliveryChan); ok {
+				deliveryChan = next
+				continue
+			}
+			queue.closeDispatchees()
+			return
+		}
+
+		for !queue.dispatchTo(delivery) {
+			if queue.stoppedConsuming() && queue.dispatcheeCount() == 0 {
+				queue.returnToReady(delivery) // nobody left to consume it
+				break
+			}
+
+			// wait for a consumer to become idle
+			timer := time.NewTimer(queue.permitPollDuration())
+			select {
+			case <-queue.dispatchFreed:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}
+}
+
+// dispatchTo sends delivery to the idle consumer with the fewest assigned
+// deliveries, returns false if all are busy
+func (queue *redisQueue) dispatchTo(delivery Delivery) bool {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+
+	var chosen *dispatchee
+	for _, candidate := range queue.dispatchees {
+		if !candidate.busy && (chosen == nil || candidate.assigned < chosen.assigned) {
+			chosen = candidate
+		}
+	}
+	if chosen == nil {
+		return false
+	}
+
+	chosen.busy = true
+	chosen.assigned++
+	chosen.deliveries <- delivery // doesn't block as it's not busy, sent under lock so removeDispatchee sees it
+	return true
+}
+
+func (queue *redisQueue) dispatcheeCount() int {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+	return len(queue.dispatchees)
+}
+
+// addDispatchee registers a consumer and returns the channel it gets its
+// deliveries from
+func (queue *redisQueue) addDispatchee(name string) chan Delivery {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+
+	deliveries := make(chan Delivery, 1)
+	if queue.dispatchClosed {
+		close(deliveries)
+		return deliveries
+	}
+	queue.dispatchees[name] = &dispatchee{deliveries: deliveries}
+	queue.signalDispatchFreed()
+	return deliveries
+}
+
+// removeDispatchee unregisters a stopped consumer and returns the delivery
+// dispatched to it which it didn't take yet, if any
+func (queue *redisQueue) removeDispatchee(name string) (Delivery, bool) {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+
+	dispatchee, ok := queue.dispatchees[name]
+	if !ok {
+		return nil, false
+	}
+	delete(queue.dispatchees, name)
+
+	select {
+	case delivery, ok := <-dispatchee.deliveries:
+		return delivery, ok // not ok if closed
+	default:
+		return nil, false
+	}
+}
+
+// dispatchFinished marks the consumer idle again after it consumed its
+// delivery
+func (queue *redisQueue) dispatchFinished(name string) {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+
+	if dispatchee, ok := queue.dispatchees[name]; ok {
+		dispatchee.busy = false
+		queue.signalDispatchFreed()
+	}
+}
+
+func (queue *redisQueue) signalDispatchFreed() {
+	select {
+	case queue.dispatchFreed <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// closeDispatchees closes the channels of all consumers, they stop after
+// their last delivery
+func (queue *redisQueue) closeDispatchees() {
+	queue.dispatchMutex.Lock()
+	defer queue.dispatchMutex.Unlock()
+
+	queue.dispatchClosed = true
+	for _, dispatchee := range queue.dispatchees {
+		close(dispatchee.deliveries)
+	}
+}
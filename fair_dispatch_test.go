@@ -0,0 +1,76 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestFairDispatchSuite(t *testing.T) {
+	TestingSuiteT(&FairDispatchSuite{}, t)
+}
+
+type FairDispatchSuite struct{}
+
+func (suite *FairDispatchSuite) TestFairDispatch(c *C) {
+	connection := OpenConnection("fair-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("fair-q").(*redisQueue)
+	queue.PurgeReady()
+	for i := 0; i < 30; i++ {
+		queue.Publish("fair-d")
+	}
+
+	queue.SetFairDispatch(true)
+	queue.StartConsuming(30, time.Millisecond)
+	consumers := []*TestConsumer{}
+	for i := 0; i < 3; i++ {
+		consumer := NewTestConsumer("fair-cons")
+		consumer.SleepDuration = time.Millisecond
+		queue.AddConsumer("fair-cons", consumer)
+		consumers = append(consumers, consumer)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, consumer := range consumers {
+		c.Check(len(consumer.LastDeliveries) >= 8, Equals, true) // about 10 each
+	}
+	c.Check(queue.UnackedCount(), Equals, 0)
+
+	queue.StopConsuming()
+	time.Sleep(10 * time.Millisecond)
+	c.Check(queue.dispatcheeCount(), Equals, 3) // closed, not removed
+	connection.StopHeartbeat()
+}
+
+func (suite *FairDispatchSuite) TestRemoveBusyConsumer(c *C) {
+	connection := OpenConnection("fair-remove-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("fair-remove-q").(*redisQueue)
+	queue.PurgeReady()
+
+	queue.SetFairDispatch(true)
+	queue.StartConsuming(10, time.Millisecond)
+	consumer := NewTestConsumer("fair-remove-cons")
+	consumer.AutoFinish = false
+	name, _ := queue.AddConsumer("fair-remove-cons", consumer)
+	queue.Publish("fair-remove-d1")
+	queue.Publish("fair-remove-d2")
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 1) // the second waits for it
+	c.Check(queue.UnackedCount(), Equals, 1)
+
+	c.Check(queue.RemoveConsumer(name), Equals, true)
+	consumer.Finish()
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 1)
+	c.Check(queue.dispatcheeCount(), Equals, 0)
+
+	// the second delivery is handed to the next consumer
+	next := NewTestConsumer("fair-remove-next")
+	queue.AddConsumer("fair-remove-next", next)
+	time.Sleep(10 * time.Millisecond)
+	c.Check(next.LastDeliveries, HasLen, 1)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,73 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrReject makes consumers created by NewHandlerConsumer reject the
+	// delivery
+	ErrReject = errors.New("rmq reject delivery")
+	// ErrPushback makes consumers created by NewHandlerConsumer push the
+	// delivery, see Delivery.Push
+	ErrPushback = errors.New("rmq push delivery")
+)
+
+// HandlerFunc processes a delivery without settling it, see
+// NewHandlerConsumer
+type HandlerFunc func(ctx context.Context, delivery Delivery) error
+
+// RetryPolicy settles a delivery whose handler failed with err, returns
+// false if settling failed
+type RetryPolicy func(delivery Delivery, err error) bool
+
+// PushOnError pushes failed deliveries, so they are retried by the push
+// queue, see SetPushQueue and NewRetryTopology. Deliveries of queues without
+// push queue are rejected.
+func PushOnError(delivery Delivery, err error) bool {
+	return delivery.Push()
+}
+
+// RejectOnError rejects failed deliveries with the error as reason
+func RejectOnError(delivery Delivery, err error) bool {
+	return delivery.RejectWithReason(err.Error())
+}
+
+// handlerConsumer settles deliveries depending on the error of its handler
+type handlerConsumer struct {
+	handle HandlerFunc
+	retry  RetryPolicy
+}
+
+// NewHandlerConsumer returns a consumer which calls handle for each delivery
+// and settles it depending on the returned error: nil acks it, ErrReject
+// rejects it, ErrPushback pushes it and other errors are passed on to retry.
+// A nil retry policy defaults to PushOnError.
+func NewHandlerConsumer(handle HandlerFunc, retry RetryPolicy) Consumer {
+	if retry == nil {
+		retry = PushOnError
+	}
+	return &handlerConsumer{handle: handle, retry: retry}
+}
+
+func (consumer *handlerConsumer) Consume(delivery Delivery) {
+	consumer.ConsumeContext(context.Background(), delivery)
+}
+
+func (consumer *handlerConsumer) ConsumeContext(ctx context.Context, delivery Delivery) {
+	var ok bool
+	switch err := consumer.handle(ctx, delivery); err {
+	case nil:
+		ok = delivery.Ack()
+	case ErrReject:
+		ok = delivery.Reject()
+	case ErrPushback:
+		ok = delivery.Push()
+	default:
+		ok = consumer.retry(delivery, err)
+	}
+	if !ok {
+		logf("rmq handler consumer failed to settle delivery %s", delivery.Payload())
+	}
+}
@@ -0,0 +1,42 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestHandlerConsumerSuite(t *testing.T) {
+	TestingSuiteT(&HandlerConsumerSuite{}, t)
+}
+
+type HandlerConsumerSuite struct{}
+
+func (suite *HandlerConsumerSuite) TestSettle(c *C) {
+	failed := errors.New("handler failed")
+	handle := func(ctx context.Context, delivery Delivery) error {
+		switch delivery.Payload() {
+		case "reject":
+			return ErrReject
+		case "push":
+			return ErrPushback
+		case "fail":
+			return failed
+		}
+		return nil
+	}
+
+	consumer := NewHandlerConsumer(handle, nil)
+	for payload, state := range map[string]State{"ack": Acked, "reject": Rejected, "push": Pushed, "fail": Pushed} {
+		delivery := NewTestDelivery(payload)
+		consumer.Consume(delivery)
+		c.Check(delivery.State, Equals, state, Commentf("payload %s", payload))
+	}
+
+	delivery := NewTestDelivery("fail")
+	NewHandlerConsumer(handle, RejectOnError).Consume(delivery)
+	c.Check(delivery.State, Equals, Rejected)
+	c.Check(delivery.RejectReason, Equals, "handler failed")
+}
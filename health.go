@@ -0,0 +1,117 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	heartbeatStaleIntervals = 5               // missed heartbeats until the heartbeat is stale
+	pollStaleSlack          = 5 * time.Second // added to the max poll duration
+)
+
+// HealthReport is the result of Connection.Health
+type HealthReport struct {
+	Healthy        bool          `json:"healthy"`
+	RedisReachable bool          `json:"redis_reachable"`
+	HeartbeatAge   time.Duration `json:"heartbeat_age"` // since the last successful heartbeat
+	Queues         []QueueHealth `json:"queues"`        // queues consuming in this process
+	Problems       []string      `json:"problems,omitempty"`
+}
+
+// QueueHealth describes a queue which started consuming in this process
+type QueueHealth struct {
+	Name      string        `json:"name"`
+	Consuming bool          `json:"consuming"` // false after StopConsuming
+	PollAge   time.Duration `json:"poll_age"`  // since the consume loop last polled
+	Consumers int           `json:"consumers"` // running consumer goroutines
+}
+
+// Health checks that Redis is reachable, the heartbeat is fresh and the
+// consume loops of all queues consuming in this process are still polling
+func (connection *redisConnection) Health(ctx context.Context) HealthReport {
+	reportChan := make(chan HealthReport, 1)
+	go func() { reportChan <- connection.health() }()
+
+	select {
+	case report := <-reportChan:
+		return report
+	case <-ctx.Done():
+		return HealthReport{Problems: []string{fmt.Sprintf("health check aborted: %s", ctx.Err())}}
+	}
+}
+
+func (connection *redisConnection) health() HealthReport {
+	report := HealthReport{Queues: []QueueHealth{}}
+
+	if _, ok := connection.redisClient.TTL(connection.heartbeatKey); ok {
+		report.RedisReachable = true
+	} else {
+		report.Problems = append(report.Problems, "redis unreachable")
+	}
+
+	report.HeartbeatAge = time.Since(time.Unix(0, atomic.LoadInt64(&connection.heartbeatAt)))
+	if atomic.LoadInt32(&connection.heartbeatStopped) == 1 {
+		report.Problems = append(report.Problems, "heartbeat stopped")
+	} else if report.HeartbeatAge > connection.heartbeatStaleAfter() {
+		report.Problems = append(report.Problems, fmt.Sprintf("heartbeat stale for %s", report.HeartbeatAge))
+	}
+
+	connection.consumingMutex.Lock()
+	queues := append([]*redisQueue(nil), connection.consumingQueues...)
+	connection.consumingMutex.Unlock()
+
+	for _, queue := range queues {
+		health, problem := queue.health()
+		report.Queues = append(report.Queues, health)
+		if problem != "" {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	report.Healthy = len(report.Problems) == 0
+	return report
+}
+
+// health returns the state of the consume loop and a problem description if
+// it stopped polling
+func (queue *redisQueue) health() (health QueueHealth, problem string) {
+	queue.consumerStopsMutex.Lock()
+	consumers := len(queue.consumerStops)
+	queue.consumerStopsMutex.Unlock()
+
+	health = QueueHealth{
+		Name:      queue.name,
+		Consuming: !queue.stoppedConsuming(),
+		PollAge:   time.Since(time.Unix(0, atomic.LoadInt64(&queue.polledAt))),
+		Consumers: consumers,
+	}
+
+	maxPoll := queue.pollDuration
+	if queue.pollBackoffMax > maxPoll {
+		maxPoll = queue.pollBackoffMax
+	}
+	if health.Consuming && health.PollAge > 2*maxPoll+pollStaleSlack {
+		problem = fmt.Sprintf("queue %s not polled for %s", queue.name, health.PollAge)
+	}
+	return health, problem
+}
+
+// NewHealthHandler returns an http.Handler which responds with the health
+// report as JSON, with status 200 if healthy and 503 otherwise. Use it for
+// liveness and readiness probes.
+func NewHealthHandler(connection Connection) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		report := connection.Health(request.Context())
+
+		writer.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(writer).Encode(report)
+	})
+}
@@ -0,0 +1,53 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestHealthSuite(t *testing.T) {
+	TestingSuiteT(&HealthSuite{}, t)
+}
+
+type HealthSuite struct{}
+
+func (suite *HealthSuite) TestHealth(c *C) {
+	connection := OpenConnection("health-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("health-q").(*redisQueue)
+	queue.StartConsuming(10, time.Minute) // polls once
+	queue.AddConsumer("health-cons", NewTestConsumer("health-A"))
+	time.Sleep(5 * time.Millisecond)
+
+	report := connection.Health(context.Background())
+	c.Check(report.Problems, HasLen, 0)
+	c.Check(report.Healthy, Equals, true)
+	c.Check(report.RedisReachable, Equals, true)
+	c.Assert(report.Queues, HasLen, 1)
+	c.Check(report.Queues[0].Name, Equals, "health-q")
+	c.Check(report.Queues[0].Consuming, Equals, true)
+	c.Check(report.Queues[0].Consumers, Equals, 1)
+
+	// simulate a consume loop which got stuck
+	atomic.StoreInt64(&queue.polledAt, time.Now().Add(-time.Hour).UnixNano())
+	report = connection.Health(context.Background())
+	c.Check(report.Healthy, Equals, false)
+	c.Assert(report.Problems, HasLen, 1)
+	c.Check(report.Problems[0], Matches, "queue health-q not polled for 1h0m0.*s")
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+
+	recorder := httptest.NewRecorder()
+	NewHealthHandler(connection).ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	c.Check(recorder.Code, Equals, http.StatusServiceUnavailable)
+	c.Check(json.Unmarshal(recorder.Body.Bytes(), &report), IsNil)
+	c.Check(report.Problems, DeepEquals, []string{"heartbeat stopped"})
+	c.Check(report.Queues[0].Consuming, Equals, false)
+}
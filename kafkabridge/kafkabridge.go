@@ -0,0 +1,95 @@
+// Package kafkabridge connects rmq queues with Kafka topics, so pipelines can
+// use rmq as a lightweight work queue and Kafka as a durable log side by side.
+package kafkabridge
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/adjust/rmq"
+)
+
+// Mirror is an rmq.BatchConsumer which produces every delivery of a batch to
+// a Kafka topic. Deliveries are acked after Kafka acknowledged them and
+// rejected if producing failed, so each delivery ends up in the topic at least
+// once. The producer should be configured with Producer.Return.Successes.
+type Mirror struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewMirror returns a mirror producing to topic
+func NewMirror(producer sarama.SyncProducer, topic string) *Mirror {
+	return &Mirror{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Consume produces the batch in a single request and acks or rejects each
+// delivery depending on its result
+func (mirror *Mirror) Consume(batch rmq.Deliveries) {
+	messages := make([]*sarama.ProducerMessage, len(batch))
+	for i, delivery := range batch {
+		messages[i] = &sarama.ProducerMessage{
+			Topic:    mirror.topic,
+			Value:    sarama.StringEncoder(delivery.Payload()),
+			Metadata: i,
+		}
+	}
+
+	failed := map[int]bool{}
+	switch err := mirror.producer.SendMessages(messages).(type) {
+	case nil:
+	case sarama.ProducerErrors:
+		for _, producerError := range err {
+			failed[producerError.Msg.Metadata.(int)] = true
+		}
+	default:
+		batch.Reject()
+		return
+	}
+
+	for i, delivery := range batch {
+		if failed[i] {
+			delivery.Reject()
+		} else {
+			delivery.Ack()
+		}
+	}
+}
+
+// Receiver is a sarama.ConsumerGroupHandler which publishes every message of
+// the claimed partitions to an rmq queue. Messages are only marked as consumed
+// after they were published, so each message ends up in the queue at least
+// once.
+type Receiver struct {
+	queue rmq.Queue
+}
+
+// NewReceiver returns a receiver publishing to queue. Pass it to
+// sarama.ConsumerGroup.Consume.
+func NewReceiver(queue rmq.Queue) *Receiver {
+	return &Receiver{queue: queue}
+}
+
+// Setup implements sarama.ConsumerGroupHandler
+func (receiver *Receiver) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler
+func (receiver *Receiver) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim publishes the messages of claim until the session ends
+func (receiver *Receiver) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for message := range claim.Messages() {
+		if !receiver.queue.PublishBytes(message.Value) {
+			return fmt.Errorf("rmq kafka bridge failed to publish message %s/%d/%d", message.Topic, message.Partition, message.Offset)
+		}
+		session.MarkMessage(message, "")
+	}
+	return nil
+}
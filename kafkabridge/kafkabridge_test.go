@@ -0,0 +1,107 @@
+package kafkabridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+)
+
+func TestBridgeSuite(t *testing.T) {
+	TestingSuiteT(&BridgeSuite{}, t)
+}
+
+type BridgeSuite struct{}
+
+func expectValue(expected string) mocks.ValueChecker {
+	return func(value []byte) error {
+		if string(value) != expected {
+			return fmt.Errorf("produced %q instead of %q", value, expected)
+		}
+		return nil
+	}
+}
+
+func (suite *BridgeSuite) TestMirror(c *C) {
+	producer := mocks.NewSyncProducer(c, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(expectValue("kafka-d1"))
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(expectValue("kafka-d2"))
+
+	batch := rmq.Deliveries{rmq.NewTestDeliveryString("kafka-d1"), rmq.NewTestDeliveryString("kafka-d2")}
+	NewMirror(producer, "things").Consume(batch)
+	for _, delivery := range batch {
+		c.Check(delivery.(*rmq.TestDelivery).State, Equals, rmq.Acked)
+	}
+	c.Check(producer.Close(), IsNil)
+}
+
+func (suite *BridgeSuite) TestMirrorError(c *C) {
+	producer := mocks.NewSyncProducer(c, nil)
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndFail(errors.New("kafka unavailable"))
+
+	batch := rmq.Deliveries{rmq.NewTestDeliveryString("kafka-d1"), rmq.NewTestDeliveryString("kafka-d2")}
+	NewMirror(producer, "things").Consume(batch)
+	for _, delivery := range batch {
+		c.Check(delivery.(*rmq.TestDelivery).State, Equals, rmq.Rejected)
+	}
+	c.Check(producer.Close(), IsNil)
+}
+
+// fakeSession records the offsets of marked messages
+type fakeSession struct {
+	marked []int64
+}
+
+func (session *fakeSession) Claims() map[string][]int32               { return nil }
+func (session *fakeSession) MemberID() string                         { return "" }
+func (session *fakeSession) GenerationID() int32                      { return 0 }
+func (session *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (session *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (session *fakeSession) Context() context.Context                 { return context.Background() }
+func (session *fakeSession) MarkMessage(message *sarama.ConsumerMessage, _ string) {
+	session.marked = append(session.marked, message.Offset)
+}
+
+// fakeClaim holds a closed channel of messages
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (claim fakeClaim) Topic() string                            { return "things" }
+func (claim fakeClaim) Partition() int32                         { return 0 }
+func (claim fakeClaim) InitialOffset() int64                     { return 0 }
+func (claim fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (claim fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return claim.messages }
+
+// failingQueue fails to publish the payload "fail"
+type failingQueue struct {
+	*rmq.TestQueue
+}
+
+func (queue failingQueue) PublishBytes(payload []byte) bool {
+	if string(payload) == "fail" {
+		return false
+	}
+	return queue.TestQueue.PublishBytes(payload)
+}
+
+func (suite *BridgeSuite) TestReceiver(c *C) {
+	claim := fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "things", Offset: 1, Value: []byte("kafka-d1")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "things", Offset: 2, Value: []byte("fail")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "things", Offset: 3, Value: []byte("kafka-d3")}
+	close(claim.messages)
+
+	queue := failingQueue{rmq.NewTestQueue("kafka-q")}
+	session := &fakeSession{}
+	err := NewReceiver(queue).ConsumeClaim(session, claim)
+	c.Check(err, ErrorMatches, "rmq kafka bridge failed to publish message things/0/2")
+	c.Check(queue.LastDeliveries, DeepEquals, []string{"kafka-d1"})
+	c.Check(session.marked, DeepEquals, []int64{1}) // not marked, so it's consumed again
+}
@@ -0,0 +1,58 @@
+package rmq
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Logger receives the log messages of rmq, *log.Logger implements it
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+type loggerHolder struct {
+	logger Logger
+}
+
+var currentLogger atomic.Value // loggerHolder
+
+// SetLogger makes rmq log to logger instead of the standard logger. Pass
+// nil to restore the standard logger.
+func SetLogger(logger Logger) {
+	currentLogger.Store(loggerHolder{logger})
+}
+
+func logf(format string, args ...interface{}) {
+	if holder, ok := currentLogger.Load().(loggerHolder); ok && holder.logger != nil {
+		holder.logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// SetDebug logs what the queue and its deliveries are doing at debug level
+// through the logger, to troubleshoot a single queue in production. It can
+// be switched on and off at any time.
+func (queue *redisQueue) SetDebug(enabled bool) {
+	var debugging int32
+	if enabled {
+		debugging = 1
+	}
+	atomic.StoreInt32(&queue.debugging, debugging)
+}
+
+func (queue *redisQueue) debugf(format string, args ...interface{}) {
+	debugf(&queue.debugging, format, args...)
+}
+
+func (delivery *wrapDelivery) debugf(format string, args ...interface{}) {
+	if delivery.debugging != nil {
+		debugf(delivery.debugging, format, args...)
+	}
+}
+
+func debugf(debugging *int32, format string, args ...interface{}) {
+	if atomic.LoadInt32(debugging) == 1 {
+		logf("rmq debug: "+format, args...)
+	}
+}
@@ -0,0 +1,68 @@
+package rmq
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestLoggerSuite(t *testing.T) {
+	TestingSuiteT(&LoggerSuite{}, t)
+}
+
+type LoggerSuite struct{}
+
+// syncBuffer is a buffer which can be written by several goroutines
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *syncBuffer) take() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	defer buffer.buffer.Reset()
+	return buffer.buffer.String()
+}
+
+func (suite *LoggerSuite) TestDebug(c *C) {
+	buffer := &syncBuffer{}
+	SetLogger(log.New(buffer, "", 0))
+	defer SetLogger(nil)
+
+	connection := OpenConnection("debug-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("debug-q").(*redisQueue)
+	queue.PurgeReady()
+
+	queue.Publish("debug-d1")
+	c.Check(buffer.take(), Equals, "")
+
+	queue.SetDebug(true)
+	queue.Publish("debug-d2")
+	c.Check(buffer.take(), Matches, "rmq debug: publish debug-d2 .*\n")
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	buffer.take()
+	c.Check(delivery.Ack(), Equals, true)
+	c.Check(buffer.take(), Matches, "rmq debug: delivery acked .*\n")
+
+	queue.SetDebug(false)
+	queue.Publish("debug-d3")
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	delivery.Reject()
+	c.Check(buffer.take(), Equals, "")
+
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,120 @@
+package rmq
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const expiredReason = "rmq delivery expired"
+
+// SetMessageTTL makes Publish wrap payloads in an envelope which expires
+// after ttl. Consumers reject expired deliveries instead of passing them on,
+// with a reason starting with "rmq delivery expired". Zero disables it.
+func (queue *redisQueue) SetMessageTTL(ttl time.Duration) {
+	queue.messageTTL = ttl
+}
+
+// PublishWithTTL is like Publish, but the delivery expires after ttl, see
+// SetMessageTTL
+func (queue *redisQueue) PublishWithTTL(payload string, ttl time.Duration) bool {
+	if !queue.validate(payload, "") {
+		return false
+	}
+	env := newEnvelope("")
+	env.Expires = time.Now().Add(ttl).UnixNano()
+	if queue.shouldEncode(len(payload)) {
+		return queue.publishEncoded(env, []byte(payload))
+	}
+
+	env.Payload = payload
+	return queue.publishValue(env.encode())
+}
+
+// newEnvelope returns an envelope for payload which expires after the
+// message TTL of the queue
+func (queue *redisQueue) newEnvelope(payload string) *envelope {
+	env := newEnvelope(payload)
+	if queue.messageTTL > 0 {
+		env.Expires = time.Now().Add(queue.messageTTL).UnixNano()
+	}
+	return env
+}
+
+// expired returns true if the delivery has an expiration which passed
+func (delivery *wrapDelivery) expired() bool {
+	return delivery.envelope != nil && delivery.envelope.expired(time.Now())
+}
+
+func (env *envelope) expired(now time.Time) bool {
+	return env.Expires > 0 && now.UnixNano() > env.Expires
+}
+
+// rejectExpired rejects the delivery if it expired, returns false if it
+// didn't expire
+func (queue *redisQueue) rejectExpired(delivery *wrapDelivery) bool {
+	if !delivery.expired() {
+		return false
+	}
+	countVar(varExpired, 1)
+	delivery.RejectWithReason(expiredReason)
+	return true
+}
+
+// SetExpiredTrimInterval makes consuming queues call TrimExpired at most
+// every interval, so expired deliveries don't wait in long ready lists until
+// they are consumed. Zero disables it.
+func (queue *redisQueue) SetExpiredTrimInterval(interval time.Duration) {
+	queue.retentionMutex.Lock()
+	queue.expiredTrimInterval = interval
+	queue.retentionMutex.Unlock()
+}
+
+// TrimExpired scans the ready list in chunks and rejects the expired
+// deliveries, see SetMessageTTL. Returns the number of rejected deliveries.
+func (queue *redisQueue) TrimExpired() int {
+	queue.retentionMutex.Lock()
+	queue.expiredTrimmedAt = time.Now()
+	queue.retentionMutex.Unlock()
+
+	rejection, _ := json.Marshal(RejectionReason{Reason: expiredReason, RejectedAt: time.Now()})
+	trimmed := 0
+	kept := 0 // number of oldest deliveries which were checked and stay ready
+	for {
+		now := time.Now()
+		values := queue.redisClient.LRange(queue.readyKey, -kept-searchChunkSize, -kept-1)
+		for i := len(values) - 1; i >= 0; i-- {
+			env, ok := decodeEnvelope(values[i])
+			if !ok || !env.expired(now) || !queue.rejectReady(values[i]) {
+				kept++
+				continue
+			}
+			queue.redisClient.HSet(queue.reasonsKey, values[i], string(rejection))
+			trimmed++
+		}
+		if len(values) < searchChunkSize {
+			break
+		}
+	}
+
+	countVar(varExpired, trimmed)
+	queue.debugf("trimmed %d expired deliveries %s", trimmed, queue)
+	return trimmed
+}
+
+// rejectReady moves the ready delivery stored as value to rejected, returns
+// false if it isn't ready anymore
+func (queue *redisQueue) rejectReady(value string) bool {
+	moved, _ := queue.redisClient.LRemLPush(queue.readyKey, queue.rejectedKey, value, value)
+	return moved
+}
+
+// trimExpiredRegularly calls TrimExpired at most every expiredTrimInterval
+func (queue *redisQueue) trimExpiredRegularly() {
+	queue.retentionMutex.Lock()
+	due := queue.expiredTrimInterval > 0 && time.Since(queue.expiredTrimmedAt) >= queue.expiredTrimInterval
+	queue.retentionMutex.Unlock()
+
+	if due {
+		queue.TrimExpired()
+	}
+}
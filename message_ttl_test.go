@@ -0,0 +1,76 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestMessageTTLSuite(t *testing.T) {
+	TestingSuiteT(&MessageTTLSuite{}, t)
+}
+
+type MessageTTLSuite struct{}
+
+func (suite *MessageTTLSuite) TestConsume(c *C) {
+	connection := OpenConnection("ttl-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("ttl-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	expired := varValue(varExpired)
+
+	c.Check(queue.PublishWithTTL("ttl-expired", time.Millisecond), Equals, true)
+	c.Check(queue.PublishWithTTL("ttl-fresh", time.Hour), Equals, true)
+	queue.SetMessageTTL(time.Hour)
+	c.Check(queue.Publish("ttl-default"), Equals, true)
+	queue.SetMessageTTL(0)
+	time.Sleep(2 * time.Millisecond)
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "ttl-fresh")
+	c.Check(delivery.Ack(), Equals, true)
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "ttl-default")
+	c.Check(delivery.(*wrapDelivery).envelope.Expires > time.Now().UnixNano(), Equals, true)
+	c.Check(delivery.Ack(), Equals, true)
+
+	c.Check(queue.RejectedCount(), Equals, 1)
+	reason, ok := queue.RejectionReason(queue.PeekRejected(1)[0])
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, expiredReason)
+	c.Check(varValue(varExpired)-expired, Equals, int64(1))
+	connection.StopHeartbeat()
+}
+
+func (suite *MessageTTLSuite) TestTrimExpired(c *C) {
+	connection := OpenConnection("ttl-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("ttl-trim-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	c.Check(queue.Publish("ttl-raw"), Equals, true)
+	c.Check(queue.PublishWithTTL("ttl-expired-1", time.Millisecond), Equals, true)
+	c.Check(queue.PublishWithTTL("ttl-fresh", time.Hour), Equals, true)
+	c.Check(queue.PublishWithTTL("ttl-expired-2", time.Millisecond), Equals, true)
+	time.Sleep(2 * time.Millisecond)
+
+	queue.trimExpiredRegularly() // not enabled
+	c.Check(queue.ReadyCount(), Equals, 4)
+
+	queue.SetExpiredTrimInterval(time.Hour)
+	queue.trimExpiredRegularly()
+	c.Check(queue.ReadyCount(), Equals, 2)
+	c.Check(queue.RejectedCount(), Equals, 2)
+	c.Check(queue.TrimExpired(), Equals, 0)
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "ttl-raw")
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "ttl-fresh")
+	connection.StopHeartbeat()
+}
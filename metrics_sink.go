@@ -0,0 +1,139 @@
+package rmq
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsSink receives metrics from a MetricsReporter. Tags are "key:value"
+// pairs like "queue:things".
+type MetricsSink interface {
+	Gauge(name string, value float64, tags ...string)
+	Count(name string, delta int64, tags ...string)
+	Timing(name string, duration time.Duration, tags ...string)
+}
+
+// MetricsReporter regularly sends queue stats to a metrics sink, use it
+// with NewStatsDSink if you're not scraping with Prometheus
+type MetricsReporter struct {
+	connection   Connection
+	sink         MetricsSink
+	mutex        sync.Mutex
+	queues       []string // nil for all open queues
+	stopChan     chan struct{}
+	reportMutex  sync.Mutex              // serializes reports which update previous
+	previous     map[string]ConsumerStat // processing totals at the last report
+	redisErrors  int64                   // redis error count at the last report
+	reportedOnce bool
+}
+
+// NewMetricsReporter reports the stats of the queues passed to AddQueue to
+// sink, or of all open queues if none are added
+func NewMetricsReporter(connection Connection, sink MetricsSink) *MetricsReporter {
+	return &MetricsReporter{
+		connection: connection,
+		sink:       sink,
+		previous:   map[string]ConsumerStat{},
+	}
+}
+
+// AddQueue reports the stats of queue
+func (reporter *MetricsReporter) AddQueue(queue string) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.queues = append(reporter.queues, queue)
+}
+
+// Start reports every interval until Stop is called
+func (reporter *MetricsReporter) Start(interval time.Duration) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	if reporter.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	reporter.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reporter.Report()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the reporting started by Start
+func (reporter *MetricsReporter) Stop() {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	if reporter.stopChan == nil {
+		return
+	}
+	close(reporter.stopChan)
+	reporter.stopChan = nil
+}
+
+// Report sends the current stats to the sink. Queue depths are sent as
+// gauges, acks, rejects and pushes since the last report as counts and the
+// average processing time since the last report as timing. The first report
+// only records the totals to count from.
+func (reporter *MetricsReporter) Report() {
+	reporter.reportMutex.Lock()
+	defer reporter.reportMutex.Unlock()
+
+	reporter.mutex.Lock()
+	queues := reporter.queues
+	reporter.mutex.Unlock()
+	if queues == nil {
+		queues = reporter.connection.GetOpenQueues()
+	}
+
+	sink := reporter.sink
+	stats := reporter.connection.CollectStats(queues)
+	for queue, stat := range stats.QueueStats {
+		tag := "queue:" + queue
+		sink.Gauge("rmq.queue.ready", float64(stat.ReadyCount), tag)
+		sink.Gauge("rmq.queue.rejected", float64(stat.RejectedCount), tag)
+		sink.Gauge("rmq.queue.unacked", float64(stat.UnackedCount()), tag)
+		sink.Gauge("rmq.queue.consumers", float64(stat.ConsumerCount()), tag)
+		if stat.OldestReadyAge >= 0 {
+			sink.Gauge("rmq.queue.oldest_ready_age", stat.OldestReadyAge.Seconds(), tag)
+		}
+
+		processing := stat.ProcessingStat()
+		if previous, ok := reporter.previous[queue]; ok {
+			sink.Count("rmq.queue.acks", nonNegative(processing.Acked-previous.Acked), tag)
+			sink.Count("rmq.queue.rejects", nonNegative(processing.Rejected-previous.Rejected), tag)
+			sink.Count("rmq.queue.pushes", nonNegative(processing.Pushed-previous.Pushed), tag)
+			if calls := processing.calls - previous.calls; calls > 0 {
+				sink.Timing("rmq.queue.processing_time", (processing.durationSum-previous.durationSum)/time.Duration(calls), tag)
+			}
+		}
+		reporter.previous[queue] = processing
+	}
+
+	redisErrors := varValue(varRedisErrors)
+	if reporter.reportedOnce {
+		sink.Count("rmq.redis_errors", redisErrors-reporter.redisErrors)
+	}
+	reporter.redisErrors = redisErrors
+	reporter.reportedOnce = true
+}
+
+// nonNegative returns delta or zero if the totals dropped because consumers
+// were removed
+func nonNegative(delta int) int64 {
+	if delta < 0 {
+		return 0
+	}
+	return int64(delta)
+}
@@ -0,0 +1,105 @@
+package rmq
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestMetricsSinkSuite(t *testing.T) {
+	TestingSuiteT(&MetricsSinkSuite{}, t)
+}
+
+type MetricsSinkSuite struct{}
+
+// recordingSink records metrics as "name value tags" lines
+type recordingSink struct {
+	mutex   sync.Mutex
+	metrics []string
+}
+
+func (sink *recordingSink) record(name string, value interface{}, tags []string) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.metrics = append(sink.metrics, fmt.Sprintf("%s %v %v", name, value, tags))
+}
+
+func (sink *recordingSink) Gauge(name string, value float64, tags ...string) {
+	sink.record(name, value, tags)
+}
+
+func (sink *recordingSink) Count(name string, delta int64, tags ...string) {
+	sink.record(name, delta, tags)
+}
+
+func (sink *recordingSink) Timing(name string, duration time.Duration, tags ...string) {
+	sink.record(name, "timing", tags)
+}
+
+func (sink *recordingSink) recorded() []string {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]string(nil), sink.metrics...)
+}
+
+func (suite *MetricsSinkSuite) TestReporter(c *C) {
+	connection := OpenConnection("reporter-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("reporter-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("reporter-d1")
+
+	sink := &recordingSink{}
+	reporter := NewMetricsReporter(connection, sink)
+	reporter.AddQueue("reporter-q")
+	reporter.Report()
+	c.Check(sink.recorded(), DeepEquals, []string{
+		"rmq.queue.ready 1 [queue:reporter-q]",
+		"rmq.queue.rejected 0 [queue:reporter-q]",
+		"rmq.queue.unacked 0 [queue:reporter-q]",
+		"rmq.queue.consumers 0 [queue:reporter-q]",
+	})
+
+	sink.metrics = nil
+	reporter.Report()
+	c.Check(sink.recorded(), HasLen, 8)
+	c.Check(sink.recorded()[4], Equals, "rmq.queue.acks 0 [queue:reporter-q]")
+	c.Check(sink.recorded()[7], Matches, "rmq.redis_errors \\d+ \\[\\]")
+
+	sink.metrics = nil
+	reporter.Start(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	reporter.Stop()
+	c.Check(len(sink.recorded()) > 0, Equals, true)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *MetricsSinkSuite) TestStatsDSink(c *C) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	sink, err := NewStatsDSink(listener.LocalAddr().String(), "env:test")
+	c.Assert(err, IsNil)
+	defer sink.Close()
+
+	sink.Gauge("rmq.queue.ready", 3, "queue:things")
+	sink.Count("rmq.queue.acks", 2)
+	sink.Timing("rmq.queue.processing_time", 1500*time.Microsecond)
+
+	buffer := make([]byte, 1024)
+	for _, expected := range []string{
+		"rmq.queue.ready:3|g|#env:test,queue:things",
+		"rmq.queue.acks:2|c|#env:test",
+		"rmq.queue.processing_time:1.5|ms|#env:test",
+	} {
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		c.Assert(err, IsNil)
+		c.Check(string(buffer[:n]), Equals, expected)
+	}
+}
@@ -0,0 +1,128 @@
+package rmq
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultMigrateBatchSize = 100
+
+// MigrateOptions configure Migrate
+type MigrateOptions struct {
+	BatchSize int                        // number of deliveries moved between progress reports, defaults to 100
+	Progress  func(moved, remaining int) // called after each batch if not nil
+}
+
+// Migrate moves all ready and rejected deliveries of source to the same
+// lists of destination, usually a queue with the same name opened on a
+// connection to another Redis. It returns the number of moved deliveries.
+//
+// Each delivery is first moved to a migrating list in the source Redis, then
+// pushed to destination and finally removed from the migrating list. If a
+// migration is interrupted, calling Migrate again resumes it by pushing the
+// leftovers of the migrating lists first. A delivery might be pushed twice if
+// the migration is interrupted right after pushing it, but none is lost.
+func Migrate(source, destination Queue, options MigrateOptions) (moved int, err error) {
+	sourceQueue, ok := source.(*redisQueue)
+	if !ok {
+		return 0, fmt.Errorf("rmq migrate needs a redis source queue, got %T", source)
+	}
+	destinationQueue, ok := destination.(*redisQueue)
+	if !ok {
+		return 0, fmt.Errorf("rmq migrate needs a redis destination queue, got %T", destination)
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultMigrateBatchSize
+	}
+
+	migrator := &migrator{
+		source:      sourceQueue,
+		destination: destinationQueue,
+		options:     options,
+	}
+
+	lists := []struct {
+		sourceKey, migratingKey, destinationKey string
+	}{
+		{sourceQueue.readyKey, strings.Replace(queueMigratingReadyTemplate, phQueue, sourceQueue.name, 1), destinationQueue.readyKey},
+		{sourceQueue.rejectedKey, strings.Replace(queueMigratingRejectedTemplate, phQueue, sourceQueue.name, 1), destinationQueue.rejectedKey},
+	}
+
+	// resume interrupted migrations before moving anything new
+	for _, list := range lists {
+		if err := migrator.resume(list.migratingKey, list.destinationKey); err != nil {
+			return migrator.moved, err
+		}
+	}
+
+	for _, list := range lists {
+		if err := migrator.migrate(list.sourceKey, list.migratingKey, list.destinationKey); err != nil {
+			return migrator.moved, err
+		}
+	}
+
+	return migrator.moved, nil
+}
+
+type migrator struct {
+	source      *redisQueue
+	destination *redisQueue
+	options     MigrateOptions
+	moved       int
+}
+
+// resume pushes the leftovers of an interrupted migration to destination
+func (migrator *migrator) resume(migratingKey, destinationKey string) error {
+	for {
+		values := migrator.source.redisClient.LRange(migratingKey, -1, -1)
+		if len(values) == 0 {
+			return nil
+		}
+		if err := migrator.push(values[0], migratingKey, destinationKey); err != nil {
+			return err
+		}
+	}
+}
+
+func (migrator *migrator) migrate(sourceKey, migratingKey, destinationKey string) error {
+	for {
+		batchMoved := 0
+		for ; batchMoved < migrator.options.BatchSize; batchMoved++ {
+			value, ok := migrator.source.redisClient.RPopLPush(sourceKey, migratingKey)
+			if !ok {
+				break // source is empty
+			}
+			if err := migrator.push(value, migratingKey, destinationKey); err != nil {
+				return err
+			}
+		}
+
+		if batchMoved > 0 {
+			migrator.report()
+		}
+		if batchMoved < migrator.options.BatchSize {
+			return nil
+		}
+	}
+}
+
+// push pushes value to destination and removes it from the migrating list
+func (migrator *migrator) push(value, migratingKey, destinationKey string) error {
+	if ok := migrator.destination.redisClient.LPush(destinationKey, value); !ok {
+		return fmt.Errorf("rmq migrate failed to push to %s", destinationKey)
+	}
+	if _, ok := migrator.source.redisClient.LRem(migratingKey, -1, value); !ok {
+		return fmt.Errorf("rmq migrate failed to remove from %s", migratingKey)
+	}
+	migrator.moved++
+	return nil
+}
+
+func (migrator *migrator) report() {
+	if migrator.options.Progress == nil {
+		return
+	}
+	readyCount, _ := migrator.source.redisClient.LLen(migrator.source.readyKey)
+	rejectedCount, _ := migrator.source.redisClient.LLen(migrator.source.rejectedKey)
+	migrator.options.Progress(migrator.moved, readyCount+rejectedCount)
+}
@@ -0,0 +1,49 @@
+package rmq
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestMigrateSuite(t *testing.T) {
+	TestingSuiteT(&MigrateSuite{}, t)
+}
+
+type MigrateSuite struct{}
+
+func (suite *MigrateSuite) TestMigrate(c *C) {
+	sourceConnection := OpenConnection("migrate-source", "tcp", "localhost:6379", 1)
+	destinationConnection := OpenConnectionWithTestRedisClient("migrate-destination")
+	source := sourceConnection.OpenQueue("migrate-q").(*redisQueue)
+	destination := destinationConnection.OpenQueue("migrate-q").(*redisQueue)
+	source.PurgeReady()
+	source.PurgeRejected()
+
+	for i := 0; i < 5; i++ {
+		source.Publish(fmt.Sprintf("migrate-d%d", i))
+	}
+	source.redisClient.LPush(source.rejectedKey, "migrate-r0")
+	// leftover of an interrupted migration
+	source.redisClient.LPush("rmq::queue::[migrate-q]::migrating::ready", "migrate-interrupted")
+
+	progress := []int{}
+	moved, err := Migrate(source, destination, MigrateOptions{
+		BatchSize: 2,
+		Progress: func(moved, remaining int) {
+			progress = append(progress, moved)
+		},
+	})
+	c.Check(err, IsNil)
+	c.Check(moved, Equals, 7)
+	c.Check(progress, DeepEquals, []int{3, 5, 6, 7})
+
+	c.Check(source.ReadyCount(), Equals, 0)
+	c.Check(source.RejectedCount(), Equals, 0)
+	c.Check(destination.PeekReady(6), DeepEquals, []string{"migrate-interrupted", "migrate-d0", "migrate-d1", "migrate-d2", "migrate-d3", "migrate-d4"})
+	c.Check(destination.PeekRejected(1), DeepEquals, []string{"migrate-r0"})
+
+	sourceConnection.StopHeartbeat()
+	destinationConnection.StopHeartbeat()
+}
@@ -0,0 +1,51 @@
+// Package msgpackcodec publishes and consumes MessagePack encoded objects
+// with rmq, which are smaller and faster to encode than JSON. Importing it
+// registers Codec, so deliveries published with PublishMsgpack or with Codec
+// set on the queue can be unmarshaled with Delivery.Unmarshal.
+package msgpackcodec
+
+import (
+	"fmt"
+
+	"github.com/adjust/rmq"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ContentType is stored with deliveries published with Codec
+const ContentType = "application/msgpack"
+
+// Codec marshals objects with MessagePack, struct fields can be renamed with
+// msgpack tags
+var Codec rmq.Codec = codec{}
+
+func init() {
+	rmq.RegisterCodec(Codec)
+}
+
+// PublishMsgpack publishes object encoded with MessagePack
+func PublishMsgpack(queue rmq.Queue, object interface{}) bool {
+	return queue.PublishObjectWith(Codec, object)
+}
+
+// UnmarshalMsgpack unmarshals the payload of delivery into object. It fails
+// if the delivery was published with another codec.
+func UnmarshalMsgpack(delivery rmq.Delivery, object interface{}) error {
+	if contentType := delivery.ContentType(); contentType != ContentType {
+		return fmt.Errorf("rmq msgpackcodec can't unmarshal content type %q", contentType)
+	}
+	return msgpack.Unmarshal(delivery.PayloadBytes(), object)
+}
+
+type codec struct{}
+
+func (codec) ContentType() string {
+	return ContentType
+}
+
+func (codec) Marshal(object interface{}) ([]byte, error) {
+	return msgpack.Marshal(object)
+}
+
+func (codec) Unmarshal(payload []byte, object interface{}) error {
+	return msgpack.Unmarshal(payload, object)
+}
@@ -0,0 +1,63 @@
+package msgpackcodec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+)
+
+func TestMsgpackSuite(t *testing.T) {
+	TestingSuiteT(&MsgpackSuite{}, t)
+}
+
+type MsgpackSuite struct{}
+
+type task struct {
+	Name  string `msgpack:"name"`
+	Count int    `msgpack:"count"`
+}
+
+func (suite *MsgpackSuite) TestCodec(c *C) {
+	c.Check(Codec.ContentType(), Equals, ContentType)
+
+	payload, err := Codec.Marshal(task{Name: "msgpack-t1", Count: 3})
+	c.Assert(err, IsNil)
+	decoded := task{}
+	c.Check(Codec.Unmarshal(payload, &decoded), IsNil)
+	c.Check(decoded, DeepEquals, task{Name: "msgpack-t1", Count: 3})
+
+	c.Check(Codec.Unmarshal([]byte{0xc1}, &decoded), NotNil) // never used by MessagePack
+}
+
+func (suite *MsgpackSuite) TestPublish(c *C) {
+	connection := rmq.OpenConnection("msgpack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("msgpack-q")
+	queue.PurgeReady()
+
+	c.Check(PublishMsgpack(queue, task{Name: "msgpack-d1", Count: 1}), Equals, true)
+	c.Check(queue.Publish(`{"name":"msgpack-d2"}`), Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	delivery, err := queue.Get(ctx)
+	c.Assert(err, IsNil)
+	c.Check(delivery.ContentType(), Equals, ContentType)
+	decoded := task{}
+	c.Check(UnmarshalMsgpack(delivery, &decoded), IsNil)
+	c.Check(decoded, DeepEquals, task{Name: "msgpack-d1", Count: 1})
+	decoded = task{}
+	c.Check(delivery.Unmarshal(&decoded), IsNil) // the codec is registered
+	c.Check(decoded.Name, Equals, "msgpack-d1")
+	c.Check(delivery.Ack(), Equals, true)
+
+	// published with another codec
+	delivery, err = queue.Get(ctx)
+	c.Assert(err, IsNil)
+	c.Check(UnmarshalMsgpack(delivery, &decoded), ErrorMatches, `rmq msgpackcodec can't unmarshal content type ""`)
+	c.Check(delivery.Ack(), Equals, true)
+
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package msgpackcodec
+
+import "github.com/adjust/rmq"
+
+// NewTypedQueue wraps queue to publish and consume objects of type T
+// encoded with MessagePack
+func NewTypedQueue[T any](queue rmq.Queue) *rmq.TypedQueue[T] {
+	return rmq.NewTypedQueue[T](queue, Codec)
+}
+
+// Unmarshal returns the object of type T in the payload of delivery, see
+// UnmarshalMsgpack
+func Unmarshal[T any](delivery rmq.Delivery) (T, error) {
+	var object T
+	err := UnmarshalMsgpack(delivery, &object)
+	return object, err
+}
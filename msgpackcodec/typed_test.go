@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package msgpackcodec
+
+import (
+	"context"
+	"time"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+)
+
+func (suite *MsgpackSuite) TestTypedQueue(c *C) {
+	connection := rmq.OpenConnection("msgpack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("msgpack-typed-q")
+	queue.PurgeReady()
+
+	typed := NewTypedQueue[task](queue)
+	c.Check(typed.Publish(task{Name: "msgpack-typed-d1", Count: 2}), Equals, true)
+	c.Check(queue.Publish("msgpack-typed-raw"), Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	delivery, err := queue.Get(ctx)
+	c.Assert(err, IsNil)
+	object, err := Unmarshal[task](delivery)
+	c.Check(err, IsNil)
+	c.Check(object, DeepEquals, task{Name: "msgpack-typed-d1", Count: 2})
+	c.Check(delivery.Ack(), Equals, true)
+
+	// bad payload
+	delivery, err = queue.Get(ctx)
+	c.Assert(err, IsNil)
+	object, err = Unmarshal[task](delivery)
+	c.Check(err, NotNil)
+	c.Check(object, DeepEquals, task{})
+	c.Check(delivery.Ack(), Equals, true)
+
+	connection.StopHeartbeat()
+}
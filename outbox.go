@@ -0,0 +1,178 @@
+package rmq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxRow is a payload an application stored in its outbox table in the
+// same transaction as the changes it announces
+type OutboxRow struct {
+	ID      string // unique per row
+	Queue   string // name of the queue to publish to
+	Payload string
+	Headers map[string]string // optional, see PublishWithHeaders
+}
+
+// Outbox is the outbox table of an application, see OutboxRelay
+type Outbox interface {
+	// Fetch returns up to limit of the oldest rows which weren't marked as
+	// published yet
+	Fetch(limit int) ([]OutboxRow, error)
+	// MarkPublished marks the rows as published, so Fetch doesn't return
+	// them anymore. Deleting them works too.
+	MarkPublished(ids []string) error
+}
+
+// OutboxRelay publishes the rows of an outbox table to their queues, so
+// payloads are published if and only if the database transaction storing
+// them commits. Each row is published exactly once: published rows are
+// recorded per queue in Redis atomically with the publish until the outbox
+// marked them as published, so rows fetched again after a failure are
+// skipped.
+type OutboxRelay struct {
+	connection *redisConnection
+	outbox     Outbox
+	batchSize  int
+	mutex      sync.Mutex
+	stopChan   chan struct{}
+	relayLock  sync.Mutex // serializes runs
+}
+
+// NewOutboxRelay returns a relay which publishes up to batchSize rows of
+// outbox per Fetch. Rows are published with the settings of the queues
+// opened on connection, like their envelope, encryption or validator.
+func NewOutboxRelay(connection *redisConnection, outbox Outbox, batchSize int) *OutboxRelay {
+	return &OutboxRelay{connection: connection, outbox: outbox, batchSize: batchSize}
+}
+
+// Start relays rows every interval until Stop is called. Errors are logged.
+func (relay *OutboxRelay) Start(interval time.Duration) {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+
+	if relay.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	relay.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := relay.Relay(); err != nil {
+					logf("rmq outbox relay failed: %s", err)
+				}
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the regular runs started by Start
+func (relay *OutboxRelay) Stop() {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+
+	if relay.stopChan == nil {
+		return
+	}
+	close(relay.stopChan)
+	relay.stopChan = nil
+}
+
+// Relay publishes the rows of the outbox until Fetch returns none and
+// returns the number of published rows. Rows which can't be published, like
+// ones rejected by the validator of their queue, stop it with an error.
+func (relay *OutboxRelay) Relay() (int, error) {
+	relay.relayLock.Lock()
+	defer relay.relayLock.Unlock()
+
+	published := 0
+	for {
+		rows, err := relay.outbox.Fetch(relay.batchSize)
+		if err != nil {
+			return published, err
+		}
+		if len(rows) == 0 {
+			return published, nil
+		}
+
+		count, err := relay.relayRows(rows)
+		published += count
+		if err != nil {
+			return published, err
+		}
+	}
+}
+
+// relayRows publishes the rows which weren't published before, marks all of
+// them as published and returns the number of published rows
+func (relay *OutboxRelay) relayRows(rows []OutboxRow) (int, error) {
+	published := 0
+	ids := make([]string, 0, len(rows))
+	queues := map[string]*redisQueue{}
+	for _, row := range rows {
+		queue, ok := queues[row.Queue]
+		if !ok {
+			queue = relay.connection.OpenQueue(row.Queue).(*redisQueue)
+			queues[row.Queue] = queue
+		}
+
+		pushed, err := queue.publishOnce(row)
+		if err != nil {
+			return published, err
+		}
+		if pushed {
+			published++
+		}
+		ids = append(ids, row.ID)
+	}
+
+	if err := relay.outbox.MarkPublished(ids); err != nil {
+		return published, err
+	}
+
+	// the outbox won't return them again
+	for _, row := range rows {
+		queues[row.Queue].redisClient.SRem(queues[row.Queue].outboxKey(), row.ID)
+	}
+	return published, nil
+}
+
+// publishOnce publishes the payload of row unless it was published before
+// and returns whether it was published
+func (queue *redisQueue) publishOnce(row OutboxRow) (bool, error) {
+	var value string
+	var ok bool
+	if len(row.Headers) == 0 {
+		value, ok = queue.encodeValue(row.Payload)
+	} else if queue.validate(row.Payload, "") {
+		env := queue.newEnvelope("")
+		env.Headers = row.Headers
+		value, ok = queue.encodePayload(env, []byte(row.Payload))
+	}
+	if !ok {
+		return false, fmt.Errorf("rmq failed to encode outbox row %s", row.ID)
+	}
+
+	pushed, ok := queue.redisClient.SAddLPush(queue.outboxKey(), row.ID, queue.readyKey, value)
+	if !ok {
+		return false, fmt.Errorf("rmq failed to publish outbox row %s", row.ID)
+	}
+	if pushed {
+		queue.published([]string{value})
+	}
+	return pushed, nil
+}
+
+func (queue *redisQueue) outboxKey() string {
+	return strings.Replace(queueOutboxTemplate, phQueue, queue.name, 1)
+}
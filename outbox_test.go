@@ -0,0 +1,111 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestOutboxSuite(t *testing.T) {
+	TestingSuiteT(&OutboxSuite{}, t)
+}
+
+type OutboxSuite struct{}
+
+type testOutbox struct {
+	mutex     sync.Mutex
+	rows      []OutboxRow
+	published map[string]bool
+	markErr   error // returned once by MarkPublished
+}
+
+func (outbox *testOutbox) Fetch(limit int) ([]OutboxRow, error) {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	rows := []OutboxRow{}
+	for _, row := range outbox.rows {
+		if !outbox.published[row.ID] && len(rows) < limit {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (outbox *testOutbox) MarkPublished(ids []string) error {
+	outbox.mutex.Lock()
+	defer outbox.mutex.Unlock()
+
+	if err := outbox.markErr; err != nil {
+		outbox.markErr = nil
+		return err
+	}
+	for _, id := range ids {
+		outbox.published[id] = true
+	}
+	return nil
+}
+
+func (suite *OutboxSuite) TestRelay(c *C) {
+	connection := OpenConnection("outbox-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("outbox-q").(*redisQueue)
+	other := connection.OpenQueue("outbox-other-q").(*redisQueue)
+	queue.PurgeReady()
+	other.PurgeReady()
+
+	outbox := &testOutbox{published: map[string]bool{}, markErr: errors.New("database down")}
+	for i := 0; i < 5; i++ {
+		outbox.rows = append(outbox.rows, OutboxRow{ID: fmt.Sprintf("outbox-%d", i), Queue: "outbox-q", Payload: fmt.Sprintf("outbox-d%d", i)})
+	}
+	outbox.rows = append(outbox.rows, OutboxRow{ID: "outbox-h", Queue: "outbox-other-q", Payload: "outbox-dh", Headers: map[string]string{"h": "v"}})
+	relay := NewOutboxRelay(connection, outbox, 4)
+
+	// rows published before the outbox failed aren't published again
+	published, err := relay.Relay()
+	c.Check(err, ErrorMatches, "database down")
+	c.Check(published, Equals, 4)
+	published, err = relay.Relay()
+	c.Check(err, IsNil)
+	c.Check(published, Equals, 2)
+	c.Check(queue.PeekReady(10), DeepEquals, []string{"outbox-d0", "outbox-d1", "outbox-d2", "outbox-d3", "outbox-d4"})
+	c.Check(connection.redisClient.SMembers(queue.outboxKey()), HasLen, 0)
+
+	delivery, err := other.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "outbox-dh")
+	c.Check(delivery.Header("h"), Equals, "v")
+	c.Check(delivery.Ack(), Equals, true)
+
+	published, err = relay.Relay()
+	c.Check(err, IsNil)
+	c.Check(published, Equals, 0)
+
+	outbox.mutex.Lock()
+	outbox.rows = append(outbox.rows, OutboxRow{ID: "outbox-5", Queue: "outbox-q", Payload: "outbox-d5"})
+	outbox.mutex.Unlock()
+	relay.Start(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	relay.Stop()
+	c.Check(queue.ReadyCount(), Equals, 6)
+
+	c.Check(len(outbox.published), Equals, 7)
+	connection.StopHeartbeat()
+}
+
+func (suite *OutboxSuite) TestInvalidRow(c *C) {
+	connection := OpenConnection("outbox-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("outbox-invalid-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetValidator(ValidJSON)
+
+	outbox := &testOutbox{published: map[string]bool{}, rows: []OutboxRow{{ID: "outbox-1", Queue: "outbox-invalid-q", Payload: "not json"}}}
+	_, err := NewOutboxRelay(connection, outbox, 10).Relay()
+	c.Check(err, ErrorMatches, "rmq failed to encode outbox row outbox-1")
+	c.Check(queue.ReadyCount(), Equals, 0)
+	connection.StopHeartbeat()
+}
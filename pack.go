@@ -0,0 +1,180 @@
+package rmq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// deliveryPack is a Redis list entry holding several deliveries, see
+// SetPackSize
+type deliveryPack struct {
+	value     string // as stored in the unacked list
+	remaining int32  // atomic, number of deliveries which aren't settled yet
+}
+
+// SetPackSize makes the publish buffer pack up to size buffered payloads into
+// a single Redis list entry, which saves memory and round trips for very
+// small payloads. Consumers unpack them into separate deliveries and the
+// entry is removed from unacked once all of them are settled. It has no
+// effect without a publish buffer, see SetPublishBufferSize. A size below two
+// disables packing. As the ready, unacked and rejected counts count entries,
+// only enable it once all consumers are up to date.
+func (queue *redisQueue) SetPackSize(size int) {
+	queue.packSize = size
+}
+
+// packValues packs values as stored in Redis into entries of up to size
+// values each
+func packValues(values []string, size int) []string {
+	if size < 2 || len(values) < 2 {
+		return values
+	}
+
+	packed := make([]string, 0, (len(values)+size-1)/size)
+	for len(values) > 0 {
+		n := size
+		if n > len(values) {
+			n = len(values)
+		}
+		if n == 1 {
+			packed = append(packed, values[0]) // not worth an envelope
+		} else {
+			packed = append(packed, encodePack(values[:n]))
+		}
+		values = values[n:]
+	}
+	return packed
+}
+
+// encodePack returns an envelope whose payload holds values, each prefixed
+// with its length
+func encodePack(values []string) string {
+	env := newEnvelope("")
+	env.Packed = len(values)
+
+	builder := strings.Builder{}
+	for _, value := range values {
+		builder.WriteString(strconv.Itoa(len(value)))
+		builder.WriteByte(':')
+		builder.WriteString(value)
+	}
+	env.Payload = builder.String()
+	return env.encode()
+}
+
+// decodePack returns the values packed into the payload of env
+func decodePack(env *envelope) ([]string, error) {
+	values := make([]string, 0, env.Packed)
+	payload := env.Payload
+	for len(payload) > 0 {
+		colon := strings.IndexByte(payload, ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("rmq pack truncated")
+		}
+		length, err := strconv.Atoi(payload[:colon])
+		if err != nil || length < 0 || length > len(payload)-colon-1 {
+			return nil, fmt.Errorf("rmq pack has invalid length %q", payload[:colon])
+		}
+		payload = payload[colon+1:]
+		values = append(values, payload[:length])
+		payload = payload[length:]
+	}
+
+	if len(values) != env.Packed {
+		return nil, fmt.Errorf("rmq pack holds %d deliveries instead of %d", len(values), env.Packed)
+	}
+	return values, nil
+}
+
+// unpack returns the deliveries packed into delivery. Deliveries which can't
+// be decoded are rejected.
+func (queue *redisQueue) unpack(delivery *wrapDelivery, options decodeOptions) ([]Delivery, error) {
+	values, err := decodePack(delivery.envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &deliveryPack{value: delivery.value, remaining: int32(len(values))}
+	deliveries := make([]Delivery, 0, len(values))
+	for _, value := range values {
+		part := newDelivery(value, delivery.unackedKey, delivery.rejectedKey, delivery.reasonsKey, delivery.pushKey, delivery.redisClient)
+		part.pack = pack
+		part.queueName = delivery.queueName
+		part.maxHops = delivery.maxHops
+		part.debugging = delivery.debugging
+		part.autoAcked = delivery.autoAcked
+		part.deadlinesKey = delivery.deadlinesKey
+		part.visibilityTimeout = delivery.visibilityTimeout
+		if part.envelope != nil {
+			part.envelope.Redelivered += delivery.envelope.Redelivered // the pack got redelivered
+		}
+		if queue.rejectExpired(part) {
+			continue
+		}
+		if err := part.decode(options); err != nil {
+			part.RejectWithReason(err.Error())
+			continue
+		}
+		if err := queue.validationError(part); err != nil {
+			part.RejectWithReason(err.Error())
+			continue
+		}
+		deliveries = append(deliveries, part)
+	}
+	return deliveries, nil
+}
+
+// settlePart marks a packed delivery as settled and removes its pack from
+// unacked once all deliveries of the pack are settled. Returns false if the
+// delivery was settled before or the pack was returned to ready meanwhile.
+func (delivery *wrapDelivery) settlePart() bool {
+	if !atomic.CompareAndSwapInt32(&delivery.partSettled, 0, 1) {
+		return false
+	}
+	return delivery.packSettled("", "")
+}
+
+// packSettled counts a settled delivery of the pack and pushes value to key
+// unless key is empty. Every part checks that the pack is still unacked in
+// the same script which pushes it, so no part is settled after the pack was
+// returned to ready. The last part also removes the pack from unacked.
+func (delivery *wrapDelivery) packSettled(key, value string) bool {
+	pack := delivery.pack
+	last := atomic.AddInt32(&pack.remaining, -1) == 0
+
+	settled, ok := delivery.redisClient.SettlePart(delivery.unackedKey, pack.value, key, value, last)
+	if !ok {
+		atomic.AddInt32(&pack.remaining, 1)
+		atomic.StoreInt32(&delivery.partSettled, 0)
+		return false
+	}
+	if last && delivery.deadlinesKey != "" {
+		delivery.redisClient.HDel(delivery.deadlinesKey, pack.value)
+	}
+	return settled
+}
+
+// unackedValue returns the value of the delivery in the unacked list, which
+// is its pack if it was packed
+func (delivery *wrapDelivery) unackedValue() string {
+	if delivery.pack != nil {
+		return delivery.pack.value
+	}
+	return delivery.value
+}
+
+// movePart is like move for packed deliveries, the pack stays in unacked
+// until all of its deliveries are settled
+func (delivery *wrapDelivery) movePart(key, value string) bool {
+	if !atomic.CompareAndSwapInt32(&delivery.partSettled, 0, 1) {
+		return false
+	}
+	if !delivery.packSettled(key, value) {
+		return false // the pack was returned meanwhile, don't duplicate it
+	}
+
+	delivery.debugf("packed delivery moved to %s %s", key, delivery)
+	return true
+}
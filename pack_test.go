@@ -0,0 +1,152 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPackSuite(t *testing.T) {
+	TestingSuiteT(&PackSuite{}, t)
+}
+
+type PackSuite struct{}
+
+func (suite *PackSuite) TestPackValues(c *C) {
+	values := []string{"pack-a", "", "12:pack\nb", newEnvelope("pack-c").encode()}
+	c.Check(packValues(values, 1), DeepEquals, values)
+
+	packed := packValues(values, 3)
+	c.Assert(packed, HasLen, 2)
+	c.Check(packed[1], Equals, values[3]) // single values aren't packed
+
+	env, ok := decodeEnvelope(packed[0])
+	c.Assert(ok, Equals, true)
+	c.Check(env.Packed, Equals, 3)
+	unpacked, err := decodePack(env)
+	c.Check(err, IsNil)
+	c.Check(unpacked, DeepEquals, values[:3])
+
+	env.Payload = "9:pack-a"
+	_, err = decodePack(env)
+	c.Check(err, ErrorMatches, "rmq pack has invalid length .*")
+}
+
+func (suite *PackSuite) TestPackedDeliveries(c *C) {
+	connection := OpenConnection("pack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("pack-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetPublishBufferSize(10, OverflowBlock)
+	queue.SetPublishLinger(50 * time.Millisecond)
+	queue.SetPackSize(3)
+
+	for _, payload := range []string{"pack-d1", "pack-d2", "pack-d3", "pack-d4", "pack-d5"} {
+		c.Check(queue.Publish(payload), Equals, true)
+	}
+	c.Assert(queue.Flush(context.Background()), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 2)
+
+	deliveries, err := queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 5)
+	for i, delivery := range deliveries {
+		c.Check(delivery.Payload(), Equals, []string{"pack-d1", "pack-d2", "pack-d3", "pack-d4", "pack-d5"}[i])
+	}
+	c.Check(queue.UnackedCount(), Equals, 2)
+
+	c.Check(deliveries[0].Ack(), Equals, true)
+	c.Check(deliveries[1].Ack(), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 2)
+	c.Check(deliveries[2].Reject(), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 1)
+	c.Check(queue.PeekRejected(1), DeepEquals, []string{"pack-d3"})
+
+	c.Check(deliveries[3].Ack(), Equals, true)
+	c.Check(deliveries[3].Ack(), Equals, false) // already settled
+	c.Check(deliveries[4].Push(), Equals, true) // rejected without push queue
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 2)
+	connection.StopHeartbeat()
+}
+
+func (suite *PackSuite) TestGetAndReturn(c *C) {
+	connection := OpenConnection("pack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("pack-get-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetPublishBufferSize(10, OverflowBlock)
+	queue.SetPublishLinger(50 * time.Millisecond)
+	queue.SetPackSize(3)
+	queue.SetEnvelope(true)
+
+	queue.Publish("pack-d1")
+	queue.Publish("pack-d2")
+	c.Assert(queue.Flush(context.Background()), IsNil)
+
+	// the rest of the pack is returned individually
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "pack-d1")
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(queue.UnackedCount(), Equals, 1)
+	c.Check(delivery.Ack(), Equals, true)
+	c.Check(queue.UnackedCount(), Equals, 0)
+
+	// redelivering the pack counts for all its deliveries
+	queue.PurgeReady()
+	queue.Publish("pack-d5")
+	queue.Publish("pack-d6")
+	c.Assert(queue.Flush(context.Background()), IsNil)
+	_, err = queue.GetBatch(context.Background(), 1)
+	c.Assert(err, IsNil)
+	c.Check(queue.ReturnAllUnacked(), Equals, 1)
+
+	deliveries, err := queue.GetBatch(context.Background(), 1)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	count, ok := deliveries[1].RedeliveryCount()
+	c.Check(ok, Equals, true)
+	c.Check(count, Equals, 1)
+	c.Check(deliveries.Ack(), Equals, 0) // none failed
+	c.Check(queue.UnackedCount(), Equals, 0)
+
+	// no part is settled once the pack was returned
+	queue.PurgeRejected()
+	queue.Publish("pack-d7")
+	queue.Publish("pack-d8")
+	c.Assert(queue.Flush(context.Background()), IsNil)
+	deliveries, err = queue.GetBatch(context.Background(), 1)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	c.Check(queue.ReturnAllUnacked(), Equals, 1)
+	c.Check(deliveries[0].Reject(), Equals, false)
+	c.Check(deliveries[1].Ack(), Equals, false)
+	c.Check(queue.RejectedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 1)
+	connection.StopHeartbeat()
+}
+
+func (suite *PackSuite) TestAckExcept(c *C) {
+	connection := OpenConnection("pack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("pack-ack-except-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetPublishBufferSize(10, OverflowBlock)
+	queue.SetPublishLinger(50 * time.Millisecond)
+	queue.SetPackSize(3)
+
+	for _, payload := range []string{"pack-d1", "pack-d2", "pack-d3"} {
+		c.Check(queue.Publish(payload), Equals, true)
+	}
+	c.Assert(queue.Flush(context.Background()), IsNil)
+
+	deliveries, err := queue.GetBatch(context.Background(), 1)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 3)
+	c.Check(deliveries.AckExcept([]int{1}, false), Equals, 0)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.PeekRejected(1), DeepEquals, []string{"pack-d2"})
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,81 @@
+package rmq
+
+import (
+	"fmt"
+	"time"
+)
+
+// partitionLease is how long a dead connection keeps its partitions
+const partitionLease = 30 * time.Second
+
+// PartitionedQueue is a queue split into partitions by key. Payloads with
+// the same key go to the same partition and are consumed one at a time in
+// publish order, while partitions are consumed in parallel. This gives per
+// entity ordering like Kafka partitions.
+type PartitionedQueue struct {
+	Partitions []Queue
+}
+
+// NewPartitionedQueue opens a queue for each partition named like
+// "name-partition-0". The number of partitions must not change while
+// payloads are queued, otherwise keys move to other partitions.
+func NewPartitionedQueue(connection Connection, name string, partitions int) *PartitionedQueue {
+	if partitions < 1 {
+		partitions = 1
+	}
+
+	partitioned := &PartitionedQueue{}
+	for i := 0; i < partitions; i++ {
+		partition := connection.OpenQueue(fmt.Sprintf("%s-partition-%d", name, i))
+		partition.SetSingleActiveConsumer(partitionLease)
+		partitioned.Partitions = append(partitioned.Partitions, partition)
+	}
+	return partitioned
+}
+
+// Partition returns the partition of key
+func (partitioned *PartitionedQueue) Partition(key string) Queue {
+	return partitioned.Partitions[keyIndex(key, len(partitioned.Partitions))]
+}
+
+// PublishWithKey publishes payload to the partition of key
+func (partitioned *PartitionedQueue) PublishWithKey(key, payload string) bool {
+	return partitioned.Partition(key).Publish(payload)
+}
+
+// StartConsuming starts consuming all partitions. Each partition is only
+// consumed by one connection at a time and prefetches a single delivery.
+// Deliveries left unacked by a dead connection are returned to ready by the
+// cleaner, so they may be consumed after later ones.
+func (partitioned *PartitionedQueue) StartConsuming(pollDuration time.Duration) error {
+	var firstErr error
+	for _, partition := range partitioned.Partitions {
+		if err := partition.StartConsuming(1, pollDuration); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StopConsuming stops consuming all partitions
+func (partitioned *PartitionedQueue) StopConsuming() bool {
+	ok := true
+	for _, partition := range partitioned.Partitions {
+		ok = partition.StopConsuming() && ok
+	}
+	return ok
+}
+
+// AddConsumer adds one consumer to each partition and returns their names.
+// Add it only once, more consumers per partition would break the ordering.
+func (partitioned *PartitionedQueue) AddConsumer(tag string, consumer Consumer) ([]string, error) {
+	names := []string{}
+	for _, partition := range partitioned.Partitions {
+		name, err := partition.AddConsumer(tag, consumer)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,69 @@
+package rmq
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPartitionedQueueSuite(t *testing.T) {
+	TestingSuiteT(&PartitionedQueueSuite{}, t)
+}
+
+type PartitionedQueueSuite struct{}
+
+// payloadsConsumer records payloads of deliveries from all partitions
+type payloadsConsumer struct {
+	mutex    sync.Mutex
+	payloads []string
+}
+
+func (consumer *payloadsConsumer) Consume(delivery Delivery) {
+	consumer.mutex.Lock()
+	consumer.payloads = append(consumer.payloads, delivery.Payload())
+	consumer.mutex.Unlock()
+	delivery.Ack()
+}
+
+func (suite *PartitionedQueueSuite) TestPartitionedQueue(c *C) {
+	connection := OpenConnection("partitioned-conn", "tcp", "localhost:6379", 1)
+	partitioned := NewPartitionedQueue(connection, "partitioned-q", 4)
+	c.Assert(partitioned.Partitions, HasLen, 4)
+	for _, partition := range partitioned.Partitions {
+		partition.PurgeReady()
+		partition.(*redisQueue).redisClient.Del(partition.(*redisQueue).consumerLockKey)
+	}
+	c.Check(partitioned.Partition("a"), Equals, partitioned.Partition("a"))
+
+	for i := 0; i < 5; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			c.Check(partitioned.PublishWithKey(key, fmt.Sprintf("%s %d", key, i)), Equals, true)
+		}
+	}
+	c.Check(partitioned.Partition("a").(*redisQueue).ReadyCount() >= 5, Equals, true)
+
+	consumer := &payloadsConsumer{}
+	c.Check(partitioned.StartConsuming(time.Millisecond), IsNil)
+	names, err := partitioned.AddConsumer("partitioned-cons", consumer)
+	c.Check(err, IsNil)
+	c.Check(names, HasLen, 4)
+	time.Sleep(50 * time.Millisecond)
+	consumer.mutex.Lock()
+	defer consumer.mutex.Unlock()
+	c.Assert(consumer.payloads, HasLen, 15)
+
+	next := map[string]int{}
+	for _, payload := range consumer.payloads {
+		var key string
+		var i int
+		fmt.Sscanf(payload, "%s %d", &key, &i)
+		c.Check(i, Equals, next[key]) // in publish order per key
+		next[key]++
+	}
+
+	partitioned.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,171 @@
+package rmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// PoisonReport describes why a delivery was quarantined, see
+// SetPoisonQuarantine
+type PoisonReport struct {
+	Attempts      int       `json:"attempts"`           // number of failed attempts to consume it
+	Failure       string    `json:"failure,omitempty"`  // panic or timeout of the last attempt, empty if its process died
+	Stack         string    `json:"stack,omitempty"`    // stack trace of the last panic
+	Consumer      string    `json:"consumer,omitempty"` // consumer of the last attempt
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// SetPoisonQuarantine makes consumers quarantine deliveries which failed to
+// be consumed attempts times, so they don't keep crashing consumers. Panics
+// of consumers are recovered and processing timeouts don't settle the
+// delivery with their action anymore, see SetProcessingTimeout. Both return
+// the delivery to ready for another attempt, like the cleaner does for
+// deliveries of dead connections. Deliveries returned to ready attempts
+// times are moved to the poison list instead of being consumed again, see
+// PeekPoison and PoisonReport. Attempts are counted in the envelope, so
+// deliveries published without one are quarantined on their first failure,
+// see SetEnvelope. Batch consumers are not guarded. Zero disables it. Call it
+// before adding consumers.
+func (queue *redisQueue) SetPoisonQuarantine(attempts int) {
+	queue.poisonAttempts = attempts
+}
+
+// PoisonCount returns the number of quarantined deliveries
+func (queue *redisQueue) PoisonCount() int {
+	count, _ := queue.redisClient.LLen(queue.poisonKey())
+	return count
+}
+
+// PeekPoison returns up to count quarantined payloads, starting with the
+// oldest
+func (queue *redisQueue) PeekPoison(count int) []string {
+	return queue.peekList(queue.poisonKey(), count)
+}
+
+// PoisonReport returns why the quarantined delivery with the given payload,
+// as returned by PeekPoison, was quarantined
+func (queue *redisQueue) PoisonReport(payload string) (report PoisonReport, ok bool) {
+	value, ok := queue.redisClient.HGet(queue.poisonReportsKey(), payload)
+	if !ok {
+		return PoisonReport{}, false
+	}
+	if err := json.Unmarshal([]byte(value), &report); err != nil {
+		return PoisonReport{}, false
+	}
+	return report, true
+}
+
+// ReturnPoison returns up to count of the oldest quarantined deliveries to
+// ready, for example after the consumer was fixed. Their attempts are counted
+// from zero again. Returns the number of returned deliveries.
+func (queue *redisQueue) ReturnPoison(count int) int {
+	returned := 0
+	for ; returned < count; returned++ {
+		value, ok := queue.returnOldest(queue.poisonKey(), resetValue)
+		if !ok {
+			break
+		}
+		queue.redisClient.HDel(queue.poisonReportsKey(), value)
+	}
+
+	queue.audit(AuditReturnPoison, returned, "")
+	return returned
+}
+
+// resetValue returns value with its redelivery count reset if it's an
+// envelope, raw payloads are returned as they are
+func resetValue(value string) string {
+	env, ok := decodeEnvelope(value)
+	if !ok {
+		return value
+	}
+	env.Redelivered = 0
+	return env.encode()
+}
+
+// PurgePoison removes all quarantined deliveries and returns the number of
+// purged deliveries
+func (queue *redisQueue) PurgePoison() int {
+	count := queue.purgePoison()
+	queue.audit(AuditPurgePoison, count, "")
+	return count
+}
+
+func (queue *redisQueue) purgePoison() int {
+	queue.redisClient.Del(queue.poisonReportsKey())
+	return queue.deleteRedisList(queue.poisonKey())
+}
+
+// quarantineReturned quarantines the delivery if it was returned to ready as
+// often as allowed by SetPoisonQuarantine, returns false if it may be
+// consumed
+func (queue *redisQueue) quarantineReturned(delivery Delivery) bool {
+	wrapped, ok := delivery.(*wrapDelivery)
+	if !ok || wrapped.envelope == nil || wrapped.envelope.Redelivered < queue.poisonAttempts {
+		return false
+	}
+	return queue.quarantine(wrapped, PoisonReport{Attempts: wrapped.envelope.Redelivered})
+}
+
+// recoverPanic recovers a panic of the consumer of delivery and counts it as
+// failed attempt, it must be deferred
+func (queue *redisQueue) recoverPanic(delivery Delivery) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	logf("rmq consumer panicked consuming %s: %v", queue, recovered)
+	queue.failed(delivery, fmt.Sprintf("panic: %v", recovered), stack)
+}
+
+// failed returns the delivery to ready for another attempt or quarantines it
+// if it failed too often
+func (queue *redisQueue) failed(delivery Delivery, failure, stack string) bool {
+	wrapped, ok := delivery.(*wrapDelivery)
+	if !ok {
+		return false
+	}
+
+	if wrapped.envelope == nil || wrapped.envelope.Redelivered+1 >= queue.poisonAttempts {
+		attempts := 1
+		if wrapped.envelope != nil {
+			attempts = wrapped.envelope.Redelivered + 1
+		}
+		return queue.quarantine(wrapped, PoisonReport{Attempts: attempts, Failure: failure, Stack: stack})
+	}
+
+	wrapped.settling()
+	if !wrapped.move(queue.readyKey, redeliveredValue(wrapped.value)) {
+		return false
+	}
+	queue.debugf("returned failed delivery %s %s", wrapped, queue)
+	return true
+}
+
+// quarantine moves the delivery to the poison list and stores report
+func (queue *redisQueue) quarantine(delivery *wrapDelivery, report PoisonReport) bool {
+	delivery.settling()
+	if !delivery.move(queue.poisonKey(), delivery.value) {
+		return false
+	}
+
+	report.Consumer = delivery.consumer
+	report.QuarantinedAt = time.Now()
+	encoded, _ := json.Marshal(report)
+	queue.redisClient.HSet(queue.poisonReportsKey(), delivery.value, string(encoded)) // report is lost on error
+	countVar(varQuarantined, 1)
+	logf("rmq quarantined delivery of %s after %d attempts", queue, report.Attempts)
+	return true
+}
+
+func (queue *redisQueue) poisonKey() string {
+	return strings.Replace(queuePoisonTemplate, phQueue, queue.name, 1)
+}
+
+func (queue *redisQueue) poisonReportsKey() string {
+	return strings.Replace(queuePoisonReportsTemplate, phQueue, queue.name, 1)
+}
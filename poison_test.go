@@ -0,0 +1,129 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPoisonSuite(t *testing.T) {
+	TestingSuiteT(&PoisonSuite{}, t)
+}
+
+type PoisonSuite struct{}
+
+func (suite *PoisonSuite) TestQuarantinePanics(c *C) {
+	connection := OpenConnection("poison-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("poison-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgePoison()
+	queue.SetEnvelope(true)
+	queue.SetPoisonQuarantine(3)
+	queue.Publish("poison-crash")
+	queue.Publish("poison-ok")
+
+	attempts := make(chan string, 10)
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	queue.AddConsumerFunc("poison-cons", func(delivery Delivery) {
+		attempts <- delivery.Payload()
+		if delivery.Payload() == "poison-crash" {
+			panic("poison-boom")
+		}
+		delivery.Ack()
+	})
+
+	crashes := 0
+	for crashes < 3 {
+		select {
+		case payload := <-attempts:
+			if payload == "poison-crash" {
+				crashes++
+			}
+		case <-time.After(time.Second):
+			c.Fatal("delivery not retried")
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	queue.StopConsuming()
+
+	c.Check(queue.PoisonCount(), Equals, 1)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	poisoned := queue.PeekPoison(1)
+	c.Assert(poisoned, HasLen, 1)
+	report, ok := queue.PoisonReport(poisoned[0])
+	c.Assert(ok, Equals, true)
+	c.Check(report.Attempts, Equals, 3)
+	c.Check(report.Failure, Equals, "panic: poison-boom")
+	c.Check(report.Stack, Not(Equals), "")
+	c.Check(report.Consumer, Matches, "poison-cons-.*")
+
+	c.Check(queue.ReturnPoison(1), Equals, 1)
+	c.Check(queue.PoisonCount(), Equals, 0)
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	count, _ := delivery.RedeliveryCount()
+	c.Check(count, Equals, 0)
+	delivery.Ack()
+	connection.StopHeartbeat()
+}
+
+func (suite *PoisonSuite) TestQuarantineReturned(c *C) {
+	connection := OpenConnection("poison-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("poison-returned-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgePoison()
+	queue.SetEnvelope(true)
+	queue.SetPoisonQuarantine(2)
+	queue.Publish("poison-returned")
+
+	// like the cleaner after its consumers crashed twice
+	for i := 0; i < 2; i++ {
+		_, err := queue.Get(context.Background())
+		c.Assert(err, IsNil)
+		c.Check(queue.ReturnAllUnacked(), Equals, 1)
+	}
+
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	queue.AddConsumerFunc("poison-cons", func(delivery Delivery) {
+		delivery.Ack()
+	})
+	time.Sleep(50 * time.Millisecond)
+	queue.StopConsuming()
+
+	c.Check(queue.PoisonCount(), Equals, 1)
+	report, ok := queue.PoisonReport(queue.PeekPoison(1)[0])
+	c.Check(ok, Equals, true)
+	c.Check(report.Attempts, Equals, 2)
+	c.Check(report.Failure, Equals, "")
+	c.Check(queue.PurgePoison(), Equals, 1)
+	connection.StopHeartbeat()
+}
+
+func (suite *PoisonSuite) TestQuarantineTimeouts(c *C) {
+	connection := OpenConnection("poison-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("poison-timeout-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.PurgePoison()
+	queue.SetProcessingTimeout(10*time.Millisecond, TimeoutReject)
+	queue.SetPoisonQuarantine(2)
+	queue.Publish("poison-raw-hang") // without envelope, so quarantined right away
+
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	queue.AddConsumerFunc("poison-cons", func(delivery Delivery) {
+		time.Sleep(time.Second)
+	})
+	time.Sleep(100 * time.Millisecond)
+	queue.StopConsuming()
+
+	c.Check(queue.RejectedCount(), Equals, 0)
+	c.Check(queue.PeekPoison(1), DeepEquals, []string{"poison-raw-hang"})
+	report, ok := queue.PoisonReport("poison-raw-hang")
+	c.Check(ok, Equals, true)
+	c.Check(report.Attempts, Equals, 1)
+	c.Check(report.Failure, Equals, "processing timeout")
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,78 @@
+// Package promcollector exports rmq queue stats as Prometheus metrics.
+package promcollector
+
+import (
+	"github.com/adjust/rmq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	readyDesc = prometheus.NewDesc(
+		"rmq_queue_ready",
+		"Number of ready deliveries in the queue.",
+		[]string{"queue"}, nil,
+	)
+	rejectedDesc = prometheus.NewDesc(
+		"rmq_queue_rejected",
+		"Number of rejected deliveries in the queue.",
+		[]string{"queue"}, nil,
+	)
+	unackedDesc = prometheus.NewDesc(
+		"rmq_queue_unacked",
+		"Number of deliveries currently being consumed.",
+		[]string{"queue"}, nil,
+	)
+	consumersDesc = prometheus.NewDesc(
+		"rmq_queue_consumers",
+		"Number of consumers of the queue.",
+		[]string{"queue"}, nil,
+	)
+	oldestReadyAgeDesc = prometheus.NewDesc(
+		"rmq_queue_oldest_ready_age_seconds",
+		"Time the oldest ready delivery has been waiting. Missing if it was published without envelope.",
+		[]string{"queue"}, nil,
+	)
+)
+
+// Collector is a prometheus.Collector which collects rmq stats on every scrape
+type Collector struct {
+	connection rmq.Connection
+	queues     []string // nil for all open queues
+}
+
+// New returns a collector for the given queues, or all open queues if none
+// are given
+func New(connection rmq.Connection, queues ...string) *Collector {
+	return &Collector{
+		connection: connection,
+		queues:     queues,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (collector *Collector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- readyDesc
+	descs <- rejectedDesc
+	descs <- unackedDesc
+	descs <- consumersDesc
+	descs <- oldestReadyAgeDesc
+}
+
+// Collect implements prometheus.Collector
+func (collector *Collector) Collect(metrics chan<- prometheus.Metric) {
+	queues := collector.queues
+	if queues == nil {
+		queues = collector.connection.GetOpenQueues()
+	}
+
+	stats := collector.connection.CollectStats(queues)
+	for queue, stat := range stats.QueueStats {
+		metrics <- prometheus.MustNewConstMetric(readyDesc, prometheus.GaugeValue, float64(stat.ReadyCount), queue)
+		metrics <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.GaugeValue, float64(stat.RejectedCount), queue)
+		metrics <- prometheus.MustNewConstMetric(unackedDesc, prometheus.GaugeValue, float64(stat.UnackedCount()), queue)
+		metrics <- prometheus.MustNewConstMetric(consumersDesc, prometheus.GaugeValue, float64(stat.ConsumerCount()), queue)
+		if stat.OldestReadyAge >= 0 {
+			metrics <- prometheus.MustNewConstMetric(oldestReadyAgeDesc, prometheus.GaugeValue, stat.OldestReadyAge.Seconds(), queue)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package promcollector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorSuite(t *testing.T) {
+	TestingSuiteT(&CollectorSuite{}, t)
+}
+
+type CollectorSuite struct{}
+
+// statsConnection is a test connection with fixed stats
+type statsConnection struct {
+	rmq.TestConnection
+	stats rmq.Stats
+}
+
+func (connection statsConnection) GetOpenQueues() []string {
+	queues := []string{}
+	for queue := range connection.stats.QueueStats {
+		queues = append(queues, queue)
+	}
+	return queues
+}
+
+func (connection statsConnection) CollectStats(queueList []string) rmq.Stats {
+	stats := rmq.NewStats()
+	for _, queue := range queueList {
+		if stat, ok := connection.stats.QueueStats[queue]; ok {
+			stats.QueueStats[queue] = stat
+		}
+	}
+	return stats
+}
+
+func newStatsConnection() statsConnection {
+	stats := rmq.NewStats()
+	things := rmq.NewQueueStat(3, 1)
+	things.OldestReadyAge = 90 * time.Second
+	stats.QueueStats["things"] = things
+	balls := rmq.NewQueueStat(0, 2)
+	balls.OldestReadyAge = -1 // unknown
+	stats.QueueStats["balls"] = balls
+	return statsConnection{TestConnection: rmq.NewTestConnection(), stats: stats}
+}
+
+func (suite *CollectorSuite) TestDescribe(c *C) {
+	c.Check(testutil.CollectAndCount(New(newStatsConnection()), "rmq_queue_ready"), Equals, 2)
+	c.Check(testutil.CollectAndCount(New(newStatsConnection()), "rmq_queue_oldest_ready_age_seconds"), Equals, 1)
+
+	problems, err := testutil.CollectAndLint(New(newStatsConnection()))
+	c.Check(err, IsNil)
+	c.Check(problems, HasLen, 0)
+}
+
+func (suite *CollectorSuite) TestCollect(c *C) {
+	expected := `
+# HELP rmq_queue_ready Number of ready deliveries in the queue.
+# TYPE rmq_queue_ready gauge
+rmq_queue_ready{queue="balls"} 0
+rmq_queue_ready{queue="things"} 3
+# HELP rmq_queue_rejected Number of rejected deliveries in the queue.
+# TYPE rmq_queue_rejected gauge
+rmq_queue_rejected{queue="balls"} 2
+rmq_queue_rejected{queue="things"} 1
+# HELP rmq_queue_unacked Number of deliveries currently being consumed.
+# TYPE rmq_queue_unacked gauge
+rmq_queue_unacked{queue="balls"} 0
+rmq_queue_unacked{queue="things"} 0
+# HELP rmq_queue_consumers Number of consumers of the queue.
+# TYPE rmq_queue_consumers gauge
+rmq_queue_consumers{queue="balls"} 0
+rmq_queue_consumers{queue="things"} 0
+# HELP rmq_queue_oldest_ready_age_seconds Time the oldest ready delivery has been waiting. Missing if it was published without envelope.
+# TYPE rmq_queue_oldest_ready_age_seconds gauge
+rmq_queue_oldest_ready_age_seconds{queue="things"} 90
+`
+	c.Check(testutil.CollectAndCompare(New(newStatsConnection()), strings.NewReader(expected)), IsNil)
+
+	// only the given queues
+	expected = `
+# HELP rmq_queue_ready Number of ready deliveries in the queue.
+# TYPE rmq_queue_ready gauge
+rmq_queue_ready{queue="things"} 3
+`
+	c.Check(testutil.CollectAndCompare(New(newStatsConnection(), "things"), strings.NewReader(expected), "rmq_queue_ready"), IsNil)
+}
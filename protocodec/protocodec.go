@@ -0,0 +1,57 @@
+// Package protocodec publishes and consumes protobuf messages with rmq.
+// Importing it registers Codec, so deliveries published with PublishProto or
+// with Codec set on the queue can be unmarshaled with Delivery.Unmarshal.
+package protocodec
+
+import (
+	"fmt"
+
+	"github.com/adjust/rmq"
+	"github.com/golang/protobuf/proto"
+)
+
+// ContentType is stored with deliveries published with Codec
+const ContentType = "application/x-protobuf"
+
+// Codec marshals proto.Message objects
+var Codec rmq.Codec = codec{}
+
+func init() {
+	rmq.RegisterCodec(Codec)
+}
+
+// PublishProto publishes message in its protobuf wire format
+func PublishProto(queue rmq.Queue, message proto.Message) bool {
+	return queue.PublishObjectWith(Codec, message)
+}
+
+// UnmarshalProto unmarshals the payload of delivery into message. It fails
+// if the delivery was published with another codec.
+func UnmarshalProto(delivery rmq.Delivery, message proto.Message) error {
+	if contentType := delivery.ContentType(); contentType != ContentType {
+		return fmt.Errorf("rmq protocodec can't unmarshal content type %q", contentType)
+	}
+	return proto.Unmarshal(delivery.PayloadBytes(), message)
+}
+
+type codec struct{}
+
+func (codec) ContentType() string {
+	return ContentType
+}
+
+func (codec) Marshal(object interface{}) ([]byte, error) {
+	message, ok := object.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("rmq protocodec can't marshal %T", object)
+	}
+	return proto.Marshal(message)
+}
+
+func (codec) Unmarshal(payload []byte, object interface{}) error {
+	message, ok := object.(proto.Message)
+	if !ok {
+		return fmt.Errorf("rmq protocodec can't unmarshal into %T", object)
+	}
+	return proto.Unmarshal(payload, message)
+}
@@ -0,0 +1,69 @@
+package protocodec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestProtoSuite(t *testing.T) {
+	TestingSuiteT(&ProtoSuite{}, t)
+}
+
+type ProtoSuite struct{}
+
+func (suite *ProtoSuite) TestCodec(c *C) {
+	c.Check(Codec.ContentType(), Equals, ContentType)
+
+	payload, err := Codec.Marshal(&timestamp.Timestamp{Seconds: 23, Nanos: 5})
+	c.Assert(err, IsNil)
+	decoded := &timestamp.Timestamp{}
+	c.Check(Codec.Unmarshal(payload, decoded), IsNil)
+	c.Check(decoded.Seconds, Equals, int64(23))
+	c.Check(decoded.Nanos, Equals, int32(5))
+}
+
+func (suite *ProtoSuite) TestWrongType(c *C) {
+	_, err := Codec.Marshal("proto-not-a-message")
+	c.Check(err, ErrorMatches, "rmq protocodec can't marshal string")
+
+	payload, err := Codec.Marshal(&wrappers.StringValue{Value: "proto-v1"})
+	c.Assert(err, IsNil)
+	text := ""
+	c.Check(Codec.Unmarshal(payload, &text), ErrorMatches, `rmq protocodec can't unmarshal into \*string`)
+}
+
+func (suite *ProtoSuite) TestPublish(c *C) {
+	connection := rmq.OpenConnection("proto-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("proto-q")
+	queue.PurgeReady()
+
+	c.Check(PublishProto(queue, &wrappers.StringValue{Value: "proto-d1"}), Equals, true)
+	c.Check(queue.Publish("proto-d2"), Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	delivery, err := queue.Get(ctx)
+	c.Assert(err, IsNil)
+	c.Check(delivery.ContentType(), Equals, ContentType)
+	message := &wrappers.StringValue{}
+	c.Check(UnmarshalProto(delivery, message), IsNil)
+	c.Check(message.Value, Equals, "proto-d1")
+	message = &wrappers.StringValue{}
+	c.Check(delivery.Unmarshal(message), IsNil) // the codec is registered
+	c.Check(message.Value, Equals, "proto-d1")
+	c.Check(delivery.Ack(), Equals, true)
+
+	// published without the codec
+	delivery, err = queue.Get(ctx)
+	c.Assert(err, IsNil)
+	c.Check(UnmarshalProto(delivery, message), ErrorMatches, `rmq protocodec can't unmarshal content type ""`)
+	c.Check(delivery.Ack(), Equals, true)
+
+	connection.StopHeartbeat()
+}
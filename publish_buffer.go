@@ -0,0 +1,340 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	publishBatchSize     = 100                    // max values per LPUSH of the publish buffer
+	publishRetryInterval = 100 * time.Millisecond // wait before pushing a failed batch again
+)
+
+// ErrPublishFailed is returned by Flush if pushing buffered payloads to Redis
+// failed
+var ErrPublishFailed = errors.New("rmq publish buffer failed to push payloads to Redis")
+
+// OverflowPolicy decides what happens when publishing to a full publish buffer
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait until there's space in the buffer
+	OverflowDropNew                          // drop the new payload
+	OverflowDropOldest                       // drop the oldest buffered payload to make space
+	OverflowError                            // don't publish and return false
+)
+
+// PublishBufferStats describe the occupancy of a publish buffer
+type PublishBufferStats struct {
+	Buffered   int `json:"buffered"`   // payloads waiting to be published
+	Publishing int `json:"publishing"` // payloads being pushed to Redis right now
+	Capacity   int `json:"capacity"`
+	Dropped    int `json:"dropped"` // payloads dropped by the overflow policy
+	Failed     int `json:"failed"`  // payloads whose push to Redis failed, counted per attempt
+}
+
+type bufferedValue struct {
+	value string
+	seq   int64 // increases by one per buffered value
+}
+
+// pendingFlush is a flush waiting for the values up to target
+type pendingFlush struct {
+	target int64 // seq of the last value buffered before the flush
+	failed bool  // true if pushing a batch with values up to target failed
+}
+
+// publishBuffer publishes values to Redis in batches in a background
+// goroutine. The capacity and policy can be changed at any time without
+// losing buffered values. Batches which fail to be pushed are retried in
+// order until the buffer is closed.
+type publishBuffer struct {
+	publish func(values []string) bool
+	linger  int64 // atomic time.Duration, max time to wait for a batch to fill up
+
+	mutex      sync.Mutex
+	capacity   int
+	policy     OverflowPolicy
+	journal    *publishJournal // nil if buffered values are only kept in memory
+	pending    []bufferedValue // oldest first
+	publishing int             // values in the batch being published
+	lastSeq    int64           // seq of the last buffered value
+	completed  int64           // seq of the last published or dropped value
+	dropped    int
+	failed     int
+	flushes    map[*pendingFlush]struct{} // waiting flushes
+	closed     bool
+	spaceFreed *sync.Cond    // signaled when pending shrank or the capacity changed
+	added      chan struct{} // signals the background goroutine, holds at most one signal
+	changed    chan struct{} // closed when completed changes, nil if nobody waits
+
+	done chan struct{} // closed when the background goroutine returned
+}
+
+func newPublishBuffer(size int, policy OverflowPolicy, linger time.Duration, journal *publishJournal, publish func(values []string) bool) *publishBuffer {
+	buffer := &publishBuffer{
+		publish:  publish,
+		linger:   int64(linger),
+		capacity: size,
+		policy:   policy,
+		journal:  journal,
+		flushes:  map[*pendingFlush]struct{}{},
+		added:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	buffer.spaceFreed = sync.NewCond(&buffer.mutex)
+	go buffer.run()
+	return buffer
+}
+
+// add buffers value according to the overflow policy, returns false if the
+// value was rejected or couldn't be written to the journal
+func (buffer *publishBuffer) add(value string) bool {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	for len(buffer.pending) >= buffer.capacity {
+		switch buffer.policy {
+		case OverflowDropNew:
+			buffer.drop()
+			return true
+
+		case OverflowDropOldest:
+			// only one, values above a shrunk capacity are kept
+			buffer.pending = buffer.pending[1:]
+			buffer.drop()
+
+		case OverflowError:
+			return false
+
+		default:
+			buffer.spaceFreed.Wait()
+			continue
+		}
+		break
+	}
+
+	seq := buffer.lastSeq + 1
+	if buffer.journal != nil {
+		if err := buffer.journal.append(value, seq); err != nil {
+			return false
+		}
+	}
+
+	buffer.pending = append(buffer.pending, bufferedValue{value: value, seq: seq})
+	buffer.lastSeq = seq
+	buffer.signalAdded()
+	return true
+}
+
+func (buffer *publishBuffer) drop() {
+	buffer.dropped++
+	countVar(varBufferDrops, 1)
+}
+
+func (buffer *publishBuffer) signalAdded() {
+	select {
+	case buffer.added <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// resize changes the capacity and overflow policy. Buffered values are kept
+// even if there are more than the new capacity, adding waits or drops until
+// enough were published.
+func (buffer *publishBuffer) resize(size int, policy OverflowPolicy) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	buffer.capacity = size
+	buffer.policy = policy
+	buffer.spaceFreed.Broadcast()
+}
+
+func (buffer *publishBuffer) setJournal(journal *publishJournal) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	buffer.journal = journal
+}
+
+func (buffer *publishBuffer) setLinger(linger time.Duration) {
+	atomic.StoreInt64(&buffer.linger, int64(linger))
+}
+
+func (buffer *publishBuffer) run() {
+	defer close(buffer.done)
+
+	for {
+		batch, journal := buffer.collect()
+		if len(batch) == 0 {
+			return // closed and drained
+		}
+
+		values := make([]string, len(batch))
+		for i, item := range batch {
+			values[i] = item.value
+		}
+		published := buffer.publish(values)
+		switch {
+		case buffer.complete(batch, published):
+			time.Sleep(publishRetryInterval) // give Redis time to recover
+		case !published && journal != nil:
+			journal.keep() // so the values get recovered
+		case published && journal != nil:
+			// all values up to the batch are published, failed ones were retried first
+			if err := journal.truncate(batch[len(batch)-1].seq); err != nil {
+				logf("rmq publish buffer failed to truncate journal %s", err)
+			}
+		}
+	}
+}
+
+// collect waits for buffered values and takes up to a batch of them. If a
+// linger is set, it waits up to linger after the first value for the batch
+// to fill up. Returns no values once the buffer was closed and drained.
+func (buffer *publishBuffer) collect() ([]bufferedValue, *publishJournal) {
+	var lingerTimer <-chan time.Time
+
+wait:
+	for {
+		buffer.mutex.Lock()
+		pending, closed := len(buffer.pending), buffer.closed
+		buffer.mutex.Unlock()
+
+		if pending >= publishBatchSize || closed {
+			break
+		}
+		if pending > 0 && lingerTimer == nil {
+			linger := time.Duration(atomic.LoadInt64(&buffer.linger))
+			if linger <= 0 {
+				break
+			}
+			timer := time.NewTimer(linger)
+			defer timer.Stop()
+			lingerTimer = timer.C
+		}
+
+		select {
+		case <-buffer.added:
+		case <-lingerTimer:
+			break wait
+		}
+	}
+
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	size := len(buffer.pending)
+	if size > publishBatchSize {
+		size = publishBatchSize
+	}
+	batch := append([]bufferedValue(nil), buffer.pending[:size]...)
+	buffer.pending = buffer.pending[size:]
+	buffer.publishing = size
+	buffer.spaceFreed.Broadcast()
+	return batch, buffer.journal
+}
+
+// complete records that batch was pushed to Redis or failed to, which fails
+// the flushes waiting for any of its values. Returns true if the failed batch
+// was buffered again to be retried, which it isn't once the buffer is closed.
+func (buffer *publishBuffer) complete(batch []bufferedValue, published bool) (retry bool) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if !published {
+		buffer.failed += len(batch)
+		for flush := range buffer.flushes {
+			if batch[0].seq <= flush.target {
+				flush.failed = true
+			}
+		}
+
+		if buffer.closed {
+			logf("rmq publish buffer gave up on %d payloads which failed to be pushed while closing", len(batch))
+		} else {
+			buffer.pending = append(batch, buffer.pending...) // oldest first
+			retry = true
+		}
+	}
+	if !retry {
+		buffer.completed = batch[len(batch)-1].seq
+	}
+	buffer.publishing = 0
+	if buffer.changed != nil {
+		close(buffer.changed)
+		buffer.changed = nil
+	}
+	return retry
+}
+
+// flush waits until all values buffered before the call are published or
+// dropped, or the context is done. Returns ErrPublishFailed if pushing any of
+// them failed meanwhile.
+func (buffer *publishBuffer) flush(ctx context.Context) error {
+	buffer.mutex.Lock()
+	flush := &pendingFlush{target: buffer.lastSeq}
+	buffer.flushes[flush] = struct{}{}
+	buffer.mutex.Unlock()
+
+	defer func() {
+		buffer.mutex.Lock()
+		delete(buffer.flushes, flush)
+		buffer.mutex.Unlock()
+	}()
+
+	for {
+		buffer.mutex.Lock()
+		if flush.failed {
+			buffer.mutex.Unlock()
+			return ErrPublishFailed
+		}
+		if buffer.completed >= flush.target || buffer.idle() {
+			buffer.mutex.Unlock()
+			return nil
+		}
+		if buffer.changed == nil {
+			buffer.changed = make(chan struct{})
+		}
+		changed := buffer.changed
+		buffer.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// idle returns true if no values are buffered or being published, the last
+// ones might have been dropped
+func (buffer *publishBuffer) idle() bool {
+	return len(buffer.pending) == 0 && buffer.publishing == 0
+}
+
+// close publishes all buffered values and stops the background goroutine,
+// no values must be added afterwards
+func (buffer *publishBuffer) close() {
+	buffer.mutex.Lock()
+	buffer.closed = true
+	buffer.signalAdded()
+	buffer.mutex.Unlock()
+	<-buffer.done
+}
+
+func (buffer *publishBuffer) stats() PublishBufferStats {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	return PublishBufferStats{
+		Buffered:   len(buffer.pending),
+		Publishing: buffer.publishing,
+		Capacity:   buffer.capacity,
+		Dropped:    buffer.dropped,
+		Failed:     buffer.failed,
+	}
+}
@@ -0,0 +1,171 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPublishBufferSuite(t *testing.T) {
+	TestingSuiteT(&PublishBufferSuite{}, t)
+}
+
+type PublishBufferSuite struct{}
+
+// newBlockedBuffer returns a buffer whose background goroutine blocks on the
+// first batch until the returned channel is closed
+func newBlockedBuffer(size int, policy OverflowPolicy) (*publishBuffer, chan struct{}, *[]string) {
+	gate := make(chan struct{})
+	published := &[]string{}
+	buffer := newPublishBuffer(size, policy, 0, nil, func(values []string) bool {
+		<-gate
+		*published = append(*published, values...)
+		return true
+	})
+	return buffer, gate, published
+}
+
+func (suite *PublishBufferSuite) TestQueue(c *C) {
+	connection := OpenConnection("buffer-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("buffer-q").(*redisQueue)
+	queue.PurgeReady()
+
+	c.Check(queue.Flush(context.Background()), IsNil) // unbuffered
+
+	queue.SetPublishBufferSize(10, OverflowBlock)
+	for i := 0; i < 5; i++ {
+		c.Check(queue.Publish("buffer-d"), Equals, true)
+	}
+	c.Check(queue.Flush(context.Background()), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 5)
+	c.Check(queue.PublishBufferStats(), DeepEquals, PublishBufferStats{Capacity: 10})
+
+	queue.SetPublishLinger(time.Hour)
+	queue.Publish("buffer-d")
+	queue.SetPublishBufferSize(20, OverflowError) // keeps the payload
+	c.Check(queue.PublishBufferStats(), DeepEquals, PublishBufferStats{Buffered: 1, Capacity: 20})
+	queue.SetPublishBufferSize(0, OverflowBlock) // flushes
+	c.Check(queue.ReadyCount(), Equals, 6)
+	c.Check(queue.PublishBufferStats(), DeepEquals, PublishBufferStats{})
+
+	connection.StopHeartbeat()
+}
+
+func (suite *PublishBufferSuite) TestLinger(c *C) {
+	batches := make(chan []string, 10)
+	buffer := newPublishBuffer(10, OverflowBlock, 20*time.Millisecond, nil, func(values []string) bool {
+		batches <- values
+		return true
+	})
+
+	start := time.Now()
+	buffer.add("a")
+	time.Sleep(5 * time.Millisecond)
+	buffer.add("b")
+	c.Check(<-batches, DeepEquals, []string{"a", "b"}) // one batch
+	c.Check(time.Since(start) >= 20*time.Millisecond, Equals, true)
+
+	buffer.setLinger(0)
+	buffer.add("c") // waits for the linger set before
+	c.Check(<-batches, DeepEquals, []string{"c"})
+	buffer.close()
+}
+
+func (suite *PublishBufferSuite) TestDropNew(c *C) {
+	buffer, gate, published := newBlockedBuffer(1, OverflowDropNew)
+	c.Check(buffer.add("a"), Equals, true) // taken by goroutine
+	time.Sleep(time.Millisecond)
+	c.Check(buffer.add("b"), Equals, true) // buffered
+	c.Check(buffer.add("c"), Equals, true) // dropped
+	c.Check(buffer.stats(), DeepEquals, PublishBufferStats{Buffered: 1, Publishing: 1, Capacity: 1, Dropped: 1})
+
+	close(gate)
+	c.Check(buffer.flush(context.Background()), IsNil)
+	c.Check(*published, DeepEquals, []string{"a", "b"})
+	buffer.close()
+}
+
+func (suite *PublishBufferSuite) TestDropOldest(c *C) {
+	buffer, gate, published := newBlockedBuffer(1, OverflowDropOldest)
+	c.Check(buffer.add("a"), Equals, true)
+	time.Sleep(time.Millisecond)
+	c.Check(buffer.add("b"), Equals, true)
+	c.Check(buffer.add("c"), Equals, true) // drops b
+
+	close(gate)
+	c.Check(buffer.flush(context.Background()), IsNil)
+	c.Check(*published, DeepEquals, []string{"a", "c"})
+	c.Check(buffer.stats().Dropped, Equals, 1)
+	buffer.close()
+}
+
+func (suite *PublishBufferSuite) TestErrorAndFlushTimeout(c *C) {
+	buffer, gate, published := newBlockedBuffer(1, OverflowError)
+	c.Check(buffer.add("a"), Equals, true)
+	time.Sleep(time.Millisecond)
+	c.Check(buffer.add("b"), Equals, true)
+	c.Check(buffer.add("c"), Equals, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	c.Check(buffer.flush(ctx), Equals, context.DeadlineExceeded)
+
+	close(gate)
+	buffer.close()
+	c.Check(*published, DeepEquals, []string{"a", "b"})
+}
+
+func (suite *PublishBufferSuite) TestFailure(c *C) {
+	results := make(chan bool)
+	buffer := newPublishBuffer(10, OverflowBlock, 0, nil, func(values []string) bool {
+		return <-results
+	})
+
+	c.Check(buffer.add("a"), Equals, true)
+	flushed := make(chan error)
+	go func() { flushed <- buffer.flush(context.Background()) }()
+	time.Sleep(5 * time.Millisecond)
+	results <- false
+	c.Check(<-flushed, Equals, ErrPublishFailed)
+	c.Check(buffer.stats().Failed, Equals, 1)
+
+	c.Check(buffer.add("b"), Equals, true)
+	results <- true
+	c.Check(buffer.flush(context.Background()), IsNil)
+	buffer.close()
+}
+
+func (suite *PublishBufferSuite) TestResize(c *C) {
+	buffer, gate, published := newBlockedBuffer(1, OverflowError)
+	c.Check(buffer.add("a"), Equals, true)
+	time.Sleep(time.Millisecond)
+	c.Check(buffer.add("b"), Equals, true)
+	c.Check(buffer.add("c"), Equals, false)
+
+	buffer.resize(3, OverflowError)
+	c.Check(buffer.add("c"), Equals, true)
+	c.Check(buffer.add("d"), Equals, true)
+	c.Check(buffer.stats(), DeepEquals, PublishBufferStats{Buffered: 3, Publishing: 1, Capacity: 3})
+
+	buffer.resize(1, OverflowBlock) // keeps b, c and d
+	c.Check(buffer.stats().Buffered, Equals, 3)
+
+	added := make(chan bool)
+	go func() { added <- buffer.add("e") }()
+	select {
+	case <-added:
+		c.Error("add didn't wait for space")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	buffer.resize(5, OverflowBlock) // wakes up the waiting add
+	c.Check(<-added, Equals, true)
+
+	close(gate)
+	c.Check(buffer.flush(context.Background()), IsNil)
+	c.Check(*published, DeepEquals, []string{"a", "b", "c", "d", "e"})
+	c.Check(buffer.stats(), DeepEquals, PublishBufferStats{Capacity: 5})
+	buffer.close()
+}
@@ -0,0 +1,119 @@
+package rmq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// publishJournal is an append only file of buffered values which have not
+// been published yet. Each record is the value length as uint32 followed by
+// the value bytes. The file is truncated whenever the publish buffer is
+// drained, so after a crash it contains at least all unpublished values.
+type publishJournal struct {
+	mutex     sync.Mutex
+	file      *os.File
+	journaled int64 // seq of the last appended value
+	kept      bool  // true once values were given up, they stay until the next open
+}
+
+// openPublishJournal opens or creates the journal at path and returns the
+// values left in it by a previous process
+func openPublishJournal(path string) (journal *publishJournal, values []string, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values, err = readJournal(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return &publishJournal{file: file}, values, nil
+}
+
+// readJournal returns all complete records, a partially written last record
+// is ignored
+func readJournal(file *os.File) ([]string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	reader := bufio.NewReader(file)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return values, nil
+			}
+			return nil, err
+		}
+
+		value := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(reader, value); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return values, nil
+			}
+			return nil, err
+		}
+		values = append(values, string(value))
+	}
+}
+
+// append writes value to the journal, seq is the buffer seq of value
+func (journal *publishJournal) append(value string, seq int64) error {
+	record := make([]byte, 4+len(value))
+	binary.BigEndian.PutUint32(record, uint32(len(value)))
+	copy(record[4:], value)
+
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if _, err := journal.file.Write(record); err != nil {
+		return err
+	}
+	journal.journaled = seq
+	return nil
+}
+
+// truncate empties the journal if seq is the last appended value, which
+// means all journaled values are published, unless keep was called
+func (journal *publishJournal) truncate(seq int64) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if journal.kept || journal.journaled != seq {
+		return nil // given up on values or appended more in the meantime
+	}
+	return journal.reset()
+}
+
+// keep makes the journal keep all values, because some of them failed to be
+// published and were given up
+func (journal *publishJournal) keep() {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	journal.kept = true
+}
+
+func (journal *publishJournal) reset() error {
+	if err := journal.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := journal.file.Seek(0, io.SeekStart)
+	return err
+}
+
+func (journal *publishJournal) close() error {
+	return journal.file.Close()
+}
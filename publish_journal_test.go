@@ -0,0 +1,127 @@
+package rmq
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPublishJournalSuite(t *testing.T) {
+	TestingSuiteT(&PublishJournalSuite{}, t)
+}
+
+type PublishJournalSuite struct {
+	dir string
+}
+
+func (suite *PublishJournalSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "rmq-journal")
+	c.Assert(err, IsNil)
+	suite.dir = dir
+}
+
+func (suite *PublishJournalSuite) TearDownTest(c *C) {
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *PublishJournalSuite) TestRecover(c *C) {
+	path := filepath.Join(suite.dir, "journal")
+	journal, values, err := openPublishJournal(path)
+	c.Assert(err, IsNil)
+	c.Check(values, HasLen, 0)
+
+	c.Check(journal.append("a", 1), IsNil)
+	c.Check(journal.append("b\nc\x00", 2), IsNil)
+	c.Check(journal.truncate(1), IsNil) // not the last value, keeps journal
+	c.Check(journal.close(), IsNil)
+
+	// simulate crash during write of the third record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	c.Assert(err, IsNil)
+	file.Write([]byte{0, 0, 0, 5, 'd'})
+	file.Close()
+
+	journal, values, err = openPublishJournal(path)
+	c.Assert(err, IsNil)
+	c.Check(values, DeepEquals, []string{"a", "b\nc\x00"})
+	c.Check(journal.reset(), IsNil)
+	c.Check(journal.close(), IsNil)
+
+	_, values, err = openPublishJournal(path)
+	c.Assert(err, IsNil)
+	c.Check(values, HasLen, 0)
+}
+
+func (suite *PublishJournalSuite) TestQueue(c *C) {
+	path := filepath.Join(suite.dir, "journal")
+	journal, _, err := openPublishJournal(path)
+	c.Assert(err, IsNil)
+	journal.append("journal-d1", 1)
+	journal.append("journal-d2", 2)
+	journal.close()
+
+	connection := OpenConnection("journal-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("journal-q").(*redisQueue)
+	queue.PurgeReady()
+
+	queue.SetPublishBufferSize(10, OverflowBlock)
+	c.Check(queue.SetPublishJournal(path), IsNil)
+	c.Check(queue.SetPublishJournal(path), NotNil)
+	c.Check(queue.ReadyCount(), Equals, 2) // recovered
+
+	c.Check(queue.Publish("journal-d3"), Equals, true)
+	c.Check(queue.Flush(context.Background()), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 3)
+
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Check(info.Size(), Equals, int64(0)) // truncated after publishing
+
+	connection.StopHeartbeat()
+}
+
+func (suite *PublishJournalSuite) TestFailure(c *C) {
+	path := filepath.Join(suite.dir, "journal")
+	journal, _, err := openPublishJournal(path)
+	c.Assert(err, IsNil)
+
+	results := make(chan bool)
+	batches := [][]string{}
+	buffer := newPublishBuffer(10, OverflowBlock, 0, journal, func(values []string) bool {
+		batches = append(batches, values)
+		return <-results
+	})
+
+	// the failed batch is retried before the next one
+	c.Check(buffer.add("a"), Equals, true)
+	results <- false
+	c.Check(buffer.add("b"), Equals, true)
+	results <- true
+	c.Check(buffer.flush(context.Background()), IsNil)
+	c.Check(batches, DeepEquals, [][]string{{"a"}, {"a", "b"}})
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Check(info.Size(), Equals, int64(0))
+
+	// failing while closing keeps the values in the journal
+	c.Check(buffer.add("c"), Equals, true)
+	closed := make(chan struct{})
+	go func() {
+		buffer.close()
+		close(closed)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	results <- false
+	<-closed
+	c.Check(buffer.stats().Failed, Equals, 2)
+	c.Check(journal.close(), IsNil)
+
+	_, values, err := openPublishJournal(path)
+	c.Assert(err, IsNil)
+	c.Check(values, DeepEquals, []string{"c"})
+}
@@ -0,0 +1,35 @@
+package rmq
+
+// PublishMulti publishes the payloads to their queues, keyed by queue name,
+// all or nothing: either every payload is published or none is, like for a
+// set of related messages to several queues. Payloads are encoded with the
+// settings of the queues opened on this connection, like Publish would
+// encode them. Returns false if a payload couldn't be encoded, for example
+// because the validator of its queue rejected it, or if pushing failed.
+// On Redis Cluster all queues must hash to the same slot.
+func (connection *redisConnection) PublishMulti(payloads map[string][]string) bool {
+	queues := map[string]*redisQueue{}
+	values := map[string][]string{}
+	for name, queuePayloads := range payloads {
+		queue := connection.OpenQueue(name).(*redisQueue)
+		queueValues := make([]string, 0, len(queuePayloads))
+		for _, payload := range queuePayloads {
+			value, ok := queue.encodeValue(payload)
+			if !ok {
+				return false
+			}
+			queueValues = append(queueValues, value)
+		}
+		queues[queue.readyKey] = queue
+		values[queue.readyKey] = append(values[queue.readyKey], queueValues...)
+	}
+
+	if !connection.redisClient.LPushMulti(values) {
+		return false
+	}
+	for key, queue := range queues {
+		queue.published(values[key])
+		queue.debugf("published %d deliveries together %s", len(values[key]), queue)
+	}
+	return true
+}
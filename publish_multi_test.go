@@ -0,0 +1,44 @@
+package rmq
+
+import (
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestPublishMultiSuite(t *testing.T) {
+	TestingSuiteT(&PublishMultiSuite{}, t)
+}
+
+type PublishMultiSuite struct{}
+
+func (suite *PublishMultiSuite) TestPublishMulti(c *C) {
+	connection := OpenConnection("multi-conn", "tcp", "localhost:6379", 1)
+	orders := connection.OpenQueue("multi-orders-q").(*redisQueue)
+	orders.PurgeReady()
+	mails := connection.OpenQueue("multi-mails-q").(*redisQueue)
+	mails.PurgeReady()
+	mails.SetEnvelope(true)
+
+	c.Check(connection.PublishMulti(map[string][]string{
+		"multi-orders-q": {"multi-o1", "multi-o2"},
+		"multi-mails-q":  {"multi-m1"},
+	}), Equals, true)
+	c.Check(orders.ReadyCount(), Equals, 2)
+	c.Check(mails.ReadyCount(), Equals, 1)
+	c.Check(orders.redisClient.LRange(orders.readyKey, 0, -1), DeepEquals, []string{"multi-o2", "multi-o1"})
+	env, ok := decodeEnvelope(mails.redisClient.LRange(mails.readyKey, 0, -1)[0])
+	c.Assert(ok, Equals, true)
+	c.Check(env.Payload, Equals, "multi-m1")
+
+	// nothing is published if one payload is invalid
+	mails.SetValidator(ValidJSON)
+	c.Check(connection.PublishMulti(map[string][]string{
+		"multi-orders-q": {"multi-o3"},
+		"multi-mails-q":  {"{}", "multi-invalid"},
+	}), Equals, false)
+	c.Check(orders.ReadyCount(), Equals, 2)
+	c.Check(mails.ReadyCount(), Equals, 1)
+	mails.SetValidator(nil)
+	connection.StopHeartbeat()
+}
@@ -1,63 +1,282 @@
 package rmq
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adjust/uniuri"
 )
 
 const (
-	connectionsKey                   = "rmq::connections"                                           // Set of connection names
-	connectionHeartbeatTemplate      = "rmq::connection::{connection}::heartbeat"                   // expires after {connection} died
-	connectionQueuesTemplate         = "rmq::connection::{connection}::queues"                      // Set of queues consumers of {connection} are consuming
-	connectionQueueConsumersTemplate = "rmq::connection::{connection}::queue::[{queue}]::consumers" // Set of all consumers from {connection} consuming from {queue}
-	connectionQueueUnackedTemplate   = "rmq::connection::{connection}::queue::[{queue}]::unacked"   // List of deliveries consumers of {connection} are currently consuming
+	connectionsKey                         = "rmq::connections"                                                               // Set of connection names
+	connectionHeartbeatTemplate            = "rmq::connection::{connection}::heartbeat"                                       // expires after {connection} died
+	connectionQueuesTemplate               = "rmq::connection::{connection}::queues"                                          // Set of queues consumers of {connection} are consuming
+	connectionQueueConsumersTemplate       = "rmq::connection::{connection}::queue::[{queue}]::consumers"                     // Set of all consumers from {connection} consuming from {queue}
+	connectionQueueUnackedTemplate         = "rmq::connection::{connection}::queue::[{queue}]::unacked"                       // List of deliveries consumers of {connection} are currently consuming
+	connectionQueueConsumerMetricsTemplate = "rmq::connection::{connection}::queue::[{queue}]::consumer::{consumer}::metrics" // Hash of processing metrics of {consumer}
+	connectionQueueDeadlinesTemplate       = "rmq::connection::{connection}::queue::[{queue}]::deadlines"                     // Hash of unacked deliveries to their visibility deadline
+	connectionTemporaryQueuesTemplate      = "rmq::connection::{connection}::temporary"                                       // Set of temporary queues removed with {connection}
 
-	queuesKey             = "rmq::queues"                     // Set of all open queues
-	queueReadyTemplate    = "rmq::queue::[{queue}]::ready"    // List of deliveries in that {queue} (right is first and oldest, left is last and youngest)
-	queueRejectedTemplate = "rmq::queue::[{queue}]::rejected" // List of rejected deliveries from that {queue}
+	queuesKey                      = "rmq::queues"                                // Set of all open queues
+	pausedQueuesKey                = "rmq::paused"                                // Hash of paused queues to when they were paused
+	expiringQueuesKey              = "rmq::expiring"                              // Hash of queues to their idle expiration in nanoseconds
+	queueAliasesKey                = "rmq::aliases"                               // Hash of queue aliases to the queue they open
+	queuesActivityKey              = "rmq::activity"                              // Hash of expiring queues to their last publish or consumption in unix nanoseconds
+	auditKey                       = "rmq::audit"                                 // List of audit events, newest first, see RedisAuditSink
+	cleanerLockKey                 = "rmq::cleaner::lock"                         // name of the connection running scheduled cleaning, see Cleaner.Start
+	connectionEventsChannel        = "rmq::connections::events"                   // Channel of connection lifecycle events, see SubscribeConnectionEvents
+	queueReadyTemplate             = "rmq::queue::[{queue}]::ready"               // List of deliveries in that {queue} (right is first and oldest, left is last and youngest)
+	queueRejectedTemplate          = "rmq::queue::[{queue}]::rejected"            // List of rejected deliveries from that {queue}
+	queueRejectedReasonsTemplate   = "rmq::queue::[{queue}]::rejected::reasons"   // Hash of rejected deliveries to why they were rejected
+	queueConcurrencyTemplate       = "rmq::queue::[{queue}]::concurrency"         // Hash of connections to the number of deliveries they are processing
+	queueConsumerLockTemplate      = "rmq::queue::[{queue}]::consumer::lock"      // name of the only connection consuming {queue} in single active consumer mode
+	queueHistoryTemplate           = "rmq::queue::[{queue}]::history"             // List of stats samples of {queue}, newest first
+	queueTailingTemplate           = "rmq::queue::[{queue}]::tailing"             // expires when nobody is tailing {queue} anymore
+	queueTailTemplate              = "rmq::queue::[{queue}]::tail"                // Channel mirroring payloads published to {queue} while it's being tailed
+	queueMigratingReadyTemplate    = "rmq::queue::[{queue}]::migrating::ready"    // List of ready deliveries being migrated to another Redis
+	queueMigratingRejectedTemplate = "rmq::queue::[{queue}]::migrating::rejected" // List of rejected deliveries being migrated to another Redis
+	queueSQSInflightTemplate       = "rmq::queue::[{queue}]::sqs::inflight"       // List of deliveries received through the SQS shim and not deleted yet
+	queueSQSReceiptsTemplate       = "rmq::queue::[{queue}]::sqs::receipts"       // Hash of SQS receipt handles to visibility deadline and payload
+
+	queueArchivesTemplate        = "rmq::queue::[{queue}]::archives"                              // Hash of archives of {queue} to when they expire in unix nanoseconds
+	queueArchiveReadyTemplate    = "rmq::queue::[{queue}]::archive::{archive}::ready"             // List of ready deliveries of {queue} when it was closed
+	queueArchiveRejectedTemplate = "rmq::queue::[{queue}]::archive::{archive}::rejected"          // List of rejected deliveries of {queue} when it was closed
+	queueArchiveReasonsTemplate  = "rmq::queue::[{queue}]::archive::{archive}::rejected::reasons" // Hash of archived rejected deliveries to why they were rejected
+	queueStagedTemplate          = "rmq::queue::[{queue}]::staged::{staged}"                      // List of deliveries prepared for publishing, see PreparePublish
+	queueOutboxTemplate          = "rmq::queue::[{queue}]::outbox"                                // Set of outbox rows published to {queue} but not marked as published yet
+	queuePoisonTemplate          = "rmq::queue::[{queue}]::poison"                                // List of deliveries quarantined after failing too often, see SetPoisonQuarantine
+	queuePoisonReportsTemplate   = "rmq::queue::[{queue}]::poison::reports"                       // Hash of quarantined deliveries to why they were quarantined
 
 	phConnection = "{connection}" // connection name
 	phQueue      = "{queue}"      // queue name
 	phConsumer   = "{consumer}"   // consumer name (consisting of tag and token)
+	phArchive    = "{archive}"    // archive name (when it was archived in unix nanoseconds)
+	phStaged     = "{staged}"     // ID of prepared deliveries
+
+	defaultBatchTimeout  = time.Second
+	defaultGetPoll       = 100 * time.Millisecond // poll duration of Get if not consuming
+	prefetchTuneInterval = time.Second
+	rejectedTrimInterval = time.Second
+	purgeBatchSize       = 100
+)
 
-	defaultBatchTimeout = time.Second
-	purgeBatchSize      = 100
+var (
+	// ErrAlreadyConsuming is returned by StartConsuming if the queue is
+	// consuming already
+	ErrAlreadyConsuming = errors.New("rmq queue is already consuming")
+	// ErrNotConsuming is returned when adding a consumer to a queue or
+	// asking for its Deliveries before calling StartConsuming
+	ErrNotConsuming = errors.New("rmq queue is not consuming, call StartConsuming first")
+	// ErrConsumerNameInUse is returned when adding a consumer with the name of
+	// another consumer of the queue on the same connection
+	ErrConsumerNameInUse = errors.New("rmq consumer name in use")
+	// ErrQueueExists is returned when renaming a queue or adding an alias
+	// with the name of an existing queue
+	ErrQueueExists = errors.New("rmq queue exists already")
 )
 
 type Queue interface {
 	Publish(payload string) bool
 	PublishBytes(payload []byte) bool
+	PublishWithHeaders(payload string, headers map[string]string) bool
+	PublishWithTTL(payload string, ttl time.Duration) bool
+	PreparePublish(payloads ...string) (id string, ok bool)
+	CommitPublish(id string) int
+	DiscardPublish(id string) bool
+	PublishObject(object interface{}) bool
+	PublishObjectWith(codec Codec, object interface{}) bool
+	SetCodec(codec Codec)
+	SetValidator(validator Validator)
 	SetPushQueue(pushQueue Queue)
-	StartConsuming(prefetchLimit int, pollDuration time.Duration) bool
+	SetMaxHops(maxHops int)
+	SetAutoAck(enabled bool)
+	SetEnvelope(enabled bool)
+	SetCompression(compression Compression, threshold int)
+	SetBlobStore(store BlobStore, threshold int)
+	SetEncryption(keys KeyProvider)
+	SetSigningKey(key []byte)
+	SetPublishBufferSize(size int, policy OverflowPolicy)
+	SetPublishLinger(linger time.Duration)
+	SetPackSize(size int)
+	SetPublishJournal(path string) error
+	Flush(ctx context.Context) error
+	PublishBufferStats() PublishBufferStats
+	SetPrefetchLimit(prefetchLimit int) bool
+	SetReadyCountCheck(enabled bool)
+	SetUnackedLimit(limit int)
+	SetVisibilityTimeout(timeout time.Duration)
+	SetProcessingTimeout(timeout time.Duration, action TimeoutAction)
+	SetPoisonQuarantine(attempts int)
+	SetPollBackoff(maxPollDuration time.Duration)
+	SetGlobalConcurrency(limit int)
+	SetSingleActiveConsumer(lease time.Duration)
+	SetFairDispatch(enabled bool)
+	ActiveConsumer() bool
+	EnablePrefetchAutoTune(minLimit, maxLimit int) bool
+	EnableNotifications() bool
+	StartConsuming(prefetchLimit int, pollDuration time.Duration) error
 	StopConsuming() bool
-	AddConsumer(tag string, consumer Consumer) string
-	AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) string
-	AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) string
+	Pause() bool
+	Resume() bool
+	Paused() bool
+	SetDebug(enabled bool)
+	Get(ctx context.Context) (Delivery, error)
+	GetBatch(ctx context.Context, count int) (Deliveries, error)
+	Deliveries() (<-chan Delivery, error)
+	AddConsumer(tag string, consumer Consumer) (string, error)
+	AddConsumerFunc(tag string, consumerFunc func(delivery Delivery)) (string, error)
+	AddConsumerWithLimit(tag string, limit int, consumer Consumer) (string, error)
+	AddConsumerWithName(name string, consumer Consumer) error
+	AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) (string, error)
+	AddBatchConsumerFunc(tag string, batchSize int, consumerFunc func(batch Deliveries)) (string, error)
+	AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) (string, error)
+	AddBatchConsumerWithOptions(tag string, options BatchOptions, consumer BatchConsumer) (string, error)
 	PurgeReady() int
 	PurgeRejected() int
 	ReturnRejected(count int) int
+	ReturnRejectedWith(count int, transform func(payload string) (transformed string, keep bool)) int
+	ReturnRejectedWhere(predicate func(payload string) bool, limit int) int
 	ReturnAllRejected() int
+	DeleteReady(id string) bool
+	DeleteRejected(id string) bool
+	MoveReady(id string, destination Queue) bool
+	MoveRejected(id string, destination Queue) bool
+	MoveTo(destination Queue, count int) int
+	PeekReady(count int) []string
+	PeekRejected(count int) []string
+	SearchReady(query SearchQuery) SearchResult
+	SearchRejected(query SearchQuery) SearchResult
+	RejectionReason(payload string) (reason RejectionReason, ok bool)
+	PoisonCount() int
+	PeekPoison(count int) []string
+	PoisonReport(payload string) (report PoisonReport, ok bool)
+	ReturnPoison(count int) int
+	PurgePoison() int
+	SetRejectedRetention(retention RejectedRetention)
+	SetIdleExpiration(expiration time.Duration)
+	SetMessageTTL(ttl time.Duration)
+	SetExpiredTrimInterval(interval time.Duration)
+	TrimExpired() int
+	SetCloseArchive(retention time.Duration)
+	Archives() []string
+	RestoreArchive(archive string) int
+	TrimRejected() int
+	OldestReadyAge() (age time.Duration, ok bool)
 	Close() bool
 }
 
+// RejectedRetention limits the rejected list of a queue, see
+// SetRejectedRetention. Zero values mean no limit.
+type RejectedRetention struct {
+	MaxLength int                     // max number of rejected deliveries
+	MaxAge    time.Duration           // max time since rejection
+	Archive   func(payloads []string) // called with trimmed payloads, oldest first, nil drops them
+}
+
 type redisQueue struct {
-	name             string
-	connectionName   string
-	queuesKey        string // key to list of queues consumed by this connection
-	consumersKey     string // key to set of consumers using this connection
-	readyKey         string // key to list of ready deliveries
-	rejectedKey      string // key to list of rejected deliveries
-	unackedKey       string // key to list of currently consuming deliveries
-	pushKey          string // key to list of pushed deliveries
-	redisClient      RedisClient
-	deliveryChan     chan Delivery // nil for publish channels, not nil for consuming channels
-	prefetchLimit    int           // max number of prefetched deliveries number of unacked can go up to prefetchLimit + numConsumers
-	pollDuration     time.Duration
-	consumingStopped bool
+	name           string
+	connectionName string
+	queuesKey      string // key to list of queues consumed by this connection
+	consumersKey   string // key to set of consumers using this connection
+	metricsKey     string // key template to hash of consumer metrics, {consumer} needs to be replaced
+	readyKey       string // key to list of ready deliveries
+	rejectedKey    string // key to list of rejected deliveries
+	reasonsKey     string // key to hash of rejection reasons
+	unackedKey     string // key to list of currently consuming deliveries
+	pushKey        string // key to list of pushed deliveries
+	maxHops        int    // pushes per delivery before it's rejected, zero means unlimited
+	envelope       bool   // wrap published payloads in envelopes with metadata
+	autoAck        bool   // fetch deliveries without unacked entries, see SetAutoAck
+
+	compression          Compression // nil if payloads are not compressed
+	compressionThreshold int         // minimum payload size to compress
+	blobStore            BlobStore   // nil if payloads are never stored externally
+	blobThreshold        int         // minimum payload size to put in the blob store
+	encryption           KeyProvider // nil if payloads are not encrypted
+	signingKey           []byte      // nil if payloads are not signed
+	codec                Codec       // used by PublishObject, nil means JSONCodec
+	validator            Validator   // nil if payloads aren't validated
+
+	publishBuffer      *publishBuffer // nil if publishing is unbuffered
+	publishBufferMutex sync.RWMutex
+	publishLinger      time.Duration
+	publishJournal     *publishJournal // nil if buffered payloads are only kept in memory
+	packSize           int             // max buffered payloads per list entry, see SetPackSize
+	redisClient        RedisClient
+	deliveryChan       chan Delivery // nil for publish channels, not nil for consuming channels
+	prefetchLimit      int           // max number of prefetched deliveries number of unacked can go up to prefetchLimit + numConsumers
+	pollDuration       time.Duration
+	consumingStopped   chan struct{}    // closed by StopConsuming, nil if not consuming
+	consumeDone        chan struct{}    // closed when the consume goroutine returned, nil if not consuming
+	consumeMutex       sync.Mutex       // serializes StartConsuming and StopConsuming
+	paused             int32            // atomic, 1 while paused, refreshed by the consume loop
+	polledAt           int64            // atomic, unix nanoseconds of the last consume loop iteration
+	connection         *redisConnection // nil for queues opened internally
+	skipReadyCount     bool             // fetch without checking the ready count first
+	unackedLimit       int64            // atomic, max unacked deliveries before fetching stops, zero means unlimited
+	deadlinesKey       string
+	visibilityTimeout  time.Duration // zero means unacked deliveries only return when their connection dies
+	processingTimeout  time.Duration // zero means consumers may take forever
+	timeoutAction      TimeoutAction
+	poisonAttempts     int // failed attempts until deliveries are quarantined, zero disables it
+	concurrencyKey     string
+	concurrencyLimit   int // max deliveries processed at once across connections, zero means unlimited
+
+	consumerLockKey       string
+	consumerLockLease     time.Duration // zero if any number of connections may consume
+	consumerLocked        int32         // atomic, 1 while this connection holds the consumer lock
+	debugging             int32         // atomic, 1 if debug messages are logged, see SetDebug
+	consumerLockRenewedAt time.Time     // only used by the consume goroutine
+
+	fairDispatch   bool // consumers get deliveries from the dispatcher instead of deliveryChan
+	dispatchMutex  sync.Mutex
+	dispatchees    map[string]*dispatchee // consumers by name
+	dispatchFreed  chan struct{}          // signals that a consumer became idle
+	dispatchClosed bool
+	dispatchDone   chan struct{} // closed when the dispatcher returned, nil without fair dispatch
+
+	pollBackoffMax      time.Duration // poll duration cap while idle, backoff is disabled if not above pollDuration
+	currentPollDuration time.Duration // only used by the consume goroutine
+
+	prefetchMutex    sync.Mutex // guards deliveryChan, consumingStopped and prefetchLimit once consuming
+	prefetchMinLimit int        // auto tune range, zero if auto tuning is disabled
+	prefetchMaxLimit int
+	prefetchTunedAt  time.Time
+	prefetched       int // deliveries fetched since prefetchTunedAt
+
+	pushNotifications <-chan struct{} // signals new ready deliveries if keyspace notifications are enabled
+	stopNotifications func()
+
+	retentionMutex     sync.Mutex
+	retention          RejectedRetention
+	retentionTrimmedAt time.Time
+
+	messageTTL          time.Duration // expiration of published deliveries, zero if they never expire
+	expiredTrimInterval time.Duration // zero if consumers don't trim expired deliveries, see SetExpiredTrimInterval
+	expiredTrimmedAt    time.Time
+
+	consumerStopsMutex sync.Mutex
+	consumerStops      map[string]func() // stop functions of consumers running in this process by name
+	consumerExited     chan struct{}     // signals that a consumer goroutine is about to return
+
+	tailingKey    string // key which exists while someone is tailing this queue
+	tailChannel   string // channel to mirror published payloads to while tailing
+	tailMutex     sync.Mutex
+	tailCheckedAt time.Time
+	tailing       bool
+
+	activityMutex  sync.Mutex
+	idleExpiration time.Duration // zero if the queue never expires, see SetIdleExpiration
+	activeAt       time.Time     // when the activity was last recorded
+
+	closeArchive time.Duration // how long Close keeps deliveries, zero if it purges them
 }
 
 func newQueue(name, connectionName, queuesKey string, redisClient RedisClient) *redisQueue {
@@ -66,19 +285,39 @@ func newQueue(name, connectionName, queuesKey string, redisClient RedisClient) *
 
 	readyKey := strings.Replace(queueReadyTemplate, phQueue, name, 1)
 	rejectedKey := strings.Replace(queueRejectedTemplate, phQueue, name, 1)
+	reasonsKey := strings.Replace(queueRejectedReasonsTemplate, phQueue, name, 1)
+	concurrencyKey := strings.Replace(queueConcurrencyTemplate, phQueue, name, 1)
+	consumerLockKey := strings.Replace(queueConsumerLockTemplate, phQueue, name, 1)
 
 	unackedKey := strings.Replace(connectionQueueUnackedTemplate, phConnection, connectionName, 1)
 	unackedKey = strings.Replace(unackedKey, phQueue, name, 1)
 
+	metricsKey := strings.Replace(connectionQueueConsumerMetricsTemplate, phConnection, connectionName, 1)
+	metricsKey = strings.Replace(metricsKey, phQueue, name, 1)
+
+	deadlinesKey := strings.Replace(connectionQueueDeadlinesTemplate, phConnection, connectionName, 1)
+	deadlinesKey = strings.Replace(deadlinesKey, phQueue, name, 1)
+
+	tailingKey := strings.Replace(queueTailingTemplate, phQueue, name, 1)
+	tailChannel := strings.Replace(queueTailTemplate, phQueue, name, 1)
+
 	queue := &redisQueue{
-		name:           name,
-		connectionName: connectionName,
-		queuesKey:      queuesKey,
-		consumersKey:   consumersKey,
-		readyKey:       readyKey,
-		rejectedKey:    rejectedKey,
-		unackedKey:     unackedKey,
-		redisClient:    redisClient,
+		name:            name,
+		connectionName:  connectionName,
+		queuesKey:       queuesKey,
+		consumersKey:    consumersKey,
+		metricsKey:      metricsKey,
+		readyKey:        readyKey,
+		rejectedKey:     rejectedKey,
+		reasonsKey:      reasonsKey,
+		unackedKey:      unackedKey,
+		deadlinesKey:    deadlinesKey,
+		concurrencyKey:  concurrencyKey,
+		consumerLockKey: consumerLockKey,
+		tailingKey:      tailingKey,
+		tailChannel:     tailChannel,
+		redisClient:     redisClient,
+		consumerExited:  make(chan struct{}, 1),
 	}
 	return queue
 }
@@ -87,32 +326,388 @@ func (queue *redisQueue) String() string {
 	return fmt.Sprintf("[%s conn:%s]", queue.name, queue.connectionName)
 }
 
-// Publish adds a delivery with the given payload to the queue
+// Publish adds a delivery with the given payload to the queue. If a publish
+// buffer is set, the payload is added to it and published in the background
 func (queue *redisQueue) Publish(payload string) bool {
-	// debug(fmt.Sprintf("publish %s %s", payload, queue)) // COMMENTOUT
-	return queue.redisClient.LPush(queue.readyKey, payload)
+	queue.debugf("publish %s %s", payload, queue)
+	if !queue.validate(payload, "") {
+		return false
+	}
+	if queue.shouldEncode(len(payload)) {
+		return queue.publishEncoded(queue.newEnvelope(""), []byte(payload))
+	}
+
+	value := payload
+	if queue.envelope || queue.messageTTL > 0 {
+		value = queue.newEnvelope(payload).encode()
+	}
+	return queue.publishValue(value)
 }
 
-// PublishBytes just casts the bytes and calls Publish
+// PublishBytes is like Publish, the payload is copied only once and may
+// contain arbitrary bytes
 func (queue *redisQueue) PublishBytes(payload []byte) bool {
-	return queue.Publish(string(payload))
+	if queue.validator != nil && !queue.validate(string(payload), "") {
+		return false
+	}
+	if queue.shouldEncode(len(payload)) {
+		return queue.publishEncoded(queue.newEnvelope(""), payload)
+	}
+
+	if queue.envelope || queue.messageTTL > 0 {
+		return queue.publishValue(queue.newEnvelope("").encodeBytes(payload))
+	}
+	return queue.publishValue(string(payload))
+}
+
+// PublishWithHeaders is like Publish, but always wraps the payload in an
+// envelope carrying headers, like a trace context under TraceParentHeader or
+// a correlation ID. Consumers read them with Delivery.Header and pushes keep
+// them.
+func (queue *redisQueue) PublishWithHeaders(payload string, headers map[string]string) bool {
+	if !queue.validate(payload, "") {
+		return false
+	}
+	env := queue.newEnvelope("")
+	if len(headers) > 0 {
+		env.Headers = headers
+	}
+	if queue.shouldEncode(len(payload)) {
+		return queue.publishEncoded(env, []byte(payload))
+	}
+
+	env.Payload = payload
+	return queue.publishValue(env.encode())
+}
+
+// shouldEncode returns true if the payload needs to be compressed, encrypted,
+// signed or put in the blob store
+func (queue *redisQueue) shouldEncode(payloadSize int) bool {
+	return queue.shouldCompress(payloadSize) || queue.encryption != nil || queue.signingKey != nil || queue.shouldStoreBlob(payloadSize)
+}
+
+func (queue *redisQueue) shouldCompress(payloadSize int) bool {
+	return queue.compression != nil && payloadSize >= queue.compressionThreshold
+}
+
+func (queue *redisQueue) shouldStoreBlob(payloadSize int) bool {
+	return queue.blobStore != nil && payloadSize >= queue.blobThreshold
+}
+
+// PublishObject marshals object with the codec set by SetCodec, JSON by
+// default, and publishes it in an envelope noting the content type. Returns
+// false if marshaling failed.
+func (queue *redisQueue) PublishObject(object interface{}) bool {
+	codec := queue.codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return queue.PublishObjectWith(codec, object)
+}
+
+// PublishObjectWith is like PublishObject, but uses codec instead of the
+// codec of the queue
+func (queue *redisQueue) PublishObjectWith(codec Codec, object interface{}) bool {
+	payload, err := codec.Marshal(object)
+	if err != nil {
+		return false
+	}
+	if queue.validator != nil && !queue.validate(string(payload), codec.ContentType()) {
+		return false
+	}
+
+	env := queue.newEnvelope("")
+	env.ContentType = codec.ContentType()
+	return queue.publishEncoded(env, payload)
+}
+
+// SetCodec sets the codec used by PublishObject
+func (queue *redisQueue) SetCodec(codec Codec) {
+	queue.codec = codec
+}
+
+// publishEncoded compresses, encrypts, signs and stores the payload in the
+// blob store as configured and publishes it in env. Returns false if one of
+// these steps failed
+func (queue *redisQueue) publishEncoded(env *envelope, payload []byte) bool {
+	value, ok := queue.encodePayload(env, payload)
+	if !ok {
+		return false
+	}
+	if !queue.publishValue(value) {
+		if env.Blob != "" {
+			queue.blobStore.Delete(env.Blob)
+		}
+		return false
+	}
+	return true
+}
+
+// encodePayload compresses, encrypts, signs and stores the payload in the
+// blob store as configured and returns env with it as stored in Redis
+func (queue *redisQueue) encodePayload(env *envelope, payload []byte) (string, bool) {
+	storeBlob := queue.shouldStoreBlob(len(payload))
+
+	if queue.shouldCompress(len(payload)) {
+		compressed, err := queue.compression.Compress(payload)
+		if err != nil {
+			return "", false
+		}
+		payload = compressed
+		env.Encoding = queue.compression.Name()
+	}
+
+	if queue.encryption != nil {
+		keyID, encrypted, err := encryptPayload(queue.encryption, payload)
+		if err != nil {
+			return "", false
+		}
+		payload = encrypted
+		env.Key = keyID
+	}
+
+	if storeBlob {
+		env.Blob = env.ID
+	}
+	if queue.signingKey != nil {
+		env.Signature = env.sign(queue.signingKey, payload)
+	}
+
+	if !storeBlob {
+		return env.encodeBytes(payload), true
+	}
+	if err := queue.blobStore.Put(env.Blob, payload); err != nil {
+		return "", false
+	}
+	return env.encode(), true
+}
+
+// publishValue publishes value as stored in Redis, either through the publish
+// buffer or directly
+func (queue *redisQueue) publishValue(value string) bool {
+	queue.publishBufferMutex.RLock()
+	defer queue.publishBufferMutex.RUnlock()
+
+	if queue.publishBuffer != nil {
+		return queue.publishBuffer.add(value)
+	}
+	return queue.publishValues([]string{value})
+}
+
+// publishValues pushes values as stored in Redis to the ready list in one
+// round trip
+func (queue *redisQueue) publishValues(values []string) bool {
+	if ok := queue.redisClient.LPushBatch(queue.readyKey, packValues(values, queue.packSize)); !ok {
+		return false
+	}
+	queue.published(values)
+	return true
+}
+
+// published does the bookkeeping after values were pushed to the ready list
+func (queue *redisQueue) published(values []string) {
+	countVar(varPublished, len(values))
+	queue.markActive()
+
+	if queue.isTailed() {
+		for _, value := range values {
+			queue.redisClient.Publish(queue.tailChannel, unwrapPayload(value))
+		}
+	}
+}
+
+// SetPublishBufferSize makes Publish buffer up to size payloads in memory
+// which are published to Redis in the background. The policy decides what
+// happens when the buffer is full. Changing the size of an existing buffer
+// keeps the buffered payloads and doesn't wait, even when shrinking it below
+// the number of buffered payloads. A size of zero disables buffering, the
+// buffer is flushed first.
+func (queue *redisQueue) SetPublishBufferSize(size int, policy OverflowPolicy) {
+	// publishers waiting for space hold the read lock
+	queue.publishBufferMutex.RLock()
+	if buffer := queue.publishBuffer; buffer != nil && size > 0 {
+		buffer.resize(size, policy)
+		queue.publishBufferMutex.RUnlock()
+		return
+	}
+	queue.publishBufferMutex.RUnlock()
+
+	queue.publishBufferMutex.Lock()
+	defer queue.publishBufferMutex.Unlock()
+
+	switch {
+	case queue.publishBuffer != nil && size > 0: // created in the meantime
+		queue.publishBuffer.resize(size, policy)
+	case queue.publishBuffer != nil:
+		queue.publishBuffer.close()
+		queue.publishBuffer = nil
+	case size > 0:
+		queue.publishBuffer = newPublishBuffer(size, policy, queue.publishLinger, queue.publishJournal, queue.publishValues)
+		if queue.connection != nil {
+			queue.connection.startedBuffering(queue)
+		}
+	}
+}
+
+// SetPublishJournal makes the publish buffer append payloads to the journal
+// file at path before buffering them, so they survive a crash of the process.
+// Payloads left in the journal by a previous process are published first.
+// After a crash payloads which were published but not yet removed from the
+// journal are published again. If pushing payloads fails while the buffer is
+// removed, they are kept in the journal. Use a separate path per queue and
+// process.
+func (queue *redisQueue) SetPublishJournal(path string) error {
+	queue.publishBufferMutex.Lock()
+	defer queue.publishBufferMutex.Unlock()
+
+	if queue.publishJournal != nil {
+		return fmt.Errorf("rmq queue %s already has a publish journal", queue.name)
+	}
+
+	journal, values, err := openPublishJournal(path)
+	if err != nil {
+		return err
+	}
+
+	for len(values) > 0 {
+		batch := values
+		if len(batch) > publishBatchSize {
+			batch = batch[:publishBatchSize]
+		}
+		if !queue.publishValues(batch) {
+			journal.close()
+			return fmt.Errorf("rmq queue %s failed to publish journaled payloads", queue.name)
+		}
+		values = values[len(batch):]
+	}
+
+	if err := journal.reset(); err != nil {
+		journal.close()
+		return err
+	}
+	queue.publishJournal = journal
+
+	if queue.publishBuffer != nil {
+		queue.publishBuffer.setJournal(journal)
+	}
+	return nil
+}
+
+// SetPublishLinger makes the publish buffer wait up to linger for more
+// payloads before pushing a batch to Redis. Without linger a batch is pushed
+// as soon as the buffer is drained. Either way buffered payloads reach Redis
+// at the latest linger after they were published, which bounds the payloads
+// lost if the process crashes.
+func (queue *redisQueue) SetPublishLinger(linger time.Duration) {
+	queue.publishBufferMutex.Lock()
+	defer queue.publishBufferMutex.Unlock()
+
+	queue.publishLinger = linger
+	if queue.publishBuffer != nil {
+		queue.publishBuffer.setLinger(linger)
+	}
+}
+
+// Flush waits until all payloads buffered before the call are published to
+// Redis or the context is done. Returns ErrPublishFailed if pushing some of
+// them to Redis failed, they stay buffered and are retried. Returns nil if
+// publishing is unbuffered
+func (queue *redisQueue) Flush(ctx context.Context) error {
+	queue.publishBufferMutex.RLock()
+	buffer := queue.publishBuffer
+	queue.publishBufferMutex.RUnlock()
+
+	if buffer == nil {
+		return nil
+	}
+	return buffer.flush(ctx)
+}
+
+// PublishBufferStats returns the occupancy of the publish buffer
+func (queue *redisQueue) PublishBufferStats() PublishBufferStats {
+	queue.publishBufferMutex.RLock()
+	defer queue.publishBufferMutex.RUnlock()
+
+	if queue.publishBuffer == nil {
+		return PublishBufferStats{}
+	}
+	return queue.publishBuffer.stats()
+}
+
+// SetEnvelope makes Publish wrap payloads in an envelope which carries
+// metadata like the publish time. Consumers unwrap envelopes automatically,
+// so only enable it once all consumers of the queue are running this version.
+func (queue *redisQueue) SetEnvelope(enabled bool) {
+	queue.envelope = enabled
+}
+
+// SetCompression makes Publish compress payloads of at least threshold bytes
+// and wrap them in an envelope. Consumers decompress them automatically if the
+// compression is registered, see RegisterCompression. Deliveries which can't
+// be decompressed are rejected. A nil compression disables compression.
+func (queue *redisQueue) SetCompression(compression Compression, threshold int) {
+	queue.compression = compression
+	queue.compressionThreshold = threshold
+}
+
+// SetBlobStore makes Publish put payloads of at least threshold bytes in
+// store and only publish a reference to them. Consumers need the same store to
+// load these payloads, deliveries which can't be loaded are rejected. Payloads
+// are deleted from the store when the delivery is acked. A nil store disables
+// it.
+func (queue *redisQueue) SetBlobStore(store BlobStore, threshold int) {
+	queue.blobStore = store
+	queue.blobThreshold = threshold
+}
+
+// SetEncryption makes Publish encrypt payloads with AES-GCM using the current
+// encryption key of keys and wrap them in an envelope. Consumers decrypt them
+// automatically if they set keys which provide the same key, deliveries which
+// can't be decrypted are rejected. A nil provider disables encryption.
+func (queue *redisQueue) SetEncryption(keys KeyProvider) {
+	queue.encryption = keys
+}
+
+// SetSigningKey makes Publish sign payloads with HMAC-SHA256 using key and
+// makes consumers verify them. Deliveries which are not signed with key, like
+// tampered ones or those of other producers, are rejected. A nil key disables
+// signing.
+func (queue *redisQueue) SetSigningKey(key []byte) {
+	queue.signingKey = key
 }
 
 // PurgeReady removes all ready deliveries from the queue and returns the number of purged deliveries
 func (queue *redisQueue) PurgeReady() int {
-	return queue.deleteRedisList(queue.readyKey)
+	count := queue.deleteRedisList(queue.readyKey)
+	queue.audit(AuditPurgeReady, count, "")
+	return count
 }
 
 // PurgeRejected removes all rejected deliveries from the queue and returns the number of purged deliveries
 func (queue *redisQueue) PurgeRejected() int {
+	count := queue.purgeRejected()
+	queue.audit(AuditPurgeRejected, count, "")
+	return count
+}
+
+func (queue *redisQueue) purgeRejected() int {
+	queue.redisClient.Del(queue.reasonsKey)
 	return queue.deleteRedisList(queue.rejectedKey)
 }
 
-// Close purges and removes the queue from the list of queues
+// Close purges and removes the queue from the list of queues. With
+// SetCloseArchive it archives the deliveries instead of purging them.
 func (queue *redisQueue) Close() bool {
-	queue.PurgeRejected()
-	queue.PurgeReady()
+	var purged int
+	if queue.closeArchive > 0 {
+		purged = queue.archive(queue.closeArchive)
+	} else {
+		purged = queue.purgeRejected()
+		purged += queue.purgePoison()
+		purged += queue.deleteRedisList(queue.readyKey)
+	}
 	count, _ := queue.redisClient.SRem(queuesKey, queue.name)
+	queue.audit(AuditCloseQueue, purged, "")
 	return count > 0
 }
 
@@ -135,6 +730,12 @@ func (queue *redisQueue) RejectedCount() int {
 // queue and deletes the unacked key afterwards, returns number of returned
 // deliveries
 func (queue *redisQueue) ReturnAllUnacked() int {
+	returned := queue.returnAllUnacked()
+	queue.audit(AuditReturnUnacked, returned, "")
+	return returned
+}
+
+func (queue *redisQueue) returnAllUnacked() int {
 	count, ok := queue.redisClient.LLen(queue.unackedKey)
 	if !ok {
 		return 0
@@ -142,232 +743,1439 @@ func (queue *redisQueue) ReturnAllUnacked() int {
 
 	unackedCount := count
 	for i := 0; i < unackedCount; i++ {
-		if _, ok := queue.redisClient.RPopLPush(queue.unackedKey, queue.readyKey); !ok {
+		if _, ok := queue.redeliverOldest(queue.unackedKey); !ok {
 			return i
 		}
-		// debug(fmt.Sprintf("rmq queue returned unacked delivery %s %s", count, queue.readyKey)) // COMMENTOUT
+		queue.debugf("returned unacked delivery %d %s", i, queue.readyKey)
 	}
 
 	return unackedCount
 }
 
+// redeliverOldest moves the oldest delivery in the list at key back to ready.
+// Envelopes get their redelivery count incremented on the way. Returns the
+// value as it was stored at key.
+func (queue *redisQueue) redeliverOldest(key string) (string, bool) {
+	return queue.returnOldest(key, redeliveredValue)
+}
+
+// returnOldest moves the oldest delivery in the list at key back to ready,
+// replaced by replace. Returns the value as it was stored at key.
+func (queue *redisQueue) returnOldest(key string, replace func(value string) string) (string, bool) {
+	for {
+		oldest := queue.redisClient.LRange(key, -1, -1)
+		if len(oldest) == 0 {
+			return "", false
+		}
+
+		// pops the value only if it's still the oldest, so it's neither lost
+		// nor duplicated if it's settled or redelivered meanwhile
+		value := oldest[0]
+		moved, ok := queue.redisClient.RPopLPushReplace(key, queue.readyKey, value, replace(value))
+		if !ok {
+			return "", false
+		}
+		if moved {
+			return value, true
+		}
+		// popped meanwhile, try the next one
+	}
+}
+
+// redeliveredValue returns value with its redelivery count incremented if
+// it's an envelope, raw payloads are returned as they are
+func redeliveredValue(value string) string {
+	env, ok := decodeEnvelope(value)
+	if !ok {
+		return value
+	}
+	env.Redelivered++
+	return env.encode()
+}
+
+// returnToReady moves unacked deliveries which weren't handed to a consumer
+// back to ready
+func (queue *redisQueue) returnToReady(deliveries ...Delivery) {
+	for _, delivery := range deliveries {
+		if wrapped, ok := delivery.(*wrapDelivery); ok {
+			wrapped.move(queue.readyKey, wrapped.value)
+		}
+	}
+}
+
+// returnExpiredUnacked moves unacked deliveries whose visibility timeout
+// expired back to ready and returns the number of returned deliveries
+func (queue *redisQueue) returnExpiredUnacked() int {
+	returned := 0
+	now := time.Now()
+	for value, deadline := range queue.redisClient.HGetAll(queue.deadlinesKey) {
+		if nanos, err := strconv.ParseInt(deadline, 10, 64); err == nil && time.Unix(0, nanos).After(now) {
+			continue
+		}
+
+		// only return it if it's still unacked
+		if moved, _ := queue.redisClient.LRemLPush(queue.unackedKey, queue.readyKey, value, redeliveredValue(value)); moved {
+			returned++
+		}
+		queue.redisClient.HDel(queue.deadlinesKey, value)
+	}
+	return returned
+}
+
 // ReturnAllRejected moves all rejected deliveries back to the ready
 // list and returns the number of returned deliveries
 func (queue *redisQueue) ReturnAllRejected() int {
 	rejectedCount, _ := queue.redisClient.LLen(queue.rejectedKey)
-	return queue.ReturnRejected(rejectedCount)
+	returned := queue.returnRejected(rejectedCount)
+	queue.audit(AuditReturnRejected, returned, "")
+	return returned
 }
 
 // ReturnRejected tries to return count rejected deliveries back to
 // the ready list and returns the number of returned deliveries
 func (queue *redisQueue) ReturnRejected(count int) int {
+	returned := queue.returnRejected(count)
+	queue.audit(AuditReturnRejected, returned, "")
+	return returned
+}
+
+func (queue *redisQueue) returnRejected(count int) int {
 	if count == 0 {
 		return 0
 	}
 
 	for i := 0; i < count; i++ {
-		_, ok := queue.redisClient.RPopLPush(queue.rejectedKey, queue.readyKey)
+		value, ok := queue.redeliverOldest(queue.rejectedKey)
 		if !ok {
 			return i
 		}
-		// debug(fmt.Sprintf("rmq queue returned rejected delivery %s %s", value, queue.readyKey)) // COMMENTOUT
+		queue.redisClient.HDel(queue.reasonsKey, value)
+		queue.debugf("returned rejected delivery %s %s", value, queue.readyKey)
 	}
 
 	return count
 }
 
-// CloseInConnection closes the queue in the associated connection by removing all related keys
-func (queue *redisQueue) CloseInConnection() {
-	queue.redisClient.Del(queue.unackedKey)
-	queue.redisClient.Del(queue.consumersKey)
-	queue.redisClient.SRem(queue.queuesKey, queue.name)
+// DeleteReady removes the ready delivery with the given ID, see
+// SearchMatch.ID. Deliveries published without envelope have no ID and are
+// matched by their payload. Returns false if no such delivery was found.
+func (queue *redisQueue) DeleteReady(id string) bool {
+	value, found := queue.findInList(queue.readyKey, id)
+	return found && queue.deleteFromList(queue.readyKey, value)
 }
 
-func (queue *redisQueue) SetPushQueue(pushQueue Queue) {
-	redisPushQueue, ok := pushQueue.(*redisQueue)
-	if !ok {
-		return
+// DeleteRejected removes the rejected delivery with the given ID like
+// DeleteReady
+func (queue *redisQueue) DeleteRejected(id string) bool {
+	value, found := queue.findInList(queue.rejectedKey, id)
+	if !found || !queue.deleteFromList(queue.rejectedKey, value) {
+		return false
 	}
-
-	queue.pushKey = redisPushQueue.readyKey
+	queue.redisClient.HDel(queue.reasonsKey, value)
+	return true
 }
 
-// StartConsuming starts consuming into a channel of size prefetchLimit
-// must be called before consumers can be added!
-// pollDuration is the duration the queue sleeps before checking for new deliveries
-func (queue *redisQueue) StartConsuming(prefetchLimit int, pollDuration time.Duration) bool {
-	if queue.deliveryChan != nil {
-		return false // already consuming
-	}
+// MoveReady moves the ready delivery with the given ID to the ready list of
+// the destination queue, see DeleteReady
+func (queue *redisQueue) MoveReady(id string, destination Queue) bool {
+	value, found := queue.findInList(queue.readyKey, id)
+	return found && queue.moveFromList(queue.readyKey, value, destination)
+}
 
-	// add queue to list of queues consumed on this connection
-	if ok := queue.redisClient.SAdd(queue.queuesKey, queue.name); !ok {
-		log.Panicf("rmq queue failed to start consuming %s", queue)
+// MoveRejected moves the rejected delivery with the given ID to the ready
+// list of the destination queue, see DeleteReady
+func (queue *redisQueue) MoveRejected(id string, destination Queue) bool {
+	value, found := queue.findInList(queue.rejectedKey, id)
+	if !found || !queue.moveFromList(queue.rejectedKey, value, destination) {
+		return false
 	}
-
-	queue.prefetchLimit = prefetchLimit
-	queue.pollDuration = pollDuration
-	queue.deliveryChan = make(chan Delivery, prefetchLimit)
-	// log.Printf("rmq queue started consuming %s %d %s", queue, prefetchLimit, pollDuration)
-	go queue.consume()
+	queue.redisClient.HDel(queue.reasonsKey, value)
 	return true
 }
 
-func (queue *redisQueue) StopConsuming() bool {
-	if queue.deliveryChan == nil || queue.consumingStopped {
-		return false // not consuming or already stopped
+// MoveTo moves up to count of the oldest ready deliveries to the ready list
+// of the destination queue, where they are consumed after its current
+// deliveries. Deliveries are moved atomically in batches, so none are lost or
+// duplicated even if consumers are running. Returns the number of moved
+// deliveries.
+func (queue *redisQueue) MoveTo(destination Queue, count int) int {
+	redisDestination, ok := destination.(*redisQueue)
+	if !ok || redisDestination.readyKey == queue.readyKey {
+		return 0
 	}
 
-	queue.consumingStopped = true
-	return true
-}
+	moved := 0
+	for moved < count {
+		batchSize := purgeBatchSize
+		if batchSize > count-moved {
+			batchSize = count - moved
+		}
+		values := queue.redisClient.RPopLPushBatch(queue.readyKey, redisDestination.readyKey, batchSize)
+		moved += len(values)
+		if len(values) < batchSize {
+			break
+		}
+	}
 
-// AddConsumer adds a consumer to the queue and returns its internal name
-// panics if StartConsuming wasn't called before!
-func (queue *redisQueue) AddConsumer(tag string, consumer Consumer) string {
-	name := queue.addConsumer(tag)
-	go queue.consumerConsume(consumer)
-	return name
+	queue.audit(AuditMoveReady, moved, "")
+	queue.debugf("moved %d ready deliveries %s to %s", moved, queue, redisDestination)
+	return moved
 }
 
-// AddBatchConsumer is similar to AddConsumer, but for batches of deliveries
-func (queue *redisQueue) AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) string {
-	return queue.AddBatchConsumerWithTimeout(tag, batchSize, defaultBatchTimeout, consumer)
+// PeekReady returns up to count ready payloads without consuming them,
+// starting with the one that would be consumed next
+func (queue *redisQueue) PeekReady(count int) []string {
+	return queue.peekList(queue.readyKey, count)
 }
 
-// Timeout limits the amount of time waiting to fill an entire batch
-// The timer is only started when the first message in a batch is received
-func (queue *redisQueue) AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) string {
-	name := queue.addConsumer(tag)
-	go queue.consumerBatchConsume(batchSize, timeout, consumer)
-	return name
+// PeekRejected returns up to count rejected payloads without returning them,
+// starting with the one that would be returned next
+func (queue *redisQueue) PeekRejected(count int) []string {
+	return queue.peekList(queue.rejectedKey, count)
 }
 
-func (queue *redisQueue) GetConsumers() []string {
-	return queue.redisClient.SMembers(queue.consumersKey)
+// RejectionReason returns why and when the rejected delivery with the given
+// payload, as returned by PeekRejected, was rejected
+func (queue *redisQueue) RejectionReason(payload string) (reason RejectionReason, ok bool) {
+	value, ok := queue.redisClient.HGet(queue.reasonsKey, payload)
+	if !ok {
+		return reason, false
+	}
+	if err := json.Unmarshal([]byte(value), &reason); err != nil {
+		return reason, false
+	}
+	return reason, true
 }
 
-func (queue *redisQueue) RemoveConsumer(name string) bool {
-	count, _ := queue.redisClient.SRem(queue.consumersKey, name)
-	return count > 0
+// SetRejectedRetention limits the rejected list of the queue. Consuming
+// queues apply it regularly, otherwise call TrimRejected.
+func (queue *redisQueue) SetRejectedRetention(retention RejectedRetention) {
+	queue.retentionMutex.Lock()
+	defer queue.retentionMutex.Unlock()
+	queue.retention = retention
 }
 
-func (queue *redisQueue) addConsumer(tag string) string {
-	if queue.deliveryChan == nil {
-		log.Panicf("rmq queue failed to add consumer, call StartConsuming first! %s", queue)
-	}
-
-	name := fmt.Sprintf("%s-%s", tag, uniuri.NewLen(6))
+// TrimRejected removes the oldest rejected deliveries exceeding the rejected
+// retention and passes them to its archive function. It returns the number
+// of removed deliveries.
+func (queue *redisQueue) TrimRejected() int {
+	queue.retentionMutex.Lock()
+	defer queue.retentionMutex.Unlock()
+	queue.retentionTrimmedAt = time.Now()
 
-	// add consumer to list of consumers of this queue
-	if ok := queue.redisClient.SAdd(queue.consumersKey, name); !ok {
-		log.Panicf("rmq queue failed to add consumer %s %s", queue, tag)
+	retention := queue.retention
+	if retention.MaxLength <= 0 && retention.MaxAge <= 0 {
+		return 0
 	}
 
-	// log.Printf("rmq queue added consumer %s %s", queue, name)
-	return name
-}
-
-func (queue *redisQueue) RemoveAllConsumers() int {
-	count, _ := queue.redisClient.Del(queue.consumersKey)
-	return count
-}
+	excess := 0
+	if retention.MaxLength > 0 {
+		if count, ok := queue.redisClient.LLen(queue.rejectedKey); ok && count > retention.MaxLength {
+			excess = count - retention.MaxLength
+		}
+	}
 
-func (queue *redisQueue) consume() {
+	trimmed := []string{}
 	for {
-		batchSize := queue.batchSize()
-		wantMore := queue.consumeBatch(batchSize)
+		values := queue.redisClient.LRange(queue.rejectedKey, -1, -1) // oldest
+		if len(values) == 0 {
+			break
+		}
+		value := values[0]
 
-		if !wantMore {
-			time.Sleep(queue.pollDuration)
+		if len(trimmed) >= excess {
+			if retention.MaxAge <= 0 {
+				break
+			}
+			// deliveries without rejection time stop trimming by age
+			reason, ok := queue.RejectionReason(value)
+			if !ok || time.Since(reason.RejectedAt) <= retention.MaxAge {
+				break
+			}
 		}
 
-		if queue.consumingStopped {
-			// log.Printf("rmq queue stopped consuming %s", queue)
-			return
+		if count, ok := queue.redisClient.LRem(queue.rejectedKey, -1, value); !ok || count != 1 {
+			break // returned in the meantime
 		}
+		queue.redisClient.HDel(queue.reasonsKey, value)
+		trimmed = append(trimmed, value)
 	}
-}
 
-func (queue *redisQueue) batchSize() int {
-	prefetchCount := len(queue.deliveryChan)
-	prefetchLimit := queue.prefetchLimit - prefetchCount
-	// TODO: ignore ready count here and just return prefetchLimit?
-	if readyCount := queue.ReadyCount(); readyCount < prefetchLimit {
-		return readyCount
+	if len(trimmed) > 0 && retention.Archive != nil {
+		retention.Archive(trimmed)
 	}
-	return prefetchLimit
+	return len(trimmed)
 }
 
-// consumeBatch tries to read batchSize deliveries, returns true if any and all were consumed
-func (queue *redisQueue) consumeBatch(batchSize int) bool {
-	if batchSize == 0 {
-		return false
+// trimRejectedRegularly calls TrimRejected at most every
+// rejectedTrimInterval if a rejected retention is set
+func (queue *redisQueue) trimRejectedRegularly() {
+	queue.retentionMutex.Lock()
+	due := (queue.retention.MaxLength > 0 || queue.retention.MaxAge > 0) &&
+		time.Since(queue.retentionTrimmedAt) >= rejectedTrimInterval
+	queue.retentionMutex.Unlock()
+
+	if due {
+		queue.TrimRejected()
 	}
+}
 
-	for i := 0; i < batchSize; i++ {
-		value, ok := queue.redisClient.RPopLPush(queue.readyKey, queue.unackedKey)
-		if !ok {
-			// debug(fmt.Sprintf("rmq queue consumed last batch %s %d", queue, i)) // COMMENTOUT
-			return false
-		}
+// OldestReadyAge returns how long the oldest ready delivery has been waiting.
+// Returns zero if there are no ready deliveries and false if the oldest
+// delivery was published without envelope, so its publish time is unknown.
+func (queue *redisQueue) OldestReadyAge() (age time.Duration, ok bool) {
+	values := queue.redisClient.LRange(queue.readyKey, -1, -1)
+	if len(values) == 0 {
+		return 0, true
+	}
 
-		// debug(fmt.Sprintf("consume %d/%d %s %s", i, batchSize, value, queue)) // COMMENTOUT
-		queue.deliveryChan <- newDelivery(value, queue.unackedKey, queue.rejectedKey, queue.pushKey, queue.redisClient)
+	env, ok := decodeEnvelope(values[0])
+	if !ok {
+		return 0, false
 	}
 
-	// debug(fmt.Sprintf("rmq queue consumed batch %s %d", queue, batchSize)) // COMMENTOUT
-	return true
+	return time.Since(env.publishedAt()), true
 }
 
-func (queue *redisQueue) consumerConsume(consumer Consumer) {
-	for delivery := range queue.deliveryChan {
-		// debug(fmt.Sprintf("consumer consume %s %s", delivery, consumer)) // COMMENTOUT
-		consumer.Consume(delivery)
+// peekList returns the last count elements of the list at key (right is
+// oldest) in reverse order, so the oldest comes first
+func (queue *redisQueue) peekList(key string, count int) []string {
+	if count <= 0 {
+		return []string{}
+	}
+
+	values := queue.redisClient.LRange(key, -count, -1)
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
 	}
+	return values
 }
 
-func (queue *redisQueue) consumerBatchConsume(batchSize int, timeout time.Duration, consumer BatchConsumer) {
+// findInList returns the value of the delivery with the given ID in the list
+// at key. It's scanned in chunks, starting with the delivery consumed next.
+func (queue *redisQueue) findInList(key, id string) (value string, found bool) {
+	for position := 0; ; position += searchChunkSize {
+		values := queue.redisClient.LRange(key, -position-searchChunkSize, -position-1)
+		for i := len(values) - 1; i >= 0; i-- {
+			if deliveryID(values[i]) == id {
+				return values[i], true
+			}
+		}
+		if len(values) < searchChunkSize {
+			return "", false
+		}
+	}
+}
+
+func (queue *redisQueue) deleteFromList(key, value string) bool {
+	count, ok := queue.redisClient.LRem(key, 1, value)
+	return ok && count == 1
+}
+
+// moveFromList removes value from the list at key and pushes it to the
+// destination in one script, so it's neither lost nor pushed if it wasn't there
+func (queue *redisQueue) moveFromList(key, value string, destination Queue) bool {
+	redisDestination, ok := destination.(*redisQueue)
+	if !ok {
+		return false
+	}
+
+	return queue.redisClient.SettleBatch(key, []string{value}, []string{redisDestination.readyKey})[0]
+}
+
+// CloseInConnection closes the queue in the associated connection by removing all related keys
+func (queue *redisQueue) CloseInConnection() {
+	queue.redisClient.Del(queue.unackedKey)
+	queue.redisClient.Del(queue.deadlinesKey)
+	queue.redisClient.HDel(queue.concurrencyKey, queue.connectionName)
+	queue.deleteConsumerMetrics(queue.GetConsumers()...)
+	queue.redisClient.Del(queue.consumersKey)
+	queue.redisClient.SRem(queue.queuesKey, queue.name)
+}
+
+func (queue *redisQueue) SetPushQueue(pushQueue Queue) {
+	redisPushQueue, ok := pushQueue.(*redisQueue)
+	if !ok {
+		return
+	}
+
+	queue.pushKey = redisPushQueue.readyKey
+}
+
+// SetMaxHops limits how often a delivery can be pushed along push queues,
+// which protects against push queues pushing to each other forever. Pushing
+// a delivery which was pushed maxHops times rejects it instead. Set it on all
+// queues of the chain, pushed raw payloads are wrapped in envelopes.
+func (queue *redisQueue) SetMaxHops(maxHops int) {
+	queue.maxHops = maxHops
+}
+
+// SetAutoAck makes consumers pop deliveries from ready without keeping them
+// in unacked, which halves the Redis writes per delivery. Deliveries are
+// consumed at most once: deliveries which are prefetched or being processed
+// when the process dies are lost instead of being returned by the cleaner.
+// Acking only records metrics, rejecting and pushing work as before.
+// Visibility timeouts don't apply. Set it before StartConsuming.
+func (queue *redisQueue) SetAutoAck(enabled bool) {
+	queue.autoAck = enabled
+}
+
+// EnableNotifications subscribes to Redis keyspace notifications for the ready
+// list so the consumer is woken up as soon as deliveries are published instead
+// of waiting for the next poll. Must be called before StartConsuming. Returns
+// false if notifications are not enabled on the server (notify-keyspace-events
+// needs K and l), the queue keeps polling in that case.
+func (queue *redisQueue) EnableNotifications() bool {
+	if queue.getDeliveryChan() != nil {
+		return false // already consuming
+	}
+	if queue.pushNotifications != nil {
+		return true // already enabled
+	}
+
+	notifications, stop, ok := queue.redisClient.NotifyPush(queue.readyKey)
+	if !ok {
+		return false
+	}
+
+	queue.pushNotifications = notifications
+	queue.stopNotifications = stop
+	return true
+}
+
+// SetPrefetchLimit changes the prefetch limit of a consuming queue. The
+// consume goroutine replaces the delivery channel by one of the new size on
+// its next poll, consumers switch to it once they drained the old one.
+// Prefetched deliveries which don't fit into a smaller channel are returned to
+// ready. Returns false if the queue isn't consuming.
+func (queue *redisQueue) SetPrefetchLimit(prefetchLimit int) bool {
+	if prefetchLimit < 1 {
+		return false
+	}
+
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+
+	if queue.deliveryChan == nil {
+		return false // not consuming, pass the limit to StartConsuming instead
+	}
+
+	queue.prefetchLimit = prefetchLimit
+	return true
+}
+
+// SetReadyCountCheck controls whether the consumer checks the ready count
+// before fetching deliveries (enabled by default). Disabling it saves one
+// round trip per fetch for busy queues, the consumer then just tries to fetch
+// up to the prefetch limit and stops at the first miss. Call it before
+// StartConsuming.
+func (queue *redisQueue) SetReadyCountCheck(enabled bool) {
+	queue.skipReadyCount = !enabled
+}
+
+// SetUnackedLimit makes the consumer stop fetching while the deliveries of
+// this queue unacked by this connection, including the prefetched ones,
+// reach limit, for example because consumers are slow to ack during an
+// incident. Fetching continues once acks, rejects or pushes brought the
+// count below limit again. Packed deliveries count as one and auto acked ones
+// don't count, see SetPackSize and SetAutoAck. Zero disables it.
+func (queue *redisQueue) SetUnackedLimit(limit int) {
+	atomic.StoreInt64(&queue.unackedLimit, int64(limit))
+}
+
+// SetVisibilityTimeout makes deliveries fetched from now on return to ready
+// if they are not acked, rejected or pushed within timeout, even if their
+// connection is still alive. Expired deliveries are returned by the cleaner.
+// Consumers of long running deliveries can extend the timeout with Touch.
+func (queue *redisQueue) SetVisibilityTimeout(timeout time.Duration) {
+	queue.visibilityTimeout = timeout
+}
+
+// SetProcessingTimeout limits how long a consumer may take to consume a
+// delivery. When it's exceeded, the context of a ContextConsumer is cancelled,
+// the delivery is rejected or pushed according to action and the consumer
+// continues with the next delivery. The timed out Consume call keeps running
+// in the background, acking the delivery from there fails. Call it before
+// adding consumers.
+func (queue *redisQueue) SetProcessingTimeout(timeout time.Duration, action TimeoutAction) {
+	queue.processingTimeout = timeout
+	queue.timeoutAction = action
+}
+
+// SetPollBackoff makes the consumer double the poll duration after every
+// poll which found the queue empty, up to maxPollDuration. It's reset as soon
+// as deliveries are fetched again. This reduces idle Redis load for many
+// mostly empty queues. Call it before StartConsuming.
+func (queue *redisQueue) SetPollBackoff(maxPollDuration time.Duration) {
+	queue.pollBackoffMax = maxPollDuration
+}
+
+// EnablePrefetchAutoTune regularly adjusts the prefetch limit of a consuming
+// queue to about a second worth of deliveries at the observed throughput,
+// within minLimit and maxLimit. Returns false if the queue isn't consuming.
+func (queue *redisQueue) EnablePrefetchAutoTune(minLimit, maxLimit int) bool {
+	if minLimit < 1 || maxLimit < minLimit {
+		return false
+	}
+
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+
+	if queue.deliveryChan == nil {
+		return false
+	}
+
+	queue.prefetchMinLimit = minLimit
+	queue.prefetchMaxLimit = maxLimit
+	queue.prefetchTunedAt = time.Now()
+	queue.prefetched = 0
+	return true
+}
+
+// StartConsuming starts consuming into a channel of size prefetchLimit
+// must be called before consumers can be added!
+// pollDuration is the duration the queue sleeps before checking for new deliveries
+func (queue *redisQueue) StartConsuming(prefetchLimit int, pollDuration time.Duration) error {
+	queue.consumeMutex.Lock()
+	defer queue.consumeMutex.Unlock()
+
+	if queue.getDeliveryChan() != nil {
+		return ErrAlreadyConsuming
+	}
+
+	// add queue to list of queues consumed on this connection
+	if ok := queue.redisClient.SAdd(queue.queuesKey, queue.name); !ok {
+		return fmt.Errorf("rmq queue failed to start consuming %s: %v", queue, queue.redisClient.LastError())
+	}
+
+	queue.prefetchMutex.Lock()
+	queue.prefetchLimit = prefetchLimit
+	queue.pollDuration = pollDuration
+	queue.deliveryChan = make(chan Delivery, prefetchLimit)
+	queue.consumingStopped = make(chan struct{})
+	queue.consumeDone = make(chan struct{})
+	queue.prefetchMutex.Unlock()
+	if queue.connection != nil {
+		queue.connection.startedConsuming(queue)
+	}
+	queue.debugf("started consuming %s %d %s", queue, prefetchLimit, pollDuration)
+	go queue.consume()
+	if queue.fairDispatch {
+		queue.dispatchees = map[string]*dispatchee{}
+		queue.dispatchFreed = make(chan struct{}, 1)
+		queue.dispatchDone = make(chan struct{})
+		go queue.dispatch()
+	}
+	return nil
+}
+
+// StopConsuming makes the queue stop fetching deliveries. Consumers stop
+// after consuming the prefetched deliveries. It's safe to call it from any
+// goroutine, only the first call returns true.
+func (queue *redisQueue) StopConsuming() bool {
+	queue.consumeMutex.Lock()
+	defer queue.consumeMutex.Unlock()
+
+	if queue.getConsumingStopped() == nil || queue.stoppedConsuming() {
+		return false // not consuming or already stopped
+	}
+
+	close(queue.getConsumingStopped())
+	return true
+}
+
+// getConsumingStopped returns the channel closed by StopConsuming, nil if the
+// queue isn't consuming
+func (queue *redisQueue) getConsumingStopped() chan struct{} {
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+	return queue.consumingStopped
+}
+
+// stoppedConsuming returns true once StopConsuming was called
+func (queue *redisQueue) stoppedConsuming() bool {
+	select {
+	case <-queue.getConsumingStopped(): // nil blocks if not consuming
+		return true
+	default:
+		return false
+	}
+}
+
+// AddConsumer adds a consumer to the queue and returns its internal name.
+// Returns ErrNotConsuming if StartConsuming wasn't called before.
+func (queue *redisQueue) AddConsumer(tag string, consumer Consumer) (string, error) {
+	name, _, err := queue.addStoppableConsumer(tag, consumer)
+	return name, err
+}
+
+// AddConsumerFunc is like AddConsumer, but takes a function
+func (queue *redisQueue) AddConsumerFunc(tag string, consumerFunc func(delivery Delivery)) (string, error) {
+	return queue.AddConsumer(tag, ConsumerFunc(consumerFunc))
+}
+
+// AddConsumerWithLimit is like AddConsumer, but the consumer only gets a
+// new delivery while it has less than limit deliveries which it didn't ack,
+// reject or push yet. Use it for consumers which settle deliveries
+// asynchronously, so a slow one can't take all prefetched deliveries from
+// faster ones. Zero means no limit.
+func (queue *redisQueue) AddConsumerWithLimit(tag string, limit int, consumer Consumer) (string, error) {
+	name, err := queue.addConsumer(tag)
+	if err != nil {
+		return "", err
+	}
+	stopChan := queue.registerConsumer(name)
+	go queue.consumerConsume(name, consumer, limit, stopChan)
+	return name, nil
+}
+
+// AddConsumerWithName is like AddConsumer, but uses name as it is instead of
+// generating one from a tag. Returns ErrConsumerNameInUse if the queue has a
+// consumer with that name on this connection already.
+func (queue *redisQueue) AddConsumerWithName(name string, consumer Consumer) error {
+	if _, err := queue.addNamedConsumer(name); err != nil {
+		return err
+	}
+	stopChan := queue.registerConsumer(name)
+	go queue.consumerConsume(name, consumer, 0, stopChan)
+	return nil
+}
+
+// addStoppableConsumer is like AddConsumer, but the consumer stops consuming
+// when the returned function is called
+func (queue *redisQueue) addStoppableConsumer(tag string, consumer Consumer) (name string, stop func(), err error) {
+	name, err = queue.addConsumer(tag)
+	if err != nil {
+		return "", nil, err
+	}
+	stopChan := queue.registerConsumer(name)
+	go queue.consumerConsume(name, consumer, 0, stopChan)
+	return name, queue.consumerStop(name), nil
+}
+
+// registerConsumer returns the channel which gets closed when the consumer
+// with the given name should stop
+func (queue *redisQueue) registerConsumer(name string) <-chan struct{} {
+	stopChan := make(chan struct{})
+	var once sync.Once
+
+	queue.consumerStopsMutex.Lock()
+	defer queue.consumerStopsMutex.Unlock()
+	if queue.consumerStops == nil {
+		queue.consumerStops = map[string]func(){}
+	}
+	queue.consumerStops[name] = func() {
+		once.Do(func() { close(stopChan) })
+	}
+	return stopChan
+}
+
+// consumerStop returns the stop function of the consumer, a no-op if it's
+// not running in this process
+func (queue *redisQueue) consumerStop(name string) func() {
+	queue.consumerStopsMutex.Lock()
+	defer queue.consumerStopsMutex.Unlock()
+	if stop, ok := queue.consumerStops[name]; ok {
+		return stop
+	}
+	return func() {}
+}
+
+// consumerStopped cleans up after a consumer goroutine returned, removed
+// means it was stopped by RemoveConsumer or its stop function
+func (queue *redisQueue) consumerStopped(name string, consumer interface{}, metrics *consumerMetrics, removed bool) {
+	metrics.stop()
+
+	if removed {
+		queue.removeConsumer(name) // after the last flush so the metrics don't reappear
+	}
+	callOnStop(consumer)
+	if removed {
+		callOnRemoved(consumer)
+	}
+
+	queue.consumerStopsMutex.Lock()
+	delete(queue.consumerStops, name)
+	queue.consumerStopsMutex.Unlock()
+
+	select {
+	case queue.consumerExited <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// AddBatchConsumer is similar to AddConsumer, but for batches of deliveries
+func (queue *redisQueue) AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) (string, error) {
+	return queue.AddBatchConsumerWithTimeout(tag, batchSize, defaultBatchTimeout, consumer)
+}
+
+// AddBatchConsumerFunc is like AddBatchConsumer, but takes a function
+func (queue *redisQueue) AddBatchConsumerFunc(tag string, batchSize int, consumerFunc func(batch Deliveries)) (string, error) {
+	return queue.AddBatchConsumer(tag, batchSize, BatchConsumerFunc(consumerFunc))
+}
+
+// Timeout limits the amount of time waiting to fill an entire batch
+// The timer is only started when the first message in a batch is received
+func (queue *redisQueue) AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) (string, error) {
+	return queue.AddBatchConsumerWithOptions(tag, BatchOptions{Size: batchSize, Timeout: timeout}, consumer)
+}
+
+// AddBatchConsumerWithOptions is like AddBatchConsumer, but lets you tune
+// when batches are consumed, for example to wait for a minimum batch size or
+// to limit the total payload size of bulk writes
+func (queue *redisQueue) AddBatchConsumerWithOptions(tag string, options BatchOptions, consumer BatchConsumer) (string, error) {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultBatchTimeout
+	}
+	name, err := queue.addConsumer(tag)
+	if err != nil {
+		return "", err
+	}
+	stopChan := queue.registerConsumer(name)
+	go queue.consumerBatchConsume(name, options, consumer, stopChan)
+	return name, nil
+}
+
+func (queue *redisQueue) GetConsumers() []string {
+	return queue.redisClient.SMembers(queue.consumersKey)
+}
+
+// RemoveConsumer removes the consumer with the given name from the queue. If
+// it runs in this process, it stops consuming after its current delivery.
+func (queue *redisQueue) RemoveConsumer(name string) bool {
+	removed := queue.removeConsumer(name)
+	queue.consumerStop(name)() // removes again after its last metrics flush
+	if removed {
+		queue.audit(AuditRemoveConsumer, 1, name)
+	}
+	return removed
+}
+
+func (queue *redisQueue) removeConsumer(name string) bool {
+	count, _ := queue.redisClient.SRem(queue.consumersKey, name)
+	queue.deleteConsumerMetrics(name)
+	return count > 0
+}
+
+// GetConsumerStats returns the processing metrics of all consumers of this
+// queue in this connection
+func (queue *redisQueue) GetConsumerStats() map[string]ConsumerStat {
+	stats := map[string]ConsumerStat{}
+	for _, name := range queue.GetConsumers() {
+		stats[name] = newConsumerStat(queue.redisClient.HGetAll(queue.consumerMetricsKey(name)))
+	}
+	return stats
+}
+
+func (queue *redisQueue) consumerMetricsKey(name string) string {
+	return strings.Replace(queue.metricsKey, phConsumer, name, 1)
+}
+
+func (queue *redisQueue) deleteConsumerMetrics(names ...string) {
+	for _, name := range names {
+		queue.redisClient.Del(queue.consumerMetricsKey(name))
+	}
+}
+
+func (queue *redisQueue) addConsumer(tag string) (string, error) {
+	return queue.addNamedConsumer(queue.consumerName(tag))
+}
+
+// addNamedConsumer adds the consumer name to the set of consumers, returns
+// ErrConsumerNameInUse if it's in there already
+func (queue *redisQueue) addNamedConsumer(name string) (string, error) {
+	if queue.getDeliveryChan() == nil {
+		return "", ErrNotConsuming
+	}
+
+	// add consumer to list of consumers of this queue
+	added, ok := queue.redisClient.SAddIfMissing(queue.consumersKey, name)
+	if !ok {
+		return "", fmt.Errorf("rmq queue failed to add consumer %s %s", queue, name)
+	}
+	if !added {
+		return "", ErrConsumerNameInUse
+	}
+
+	queue.debugf("added consumer %s %s", queue, name)
+	return name, nil
+}
+
+// consumerName returns the name for a new consumer with tag, generated by
+// the consumer namer of the connection if one is set
+func (queue *redisQueue) consumerName(tag string) string {
+	if queue.connection != nil {
+		if namer := queue.connection.getConsumerNamer(); namer != nil {
+			return namer(tag)
+		}
+	}
+	return fmt.Sprintf("%s-%s", tag, uniuri.NewLen(6))
+}
+
+func (queue *redisQueue) RemoveAllConsumers() int {
+	queue.consumerStopsMutex.Lock()
+	for _, stop := range queue.consumerStops {
+		stop()
+	}
+	queue.consumerStopsMutex.Unlock()
+
+	queue.deleteConsumerMetrics(queue.GetConsumers()...)
+	count, _ := queue.redisClient.Del(queue.consumersKey)
+	queue.audit(AuditRemoveAllConsumers, count, "")
+	return count
+}
+
+func (queue *redisQueue) consume() {
+	defer close(queue.consumeDone)
+	stopped := queue.getConsumingStopped()
+	for {
+		atomic.StoreInt64(&queue.polledAt, time.Now().UnixNano())
+		queue.tunePrefetchLimit()
+		queue.trimRejectedRegularly()
+		queue.trimExpiredRegularly()
+		queue.markActive()
+		queue.resizeDeliveryChan()
+		batchSize := 0
+		if !queue.refreshPaused() && queue.holdsConsumerLock() {
+			batchSize = queue.batchSize()
+		}
+		consumed := queue.consumeBatch(batchSize, stopped)
+
+		if wantMore := batchSize > 0 && consumed == batchSize; !wantMore {
+			idle := consumed == 0 && !queue.prefetchFull()
+			queue.wait(queue.nextPollDuration(idle), stopped)
+		}
+
+		if queue.stoppedConsuming() {
+			queue.debugf("stopped consuming %s", queue)
+			queue.releaseConsumerLock()
+			if queue.stopNotifications != nil {
+				queue.stopNotifications()
+			}
+			close(queue.getDeliveryChan()) // consumers stop after the prefetched deliveries
+			return
+		}
+	}
+}
+
+// Pause stops all connections from fetching deliveries of this queue and
+// their consumers from taking prefetched ones until Resume is called.
+// Prefetched deliveries stay unacked meanwhile. Get and GetBatch wait too.
+func (queue *redisQueue) Pause() bool {
+	return queue.redisClient.HSet(pausedQueuesKey, queue.name, strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// Resume continues consumption of a paused queue within a poll duration
+func (queue *redisQueue) Resume() bool {
+	_, ok := queue.redisClient.HDel(pausedQueuesKey, queue.name)
+	return ok
+}
+
+// Paused returns true if the queue is paused
+func (queue *redisQueue) Paused() bool {
+	_, ok := queue.redisClient.HGet(pausedQueuesKey, queue.name)
+	return ok
+}
+
+// connectionDead returns true if the connection of the queue noticed it was
+// considered dead, see SetDeadHandler
+func (queue *redisQueue) connectionDead() bool {
+	return queue.connection != nil && queue.connection.Dead()
+}
+
+// refreshPaused updates the paused flag consumers check and returns it
+func (queue *redisQueue) refreshPaused() bool {
+	paused := queue.Paused()
+	if paused {
+		atomic.StoreInt32(&queue.paused, 1)
+	} else {
+		atomic.StoreInt32(&queue.paused, 0)
+	}
+	return paused
+}
+
+// waitWhilePaused blocks consumers while the queue is paused. They resume
+// when the queue stops consuming to finish the prefetched deliveries.
+func (queue *redisQueue) waitWhilePaused(stopChan <-chan struct{}) {
+	stopped := queue.getConsumingStopped()
+	for atomic.LoadInt32(&queue.paused) == 1 {
+		timer := time.NewTimer(queue.pollDuration)
+		select {
+		case <-stopChan:
+			timer.Stop()
+			return
+		case <-stopped:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// wait sleeps for duration, until stopped is closed or until a delivery was
+// published if notifications are enabled
+func (queue *redisQueue) wait(duration time.Duration, stopped <-chan struct{}) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-queue.pushNotifications: // nil blocks if notifications are disabled
+	case <-stopped:
+	case <-timer.C:
+	}
+}
+
+// nextPollDuration doubles the poll duration up to the backoff cap while
+// the queue is idle and resets it otherwise
+func (queue *redisQueue) nextPollDuration(idle bool) time.Duration {
+	if !idle || queue.pollBackoffMax <= queue.pollDuration {
+		queue.currentPollDuration = queue.pollDuration
+		return queue.currentPollDuration
+	}
+
+	if queue.currentPollDuration < queue.pollDuration {
+		queue.currentPollDuration = queue.pollDuration
+	}
+	queue.currentPollDuration *= 2
+	if queue.currentPollDuration > queue.pollBackoffMax {
+		queue.currentPollDuration = queue.pollBackoffMax
+	}
+	return queue.currentPollDuration
+}
+
+func (queue *redisQueue) prefetchFull() bool {
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+	return len(queue.deliveryChan) >= queue.prefetchLimit
+}
+
+func (queue *redisQueue) getDeliveryChan() chan Delivery {
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+	return queue.deliveryChan
+}
+
+// nextDeliveryChan returns the channel which replaced the closed channel
+// because the prefetch limit changed, returns false if there is none
+func (queue *redisQueue) nextDeliveryChan(closed chan Delivery) (chan Delivery, bool) {
+	next := queue.getDeliveryChan()
+	return next, next != closed
+}
+
+// resizeDeliveryChan replaces the delivery channel if the prefetch limit
+// changed. Only called from the consume goroutine which is the only sender
+func (queue *redisQueue) resizeDeliveryChan() {
+	queue.prefetchMutex.Lock()
+	old := queue.deliveryChan
+	if cap(old) == queue.prefetchLimit {
+		queue.prefetchMutex.Unlock()
+		return
+	}
+	next := make(chan Delivery, queue.prefetchLimit)
+	queue.deliveryChan = next
+	queue.prefetchMutex.Unlock()
+
+	// consumers drain the old channel and switch to the new one, move what's
+	// left so consumers which started on the new channel don't miss it. Don't
+	// block if it shrank, so the consume loop keeps renewing its locks
+	close(old)
+	leftover := []Delivery{}
+	for delivery := range old {
+		select {
+		case next <- delivery:
+		default:
+			leftover = append(leftover, delivery)
+		}
+	}
+	queue.returnToReady(leftover...)
+}
+
+// tunePrefetchLimit sets the prefetch limit to the number of deliveries
+// fetched in the last prefetchTuneInterval if auto tuning is enabled
+func (queue *redisQueue) tunePrefetchLimit() {
+	queue.prefetchMutex.Lock()
+	defer queue.prefetchMutex.Unlock()
+
+	if queue.prefetchMinLimit == 0 || time.Since(queue.prefetchTunedAt) < prefetchTuneInterval {
+		return
+	}
+
+	limit := int(float64(queue.prefetched) / time.Since(queue.prefetchTunedAt).Seconds() * prefetchTuneInterval.Seconds())
+	if limit < queue.prefetchMinLimit {
+		limit = queue.prefetchMinLimit
+	}
+	if limit > queue.prefetchMaxLimit {
+		limit = queue.prefetchMaxLimit
+	}
+
+	queue.prefetchLimit = limit
+	queue.prefetchTunedAt = time.Now()
+	queue.prefetched = 0
+}
+
+func (queue *redisQueue) batchSize() int {
+	queue.prefetchMutex.Lock()
+	prefetchCount := len(queue.deliveryChan)
+	prefetchLimit := queue.prefetchLimit - prefetchCount
+	queue.prefetchMutex.Unlock()
+
+	if unackedLimit := int(atomic.LoadInt64(&queue.unackedLimit)); unackedLimit > 0 {
+		unackedCount := queue.UnackedCount()
+		if unackedCount >= unackedLimit {
+			queue.debugf("unacked limit %d reached, not fetching %s", unackedLimit, queue)
+			return 0
+		}
+		if room := unackedLimit - unackedCount; room < prefetchLimit {
+			prefetchLimit = room
+		}
+	}
+
+	if queue.skipReadyCount {
+		return prefetchLimit // consumeBatch stops when the queue is empty
+	}
+	if readyCount := queue.ReadyCount(); readyCount < prefetchLimit {
+		return readyCount
+	}
+	return prefetchLimit
+}
+
+// consumeBatch tries to read batchSize deliveries in one round trip, returns
+// how many were consumed. If stopped is closed while the delivery channel is
+// full, the remaining deliveries are returned to ready.
+func (queue *redisQueue) consumeBatch(batchSize int, stopped <-chan struct{}) int {
+	if batchSize == 0 {
+		return 0
+	}
+
+	deliveries, fetched := queue.fetch(batchSize)
+	deliveryChan := queue.getDeliveryChan()
+	for i, delivery := range deliveries {
+		queue.debugf("consume %d %s %s", batchSize, delivery, queue)
+		select {
+		case deliveryChan <- delivery:
+			continue
+		default:
+		}
+
+		select {
+		case deliveryChan <- delivery:
+		case <-stopped: // consumers might be gone
+			queue.returnToReady(deliveries[i:]...)
+			return fetched
+		}
+	}
+
+	queue.prefetchMutex.Lock()
+	queue.prefetched += len(deliveries)
+	queue.prefetchMutex.Unlock()
+
+	queue.debugf("consumed batch %s %d/%d", queue, fetched, batchSize)
+	return fetched
+}
+
+// fetch moves up to count ready deliveries to unacked and returns them.
+// Deliveries which can't be decoded are rejected, fetched includes them.
+// Packs count once in fetched, but all their deliveries are returned.
+func (queue *redisQueue) fetch(count int) (deliveries []Delivery, fetched int) {
+	autoAck := queue.autoAck
+	var values []string
+	if autoAck {
+		values = queue.redisClient.RPopBatch(queue.readyKey, count)
+	} else {
+		values = queue.redisClient.RPopLPushBatch(queue.readyKey, queue.unackedKey, count)
+	}
+	options := queue.decodeOptions()
+	for _, value := range values {
+		delivery := newDelivery(value, queue.unackedKey, queue.rejectedKey, queue.reasonsKey, queue.pushKey, queue.redisClient)
+		delivery.queueName = queue.name
+		delivery.maxHops = queue.maxHops
+		delivery.debugging = &queue.debugging
+		delivery.autoAcked = autoAck
+		if queue.visibilityTimeout > 0 && !autoAck {
+			delivery.claim(queue.deadlinesKey, queue.visibilityTimeout)
+		}
+		if delivery.envelope != nil && delivery.envelope.Packed > 0 {
+			unpacked, err := queue.unpack(delivery, options)
+			if err != nil {
+				delivery.RejectWithReason(err.Error())
+				continue
+			}
+			deliveries = append(deliveries, unpacked...)
+			continue
+		}
+		if queue.rejectExpired(delivery) {
+			continue
+		}
+		if err := delivery.decode(options); err != nil {
+			delivery.RejectWithReason(err.Error()) // consumers can't handle it
+			continue
+		}
+		if err := queue.validationError(delivery); err != nil {
+			delivery.RejectWithReason(err.Error())
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, len(values)
+}
+
+// Get fetches a ready delivery without StartConsuming and AddConsumer. If
+// the queue is empty, it polls until a delivery is published or ctx is done.
+// The caller must ack, reject or push the delivery.
+func (queue *redisQueue) Get(ctx context.Context) (Delivery, error) {
+	deliveries, err := queue.GetBatch(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	queue.returnToReady(deliveries[1:]...) // the rest of a pack
+	return deliveries[0], nil
+}
+
+// GetBatch is like Get, but returns up to count deliveries. It returns more
+// if the last one was packed with others, see SetPackSize.
+func (queue *redisQueue) GetBatch(ctx context.Context, count int) (Deliveries, error) {
+	// so the cleaner returns the deliveries if this connection dies
+	if ok := queue.redisClient.SAdd(queue.queuesKey, queue.name); !ok {
+		return nil, fmt.Errorf("rmq queue %s failed to register for getting: %v", queue.name, queue.redisClient.LastError())
+	}
+
+	pollDuration := queue.pollDuration
+	if pollDuration <= 0 {
+		pollDuration = defaultGetPoll
+	}
+
+	for {
+		queue.markActive()
+		if !queue.Paused() {
+			if deliveries, _ := queue.fetch(count); len(deliveries) > 0 {
+				return deliveries, nil
+			}
+		}
+
+		timer := time.NewTimer(pollDuration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (queue *redisQueue) decodeOptions() decodeOptions {
+	return decodeOptions{
+		blobStore:  queue.blobStore,
+		keys:       queue.encryption,
+		signingKey: queue.signingKey,
+	}
+}
+
+// Deliveries returns a channel of deliveries for consuming in your own
+// select loop. Deliveries are shared with the consumers and other channels
+// returned by Deliveries. The channel is closed after StopConsuming once the
+// prefetched deliveries are received. Returns ErrNotConsuming if
+// StartConsuming wasn't called before.
+func (queue *redisQueue) Deliveries() (<-chan Delivery, error) {
+	deliveryChan := queue.getDeliveryChan()
+	if deliveryChan == nil {
+		return nil, ErrNotConsuming
+	}
+
+	deliveries := make(chan Delivery)
+	go queue.forwardDeliveries(deliveryChan, deliveries)
+	return deliveries, nil
+}
+
+// forwardDeliveries sends deliveries from the delivery channel, which gets
+// replaced when the prefetch limit changes, to the unbuffered deliveries
+func (queue *redisQueue) forwardDeliveries(deliveryChan chan Delivery, deliveries chan<- Delivery) {
+	defer close(deliveries)
+	for {
+		delivery, ok := <-deliveryChan
+		if !ok {
+			next, ok := queue.nextDeliveryChan(deliveryChan)
+			if !ok {
+				return
+			}
+			deliveryChan = next
+			continue
+		}
+		deliveries <- delivery
+	}
+}
+
+// consumerConsume consumes deliveries until stopChan is closed and removes
+// the consumer then, or until the queue stopped consuming. If limit is
+// positive, the consumer only takes a delivery while less than limit of its
+// deliveries are unsettled.
+func (queue *redisQueue) consumerConsume(name string, consumer Consumer, limit int, stopChan <-chan struct{}) {
+	metrics := newConsumerMetrics(queue.consumerMetricsKey(name), queue.redisClient)
+	deliveryChan := queue.getDeliveryChan()
+	if queue.fairDispatch {
+		deliveryChan = queue.addDispatchee(name)
+	}
+	var slots chan struct{} // one per unsettled delivery
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+	callOnStart(consumer)
+
+	stop := func() {
+		if delivery, ok := queue.removeDispatchee(name); ok {
+			queue.returnToReady(delivery) // dispatched but not taken
+		}
+		queue.consumerStopped(name, consumer, metrics, true)
+	}
+
+	for {
+		queue.waitWhilePaused(stopChan)
+		if slots != nil {
+			select {
+			case <-stopChan:
+				stop()
+				return
+			case slots <- struct{}{}:
+			}
+		}
+
+		select {
+		case <-stopChan:
+			stop()
+			return
+		case delivery, ok := <-deliveryChan:
+			if !ok {
+				if slots != nil {
+					<-slots
+				}
+				if next, ok := queue.nextDeliveryChan(deliveryChan); ok && !queue.fairDispatch {
+					deliveryChan = next
+					continue
+				}
+				queue.consumerStopped(name, consumer, metrics, isClosed(stopChan)) // removed if it was stopped too
+				return
+			}
+			if queue.connectionDead() {
+				// the cleaner returns it to ready, don't process it twice
+				if slots != nil {
+					<-slots
+				}
+				if queue.fairDispatch {
+					queue.dispatchFinished(name)
+				}
+				continue
+			}
+			queue.debugf("consumer consume %s %s", delivery, name)
+			setDeliveryConsumer(delivery, name, metrics)
+			if slots != nil {
+				setDeliverySettled(delivery, func() { <-slots })
+			}
+			consumed := queue.consumeWithPermit([]Delivery{delivery}, stopChan, func() {
+				start := time.Now()
+				queue.consumeDelivery(consumer, delivery, stopChan)
+				metrics.consumed(1, time.Since(start))
+			})
+			if !consumed {
+				queue.removeDispatchee(name)
+				queue.consumerStopped(name, consumer, metrics, true)
+				return
+			}
+			if queue.fairDispatch {
+				queue.dispatchFinished(name)
+			}
+		}
+	}
+}
+
+// consumeDelivery calls the consumer. A ContextConsumer gets a context which
+// is cancelled when the consumer is stopped. If the processing timeout
+// expires first, the delivery is settled with the timeout action and the
+// still running consumer call is abandoned. With SetPoisonQuarantine, panics
+// and timeouts count as failed attempts instead.
+func (queue *redisQueue) consumeDelivery(consumer Consumer, delivery Delivery, stopChan <-chan struct{}) {
+	guarded := queue.poisonAttempts > 0
+	if guarded && queue.quarantineReturned(delivery) {
+		return
+	}
+
+	contextConsumer, isContextConsumer := consumer.(ContextConsumer)
+	if !isContextConsumer && queue.processingTimeout <= 0 {
+		if guarded {
+			defer queue.recoverPanic(delivery)
+		}
+		consumer.Consume(delivery)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if guarded {
+			defer queue.recoverPanic(delivery)
+		}
+		if isContextConsumer {
+			contextConsumer.ConsumeContext(ctx, delivery)
+		} else {
+			consumer.Consume(delivery)
+		}
+	}()
+
+	var timeoutChan <-chan time.Time
+	if queue.processingTimeout > 0 {
+		timer := time.NewTimer(queue.processingTimeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-stopChan:
+			cancel() // finish the current delivery before stopping
+			stopChan = nil
+		case <-timeoutChan:
+			cancel()
+			if guarded {
+				queue.failed(delivery, "processing timeout", "")
+			} else if queue.timeoutAction == TimeoutPush {
+				delivery.Push()
+			} else {
+				delivery.RejectWithReason("processing timeout")
+			}
+			return
+		}
+	}
+}
+
+// consumerBatchConsume is like consumerConsume, but for batches
+func (queue *redisQueue) consumerBatchConsume(name string, options BatchOptions, consumer BatchConsumer, stopChan <-chan struct{}) {
+	metrics := newConsumerMetrics(queue.consumerMetricsKey(name), queue.redisClient)
+	callOnStart(consumer)
+	deliveryChan := queue.getDeliveryChan()
 	batch := []Delivery{}
+	var overflow Delivery // didn't fit into the previous batch, see MaxBytes
 	for {
 		// Wait for first delivery
-		delivery, ok := <-queue.deliveryChan
+		var delivery Delivery
+		var ok bool
+		if overflow != nil {
+			delivery, ok, overflow = overflow, true, nil
+		} else {
+			queue.waitWhilePaused(stopChan)
+			select {
+			case <-stopChan:
+				queue.consumerStopped(name, consumer, metrics, true)
+				return
+			case delivery, ok = <-deliveryChan:
+			}
+		}
 		if !ok {
-			// debug("batch channel closed") // COMMENTOUT
+			if next, ok := queue.nextDeliveryChan(deliveryChan); ok {
+				deliveryChan = next
+				continue
+			}
+			queue.debugf("batch channel closed")
+			queue.consumerStopped(name, consumer, metrics, isClosed(stopChan))
 			return
 		}
 		batch = append(batch, delivery)
-		// debug(fmt.Sprintf("batch consume added delivery %d", len(batch))) // COMMENTOUT
-		batch, ok = queue.batchTimeout(batchSize, batch, timeout)
-		consumer.Consume(batch)
+		queue.debugf("batch consume added delivery %d", len(batch))
+		batch, overflow, ok = queue.fillBatch(&deliveryChan, batch, options, stopChan)
+		if queue.connectionDead() {
+			// the cleaner returns them to ready, don't process them twice
+			batch, overflow = batch[:0], nil
+			if !ok {
+				queue.consumerStopped(name, consumer, metrics, isClosed(stopChan))
+				return
+			}
+			continue
+		}
+		for _, delivery := range batch {
+			setDeliveryConsumer(delivery, name, metrics)
+		}
+		consumed := queue.consumeWithPermit(batch, stopChan, func() {
+			start := time.Now()
+			consumer.Consume(batch)
+			metrics.consumed(len(batch), time.Since(start))
+		})
+		if !consumed {
+			queue.returnToReady(overflow)
+			queue.consumerStopped(name, consumer, metrics, true)
+			return
+		}
 		if !ok {
-			// debug("batch channel closed") // COMMENTOUT
+			queue.debugf("batch channel closed")
+			queue.consumerStopped(name, consumer, metrics, isClosed(stopChan))
 			return
 		}
 		batch = batch[:0] // reset batch
 	}
 }
 
-func (queue *redisQueue) batchTimeout(batchSize int, batch []Delivery, timeout time.Duration) (fullBatch []Delivery, ok bool) {
-	timer := time.NewTimer(timeout)
+func isClosed(stopChan <-chan struct{}) bool {
+	select {
+	case <-stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// fillBatch adds deliveries to batch until it should be consumed according
+// to options. overflow is a delivery which didn't fit into the batch and
+// starts the next one. Returns false if the consumer was stopped or the
+// queue stopped consuming.
+func (queue *redisQueue) fillBatch(deliveryChan *chan Delivery, batch []Delivery, options BatchOptions, stopChan <-chan struct{}) (filled []Delivery, overflow Delivery, ok bool) {
+	size := 0
+	for _, delivery := range batch {
+		size += len(delivery.Payload())
+	}
+
+	timer := time.NewTimer(options.Timeout)
 	defer timer.Stop()
+	var maxWaitChan <-chan time.Time
+	if options.MaxWait > 0 {
+		maxWait := time.NewTimer(options.MaxWait)
+		defer maxWait.Stop()
+		maxWaitChan = maxWait.C
+	}
+
+	timedOut := false
 	for {
+		if options.full(batch, size) {
+			queue.debugf("batch consume full %d", len(batch))
+			return batch, nil, true
+		}
+		if timedOut && len(batch) >= options.MinSize {
+			return batch, nil, true
+		}
+
 		select {
+		case <-stopChan:
+			return batch, nil, false
 		case <-timer.C:
-			// debug("batch timer fired") // COMMENTOUT
-			// debug(fmt.Sprintf("batch consume consume %d", len(batch))) // COMMENTOUT
-			return batch, true
-		case delivery, ok := <-queue.deliveryChan:
+			queue.debugf("batch timer fired, consume %d", len(batch))
+			timedOut = true
+		case <-maxWaitChan:
+			queue.debugf("batch max wait passed, consume %d", len(batch))
+			return batch, nil, true
+		case delivery, ok := <-*deliveryChan:
 			if !ok {
-				// debug("batch channel closed") // COMMENTOUT
-				return batch, false
+				if next, ok := queue.nextDeliveryChan(*deliveryChan); ok {
+					*deliveryChan = next
+					continue
+				}
+				queue.debugf("batch channel closed")
+				return batch, nil, false
 			}
-			batch = append(batch, delivery)
-			// debug(fmt.Sprintf("batch consume added delivery %d", len(batch))) // COMMENTOUT
-			if len(batch) >= batchSize {
-				// debug(fmt.Sprintf("batch consume wait %d < %d", len(batch), batchSize)) // COMMENTOUT
-				return batch, true
+			payloadSize := len(delivery.Payload())
+			if options.overflows(batch, size, payloadSize) {
+				return batch, delivery, true
 			}
+			batch = append(batch, delivery)
+			size += payloadSize
+			queue.debugf("batch consume added delivery %d", len(batch))
 		}
 	}
 }
@@ -394,7 +2202,3 @@ func (queue *redisQueue) deleteRedisList(key string) int {
 
 	return total
 }
-
-func debug(message string) {
-	// log.Printf("rmq debug: %s", message) // COMMENTOUT
-}
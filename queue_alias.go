@@ -0,0 +1,108 @@
+package rmq
+
+import "fmt"
+
+// AddQueueAlias makes OpenQueue(alias) open the queue target instead, so
+// publishers and consumers using either name share its ready list. Returns
+// ErrQueueExists if alias is the name of an open queue.
+func (connection *redisConnection) AddQueueAlias(alias, target string) error {
+	if alias == target || connection.isOpenQueue(alias) {
+		return ErrQueueExists
+	}
+	if !connection.redisClient.HSet(queueAliasesKey, alias, connection.resolveAlias(target)) {
+		return fmt.Errorf("rmq failed to add queue alias %s", alias)
+	}
+	return nil
+}
+
+// RemoveQueueAlias removes an alias added by AddQueueAlias or RenameQueue,
+// returns false if there was no such alias
+func (connection *redisConnection) RemoveQueueAlias(alias string) bool {
+	count, _ := connection.redisClient.HDel(queueAliasesKey, alias)
+	return count > 0
+}
+
+// QueueAliases returns all aliases with the queues they open
+func (connection *redisConnection) QueueAliases() map[string]string {
+	return connection.redisClient.HGetAll(queueAliasesKey)
+}
+
+// resolveAlias returns the queue name opens, which is name itself unless
+// it's an alias
+func (connection *redisConnection) resolveAlias(name string) string {
+	if target, ok := connection.redisClient.HGet(queueAliasesKey, name); ok {
+		return target
+	}
+	return name
+}
+
+// RenameQueue renames the queue from to to by renaming its ready and
+// rejected lists and updating the set of queues. Each list is renamed
+// atomically, deliveries are never copied. from becomes an alias of to, so
+// processes opening from afterwards get the renamed queue. Processes which
+// opened from before keep using its old lists until they open it again, so
+// restart them after renaming. Unacked deliveries stay
+// with their connections and are acked as before, the cleaner returns them
+// to the renamed queue. Returns ErrQueueExists if to is open or has deliveries.
+func (connection *redisConnection) RenameQueue(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	source := connection.openQueue(from)
+	destination := connection.openQueue(to)
+	if connection.isOpenQueue(to) || destination.ReadyCount() > 0 || destination.RejectedCount() > 0 {
+		return ErrQueueExists
+	}
+
+	// leftovers of an earlier queue with that name would block the renames
+	connection.redisClient.Del(destination.reasonsKey)
+	connection.redisClient.Del(queueHistoryKey(to))
+
+	keys := [][2]string{
+		{source.readyKey, destination.readyKey},
+		{source.rejectedKey, destination.rejectedKey},
+		{source.reasonsKey, destination.reasonsKey},
+		{queueHistoryKey(from), queueHistoryKey(to)},
+	}
+	for _, key := range keys {
+		if _, ok := connection.redisClient.RenameNX(key[0], key[1]); !ok {
+			return fmt.Errorf("rmq failed to rename %s to %s", key[0], key[1])
+		}
+	}
+
+	for _, key := range []string{pausedQueuesKey, expiringQueuesKey, queuesActivityKey} {
+		connection.moveHashField(key, from, to)
+	}
+
+	connection.redisClient.SAdd(queuesKey, to)
+	connection.redisClient.SRem(queuesKey, from)
+
+	// aliases of from follow it
+	for alias, target := range connection.QueueAliases() {
+		if target == from {
+			connection.redisClient.HSet(queueAliasesKey, alias, to)
+		}
+	}
+	connection.redisClient.HDel(queueAliasesKey, to)
+	connection.redisClient.HSet(queueAliasesKey, from, to)
+	return nil
+}
+
+// moveHashField moves the field from to the field to in the hash at key
+func (connection *redisConnection) moveHashField(key, from, to string) {
+	if value, ok := connection.redisClient.HGet(key, from); ok {
+		connection.redisClient.HSet(key, to, value)
+		connection.redisClient.HDel(key, from)
+	}
+}
+
+// isOpenQueue returns true if name is in the set of open queues
+func (connection *redisConnection) isOpenQueue(name string) bool {
+	for _, open := range connection.GetOpenQueues() {
+		if open == name {
+			return true
+		}
+	}
+	return false
+}
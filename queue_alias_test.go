@@ -0,0 +1,80 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestQueueAliasSuite(t *testing.T) {
+	TestingSuiteT(&QueueAliasSuite{}, t)
+}
+
+type QueueAliasSuite struct{}
+
+func (suite *QueueAliasSuite) TestRenameQueue(c *C) {
+	connection := OpenConnection("alias-conn", "tcp", "localhost:6379", 1)
+	connection.openQueue("rename-new").Close() // left by the last run
+	connection.RemoveQueueAlias("rename-old")
+
+	queue := connection.OpenQueue("rename-old").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.Publish("rename-d1")
+	queue.Publish("rename-d2")
+	queue.Publish("rename-d3")
+	delivery, _ := queue.Get(context.Background())
+	delivery.RejectWithReason("rename-reason")
+
+	// leaves an unacked delivery behind
+	consumerConnection := OpenConnection("alias-consumer-conn", "tcp", "localhost:6379", 1)
+	_, err := consumerConnection.OpenQueue("rename-old").Get(context.Background())
+	c.Assert(err, IsNil)
+
+	c.Assert(connection.RenameQueue("rename-old", "rename-new"), IsNil)
+	renamed := connection.OpenQueue("rename-old").(*redisQueue)
+	c.Check(renamed.name, Equals, "rename-new")
+	c.Check(renamed.ReadyCount(), Equals, 1)
+	c.Check(renamed.RejectedCount(), Equals, 1)
+	reason, ok := renamed.RejectionReason("rename-d1")
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, "rename-reason")
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(connection.isOpenQueue("rename-old"), Equals, false)
+	c.Check(connection.isOpenQueue("rename-new"), Equals, true)
+	c.Check(connection.QueueAliases()["rename-old"], Equals, "rename-new")
+
+	// the cleaner returns unacked deliveries to the renamed queue
+	consumerConnection.StopHeartbeat()
+	c.Assert(NewCleaner(connection).Clean(), IsNil)
+	c.Check(renamed.ReadyCount(), Equals, 2)
+
+	connection.OpenQueue("rename-other")
+	c.Check(connection.RenameQueue("rename-other", "rename-new"), Equals, ErrQueueExists)
+
+	c.Check(connection.RemoveQueueAlias("rename-old"), Equals, true)
+	c.Check(renamed.Close(), Equals, true)
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueAliasSuite) TestAlias(c *C) {
+	connection := OpenConnection("alias-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("alias-q").(*redisQueue)
+	queue.PurgeReady()
+
+	c.Check(connection.AddQueueAlias("alias-q", "alias-other-q"), Equals, ErrQueueExists)
+	c.Assert(connection.AddQueueAlias("alias-a", "alias-q"), IsNil)
+	c.Assert(connection.AddQueueAlias("alias-b", "alias-a"), IsNil) // resolved to alias-q
+	c.Check(connection.QueueAliases()["alias-b"], Equals, "alias-q")
+
+	c.Check(connection.OpenQueue("alias-a"), Equals, queue)
+	connection.OpenQueue("alias-b").Publish("alias-d")
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(connection.isOpenQueue("alias-a"), Equals, false)
+
+	c.Check(connection.RemoveQueueAlias("alias-a"), Equals, true)
+	c.Check(connection.RemoveQueueAlias("alias-a"), Equals, false)
+	c.Check(connection.RemoveQueueAlias("alias-b"), Equals, true)
+	connection.StopHeartbeat()
+}
@@ -1,11 +1,16 @@
 package rmq
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"regexp"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/adjust/gocheck"
+	"github.com/go-redis/redis"
 )
 
 func TestQueueSuite(t *testing.T) {
@@ -48,6 +53,85 @@ func (suite *QueueSuite) TestConnections(c *C) {
 	connection.StopHeartbeat()
 }
 
+func (suite *QueueSuite) TestHeartbeat(c *C) {
+	connection := OpenConnection("heartbeat-conn", "tcp", "localhost:6379", 1)
+	c.Check(connection.SetHeartbeat(0, time.Minute, 0), Equals, false)
+	c.Check(connection.SetHeartbeat(time.Second, time.Minute, time.Second), Equals, false)
+	c.Check(connection.SetHeartbeat(time.Second, time.Second, 0), Equals, false)
+
+	c.Check(connection.SetHeartbeat(10*time.Millisecond, 3*time.Second, 5*time.Millisecond), Equals, true)
+	ttl, _ := connection.redisClient.TTL(connection.heartbeatKey)
+	c.Check(ttl > 0 && ttl <= 3*time.Second, Equals, true, Commentf("ttl %s", ttl))
+	c.Check(connection.heartbeatStaleAfter(), Equals, 75*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		next := connection.nextHeartbeat()
+		c.Assert(next >= 5*time.Millisecond && next < 15*time.Millisecond, Equals, true, Commentf("next %s", next))
+	}
+
+	// the pending heartbeat of the default interval is rescheduled
+	written := atomic.LoadInt64(&connection.heartbeatAt)
+	writes := 0
+	for i := 0; i < 20; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if at := atomic.LoadInt64(&connection.heartbeatAt); at != written {
+			writes++
+			written = at
+		}
+	}
+	c.Check(writes >= 3, Equals, true, Commentf("writes %d", writes))
+	c.Check(connection.Health(context.Background()).Problems, HasLen, 0)
+
+	// a ttl shorter than the default interval doesn't expire
+	shortConnection := OpenConnection("heartbeat-short-conn", "tcp", "localhost:6379", 1)
+	c.Check(shortConnection.SetHeartbeat(10*time.Millisecond, 300*time.Millisecond, 0), Equals, true)
+	time.Sleep(1200 * time.Millisecond)
+	c.Check(shortConnection.Dead(), Equals, false)
+	c.Check(shortConnection.Check(), Equals, true)
+	shortConnection.StopHeartbeat()
+
+	connection.StopHeartbeat()
+	c.Check(connection.Check(), Equals, false)
+}
+
+func (suite *QueueSuite) TestDeclaredDead(c *C) {
+	connection := OpenConnection("dead-conn", "tcp", "localhost:6379", 1)
+	c.Assert(connection.SetHeartbeat(10*time.Millisecond, time.Minute, 0), Equals, true)
+	dead := make(chan struct{})
+	connection.SetDeadHandler(func() { close(dead) })
+
+	queue := connection.OpenQueue("dead-q").(*redisQueue)
+	queue.PurgeReady()
+	for i := 0; i < 3; i++ {
+		queue.Publish(fmt.Sprintf("dead-d%d", i))
+	}
+	consumed := make(chan string, 3)
+	release := make(chan struct{})
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	queue.AddConsumerFunc("dead-cons", func(delivery Delivery) {
+		consumed <- delivery.Payload()
+		<-release
+		delivery.Ack()
+	})
+	c.Check(<-consumed, Equals, "dead-d0")
+
+	// like after a pause longer than the heartbeat TTL
+	connection.redisClient.Del(connection.heartbeatKey)
+	select {
+	case <-dead:
+	case <-time.After(time.Second):
+		c.Fatal("dead handler not called")
+	}
+	c.Check(connection.Dead(), Equals, true)
+	c.Check(queue.stoppedConsuming(), Equals, true)
+	c.Check(connection.Check(), Equals, false)
+
+	// prefetched deliveries are left for the cleaner
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	c.Check(consumed, HasLen, 0)
+	c.Check(queue.UnackedCount(), Equals, 2)
+}
+
 func (suite *QueueSuite) TestConnectionQueues(c *C) {
 	connection := OpenConnection("conn-q-conn", "tcp", "localhost:6379", 1)
 	c.Assert(connection, NotNil)
@@ -105,13 +189,15 @@ func (suite *QueueSuite) TestQueue(c *C) {
 	queue.RemoveAllConsumers()
 	c.Check(queue.GetConsumers(), HasLen, 0)
 	c.Check(connection.GetConsumingQueues(), HasLen, 0)
-	c.Check(queue.StartConsuming(10, time.Millisecond), Equals, true)
-	c.Check(queue.StartConsuming(10, time.Millisecond), Equals, false)
-	cons1name := queue.AddConsumer("queue-cons1", NewTestConsumer("queue-A"))
+	_, err := queue.AddConsumer("queue-cons1", NewTestConsumer("queue-A"))
+	c.Check(err, Equals, ErrNotConsuming)
+	c.Check(queue.StartConsuming(10, time.Millisecond), IsNil)
+	c.Check(queue.StartConsuming(10, time.Millisecond), Equals, ErrAlreadyConsuming)
+	cons1name, _ := queue.AddConsumer("queue-cons1", NewTestConsumer("queue-A"))
 	time.Sleep(time.Millisecond)
 	c.Check(connection.GetConsumingQueues(), HasLen, 1)
 	c.Check(queue.GetConsumers(), DeepEquals, []string{cons1name})
-	cons2name := queue.AddConsumer("queue-cons2", NewTestConsumer("queue-B"))
+	cons2name, _ := queue.AddConsumer("queue-cons2", NewTestConsumer("queue-B"))
 	c.Check(queue.GetConsumers(), HasLen, 2)
 	c.Check(queue.RemoveConsumer("queue-cons3"), Equals, false)
 	c.Check(queue.RemoveConsumer(cons1name), Equals, true)
@@ -189,6 +275,844 @@ func (suite *QueueSuite) TestConsumer(c *C) {
 	connection.StopHeartbeat()
 }
 
+func (suite *QueueSuite) TestConsumerStats(c *C) {
+	connection := OpenConnection("metrics-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("metrics-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	consumer := NewTestConsumer("metrics-A")
+	consumer.AutoAck = false
+	queue.StartConsuming(10, time.Millisecond)
+	name, _ := queue.AddConsumer("metrics-cons", consumer)
+
+	queue.Publish("metrics-d1")
+	queue.Publish("metrics-d2")
+	queue.Publish("metrics-d3")
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 3)
+	c.Check(consumer.LastDeliveries[0].Ack(), Equals, true)
+	c.Check(consumer.LastDeliveries[1].Reject(), Equals, true)
+	c.Check(consumer.LastDeliveries[2].Push(), Equals, true)
+
+	time.Sleep(consumerMetricsFlushInterval + 100*time.Millisecond)
+	stats := queue.GetConsumerStats()
+	c.Assert(stats, HasLen, 1)
+	stat := stats[name]
+	c.Check(stat.Consumed, Equals, 3)
+	c.Check(stat.Acked, Equals, 1)
+	c.Check(stat.Rejected, Equals, 1)
+	c.Check(stat.Pushed, Equals, 1)
+	c.Check(stat.DurationPercentile(0.99), Equals, time.Millisecond)
+	c.Check(stat.LastActivity.IsZero(), Equals, false)
+
+	queueStat := connection.CollectStats([]string{"metrics-q"}).QueueStats["metrics-q"]
+	c.Check(queueStat.ProcessingStat().Consumed, Equals, 3)
+
+	c.Check(queue.RemoveConsumer(name), Equals, true)
+	c.Check(queue.redisClient.HGetAll(queue.consumerMetricsKey(name)), HasLen, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestOldestReadyAge(c *C) {
+	connection := OpenConnection("age-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("age-q").(*redisQueue)
+	queue.PurgeReady()
+
+	age, ok := queue.OldestReadyAge()
+	c.Check(ok, Equals, true)
+	c.Check(age, Equals, time.Duration(0))
+
+	queue.Publish("age-d1") // raw payload, publish time unknown
+	_, ok = queue.OldestReadyAge()
+	c.Check(ok, Equals, false)
+	c.Check(connection.CollectStats([]string{"age-q"}).QueueStats["age-q"].OldestReadyAge, Equals, time.Duration(-1))
+	queue.PurgeReady()
+
+	queue.SetEnvelope(true)
+	queue.Publish("age-d2")
+	time.Sleep(10 * time.Millisecond)
+	queue.Publish("age-d3")
+	age, ok = queue.OldestReadyAge()
+	c.Check(ok, Equals, true)
+	c.Check(age >= 10*time.Millisecond, Equals, true)
+
+	consumer := NewTestConsumer("age-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("age-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+	c.Check(consumer.LastDeliveries[0].Payload(), Equals, "age-d2") // unwrapped
+	c.Check(queue.UnackedCount(), Equals, 0)                        // acked despite envelope
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestSetPrefetchLimit(c *C) {
+	connection := OpenConnection("prefetch-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("prefetch-q").(*redisQueue)
+	queue.PurgeReady()
+	c.Check(queue.SetPrefetchLimit(3), Equals, false) // not consuming
+
+	for i := 0; i < 6; i++ {
+		queue.Publish(fmt.Sprintf("prefetch-d%d", i))
+	}
+	queue.StartConsuming(1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 1)
+
+	c.Check(queue.SetPrefetchLimit(0), Equals, false)
+	c.Check(queue.SetPrefetchLimit(3), Equals, true)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 3)
+
+	// returns what doesn't fit into the smaller channel
+	c.Check(queue.SetPrefetchLimit(1), Equals, true)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 1)
+	c.Check(queue.ReadyCount(), Equals, 5)
+
+	consumer := NewTestConsumer("prefetch-A")
+	consumer.AutoAck = false
+	queue.AddConsumer("prefetch-cons", consumer)
+	time.Sleep(20 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 6)
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestSkipReadyCount(c *C) {
+	connection := OpenConnection("skip-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("skip-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetReadyCountCheck(false)
+
+	queue.Publish("skip-d1")
+	queue.Publish("skip-d2")
+	consumer := NewTestConsumer("skip-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("skip-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 2)
+
+	queue.Publish("skip-d3")
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 3)
+	c.Check(consumer.LastDelivery.Payload(), Equals, "skip-d3")
+	c.Check(queue.UnackedCount(), Equals, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestPollBackoff(c *C) {
+	connection := OpenConnection("backoff-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("backoff-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetPollBackoff(5 * time.Millisecond)
+	queue.pollDuration = time.Millisecond
+
+	c.Check(queue.nextPollDuration(true), Equals, 2*time.Millisecond)
+	c.Check(queue.nextPollDuration(true), Equals, 4*time.Millisecond)
+	c.Check(queue.nextPollDuration(true), Equals, 5*time.Millisecond)
+	c.Check(queue.nextPollDuration(true), Equals, 5*time.Millisecond)
+	c.Check(queue.nextPollDuration(false), Equals, time.Millisecond)
+	c.Check(queue.nextPollDuration(true), Equals, 2*time.Millisecond)
+
+	consumer := NewTestConsumer("backoff-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("backoff-cons", consumer)
+	time.Sleep(20 * time.Millisecond) // backed off
+	queue.Publish("backoff-d1")
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(consumer.LastDelivery, NotNil)
+	c.Check(consumer.LastDelivery.Payload(), Equals, "backoff-d1")
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestConsumerFunc(c *C) {
+	connection := OpenConnection("func-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("func-q").(*redisQueue)
+	queue.PurgeReady()
+
+	for i := 0; i < 3; i++ {
+		queue.Publish(fmt.Sprintf("func-d%d", i))
+	}
+
+	consumed := make(chan string, 3)
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumerFunc("func-cons", func(delivery Delivery) {
+		consumed <- delivery.Payload()
+		delivery.Ack()
+	})
+	c.Check(<-consumed, Equals, "func-d0")
+	c.Check(<-consumed, Equals, "func-d1")
+	c.Check(<-consumed, Equals, "func-d2")
+	queue.StopConsuming()
+
+	connection.StopHeartbeat()
+	connection = OpenConnection("func-conn", "tcp", "localhost:6379", 1) // the stopped queue can't consume again
+	queue = connection.OpenQueue("func-q").(*redisQueue)
+	for i := 0; i < 2; i++ {
+		queue.Publish(fmt.Sprintf("func-d%d", i))
+	}
+
+	batches := make(chan Deliveries, 1)
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddBatchConsumerFunc("func-batch-cons", 2, func(batch Deliveries) {
+		batches <- batch
+	})
+	c.Check(<-batches, HasLen, 2)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+// hookConsumer records its lifecycle hook calls
+type hookConsumer struct {
+	events chan string
+}
+
+func (consumer *hookConsumer) Consume(delivery Delivery) {
+	consumer.events <- "consume"
+	delivery.Ack()
+}
+
+func (consumer *hookConsumer) OnStart() {
+	consumer.events <- "start"
+}
+
+func (consumer *hookConsumer) OnStop() {
+	consumer.events <- "stop"
+}
+
+func (consumer *hookConsumer) OnRemoved() {
+	consumer.events <- "removed"
+}
+
+func (suite *QueueSuite) TestConsumerHooks(c *C) {
+	connection := OpenConnection("hook-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("hook-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("hook-d1")
+
+	consumer := &hookConsumer{events: make(chan string, 10)}
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("hook-cons", consumer)
+	c.Check(<-consumer.events, Equals, "start")
+	c.Check(<-consumer.events, Equals, "consume")
+	queue.StopConsuming()
+	c.Check(<-consumer.events, Equals, "stop")
+
+	connection.StopHeartbeat()
+	connection = OpenConnection("hook-conn", "tcp", "localhost:6379", 1) // the stopped queue can't consume again
+	queue = connection.OpenQueue("hook-q").(*redisQueue)
+	queue.StartConsuming(10, time.Millisecond)
+	_, stop, _ := queue.addStoppableConsumer("hook-cons", consumer)
+	c.Check(<-consumer.events, Equals, "start")
+	stop()
+	c.Check(<-consumer.events, Equals, "stop")
+	c.Check(<-consumer.events, Equals, "removed")
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestRemoveConsumer(c *C) {
+	connection := OpenConnection("remove-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("remove-q").(*redisQueue)
+	queue.PurgeReady()
+
+	consumer := &hookConsumer{events: make(chan string, 10)}
+	batchConsumer := NewTestBatchConsumer()
+	queue.StartConsuming(10, time.Millisecond)
+	name, _ := queue.AddConsumer("remove-cons", consumer)
+	batchName, _ := queue.AddBatchConsumerWithTimeout("remove-batch-cons", 2, time.Millisecond, batchConsumer)
+	c.Check(<-consumer.events, Equals, "start")
+
+	c.Check(queue.RemoveConsumer(name), Equals, true)
+	c.Check(<-consumer.events, Equals, "stop")
+	c.Check(<-consumer.events, Equals, "removed")
+
+	queue.Publish("remove-d1")
+	time.Sleep(5 * time.Millisecond)
+	c.Check(batchConsumer.LastBatch, HasLen, 1) // only the batch consumer is left
+	c.Check(consumer.events, HasLen, 0)
+
+	c.Check(queue.RemoveConsumer(batchName), Equals, true)
+	time.Sleep(time.Millisecond)
+	queue.Publish("remove-d2")
+	time.Sleep(5 * time.Millisecond)
+	c.Check(batchConsumer.LastBatch[0].Payload(), Equals, "remove-d1")
+	c.Check(queue.GetConsumers(), HasLen, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestGet(c *C) {
+	connection := OpenConnection("get-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("get-q").(*redisQueue)
+	queue.PurgeReady()
+	for i := 0; i < 3; i++ {
+		queue.Publish(fmt.Sprintf("get-d%d", i))
+	}
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "get-d0")
+	c.Check(queue.UnackedCount(), Equals, 1)
+	c.Check(delivery.Ack(), Equals, true)
+
+	deliveries, err := queue.GetBatch(context.Background(), 5)
+	c.Assert(err, IsNil)
+	c.Check(deliveries, HasLen, 2)
+	c.Check(deliveries.Ack(), Equals, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = queue.Get(ctx)
+	c.Check(err, Equals, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		queue.Publish("get-d3")
+	}()
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "get-d3")
+	c.Check(connection.GetConsumingQueues(), DeepEquals, []string{"get-q"})
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestAutoAck(c *C) {
+	connection := OpenConnection("auto-ack-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("auto-ack-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetAutoAck(true)
+	for i := 0; i < 4; i++ {
+		queue.Publish(fmt.Sprintf("auto-ack-d%d", i))
+	}
+
+	deliveries, err := queue.GetBatch(context.Background(), 3)
+	c.Assert(err, IsNil)
+	c.Check(deliveries.Payloads(), DeepEquals, []string{"auto-ack-d0", "auto-ack-d1", "auto-ack-d2"})
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(queue.UnackedCount(), Equals, 0)
+
+	c.Check(deliveries[0].Ack(), Equals, true)
+	c.Check(deliveries[0].Ack(), Equals, false)
+	c.Check(deliveries[1].Reject(), Equals, true)
+	c.Check(deliveries[1].Ack(), Equals, false)
+	c.Check(queue.PeekRejected(2), DeepEquals, []string{"auto-ack-d1"})
+	c.Check(deliveries[2:].AckExcept([]int{0}, false), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 2)
+
+	// consumers
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	consumer := NewTestConsumer("auto-ack-A")
+	consumer.AutoAck = true
+	_, err = queue.AddConsumer("auto-ack-cons", consumer)
+	c.Assert(err, IsNil)
+	queue.Publish("auto-ack-d4")
+	time.Sleep(20 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 2)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	queue.StopConsuming()
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestDeliveries(c *C) {
+	connection := OpenConnection("deliveries-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("deliveries-q").(*redisQueue)
+	queue.PurgeReady()
+	_, err := queue.Deliveries()
+	c.Check(err, Equals, ErrNotConsuming)
+	c.Check(queue.StartConsuming(2, time.Millisecond), IsNil)
+	deliveries, err := queue.Deliveries()
+	c.Assert(err, IsNil)
+
+	queue.Publish("deliveries-d1")
+	select {
+	case delivery := <-deliveries:
+		c.Check(delivery.Payload(), Equals, "deliveries-d1")
+		c.Check(delivery.Ack(), Equals, true)
+	case <-time.After(time.Second):
+		c.Fatal("no delivery received")
+	}
+
+	// keeps delivering after the delivery channel was resized
+	c.Check(queue.SetPrefetchLimit(5), Equals, true)
+	queue.Publish("deliveries-d2")
+	select {
+	case delivery := <-deliveries:
+		c.Check(delivery.Payload(), Equals, "deliveries-d2")
+		c.Check(delivery.Ack(), Equals, true)
+	case <-time.After(time.Second):
+		c.Fatal("no delivery received")
+	}
+
+	queue.StopConsuming()
+	select {
+	case _, ok := <-deliveries:
+		c.Check(ok, Equals, false)
+	case <-time.After(time.Second):
+		c.Fatal("deliveries not closed")
+	}
+
+	connection.StopHeartbeat()
+}
+
+// hangingConsumer blocks on the first delivery until its context is done
+type hangingConsumer struct {
+	hung     chan error
+	consumed chan Delivery
+}
+
+func (consumer *hangingConsumer) Consume(delivery Delivery) {
+	consumer.ConsumeContext(context.Background(), delivery)
+}
+
+func (consumer *hangingConsumer) ConsumeContext(ctx context.Context, delivery Delivery) {
+	if delivery.Payload() == "timeout-hang" {
+		<-ctx.Done()
+		consumer.hung <- ctx.Err()
+		return
+	}
+	delivery.Ack()
+	consumer.consumed <- delivery
+}
+
+func (suite *QueueSuite) TestProcessingTimeout(c *C) {
+	connection := OpenConnection("timeout-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("timeout-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetProcessingTimeout(20*time.Millisecond, TimeoutReject)
+	queue.Publish("timeout-hang")
+	queue.Publish("timeout-ok")
+
+	consumer := &hangingConsumer{hung: make(chan error, 1), consumed: make(chan Delivery, 1)}
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("timeout-cons", consumer)
+
+	select {
+	case err := <-consumer.hung:
+		c.Check(err, Equals, context.Canceled)
+	case <-time.After(time.Second):
+		c.Fatal("consumer context not cancelled")
+	}
+	select {
+	case delivery := <-consumer.consumed:
+		c.Check(delivery.Payload(), Equals, "timeout-ok")
+	case <-time.After(time.Second):
+		c.Fatal("consumer stalled")
+	}
+	c.Check(queue.RejectedCount(), Equals, 1)
+	c.Check(queue.PeekRejected(1), DeepEquals, []string{"timeout-hang"})
+	reason, ok := queue.RejectionReason("timeout-hang")
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, "processing timeout")
+	c.Check(reason.Consumer, Matches, "timeout-cons-.*")
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestRejectWithReason(c *C) {
+	connection := OpenConnection("reason-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("reason-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.Publish("reason-d1")
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	before := time.Now()
+	c.Check(delivery.RejectWithReason("invalid task"), Equals, true)
+	c.Check(delivery.RejectWithReason("again"), Equals, false)
+	c.Check(queue.RejectedCount(), Equals, 1)
+
+	reason, ok := queue.RejectionReason("reason-d1")
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, "invalid task")
+	c.Check(reason.Consumer, Equals, "") // not rejected by a consumer
+	c.Check(reason.RejectedAt.Before(before.Add(-time.Second)), Equals, false)
+
+	c.Check(queue.ReturnAllRejected(), Equals, 1)
+	_, ok = queue.RejectionReason("reason-d1")
+	c.Check(ok, Equals, false)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestRejectedRetention(c *C) {
+	connection := OpenConnection("retention-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("retention-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	for i := 1; i <= 4; i++ {
+		queue.Publish(fmt.Sprintf("retention-d%d", i))
+	}
+	deliveries, err := queue.GetBatch(context.Background(), 4)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 4)
+	c.Check(deliveries[:3].Reject(), Equals, 0)
+
+	archived := []string{}
+	queue.SetRejectedRetention(RejectedRetention{
+		MaxLength: 2,
+		MaxAge:    50 * time.Millisecond,
+		Archive:   func(payloads []string) { archived = append(archived, payloads...) },
+	})
+	c.Check(queue.TrimRejected(), Equals, 1)
+	c.Check(archived, DeepEquals, []string{"retention-d1"})
+	c.Check(queue.RejectedCount(), Equals, 2)
+	_, ok := queue.RejectionReason("retention-d1")
+	c.Check(ok, Equals, false)
+
+	time.Sleep(50 * time.Millisecond)
+	c.Check(deliveries[3].Reject(), Equals, true)
+	c.Check(queue.TrimRejected(), Equals, 2) // too old
+	c.Check(archived, DeepEquals, []string{"retention-d1", "retention-d2", "retention-d3"})
+	c.Check(queue.PeekRejected(2), DeepEquals, []string{"retention-d4"})
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestMaxHops(c *C) {
+	connection := OpenConnection("hops-conn", "tcp", "localhost:6379", 1)
+	queue1 := connection.OpenQueue("hops-q1").(*redisQueue)
+	queue2 := connection.OpenQueue("hops-q2").(*redisQueue)
+	for _, queue := range []*redisQueue{queue1, queue2} {
+		queue.PurgeReady()
+		queue.PurgeRejected()
+		queue.SetMaxHops(2)
+	}
+	queue1.SetPushQueue(queue2)
+	queue2.SetPushQueue(queue1)
+	queue1.Publish("hops-d1")
+
+	// q1 -> q2 -> q1 -> rejected
+	for i, queue := range []*redisQueue{queue1, queue2, queue1} {
+		delivery, err := queue.Get(context.Background())
+		c.Assert(err, IsNil)
+		c.Check(delivery.Payload(), Equals, "hops-d1")
+		c.Check(delivery.Push(), Equals, true, Commentf("push %d", i))
+	}
+	c.Check(queue1.ReadyCount(), Equals, 0)
+	c.Check(queue2.ReadyCount(), Equals, 0)
+	c.Assert(queue1.RejectedCount(), Equals, 1)
+
+	value := queue1.PeekRejected(1)[0]
+	c.Check(unwrapPayload(value), Equals, "hops-d1")
+	reason, ok := queue1.RejectionReason(value)
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, "hop limit 2 exceeded")
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestNamedConnection(c *C) {
+	redisClient := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	connection, err := OpenNamedConnection("named-conn", redisClient, false)
+	c.Assert(err, IsNil)
+	c.Check(connection.Name, Equals, "named-conn")
+
+	_, err = OpenNamedConnection("named-conn", redisClient, false)
+	c.Check(err, Equals, ErrConnectionNameInUse)
+
+	connection.StopHeartbeat()
+	connection, err = OpenNamedConnection("named-conn", redisClient, false)
+	c.Assert(err, IsNil)
+	connection.StopHeartbeat()
+
+	// only one of several processes opening the same name at once gets it
+	opened := make(chan *redisConnection, 10)
+	for i := 0; i < cap(opened); i++ {
+		go func() {
+			connection, _ := OpenNamedConnection("named-race-conn", redisClient, false)
+			opened <- connection
+		}()
+	}
+	owners := []*redisConnection{}
+	for i := 0; i < cap(opened); i++ {
+		if connection := <-opened; connection != nil {
+			owners = append(owners, connection)
+		}
+	}
+	c.Check(owners, HasLen, 1)
+	for _, connection := range owners {
+		connection.StopHeartbeat()
+	}
+
+	hostname, _ := os.Hostname()
+	connection = OpenConnection("", "tcp", "localhost:6379", 1)
+	c.Check(connection.Name, Matches, fmt.Sprintf("%s-%d-.{6}", regexp.QuoteMeta(hostname), os.Getpid()))
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestReclaimUnacked(c *C) {
+	redisClient := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	connection, err := OpenNamedConnection("reclaim-conn", redisClient, true)
+	c.Assert(err, IsNil)
+	queue := connection.OpenQueue("reclaim-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("reclaim-d1")
+	queue.Publish("reclaim-d2")
+	deliveries, err := queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Check(deliveries, HasLen, 2)
+	c.Check(queue.UnackedCount(), Equals, 2)
+	connection.StopHeartbeat() // crash without acking
+
+	connection, err = OpenNamedConnection("reclaim-conn", redisClient, true)
+	c.Assert(err, IsNil)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 2)
+	c.Check(connection.GetConsumingQueues(), HasLen, 0)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestPause(c *C) {
+	connection := OpenConnection("pause-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("pause-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Resume()
+
+	c.Check(queue.Pause(), Equals, true)
+	c.Check(queue.Paused(), Equals, true)
+	otherConnection := OpenConnection("pause-other", "tcp", "localhost:6379", 1)
+	other := otherConnection.OpenQueue("pause-q")
+	c.Check(other.Paused(), Equals, true) // shared through Redis
+
+	consumer := NewTestConsumer("pause-cons")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("pause-cons", consumer)
+	queue.Publish("pause-d1")
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 0)
+	c.Check(queue.ReadyCount(), Equals, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := other.Get(ctx)
+	c.Check(err, Equals, context.DeadlineExceeded)
+
+	c.Check(queue.Resume(), Equals, true)
+	c.Check(queue.Paused(), Equals, false)
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 1)
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+	otherConnection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestConsumerLimit(c *C) {
+	connection := OpenConnection("limit-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("limit-q").(*redisQueue)
+	queue.PurgeReady()
+	for i := 0; i < 5; i++ {
+		queue.Publish(fmt.Sprintf("limit-d%d", i))
+	}
+
+	queue.StartConsuming(10, time.Millisecond)
+	consumer := NewTestConsumer("limit-cons")
+	consumer.AutoAck = false // settles later
+	queue.AddConsumerWithLimit("limit-cons", 2, consumer)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+	c.Check(queue.UnackedCount(), Equals, 5) // the rest is prefetched
+
+	c.Check(consumer.LastDeliveries[0].Ack(), Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 3)
+
+	c.Check(consumer.LastDeliveries[1].Reject(), Equals, true)
+	c.Check(consumer.LastDeliveries[2].Push(), Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	c.Check(consumer.LastDeliveries, HasLen, 5)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestAckExcept(c *C) {
+	connection := OpenConnection("ack-except-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("ack-except-q").(*redisQueue)
+	pushQueue := connection.OpenQueue("ack-except-push").(*redisQueue)
+	queue.SetPushQueue(pushQueue)
+	for _, q := range []*redisQueue{queue, pushQueue} {
+		q.PurgeReady()
+		q.PurgeRejected()
+	}
+	for i := 0; i < 6; i++ {
+		queue.Publish(fmt.Sprintf("ack-except-d%d", i))
+	}
+
+	deliveries, err := queue.GetBatch(context.Background(), 4)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 4)
+	c.Check(deliveries.AckExcept([]int{1, 3}, false), Equals, 0)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.PeekRejected(2), DeepEquals, []string{"ack-except-d1", "ack-except-d3"})
+	_, ok := queue.RejectionReason("ack-except-d1")
+	c.Check(ok, Equals, true)
+	c.Check(deliveries.AckExcept(nil, false), Equals, 4) // already settled
+
+	deliveries, err = queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Check(deliveries.AckExcept([]int{0}, true), Equals, 0)
+	c.Check(pushQueue.PeekReady(1), DeepEquals, []string{"ack-except-d4"})
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 2)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestLatency(c *C) {
+	connection := OpenConnection("latency-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("latency-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.StartConsuming(10, time.Millisecond)
+	consumer := NewTestConsumer("latency-A")
+	name, _ := queue.AddConsumer("latency-cons", consumer)
+
+	queue.Publish("latency-d1")
+	queue.SetEnvelope(true)
+	queue.Publish("latency-d2")
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 2)
+
+	_, ok := consumer.LastDeliveries[0].Latency()
+	c.Check(ok, Equals, false) // raw payload
+	latency, ok := consumer.LastDeliveries[1].Latency()
+	c.Check(ok, Equals, true)
+	c.Check(latency > 0, Equals, true)
+
+	time.Sleep(consumerMetricsFlushInterval + 100*time.Millisecond)
+	stat := queue.GetConsumerStats()[name]
+	c.Check(stat.AverageLatency(), Equals, latency.Truncate(time.Microsecond))
+	c.Check(stat.LatencyPercentile(0.99), Equals, latencyBuckets[latencyBucket(latency)])
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestStopConsumingConcurrently(c *C) {
+	connection := OpenConnection("stop-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("stop-q").(*redisQueue)
+	c.Check(queue.StopConsuming(), Equals, false) // not consuming
+
+	c.Assert(queue.StartConsuming(10, time.Hour), IsNil)
+	deliveries, err := queue.Deliveries()
+	c.Assert(err, IsNil)
+
+	results := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		go func() { results <- queue.StopConsuming() }()
+	}
+	stopped := 0
+	for i := 0; i < 10; i++ {
+		if <-results {
+			stopped++
+		}
+	}
+	c.Check(stopped, Equals, 1)
+
+	// doesn't wait for the poll duration
+	select {
+	case _, ok := <-deliveries:
+		c.Check(ok, Equals, false)
+	case <-time.After(time.Second):
+		c.Error("consume loop didn't stop")
+	}
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestQueueRegistry(c *C) {
+	connection := OpenConnection("registry-conn", "tcp", "localhost:6379", 1)
+	c.Check(connection.Queues(), HasLen, 0)
+
+	queue := connection.OpenQueue("registry-q2")
+	c.Check(connection.OpenQueue("registry-q2"), Equals, queue)
+	connection.OpenQueue("registry-q1")
+	queues := connection.Queues()
+	c.Assert(queues, HasLen, 2)
+	c.Check(queues[0].(*redisQueue).name, Equals, "registry-q1")
+	c.Check(queues[1], Equals, queue)
+
+	c.Check(queue.StartConsuming(10, time.Millisecond), IsNil)
+	c.Check(connection.OpenQueue("registry-q2").StartConsuming(10, time.Millisecond), Equals, ErrAlreadyConsuming)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestDeliveryMetadata(c *C) {
+	connection := OpenConnection("metadata-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("metadata-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetEnvelope(true)
+	queue.Publish("metadata-d")
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.QueueName(), Equals, "metadata-q")
+	c.Check(delivery.ConsumerName(), Equals, "")
+	count, ok := delivery.RedeliveryCount()
+	c.Check(ok, Equals, true)
+	c.Check(count, Equals, 0)
+	c.Check(delivery.IsRedelivered(), Equals, false)
+
+	c.Check(queue.ReturnAllUnacked(), Equals, 1)
+	delivery, _ = queue.Get(context.Background())
+	c.Check(delivery.Payload(), Equals, "metadata-d")
+	count, _ = delivery.RedeliveryCount()
+	c.Check(count, Equals, 1)
+	c.Check(delivery.IsRedelivered(), Equals, true)
+
+	delivery.Reject()
+	c.Check(queue.ReturnAllRejected(), Equals, 1)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	consumed := make(chan Delivery, 1)
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	name, _ := queue.AddConsumerFunc("metadata-cons", func(delivery Delivery) {
+		delivery.Ack()
+		consumed <- delivery
+	})
+	delivery = <-consumed
+	c.Check(delivery.ConsumerName(), Equals, name)
+	count, _ = delivery.RedeliveryCount()
+	c.Check(count, Equals, 2)
+
+	queue.SetEnvelope(false)
+	queue.Publish("metadata-raw")
+	delivery = <-consumed
+	_, ok = delivery.RedeliveryCount()
+	c.Check(ok, Equals, false)
+	c.Check(delivery.IsRedelivered(), Equals, false)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
 func (suite *QueueSuite) TestMulti(c *C) {
 	connection := OpenConnection("multi-conn", "tcp", "localhost:6379", 1)
 	queue := connection.OpenQueue("multi-q").(*redisQueue)
@@ -287,6 +1211,73 @@ func (suite *QueueSuite) TestBatch(c *C) {
 	c.Check(queue.RejectedCount(), Equals, 3)
 }
 
+func (suite *QueueSuite) TestBatchOptions(c *C) {
+	connection := OpenConnection("batch-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("batch-options-q").(*redisQueue)
+	queue.PurgeRejected()
+	queue.PurgeReady()
+
+	for i := 0; i < 5; i++ {
+		c.Check(queue.Publish(fmt.Sprintf("bopt-%d", i)), Equals, true)
+	}
+
+	batches := make(chan []string, 5)
+	queue.StartConsuming(10, time.Millisecond)
+	options := BatchOptions{Size: 10, MinSize: 3, Timeout: 5 * time.Millisecond, MaxWait: 50 * time.Millisecond, MaxBytes: 12}
+	queue.AddBatchConsumerWithOptions("batch-options-cons", options, BatchConsumerFunc(func(batch Deliveries) {
+		batch.Ack()
+		batches <- batch.Payloads()
+	}))
+
+	// at most two payloads of six bytes fit into a batch
+	c.Check(<-batches, DeepEquals, []string{"bopt-0", "bopt-1"})
+	c.Check(<-batches, DeepEquals, []string{"bopt-2", "bopt-3"})
+
+	// the last one waits for more deliveries until max wait passed
+	select {
+	case batch := <-batches:
+		c.Fatalf("batch %v consumed before max wait", batch)
+	case <-time.After(30 * time.Millisecond):
+	}
+	c.Check(<-batches, DeepEquals, []string{"bopt-4"})
+	c.Check(queue.UnackedCount(), Equals, 0)
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestUnackedLimit(c *C) {
+	connection := OpenConnection("unacked-limit-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("unacked-limit-q").(*redisQueue)
+	queue.PurgeReady()
+	for i := 0; i < 10; i++ {
+		queue.Publish(fmt.Sprintf("unacked-limit-d%d", i))
+	}
+
+	queue.SetUnackedLimit(3)
+	deliveries := make(chan Delivery, 10)
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	queue.AddConsumerFunc("unacked-limit-cons", func(delivery Delivery) {
+		deliveries <- delivery // acked later, like by a slow consumer
+	})
+	time.Sleep(20 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 3)
+	c.Check(queue.ReadyCount(), Equals, 7)
+
+	(<-deliveries).Ack()
+	time.Sleep(20 * time.Millisecond)
+	c.Check(queue.UnackedCount(), Equals, 3)
+	c.Check(queue.ReadyCount(), Equals, 6)
+
+	queue.SetUnackedLimit(0)
+	time.Sleep(20 * time.Millisecond)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	queue.StopConsuming()
+	for len(deliveries) > 0 {
+		(<-deliveries).Ack()
+	}
+	connection.StopHeartbeat()
+}
+
 func (suite *QueueSuite) TestReturnRejected(c *C) {
 	connection := OpenConnection("return-conn", "tcp", "localhost:6379", 1)
 	queue := connection.OpenQueue("return-q").(*redisQueue)
@@ -340,6 +1331,142 @@ func (suite *QueueSuite) TestReturnRejected(c *C) {
 	c.Check(queue.RejectedCount(), Equals, 0)
 }
 
+func (suite *QueueSuite) TestDeleteAndMove(c *C) {
+	connection := OpenConnection("delete-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("delete-q").(*redisQueue)
+	other := connection.OpenQueue("delete-other").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	other.PurgeReady()
+
+	for i := 0; i < 4; i++ {
+		c.Check(queue.Publish(fmt.Sprintf("delete-d%d", i)), Equals, true)
+	}
+	c.Check(queue.ReadyCount(), Equals, 4)
+
+	c.Check(queue.DeleteReady("delete-d1"), Equals, true)
+	c.Check(queue.DeleteReady("delete-d1"), Equals, false)
+	c.Check(queue.ReadyCount(), Equals, 3)
+
+	c.Check(queue.MoveReady("delete-d2", other), Equals, true)
+	c.Check(queue.MoveReady("delete-d2", other), Equals, false)
+	c.Check(queue.ReadyCount(), Equals, 2)
+	c.Check(other.ReadyCount(), Equals, 1)
+
+	c.Check(queue.redisClient.LPush(queue.rejectedKey, "delete-r1"), Equals, true)
+	c.Check(queue.redisClient.LPush(queue.rejectedKey, "delete-r2"), Equals, true)
+	c.Check(queue.DeleteRejected("delete-r1"), Equals, true)
+	c.Check(queue.MoveRejected("delete-r2", other), Equals, true)
+	c.Check(queue.RejectedCount(), Equals, 0)
+	c.Check(other.ReadyCount(), Equals, 2)
+
+	c.Check(queue.MoveReady("delete-d0", NewTestQueue("delete-test")), Equals, false)
+	c.Check(queue.ReadyCount(), Equals, 2)
+
+	// enveloped deliveries are matched by their ID
+	c.Check(queue.PublishWithHeaders("delete-e1", map[string]string{"k": "v"}), Equals, true)
+	c.Check(queue.PublishWithHeaders("delete-e2", map[string]string{"k": "v"}), Equals, true)
+	result := queue.SearchReady(SearchQuery{Contains: "delete-e"})
+	c.Assert(result.Matches, HasLen, 2)
+	c.Check(result.Matches[0].ID, Not(Equals), result.Matches[0].Value)
+	c.Check(queue.DeleteReady("delete-e1"), Equals, false)
+	c.Check(queue.DeleteReady(result.Matches[0].ID), Equals, true)
+	c.Check(queue.MoveReady(result.Matches[1].ID, other), Equals, true)
+	c.Check(queue.ReadyCount(), Equals, 2)
+	c.Check(other.ReadyCount(), Equals, 3)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestMoveTo(c *C) {
+	connection := OpenConnection("move-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("move-q").(*redisQueue)
+	other := connection.OpenQueue("move-other").(*redisQueue)
+	queue.PurgeReady()
+	other.PurgeReady()
+
+	for i := 0; i < purgeBatchSize+5; i++ {
+		c.Check(queue.Publish(fmt.Sprintf("move-d%d", i)), Equals, true)
+	}
+	c.Check(other.Publish("move-o"), Equals, true)
+
+	c.Check(queue.MoveTo(other, purgeBatchSize+2), Equals, purgeBatchSize+2)
+	c.Check(queue.ReadyCount(), Equals, 3)
+	c.Check(other.ReadyCount(), Equals, purgeBatchSize+3)
+	c.Check(other.PeekReady(3), DeepEquals, []string{"move-o", "move-d0", "move-d1"})
+	c.Check(queue.PeekReady(1), DeepEquals, []string{fmt.Sprintf("move-d%d", purgeBatchSize+2)})
+
+	c.Check(queue.MoveTo(other, 10), Equals, 3)
+	c.Check(queue.MoveTo(other, 10), Equals, 0)
+	c.Check(other.MoveTo(other, 10), Equals, 0)
+	c.Check(other.MoveTo(NewTestQueue("move-test"), 10), Equals, 0)
+	c.Check(other.ReadyCount(), Equals, purgeBatchSize+6)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestPeek(c *C) {
+	connection := OpenConnection("peek-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("peek-q").(*redisQueue)
+	queue.PurgeReady()
+
+	c.Check(queue.PeekReady(2), HasLen, 0)
+	for i := 0; i < 3; i++ {
+		c.Check(queue.Publish(fmt.Sprintf("peek-d%d", i)), Equals, true)
+	}
+
+	c.Check(queue.PeekReady(0), HasLen, 0)
+	c.Check(queue.PeekReady(2), DeepEquals, []string{"peek-d0", "peek-d1"})
+	c.Check(queue.PeekReady(10), DeepEquals, []string{"peek-d0", "peek-d1", "peek-d2"})
+	c.Check(queue.ReadyCount(), Equals, 3)
+	c.Check(queue.PeekRejected(10), HasLen, 0)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestTail(c *C) {
+	connection := OpenConnection("tail-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("tail-q").(*redisQueue)
+	queue.PurgeReady()
+
+	c.Check(queue.Publish("tail-d0"), Equals, true)
+	c.Check(queue.isTailed(), Equals, false)
+
+	payloads, stop := connection.Tail("tail-q")
+	queue.tailCheckedAt = time.Time{} // skip check interval
+	c.Check(queue.Publish("tail-d1"), Equals, true)
+	select {
+	case payload := <-payloads:
+		c.Check(payload, Equals, "tail-d1")
+	case <-time.After(time.Second):
+		c.Error("no payload received")
+	}
+	stop()
+
+	c.Check(queue.ReadyCount(), Equals, 2)
+	connection.StopHeartbeat()
+}
+
+func (suite *QueueSuite) TestNotifications(c *C) {
+	connection := OpenConnectionWithTestRedisClient("notify-conn")
+	queue := connection.OpenQueue("notify-q").(*redisQueue)
+
+	c.Check(queue.EnableNotifications(), Equals, true)
+	consumer := NewTestConsumer("notify-cons")
+	queue.StartConsuming(10, time.Hour)
+	queue.AddConsumer("notify-cons", consumer)
+	c.Check(queue.EnableNotifications(), Equals, false)
+
+	time.Sleep(2 * time.Millisecond)
+	c.Check(queue.Publish("notify-d1"), Equals, true)
+	time.Sleep(2 * time.Millisecond)
+	c.Assert(consumer.LastDelivery, NotNil) // woken up despite the long poll duration
+	c.Check(consumer.LastDelivery.Payload(), Equals, "notify-d1")
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
+
 func (suite *QueueSuite) TestPushQueue(c *C) {
 	connection := OpenConnection("push", "tcp", "localhost:6379", 1)
 	queue1 := connection.OpenQueue("queue1").(*redisQueue)
@@ -5,21 +5,65 @@ import "time"
 type RedisClient interface {
 	// simple keys
 	Set(key string, value string, expiration time.Duration) bool
-	Del(key string) (affected int, ok bool)      // default affected: 0
-	TTL(key string) (ttl time.Duration, ok bool) // default ttl: 0
+	Del(key string) (affected int, ok bool)                // default affected: 0
+	TTL(key string) (ttl time.Duration, ok bool)           // default ttl: 0
+	SetLease(key, holder string, lease time.Duration) bool // sets key to holder with expiration lease if unset or held by holder
+	DelLease(key, holder string) bool                      // deletes key if held by holder
+	RenameNX(key, newKey string) (renamed bool, ok bool)   // renamed is false if key doesn't exist or newKey exists
+	Expire(key string, expiration time.Duration) bool      // false if key doesn't exist
+
+	// SetXX is like Set, but updated is false if key doesn't exist
+	SetXX(key string, value string, expiration time.Duration) (updated bool, ok bool)
+	// SetNX is like Set, but set is false if key exists already
+	SetNX(key string, value string, expiration time.Duration) (set bool, ok bool)
 
 	// lists
 	LPush(key, value string) bool
+	LPushBatch(key string, values []string) bool // pushes values in order, so the last one ends up first
+	LPushMulti(values map[string][]string) bool  // like LPushBatch for each key, but all or nothing
 	LLen(key string) (affected int, ok bool)
 	LRem(key string, count int, value string) (affected int, ok bool)
 	LTrim(key string, start, stop int)
+	LRange(key string, start, stop int) (values []string) // default values: []string{}
 	RPopLPush(source, destination string) (value string, ok bool)
+	RPopLPushBatch(source, destination string, count int) (values []string)    // default values: []string{}
+	RPopBatch(key string, count int) (values []string)                         // default values: []string{}
+	SettleBatch(source string, values, destinations []string) (settled []bool) // removes values from source and pushes them to their destination unless it's empty
+
+	// RPopLPushReplace pops value if it's the last element of source and
+	// pushes replacement to destination instead
+	RPopLPushReplace(source, destination, value, replacement string) (moved bool, ok bool)
+
+	// LRemLPush removes value from source and pushes replacement to
+	// destination if it did
+	LRemLPush(source, destination, value, replacement string) (moved bool, ok bool)
+
+	// SettlePart pushes value to destination unless it's empty if pack is in
+	// unacked, and removes pack from unacked if last is set
+	SettlePart(unacked, pack, destination, value string, last bool) (settled bool, ok bool)
 
 	// sets
 	SAdd(key, value string) bool
-	SMembers(key string) (members []string)         // default members: []string{}
-	SRem(key, value string) (affected int, ok bool) // default affected: 0
+	SAddIfMissing(key, value string) (added bool, ok bool)           // added is false if value is a member already
+	SAddLPush(set, member, key, value string) (pushed bool, ok bool) // atomically pushes value to key if member wasn't in set and adds it
+	SMembers(key string) (members []string)                          // default members: []string{}
+	SRem(key, value string) (affected int, ok bool)                  // default affected: 0
+
+	// hashes
+	HSet(key, field, value string) bool
+	HSetXX(key, field, value string) (updated bool, ok bool) // updated is false if field doesn't exist
+	HGet(key, field string) (value string, ok bool)
+	HGetAll(key string) (fields map[string]string)  // default fields: map[string]string{}
+	HDel(key, field string) (affected int, ok bool) // default affected: 0
+	HIncrBy(key, field string, increment int) (value int, ok bool)
+	HIncrByLimit(key, field string, increment, limit int) (incremented bool, ok bool) // incremented is false if the sum of all fields would exceed limit
+
+	// pub/sub
+	Publish(channel, message string) bool
+	Subscribe(channel string) (messages <-chan string, unsubscribe func())
+	NotifyPush(key string) (notifications <-chan struct{}, stop func(), ok bool) // ok is false if keyspace notifications are disabled
 
 	// special
 	FlushDb()
+	LastError() error // last error other than a missing key, nil if there was none
 }
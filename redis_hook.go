@@ -0,0 +1,101 @@
+package rmq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisCommand describes a Redis command issued by rmq, see
+// SetRedisCommandHook
+type RedisCommand struct {
+	Name     string // lower case like "lpush" or "evalsha" for scripts
+	Key      string // first key, empty if the command has none
+	Duration time.Duration
+	Err      error // nil if the command succeeded or found nothing
+}
+
+// commandHook holds the hook of a connection, it's read by the wrapped
+// process function of the Redis client
+type commandHook struct {
+	mutex     sync.RWMutex
+	hook      func(RedisCommand)
+	installed bool
+}
+
+// SetRedisCommandHook calls hook after every Redis command issued through
+// this connection, its queues and deliveries, so slow operations can be
+// found or fed into APM tools. The hook is called synchronously and must be
+// fast. Pass nil to remove it. Returns false if the connection doesn't use a
+// go-redis client, like test connections.
+//
+// The hook wraps the go-redis client of the connection, which can't be undone.
+// If connections share a client, like those opened with
+// OpenConnectionWithRedisClient for the same client, each of their hooks is
+// called for the commands of all of them. Give connections their own client
+// to keep their hooks apart.
+func (connection *redisConnection) SetRedisCommandHook(hook func(RedisCommand)) bool {
+	wrapper, ok := connection.redisClient.(RedisWrapper)
+	if !ok {
+		return false
+	}
+
+	connection.commandHook.mutex.Lock()
+	defer connection.commandHook.mutex.Unlock()
+	connection.commandHook.hook = hook
+	if !connection.commandHook.installed {
+		connection.commandHook.installed = true // the client can't be unwrapped, so wrap it only once
+		wrapper.rawClient.WrapProcess(connection.commandHook.wrap)
+	}
+	return true
+}
+
+func (commandHook *commandHook) wrap(process func(redis.Cmder) error) func(redis.Cmder) error {
+	return func(cmd redis.Cmder) error {
+		start := time.Now()
+		err := process(cmd)
+
+		commandHook.mutex.RLock()
+		hook := commandHook.hook
+		commandHook.mutex.RUnlock()
+		if hook == nil {
+			return err
+		}
+
+		command := RedisCommand{
+			Name:     strings.ToLower(cmd.Name()),
+			Key:      commandKey(cmd),
+			Duration: time.Since(start),
+			Err:      err,
+		}
+		if command.Err == redis.Nil {
+			command.Err = nil
+		}
+		hook(command)
+		return err
+	}
+}
+
+// commandKey returns the first key of cmd, scripts pass the number of keys
+// before their keys
+func commandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	keyIndex := 1
+	switch strings.ToLower(cmd.Name()) {
+	case "eval", "evalsha":
+		if len(args) < 3 || fmt.Sprint(args[2]) == "0" {
+			return ""
+		}
+		keyIndex = 3
+	case "publish", "subscribe", "config", "ping", "flushdb":
+		return ""
+	}
+	if len(args) <= keyIndex {
+		return ""
+	}
+	key, _ := args[keyIndex].(string)
+	return key
+}
@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestRedisHookSuite(t *testing.T) {
+	TestingSuiteT(&RedisHookSuite{}, t)
+}
+
+type RedisHookSuite struct{}
+
+func (suite *RedisHookSuite) TestRedisCommandHook(c *C) {
+	connection := OpenConnection("hook-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("hook-q").(*redisQueue)
+	queue.PurgeReady()
+
+	var mutex sync.Mutex
+	commands := []RedisCommand{}
+	c.Check(connection.SetRedisCommandHook(func(command RedisCommand) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		commands = append(commands, command)
+	}), Equals, true)
+
+	recorded := func() []RedisCommand {
+		mutex.Lock()
+		defer mutex.Unlock()
+		result := commands
+		commands = []RedisCommand{}
+		return result
+	}
+
+	recorded() // drop heartbeats
+	queue.Publish("hook-d1")
+	published := recorded()
+	c.Assert(len(published) > 0, Equals, true)
+	c.Check(published[0].Name, Equals, "lpush")
+	c.Check(published[0].Key, Equals, queue.readyKey)
+	c.Check(published[0].Err, IsNil)
+	c.Check(published[0].Duration > 0, Equals, true)
+
+	queue.redisClient.SetLease(queue.consumerLockKey, "hook-holder", time.Second)
+	script := recorded()
+	c.Assert(len(script) > 0, Equals, true)
+	c.Check(script[len(script)-1].Key, Equals, queue.consumerLockKey)
+	queue.redisClient.DelLease(queue.consumerLockKey, "hook-holder")
+
+	c.Check(connection.SetRedisCommandHook(nil), Equals, true)
+	recorded()
+	queue.Publish("hook-d2")
+	c.Check(recorded(), HasLen, 0)
+
+	testConnection := OpenConnectionWithTestRedisClient("hook-test-conn")
+	c.Check(testConnection.SetRedisCommandHook(func(RedisCommand) {}), Equals, false)
+
+	connection.StopHeartbeat()
+	testConnection.StopHeartbeat()
+}
@@ -1,45 +1,328 @@
 package rmq
 
 import (
-	"log"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
+// rPopLPushBatchScript moves up to ARGV[1] elements from KEYS[1] to KEYS[2]
+// and returns them, it stops early if KEYS[1] gets empty
+var rPopLPushBatchScript = redis.NewScript(`
+local values = {}
+for i = 1, tonumber(ARGV[1]) do
+	local value = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+	if not value then
+		break
+	end
+	values[i] = value
+end
+return values
+`)
+
+// rPopBatchScript pops up to ARGV[1] elements from KEYS[1] and returns them,
+// it stops early if KEYS[1] gets empty
+var rPopBatchScript = redis.NewScript(`
+local values = {}
+for i = 1, tonumber(ARGV[1]) do
+	local value = redis.call('RPOP', KEYS[1])
+	if not value then
+		break
+	end
+	values[i] = value
+end
+return values
+`)
+
+// sAddLPushScript pushes ARGV[2] to KEYS[2] if ARGV[1] wasn't a member of
+// KEYS[1] and adds it, returns 1 if it pushed
+var sAddLPushScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('LPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// lPushMultiScript pushes values to all KEYS, ARGV holds the number of
+// values for each key followed by its values. It checks the types first, so
+// it pushes either all values or none.
+var lPushMultiScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local keyType = redis.call('TYPE', key)['ok']
+	if keyType ~= 'none' and keyType ~= 'list' then
+		return redis.error_reply('WRONGTYPE ' .. key .. ' holds a ' .. keyType)
+	end
+end
+local n = 1
+for _, key in ipairs(KEYS) do
+	local count = tonumber(ARGV[n])
+	for i = 1, count do
+		redis.call('LPUSH', key, ARGV[n + i])
+	end
+	n = n + count + 1
+end
+return 1
+`)
+
+// setLeaseScript sets KEYS[1] to ARGV[1] with an expiration of ARGV[2]
+// milliseconds if it's unset or already set to ARGV[1]
+var setLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// delLeaseScript deletes KEYS[1] if it's set to ARGV[1]
+var delLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// rPopLPushReplaceScript pops the last element of KEYS[1] if it's ARGV[1]
+// and pushes ARGV[2] to KEYS[2] instead, returns 1 if it did
+var rPopLPushReplaceScript = redis.NewScript(`
+if redis.call('LINDEX', KEYS[1], -1) ~= ARGV[1] then
+	return 0
+end
+redis.call('RPOP', KEYS[1])
+redis.call('LPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// lRemLPushScript removes ARGV[1] from KEYS[1] and pushes ARGV[2] to KEYS[2]
+// if it did, returns 1 if it moved
+var lRemLPushScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('LPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// hSetXXScript sets field ARGV[1] of KEYS[1] to ARGV[2] if the field exists,
+// returns 1 if it did
+var hSetXXScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// hIncrByLimitScript increments field ARGV[1] of KEYS[1] by ARGV[2] if the sum
+// of all fields stays within ARGV[3], returns 1 if it did
+var hIncrByLimitScript = redis.NewScript(`
+local sum = 0
+local values = redis.call('HVALS', KEYS[1])
+for i = 1, #values do
+	sum = sum + tonumber(values[i])
+end
+if sum + tonumber(ARGV[2]) > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// settleBatchScript removes each ARGV[i] from KEYS[1] and pushes it to
+// KEYS[i+1] unless that's empty, returns 1 for each removed value
+var settleBatchScript = redis.NewScript(`
+local settled = {}
+for i = 1, #ARGV do
+	settled[i] = redis.call('LREM', KEYS[1], 1, ARGV[i])
+	if settled[i] == 1 and KEYS[i + 1] ~= '' then
+		redis.call('LPUSH', KEYS[i + 1], ARGV[i])
+	end
+end
+return settled
+`)
+
+// settlePartScript pushes ARGV[2] to KEYS[2] unless that's empty if ARGV[1]
+// is in KEYS[1] and removes ARGV[1] from KEYS[1] if ARGV[3] is 1, returns 1
+// if ARGV[1] was in KEYS[1]
+var settlePartScript = redis.NewScript(`
+local found = false
+if ARGV[3] == '1' then
+	found = redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1
+else
+	for _, value in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+		if value == ARGV[1] then
+			found = true
+			break
+		end
+	end
+end
+if found and KEYS[2] ~= '' then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+if found then
+	return 1
+end
+return 0
+`)
+
 type RedisWrapper struct {
 	rawClient *redis.Client
+	lastError *redisError // shared by copies of the wrapper, see LastError
+}
+
+// redisError holds the last error of a wrapper
+type redisError struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func newRedisWrapper(rawClient *redis.Client) RedisWrapper {
+	return RedisWrapper{rawClient: rawClient, lastError: &redisError{}}
 }
 
 func (wrapper RedisWrapper) Set(key string, value string, expiration time.Duration) bool {
-	return checkErr(wrapper.rawClient.Set(key, value, expiration).Err())
+	return wrapper.checkErr(wrapper.rawClient.Set(key, value, expiration).Err())
+}
+
+func (wrapper RedisWrapper) SetXX(key string, value string, expiration time.Duration) (updated bool, ok bool) {
+	updated, err := wrapper.rawClient.SetXX(key, value, expiration).Result()
+	return updated, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) SetNX(key string, value string, expiration time.Duration) (set bool, ok bool) {
+	set, err := wrapper.rawClient.SetNX(key, value, expiration).Result()
+	return set, wrapper.checkErr(err)
 }
 
 func (wrapper RedisWrapper) Del(key string) (affected int, ok bool) {
 	n, err := wrapper.rawClient.Del(key).Result()
-	ok = checkErr(err)
+	ok = wrapper.checkErr(err)
 	if !ok {
 		return 0, false
 	}
 	return int(n), ok
 }
 
+func (wrapper RedisWrapper) RenameNX(key, newKey string) (renamed bool, ok bool) {
+	renamed, err := wrapper.rawClient.RenameNX(key, newKey).Result()
+	if err != nil && strings.Contains(err.Error(), "no such key") {
+		return false, true
+	}
+	return renamed, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) Expire(key string, expiration time.Duration) bool {
+	expired, err := wrapper.rawClient.Expire(key, expiration).Result()
+	return wrapper.checkErr(err) && expired
+}
+
+// TTL returns the remaining time to live of key in milliseconds precision,
+// because heartbeat TTLs may be shorter than a second
 func (wrapper RedisWrapper) TTL(key string) (ttl time.Duration, ok bool) {
-	ttl, err := wrapper.rawClient.TTL(key).Result()
-	ok = checkErr(err)
+	ttl, err := wrapper.rawClient.PTTL(key).Result()
+	ok = wrapper.checkErr(err)
 	if !ok {
 		return 0, false
 	}
 	return ttl, ok
 }
 
+// SettleBatch moves values from source to their destinations in one round
+// trip using a Lua script
+func (wrapper RedisWrapper) SettleBatch(source string, values, destinations []string) []bool {
+	settled := make([]bool, len(values))
+	if len(values) == 0 {
+		return settled
+	}
+
+	keys := append([]string{source}, destinations...)
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	result, err := settleBatchScript.Run(wrapper.rawClient, keys, args...).Result()
+	if ok := wrapper.checkErr(err); !ok {
+		return settled
+	}
+
+	elements, _ := result.([]interface{})
+	for i, element := range elements {
+		if count, ok := element.(int64); ok && i < len(settled) {
+			settled[i] = count == 1
+		}
+	}
+	return settled
+}
+
+// SettlePart settles a delivery of a pack in one round trip using a Lua
+// script
+func (wrapper RedisWrapper) SettlePart(unacked, pack, destination, value string, last bool) (settled bool, ok bool) {
+	lastArg := 0
+	if last {
+		lastArg = 1
+	}
+	result, err := settlePartScript.Run(wrapper.rawClient, []string{unacked, destination}, pack, value, lastArg).Int64()
+	return result == 1, wrapper.checkErr(err)
+}
+
+// SetLease takes or renews the lease on key for holder in one round trip
+// using a Lua script
+func (wrapper RedisWrapper) SetLease(key, holder string, lease time.Duration) bool {
+	result, err := setLeaseScript.Run(wrapper.rawClient, []string{key}, holder, int64(lease/time.Millisecond)).Int64()
+	return wrapper.checkErr(err) && result == 1
+}
+
+// DelLease releases the lease on key if holder has it
+func (wrapper RedisWrapper) DelLease(key, holder string) bool {
+	result, err := delLeaseScript.Run(wrapper.rawClient, []string{key}, holder).Int64()
+	return wrapper.checkErr(err) && result == 1
+}
+
 func (wrapper RedisWrapper) LPush(key, value string) bool {
-	return checkErr(wrapper.rawClient.LPush(key, value).Err())
+	return wrapper.checkErr(wrapper.rawClient.LPush(key, value).Err())
+}
+
+func (wrapper RedisWrapper) LPushBatch(key string, values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return wrapper.checkErr(wrapper.rawClient.LPush(key, args...).Err())
+}
+
+// LPushMulti pushes the values of all keys in one Lua script, so they are
+// pushed atomically
+func (wrapper RedisWrapper) LPushMulti(values map[string][]string) bool {
+	keys := make([]string, 0, len(values))
+	args := []interface{}{}
+	for key, keyValues := range values {
+		if len(keyValues) == 0 {
+			continue
+		}
+		keys = append(keys, key)
+		args = append(args, len(keyValues))
+		for _, value := range keyValues {
+			args = append(args, value)
+		}
+	}
+	if len(keys) == 0 {
+		return true
+	}
+	return wrapper.checkErr(lPushMultiScript.Run(wrapper.rawClient, keys, args...).Err())
 }
 
 func (wrapper RedisWrapper) LLen(key string) (affected int, ok bool) {
 	n, err := wrapper.rawClient.LLen(key).Result()
-	ok = checkErr(err)
+	ok = wrapper.checkErr(err)
 	if !ok {
 		return 0, false
 	}
@@ -48,25 +331,93 @@ func (wrapper RedisWrapper) LLen(key string) (affected int, ok bool) {
 
 func (wrapper RedisWrapper) LRem(key string, count int, value string) (affected int, ok bool) {
 	n, err := wrapper.rawClient.LRem(key, int64(count), value).Result()
-	return int(n), checkErr(err)
+	return int(n), wrapper.checkErr(err)
 }
 
 func (wrapper RedisWrapper) LTrim(key string, start, stop int) {
-	checkErr(wrapper.rawClient.LTrim(key, int64(start), int64(stop)).Err())
+	wrapper.checkErr(wrapper.rawClient.LTrim(key, int64(start), int64(stop)).Err())
+}
+
+func (wrapper RedisWrapper) LRange(key string, start, stop int) []string {
+	values, err := wrapper.rawClient.LRange(key, int64(start), int64(stop)).Result()
+	if ok := wrapper.checkErr(err); !ok {
+		return []string{}
+	}
+	return values
 }
 
 func (wrapper RedisWrapper) RPopLPush(source, destination string) (value string, ok bool) {
 	value, err := wrapper.rawClient.RPopLPush(source, destination).Result()
-	return value, checkErr(err)
+	return value, wrapper.checkErr(err)
+}
+
+// RPopLPushReplace is like RPopLPush, but pushes replacement instead of the
+// popped value and only if value is the last element. It uses a Lua script,
+// so the value is neither lost nor duplicated if it's popped concurrently.
+func (wrapper RedisWrapper) RPopLPushReplace(source, destination, value, replacement string) (moved bool, ok bool) {
+	result, err := rPopLPushReplaceScript.Run(wrapper.rawClient, []string{source, destination}, value, replacement).Int64()
+	return result == 1, wrapper.checkErr(err)
+}
+
+// LRemLPush removes value from source and pushes replacement to destination
+// if it did in one Lua script, so the value is neither lost nor duplicated if
+// it's removed concurrently
+func (wrapper RedisWrapper) LRemLPush(source, destination, value, replacement string) (moved bool, ok bool) {
+	result, err := lRemLPushScript.Run(wrapper.rawClient, []string{source, destination}, value, replacement).Int64()
+	return result == 1, wrapper.checkErr(err)
+}
+
+// RPopLPushBatch moves up to count elements in one round trip using a Lua script
+func (wrapper RedisWrapper) RPopLPushBatch(source, destination string, count int) []string {
+	result, err := rPopLPushBatchScript.Run(wrapper.rawClient, []string{source, destination}, count).Result()
+	if ok := wrapper.checkErr(err); !ok {
+		return []string{}
+	}
+
+	elements, _ := result.([]interface{})
+	values := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if value, ok := element.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// RPopBatch pops up to count elements in one round trip using a Lua script
+func (wrapper RedisWrapper) RPopBatch(key string, count int) []string {
+	result, err := rPopBatchScript.Run(wrapper.rawClient, []string{key}, count).Result()
+	if ok := wrapper.checkErr(err); !ok {
+		return []string{}
+	}
+
+	elements, _ := result.([]interface{})
+	values := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if value, ok := element.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 func (wrapper RedisWrapper) SAdd(key, value string) bool {
-	return checkErr(wrapper.rawClient.SAdd(key, value).Err())
+	return wrapper.checkErr(wrapper.rawClient.SAdd(key, value).Err())
+}
+
+func (wrapper RedisWrapper) SAddIfMissing(key, value string) (added bool, ok bool) {
+	count, err := wrapper.rawClient.SAdd(key, value).Result()
+	return count > 0, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) SAddLPush(set, member, key, value string) (pushed bool, ok bool) {
+	result, err := sAddLPushScript.Run(wrapper.rawClient, []string{set, key}, member, value).Int()
+	return result == 1, wrapper.checkErr(err)
 }
 
 func (wrapper RedisWrapper) SMembers(key string) []string {
 	members, err := wrapper.rawClient.SMembers(key).Result()
-	if ok := checkErr(err); !ok {
+	if ok := wrapper.checkErr(err); !ok {
 		return []string{}
 	}
 	return members
@@ -74,26 +425,155 @@ func (wrapper RedisWrapper) SMembers(key string) []string {
 
 func (wrapper RedisWrapper) SRem(key, value string) (affected int, ok bool) {
 	n, err := wrapper.rawClient.SRem(key, value).Result()
-	ok = checkErr(err)
+	ok = wrapper.checkErr(err)
 	if !ok {
 		return 0, false
 	}
 	return int(n), ok
 }
 
+func (wrapper RedisWrapper) HSet(key, field, value string) bool {
+	return wrapper.checkErr(wrapper.rawClient.HSet(key, field, value).Err())
+}
+
+// HSetXX is like HSet, but only sets existing fields using a Lua script
+func (wrapper RedisWrapper) HSetXX(key, field, value string) (updated bool, ok bool) {
+	result, err := hSetXXScript.Run(wrapper.rawClient, []string{key}, field, value).Int64()
+	return result == 1, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) HGet(key, field string) (value string, ok bool) {
+	value, err := wrapper.rawClient.HGet(key, field).Result()
+	return value, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) HGetAll(key string) map[string]string {
+	fields, err := wrapper.rawClient.HGetAll(key).Result()
+	if ok := wrapper.checkErr(err); !ok {
+		return map[string]string{}
+	}
+	return fields
+}
+
+func (wrapper RedisWrapper) HDel(key, field string) (affected int, ok bool) {
+	n, err := wrapper.rawClient.HDel(key, field).Result()
+	ok = wrapper.checkErr(err)
+	if !ok {
+		return 0, false
+	}
+	return int(n), ok
+}
+
+func (wrapper RedisWrapper) HIncrBy(key, field string, increment int) (value int, ok bool) {
+	n, err := wrapper.rawClient.HIncrBy(key, field, int64(increment)).Result()
+	ok = wrapper.checkErr(err)
+	if !ok {
+		return 0, false
+	}
+	return int(n), ok
+}
+
+// HIncrByLimit is like HIncrBy, but only increments if the sum of all fields
+// stays within limit using a Lua script
+func (wrapper RedisWrapper) HIncrByLimit(key, field string, increment, limit int) (incremented bool, ok bool) {
+	result, err := hIncrByLimitScript.Run(wrapper.rawClient, []string{key}, field, increment, limit).Int64()
+	return result == 1, wrapper.checkErr(err)
+}
+
+func (wrapper RedisWrapper) Publish(channel, message string) bool {
+	return wrapper.checkErr(wrapper.rawClient.Publish(channel, message).Err())
+}
+
+// Subscribe returns a channel receiving all messages published to the given
+// pub/sub channel until unsubscribe is called
+func (wrapper RedisWrapper) Subscribe(channel string) (<-chan string, func()) {
+	pubSub := wrapper.rawClient.Subscribe(channel)
+	// wait for the subscription to be confirmed before returning
+	_, err := pubSub.Receive()
+	wrapper.checkErr(err)
+
+	messages := make(chan string)
+	go func() {
+		defer close(messages)
+		for message := range pubSub.Channel() {
+			messages <- message.Payload
+		}
+	}()
+	return messages, func() { pubSub.Close() }
+}
+
+// NotifyPush uses keyspace notifications to signal pushes to the list at key.
+// Notifications are coalesced, a receiver is only guaranteed to be woken once
+// after any number of pushes. Returns false if keyspace notifications for
+// lists are not enabled on the server.
+func (wrapper RedisWrapper) NotifyPush(key string) (<-chan struct{}, func(), bool) {
+	config, err := wrapper.rawClient.ConfigGet("notify-keyspace-events").Result()
+	if err != nil || len(config) != 2 {
+		return nil, func() {}, false // CONFIG might be disabled on managed servers
+	}
+	if flags, _ := config[1].(string); !keyspaceListEventsEnabled(flags) {
+		return nil, func() {}, false
+	}
+
+	channel := fmt.Sprintf("__keyspace@%d__:%s", wrapper.rawClient.Options().DB, key)
+	pubSub := wrapper.rawClient.Subscribe(channel)
+	if _, err := pubSub.Receive(); err != nil {
+		pubSub.Close()
+		return nil, func() {}, false
+	}
+
+	notifications := make(chan struct{}, 1)
+	go func() {
+		for message := range pubSub.Channel() {
+			if message.Payload != "lpush" && message.Payload != "rpush" {
+				continue
+			}
+			select {
+			case notifications <- struct{}{}:
+			default: // a notification is pending already
+			}
+		}
+	}()
+	return notifications, func() { pubSub.Close() }, true
+}
+
+// keyspaceListEventsEnabled returns true if the notify-keyspace-events flags
+// include keyspace events (K) for lists (l or A)
+func keyspaceListEventsEnabled(flags string) bool {
+	return strings.Contains(flags, "K") && strings.ContainsAny(flags, "lA")
+}
+
 func (wrapper RedisWrapper) FlushDb() {
 	wrapper.rawClient.FlushDb()
 }
 
-// checkErr returns true if there is no error, false if the result error is nil and panics if there's another error
-func checkErr(err error) (ok bool) {
+// LastError returns the last error of a Redis command other than a missing
+// key, nil if there was none
+func (wrapper RedisWrapper) LastError() error {
+	if wrapper.lastError == nil {
+		return nil
+	}
+	wrapper.lastError.mutex.Lock()
+	defer wrapper.lastError.mutex.Unlock()
+	return wrapper.lastError.err
+}
+
+// checkErr returns true if there is no error and false otherwise. Errors other
+// than a missing key are logged and recorded, see LastError.
+func (wrapper RedisWrapper) checkErr(err error) (ok bool) {
 	switch err {
 	case nil:
 		return true
 	case redis.Nil:
 		return false
 	default:
-		log.Panicf("rmq redis error is not nil %s", err)
+		countVar(varRedisErrors, 1)
+		logf("rmq redis error %s", err)
+		if wrapper.lastError != nil {
+			wrapper.lastError.mutex.Lock()
+			wrapper.lastError.err = err
+			wrapper.lastError.mutex.Unlock()
+		}
 		return false
 	}
 }
@@ -0,0 +1,97 @@
+package rmq
+
+import (
+	"sync"
+	"time"
+)
+
+type redriveRule struct {
+	queue *redisQueue
+	count int // max rejected deliveries to return per run
+}
+
+// Redriver regularly returns rejected deliveries to ready, so deliveries
+// which failed because of transient errors are retried without someone
+// calling ReturnRejected
+type Redriver struct {
+	connection  *redisConnection
+	mutex       sync.Mutex
+	rules       []redriveRule
+	stopChan    chan struct{}
+	redriveLock sync.Mutex // serializes runs
+}
+
+func NewRedriver(connection *redisConnection) *Redriver {
+	return &Redriver{connection: connection}
+}
+
+// AddQueue makes each run return up to count of the oldest rejected
+// deliveries of queue to ready
+func (redriver *Redriver) AddQueue(queue string, count int) {
+	redriver.mutex.Lock()
+	defer redriver.mutex.Unlock()
+
+	redriver.rules = append(redriver.rules, redriveRule{
+		queue: redriver.connection.openQueue(queue),
+		count: count,
+	})
+}
+
+// Start returns rejected deliveries every interval until Stop is called
+func (redriver *Redriver) Start(interval time.Duration) {
+	redriver.mutex.Lock()
+	defer redriver.mutex.Unlock()
+
+	if redriver.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	redriver.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				redriver.Redrive()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the regular runs started by Start
+func (redriver *Redriver) Stop() {
+	redriver.mutex.Lock()
+	defer redriver.mutex.Unlock()
+
+	if redriver.stopChan == nil {
+		return
+	}
+	close(redriver.stopChan)
+	redriver.stopChan = nil
+}
+
+// Redrive returns rejected deliveries of all added queues once and returns
+// the number of returned deliveries
+func (redriver *Redriver) Redrive() int {
+	redriver.redriveLock.Lock()
+	defer redriver.redriveLock.Unlock()
+
+	redriver.mutex.Lock()
+	rules := append([]redriveRule(nil), redriver.rules...)
+	redriver.mutex.Unlock()
+
+	returned := 0
+	for _, rule := range rules {
+		count := rule.count
+		if rejected := rule.queue.RejectedCount(); rejected < count {
+			count = rejected
+		}
+		returned += rule.queue.ReturnRejected(count)
+	}
+	return returned
+}
@@ -0,0 +1,44 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestRedriverSuite(t *testing.T) {
+	TestingSuiteT(&RedriverSuite{}, t)
+}
+
+type RedriverSuite struct{}
+
+func (suite *RedriverSuite) TestRedrive(c *C) {
+	connection := OpenConnection("redrive-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("redrive-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	for _, payload := range []string{"redrive-d1", "redrive-d2", "redrive-d3"} {
+		c.Check(queue.redisClient.LPush(queue.rejectedKey, payload), Equals, true)
+	}
+
+	redriver := NewRedriver(connection)
+	redriver.AddQueue("redrive-q", 2)
+
+	c.Check(redriver.Redrive(), Equals, 2)
+	c.Check(queue.RejectedCount(), Equals, 1)
+	c.Check(queue.PeekReady(2), DeepEquals, []string{"redrive-d1", "redrive-d2"}) // oldest first
+
+	c.Check(redriver.Redrive(), Equals, 1)
+	c.Check(redriver.Redrive(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 3)
+
+	c.Check(queue.redisClient.LPush(queue.rejectedKey, "redrive-d4"), Equals, true)
+	redriver.Start(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	redriver.Stop()
+	c.Check(queue.RejectedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 4)
+
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,133 @@
+package rmq
+
+// ReturnRejectedWith returns up to count of the oldest rejected deliveries
+// to ready after passing their payloads through transform, for example to
+// fix a field a buggy producer got wrong. Deliveries for which transform
+// returns false are dropped instead. Changed payloads are published again
+// like Publish does, keeping headers and content type, unchanged ones are
+// returned as they are. Deliveries which can't be decoded are returned
+// without calling transform. Returns the number of returned deliveries.
+func (queue *redisQueue) ReturnRejectedWith(count int, transform func(payload string) (transformed string, keep bool)) int {
+	returned, dropped := 0, 0
+	options := queue.decodeOptions()
+	for i := 0; i < count; i++ {
+		oldest := queue.redisClient.LRange(queue.rejectedKey, -1, -1)
+		if len(oldest) == 0 {
+			break
+		}
+		value := oldest[0]
+
+		env, isEnvelope := decodeEnvelope(value)
+		payload := value
+		if isEnvelope {
+			decoded, err := env.decodePayload(options)
+			if err != nil {
+				if queue.returnRejected(1) == 0 {
+					break
+				}
+				returned++
+				continue
+			}
+			payload = decoded
+		}
+
+		transformed, keep := transform(payload)
+		if keep && transformed == payload {
+			if queue.returnRejected(1) == 0 {
+				break
+			}
+			returned++
+			continue
+		}
+
+		// remove first, so no other returner can return it too
+		if removed, ok := queue.redisClient.LRem(queue.rejectedKey, -1, value); !ok || removed != 1 {
+			continue // returned or deleted meanwhile
+		}
+		if !keep {
+			queue.redisClient.HDel(queue.reasonsKey, value)
+			queue.debugf("dropped rejected delivery %s %s", value, queue)
+			dropped++
+			continue
+		}
+		if !queue.republish(env, transformed) {
+			queue.redisClient.LPush(queue.rejectedKey, value) // keep it rejected
+			break
+		}
+		queue.redisClient.HDel(queue.reasonsKey, value)
+		queue.debugf("returned transformed rejected delivery %s %s", transformed, queue)
+		returned++
+	}
+
+	queue.audit(AuditReturnRejected, returned, "")
+	if dropped > 0 {
+		queue.audit(AuditPurgeRejected, dropped, "")
+	}
+	return returned
+}
+
+// republish publishes payload as a new delivery with the headers and content
+// type and expiration of env, which is nil for raw payloads
+func (queue *redisQueue) republish(env *envelope, payload string) bool {
+	if env == nil {
+		return queue.Publish(payload)
+	}
+
+	republished := newEnvelope("")
+	republished.Headers = env.Headers
+	republished.ContentType = env.ContentType
+	republished.Expires = env.Expires
+	if !queue.validate(payload, republished.ContentType) {
+		return false
+	}
+	return queue.publishEncoded(republished, []byte(payload))
+}
+
+// ReturnRejectedWhere returns up to limit rejected deliveries whose payloads
+// match predicate to ready, starting with the oldest. Other deliveries stay
+// rejected in their order, like poisonous ones which would only be rejected
+// again. Deliveries which can't be decoded are never returned. Returns the
+// number of returned deliveries.
+func (queue *redisQueue) ReturnRejectedWhere(predicate func(payload string) bool, limit int) int {
+	returned := 0
+	kept := 0 // number of oldest deliveries which were checked and stay rejected
+	options := queue.decodeOptions()
+	for returned < limit {
+		values := queue.redisClient.LRange(queue.rejectedKey, -kept-searchChunkSize, -kept-1)
+		for i := len(values) - 1; i >= 0 && returned < limit; i-- {
+			value := values[i]
+			payload := value
+			if env, ok := decodeEnvelope(value); ok {
+				decoded, err := env.decodePayload(options)
+				if err != nil {
+					kept++
+					continue
+				}
+				payload = decoded
+			}
+
+			if !predicate(payload) || !queue.returnRejectedValue(value) {
+				kept++
+				continue
+			}
+			returned++
+		}
+		if len(values) < searchChunkSize {
+			break
+		}
+	}
+
+	queue.audit(AuditReturnRejected, returned, "")
+	return returned
+}
+
+// returnRejectedValue moves the rejected delivery stored as value back to
+// ready, returns false if it isn't rejected anymore
+func (queue *redisQueue) returnRejectedValue(value string) bool {
+	if moved, _ := queue.redisClient.LRemLPush(queue.rejectedKey, queue.readyKey, value, redeliveredValue(value)); !moved {
+		return false
+	}
+	queue.redisClient.HDel(queue.reasonsKey, value)
+	queue.debugf("returned rejected delivery %s %s", value, queue.readyKey)
+	return true
+}
@@ -0,0 +1,99 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestRequeueSuite(t *testing.T) {
+	TestingSuiteT(&RequeueSuite{}, t)
+}
+
+type RequeueSuite struct{}
+
+func (suite *RequeueSuite) TestReturnRejectedWith(c *C) {
+	connection := OpenConnection("requeue-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("requeue-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	c.Check(queue.Publish("requeue-ok"), Equals, true)
+	c.Check(queue.Publish("requeue-bad"), Equals, true)
+	c.Check(queue.PublishWithHeaders("requeue-fix", map[string]string{"h": "v"}), Equals, true)
+	c.Check(queue.Publish("requeue-later"), Equals, true)
+	for i := 0; i < 4; i++ {
+		delivery, err := queue.Get(context.Background())
+		c.Assert(err, IsNil)
+		c.Check(delivery.Reject(), Equals, true)
+	}
+
+	transformed := []string{}
+	returned := queue.ReturnRejectedWith(3, func(payload string) (string, bool) {
+		transformed = append(transformed, payload)
+		if payload == "requeue-bad" {
+			return "", false
+		}
+		return strings.Replace(payload, "fix", "fixed", 1), true
+	})
+	c.Check(returned, Equals, 2)
+	c.Check(transformed, DeepEquals, []string{"requeue-ok", "requeue-bad", "requeue-fix"})
+	c.Check(queue.PeekRejected(2), DeepEquals, []string{"requeue-later"})
+	_, ok := queue.RejectionReason("requeue-bad")
+	c.Check(ok, Equals, false)
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "requeue-ok")
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "requeue-fixed")
+	c.Check(delivery.Header("h"), Equals, "v")
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	// transformed payloads are validated like published ones
+	queue.SetValidator(ValidJSON)
+	c.Check(queue.ReturnRejectedWith(1, func(payload string) (string, bool) {
+		return payload + "!", true
+	}), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 1)
+	queue.SetValidator(nil)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *RequeueSuite) TestReturnRejectedWhere(c *C) {
+	connection := OpenConnection("requeue-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("requeue-where-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	count := searchChunkSize + 10
+	for i := 0; i < count; i++ {
+		c.Check(queue.redisClient.LPush(queue.rejectedKey, fmt.Sprintf("requeue-%d", i)), Equals, true)
+	}
+	c.Check(queue.redisClient.HSet(queue.reasonsKey, "requeue-5", "reason"), Equals, true)
+
+	even := func(payload string) bool {
+		var i int
+		fmt.Sscanf(payload, "requeue-%d", &i)
+		return i%2 == 0
+	}
+	c.Check(queue.ReturnRejectedWhere(even, 3), Equals, 3)
+	c.Check(queue.PeekReady(3), DeepEquals, []string{"requeue-0", "requeue-2", "requeue-4"})
+	c.Check(queue.PeekRejected(3), DeepEquals, []string{"requeue-1", "requeue-3", "requeue-5"})
+
+	// scans across chunks and keeps the order of the rest
+	c.Check(queue.ReturnRejectedWhere(even, count), Equals, count/2-3)
+	c.Check(queue.ReadyCount(), Equals, count/2)
+	c.Check(queue.RejectedCount(), Equals, count/2)
+	c.Check(queue.PeekRejected(3), DeepEquals, []string{"requeue-1", "requeue-3", "requeue-5"})
+	_, ok := queue.redisClient.HGet(queue.reasonsKey, "requeue-5")
+	c.Check(ok, Equals, true)
+
+	c.Check(queue.ReturnRejectedWhere(func(string) bool { return true }, 0), Equals, 0)
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,130 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetryTopology is a queue with a chain of retry queues. Pushing a delivery
+// moves it to the next retry queue, where it's consumed again once its
+// backoff passed. Pushing from the last retry queue rejects it.
+type RetryTopology struct {
+	Queue       Queue   // the base queue
+	RetryQueues []Queue // one per backoff duration
+	backoff     []time.Duration
+}
+
+// NewRetryTopology opens the queue name and a retry queue for each backoff
+// duration named like "name-retry-1" and sets up their push queues and hop
+// limits
+func NewRetryTopology(connection Connection, name string, backoff []time.Duration) *RetryTopology {
+	topology := &RetryTopology{
+		Queue:   connection.OpenQueue(name),
+		backoff: backoff,
+	}
+
+	previous := topology.Queue
+	for i := range backoff {
+		retryQueue := connection.OpenQueue(fmt.Sprintf("%s-retry-%d", name, i+1))
+		previous.SetPushQueue(retryQueue)
+		topology.RetryQueues = append(topology.RetryQueues, retryQueue)
+		previous = retryQueue
+	}
+
+	// counted pushes record the push time the backoff is measured from
+	for _, queue := range topology.queues() {
+		queue.SetMaxHops(len(backoff))
+	}
+	return topology
+}
+
+func (topology *RetryTopology) queues() []Queue {
+	return append([]Queue{topology.Queue}, topology.RetryQueues...)
+}
+
+// StartConsuming starts consuming all queues of the topology
+func (topology *RetryTopology) StartConsuming(prefetchLimit int, pollDuration time.Duration) error {
+	var firstErr error
+	for _, queue := range topology.queues() {
+		if err := queue.StartConsuming(prefetchLimit, pollDuration); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StopConsuming stops consuming all queues of the topology
+func (topology *RetryTopology) StopConsuming() bool {
+	ok := true
+	for _, queue := range topology.queues() {
+		ok = queue.StopConsuming() && ok
+	}
+	return ok
+}
+
+// AddConsumer adds consumer to all queues of the topology and returns the
+// consumer names. On retry queues it consumes deliveries once their backoff
+// passed since they were pushed.
+func (topology *RetryTopology) AddConsumer(tag string, consumer Consumer) ([]string, error) {
+	name, err := topology.Queue.AddConsumer(tag, consumer)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{name}
+	for i, retryQueue := range topology.RetryQueues {
+		delayed := &delayedConsumer{consumer: consumer, delay: topology.backoff[i]}
+		name, err := retryQueue.AddConsumer(tag, delayed)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// delayedConsumer waits until delay passed since the delivery was pushed
+// before passing it on to consumer
+type delayedConsumer struct {
+	consumer Consumer
+	delay    time.Duration
+}
+
+func (consumer *delayedConsumer) Consume(delivery Delivery) {
+	consumer.ConsumeContext(context.Background(), delivery)
+}
+
+func (consumer *delayedConsumer) ConsumeContext(ctx context.Context, delivery Delivery) {
+	due := time.Now().Add(consumer.delay)
+	if wrapped, ok := delivery.(*wrapDelivery); ok {
+		if pushedAt, ok := wrapped.pushedAt(); ok {
+			due = pushedAt.Add(consumer.delay)
+		}
+	}
+
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return // stays unacked until returned
+	}
+
+	if contextConsumer, ok := consumer.consumer.(ContextConsumer); ok {
+		contextConsumer.ConsumeContext(ctx, delivery)
+		return
+	}
+	consumer.consumer.Consume(delivery)
+}
+
+func (consumer *delayedConsumer) OnStart() {
+	callOnStart(consumer.consumer)
+}
+
+func (consumer *delayedConsumer) OnStop() {
+	callOnStop(consumer.consumer)
+}
+
+func (consumer *delayedConsumer) OnRemoved() {
+	callOnRemoved(consumer.consumer)
+}
@@ -0,0 +1,54 @@
+package rmq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestRetryTopologySuite(t *testing.T) {
+	TestingSuiteT(&RetryTopologySuite{}, t)
+}
+
+type RetryTopologySuite struct{}
+
+func (suite *RetryTopologySuite) TestRetries(c *C) {
+	connection := OpenConnection("retry-conn", "tcp", "localhost:6379", 1)
+	topology := NewRetryTopology(connection, "retry-q", []time.Duration{30 * time.Millisecond, 60 * time.Millisecond})
+	c.Assert(topology.RetryQueues, HasLen, 2)
+	c.Check(topology.RetryQueues[1].(*redisQueue).name, Equals, "retry-q-retry-2")
+	for _, queue := range topology.queues() {
+		queue.PurgeReady()
+		queue.PurgeRejected()
+	}
+
+	var mutex sync.Mutex
+	consumed := []time.Time{}
+	c.Check(topology.StartConsuming(10, time.Millisecond), IsNil)
+	topology.AddConsumer("retry-cons", ConsumerFunc(func(delivery Delivery) {
+		mutex.Lock()
+		consumed = append(consumed, time.Now())
+		mutex.Unlock()
+		c.Check(delivery.Payload(), Equals, "retry-d1")
+		delivery.Push() // always fails
+	}))
+
+	start := time.Now()
+	topology.Queue.Publish("retry-d1")
+	time.Sleep(200 * time.Millisecond)
+
+	mutex.Lock()
+	c.Assert(consumed, HasLen, 3)
+	c.Check(consumed[1].Sub(consumed[0]) >= 30*time.Millisecond, Equals, true)
+	c.Check(consumed[2].Sub(consumed[1]) >= 60*time.Millisecond, Equals, true)
+	c.Check(consumed[2].Sub(start) < 200*time.Millisecond, Equals, true)
+	mutex.Unlock()
+
+	lastQueue := topology.RetryQueues[1].(*redisQueue)
+	c.Check(lastQueue.RejectedCount(), Equals, 1)
+
+	topology.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,333 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: rmq.proto
+
+package rmqgrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RmqClient is the client API for Rmq service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RmqClient interface {
+	// Publish publishes payloads to a queue in order and stops at the first failure
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error)
+	// ListQueues returns all open queues with their counts
+	ListQueues(ctx context.Context, in *ListQueuesRequest, opts ...grpc.CallOption) (*ListQueuesResponse, error)
+	// PurgeQueue purges ready or rejected deliveries
+	PurgeQueue(ctx context.Context, in *PurgeQueueRequest, opts ...grpc.CallOption) (*PurgeQueueResponse, error)
+	// ReturnRejected returns rejected deliveries to ready
+	ReturnRejected(ctx context.Context, in *ReturnRejectedRequest, opts ...grpc.CallOption) (*ReturnRejectedResponse, error)
+	// PauseQueue stops consumption of a queue until ResumeQueue is called
+	PauseQueue(ctx context.Context, in *PauseQueueRequest, opts ...grpc.CallOption) (*PauseQueueResponse, error)
+	ResumeQueue(ctx context.Context, in *PauseQueueRequest, opts ...grpc.CallOption) (*PauseQueueResponse, error)
+	// Clean returns unacked deliveries of dead connections to ready
+	Clean(ctx context.Context, in *CleanRequest, opts ...grpc.CallOption) (*CleanResponse, error)
+}
+
+type rmqClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRmqClient(cc grpc.ClientConnInterface) RmqClient {
+	return &rmqClient{cc}
+}
+
+func (c *rmqClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error) {
+	out := new(PublishResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/Publish", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) ListQueues(ctx context.Context, in *ListQueuesRequest, opts ...grpc.CallOption) (*ListQueuesResponse, error) {
+	out := new(ListQueuesResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/ListQueues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) PurgeQueue(ctx context.Context, in *PurgeQueueRequest, opts ...grpc.CallOption) (*PurgeQueueResponse, error) {
+	out := new(PurgeQueueResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/PurgeQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) ReturnRejected(ctx context.Context, in *ReturnRejectedRequest, opts ...grpc.CallOption) (*ReturnRejectedResponse, error) {
+	out := new(ReturnRejectedResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/ReturnRejected", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) PauseQueue(ctx context.Context, in *PauseQueueRequest, opts ...grpc.CallOption) (*PauseQueueResponse, error) {
+	out := new(PauseQueueResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/PauseQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) ResumeQueue(ctx context.Context, in *PauseQueueRequest, opts ...grpc.CallOption) (*PauseQueueResponse, error) {
+	out := new(PauseQueueResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/ResumeQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rmqClient) Clean(ctx context.Context, in *CleanRequest, opts ...grpc.CallOption) (*CleanResponse, error) {
+	out := new(CleanResponse)
+	err := c.cc.Invoke(ctx, "/rmq.v1.Rmq/Clean", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RmqServer is the server API for Rmq service.
+// All implementations must embed UnimplementedRmqServer
+// for forward compatibility
+type RmqServer interface {
+	// Publish publishes payloads to a queue in order and stops at the first failure
+	Publish(context.Context, *PublishRequest) (*PublishResponse, error)
+	// ListQueues returns all open queues with their counts
+	ListQueues(context.Context, *ListQueuesRequest) (*ListQueuesResponse, error)
+	// PurgeQueue purges ready or rejected deliveries
+	PurgeQueue(context.Context, *PurgeQueueRequest) (*PurgeQueueResponse, error)
+	// ReturnRejected returns rejected deliveries to ready
+	ReturnRejected(context.Context, *ReturnRejectedRequest) (*ReturnRejectedResponse, error)
+	// PauseQueue stops consumption of a queue until ResumeQueue is called
+	PauseQueue(context.Context, *PauseQueueRequest) (*PauseQueueResponse, error)
+	ResumeQueue(context.Context, *PauseQueueRequest) (*PauseQueueResponse, error)
+	// Clean returns unacked deliveries of dead connections to ready
+	Clean(context.Context, *CleanRequest) (*CleanResponse, error)
+	mustEmbedUnimplementedRmqServer()
+}
+
+// UnimplementedRmqServer must be embedded to have forward compatible implementations.
+type UnimplementedRmqServer struct {
+}
+
+func (UnimplementedRmqServer) Publish(context.Context, *PublishRequest) (*PublishResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedRmqServer) ListQueues(context.Context, *ListQueuesRequest) (*ListQueuesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQueues not implemented")
+}
+func (UnimplementedRmqServer) PurgeQueue(context.Context, *PurgeQueueRequest) (*PurgeQueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeQueue not implemented")
+}
+func (UnimplementedRmqServer) ReturnRejected(context.Context, *ReturnRejectedRequest) (*ReturnRejectedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReturnRejected not implemented")
+}
+func (UnimplementedRmqServer) PauseQueue(context.Context, *PauseQueueRequest) (*PauseQueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseQueue not implemented")
+}
+func (UnimplementedRmqServer) ResumeQueue(context.Context, *PauseQueueRequest) (*PauseQueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeQueue not implemented")
+}
+func (UnimplementedRmqServer) Clean(context.Context, *CleanRequest) (*CleanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Clean not implemented")
+}
+func (UnimplementedRmqServer) mustEmbedUnimplementedRmqServer() {}
+
+// UnsafeRmqServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RmqServer will
+// result in compilation errors.
+type UnsafeRmqServer interface {
+	mustEmbedUnimplementedRmqServer()
+}
+
+func RegisterRmqServer(s grpc.ServiceRegistrar, srv RmqServer) {
+	s.RegisterService(&Rmq_ServiceDesc, srv)
+}
+
+func _Rmq_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/Publish",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_ListQueues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQueuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).ListQueues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/ListQueues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).ListQueues(ctx, req.(*ListQueuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_PurgeQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeQueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).PurgeQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/PurgeQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).PurgeQueue(ctx, req.(*PurgeQueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_ReturnRejected_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReturnRejectedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).ReturnRejected(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/ReturnRejected",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).ReturnRejected(ctx, req.(*ReturnRejectedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_PauseQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseQueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).PauseQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/PauseQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).PauseQueue(ctx, req.(*PauseQueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_ResumeQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseQueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).ResumeQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/ResumeQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).ResumeQueue(ctx, req.(*PauseQueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rmq_Clean_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CleanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RmqServer).Clean(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rmq.v1.Rmq/Clean",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RmqServer).Clean(ctx, req.(*CleanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Rmq_ServiceDesc is the grpc.ServiceDesc for Rmq service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Rmq_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rmq.v1.Rmq",
+	HandlerType: (*RmqServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Publish",
+			Handler:    _Rmq_Publish_Handler,
+		},
+		{
+			MethodName: "ListQueues",
+			Handler:    _Rmq_ListQueues_Handler,
+		},
+		{
+			MethodName: "PurgeQueue",
+			Handler:    _Rmq_PurgeQueue_Handler,
+		},
+		{
+			MethodName: "ReturnRejected",
+			Handler:    _Rmq_ReturnRejected_Handler,
+		},
+		{
+			MethodName: "PauseQueue",
+			Handler:    _Rmq_PauseQueue_Handler,
+		},
+		{
+			MethodName: "ResumeQueue",
+			Handler:    _Rmq_ResumeQueue_Handler,
+		},
+		{
+			MethodName: "Clean",
+			Handler:    _Rmq_Clean_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "rmq.proto",
+}
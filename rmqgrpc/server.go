@@ -0,0 +1,177 @@
+// Package rmqgrpc serves a gRPC service to publish to and operate rmq queues
+// remotely, so services written in other languages can enqueue work through
+// the stable contract in rmq.proto. Generate their clients from it.
+package rmqgrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative rmq.proto
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adjust/rmq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements RmqServer for an rmq connection
+type Server struct {
+	UnimplementedRmqServer
+
+	connection rmq.Connection
+	newCleaner func() *rmq.Cleaner
+}
+
+// NewServer returns a server operating the queues of connection. Every Clean
+// call sets the dry run mode of a new cleaner returned by newCleaner, so it
+// doesn't affect cleaners running on a schedule. Clean calls fail with
+// Unimplemented if newCleaner is nil.
+func NewServer(connection rmq.Connection, newCleaner func() *rmq.Cleaner) *Server {
+	return &Server{
+		connection: connection,
+		newCleaner: newCleaner,
+	}
+}
+
+// Publish publishes the payloads in order and fails with Unavailable at the
+// first one which couldn't be published. Payloads are wrapped in envelopes
+// with the headers if there are any.
+func (server *Server) Publish(ctx context.Context, request *PublishRequest) (*PublishResponse, error) {
+	if request.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing queue")
+	}
+
+	queue := server.connection.OpenQueue(request.Queue)
+	for i, payload := range request.Payloads {
+		var ok bool
+		if len(request.Headers) > 0 {
+			ok = queue.PublishWithHeaders(string(payload), request.Headers)
+		} else {
+			ok = queue.PublishBytes(payload)
+		}
+		if !ok {
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("published %d of %d payloads", i, len(request.Payloads)))
+		}
+	}
+	return &PublishResponse{Published: int64(len(request.Payloads))}, nil
+}
+
+// ListQueues returns all open queues with their counts
+func (server *Server) ListQueues(ctx context.Context, request *ListQueuesRequest) (*ListQueuesResponse, error) {
+	queueNames := server.connection.GetOpenQueues()
+	stats := server.connection.CollectStats(queueNames)
+
+	response := &ListQueuesResponse{}
+	for _, queueName := range queueNames {
+		stat := stats.QueueStats[queueName]
+		response.Queues = append(response.Queues, &Queue{
+			Name:      queueName,
+			Ready:     int64(stat.ReadyCount),
+			Rejected:  int64(stat.RejectedCount),
+			Unacked:   int64(stat.UnackedCount()),
+			Consumers: int64(stat.ConsumerCount()),
+			Paused:    server.connection.OpenQueue(queueName).Paused(),
+		})
+	}
+	return response, nil
+}
+
+// PurgeQueue purges the rejected or ready deliveries of an open queue
+func (server *Server) PurgeQueue(ctx context.Context, request *PurgeQueueRequest) (*PurgeQueueResponse, error) {
+	queue, err := server.openQueue(request.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Ready {
+		return &PurgeQueueResponse{Purged: int64(queue.PurgeReady())}, nil
+	}
+	return &PurgeQueueResponse{Purged: int64(queue.PurgeRejected())}, nil
+}
+
+// ReturnRejected returns count, or all if zero, rejected deliveries of an
+// open queue to ready
+func (server *Server) ReturnRejected(ctx context.Context, request *ReturnRejectedRequest) (*ReturnRejectedResponse, error) {
+	queue, err := server.openQueue(request.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case request.Count < 0:
+		return nil, status.Error(codes.InvalidArgument, "negative count")
+	case request.Count == 0:
+		return &ReturnRejectedResponse{Returned: int64(queue.ReturnAllRejected())}, nil
+	default:
+		return &ReturnRejectedResponse{Returned: int64(queue.ReturnRejected(int(request.Count)))}, nil
+	}
+}
+
+// PauseQueue pauses consumption of an open queue, see rmq.Queue.Pause
+func (server *Server) PauseQueue(ctx context.Context, request *PauseQueueRequest) (*PauseQueueResponse, error) {
+	queue, err := server.openQueue(request.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	if !queue.Pause() {
+		return nil, status.Error(codes.Unavailable, "failed to pause queue")
+	}
+	return &PauseQueueResponse{Paused: queue.Paused()}, nil
+}
+
+// ResumeQueue resumes consumption of a paused queue
+func (server *Server) ResumeQueue(ctx context.Context, request *PauseQueueRequest) (*PauseQueueResponse, error) {
+	queue, err := server.openQueue(request.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	if !queue.Resume() {
+		return nil, status.Error(codes.Unavailable, "failed to resume queue")
+	}
+	return &PauseQueueResponse{Paused: queue.Paused()}, nil
+}
+
+// Clean cleans dead connections or only reports what it would clean, see
+// rmq.Cleaner.CleanWithReport
+func (server *Server) Clean(ctx context.Context, request *CleanRequest) (*CleanResponse, error) {
+	if server.newCleaner == nil {
+		return nil, status.Error(codes.Unimplemented, "no cleaner")
+	}
+
+	cleaner := server.newCleaner()
+	cleaner.SetDryRun(request.DryRun)
+	report, err := cleaner.CleanWithReport()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &CleanResponse{
+		DryRun:        report.DryRun,
+		Connections:   report.Connections,
+		Returned:      int64Counts(report.Returned),
+		Expired:       int64Counts(report.Expired),
+		RemovedQueues: report.RemovedQueues,
+		DeletedKeys:   report.DeletedKeys,
+	}, nil
+}
+
+// openQueue opens the queue if it's open already, so admin calls with typos
+// don't create queues
+func (server *Server) openQueue(name string) (rmq.Queue, error) {
+	for _, openName := range server.connection.GetOpenQueues() {
+		if openName == name {
+			return server.connection.OpenQueue(name), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, fmt.Sprintf("unknown queue %q", name))
+}
+
+func int64Counts(counts map[string]int) map[string]int64 {
+	converted := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		converted[key] = int64(count)
+	}
+	return converted
+}
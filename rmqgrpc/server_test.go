@@ -0,0 +1,135 @@
+package rmqgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+	"github.com/adjust/rmq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServerSuite(t *testing.T) {
+	TestingSuiteT(&ServerSuite{}, t)
+}
+
+type ServerSuite struct {
+	connection rmq.Connection
+	server     *grpc.Server
+	client     RmqClient
+	conn       *grpc.ClientConn
+}
+
+func (suite *ServerSuite) SetUpTest(c *C) {
+	connection := rmq.OpenConnection("grpc-conn", "tcp", "localhost:6379", 1)
+	suite.connection = connection
+
+	listener := bufconn.Listen(1 << 20)
+	suite.server = grpc.NewServer()
+	RegisterRmqServer(suite.server, NewServer(connection, func() *rmq.Cleaner { return rmq.NewCleaner(connection) }))
+	go suite.server.Serve(listener)
+
+	dial := func(ctx context.Context, address string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dial), grpc.WithInsecure())
+	c.Assert(err, IsNil)
+	suite.conn = conn
+	suite.client = NewRmqClient(conn)
+}
+
+func (suite *ServerSuite) TearDownTest(c *C) {
+	suite.conn.Close()
+	suite.server.Stop()
+}
+
+func (suite *ServerSuite) TestPublish(c *C) {
+	queue := suite.connection.OpenQueue("grpc-publish-q")
+	queue.PurgeReady()
+
+	response, err := suite.client.Publish(context.Background(), &PublishRequest{
+		Queue:    "grpc-publish-q",
+		Payloads: [][]byte{[]byte("grpc-d1"), []byte("grpc-d2")},
+	})
+	c.Assert(err, IsNil)
+	c.Check(response.Published, Equals, int64(2))
+	stats := suite.connection.CollectStats([]string{"grpc-publish-q"})
+	c.Check(stats.QueueStats["grpc-publish-q"].ReadyCount, Equals, 2)
+
+	_, err = suite.client.Publish(context.Background(), &PublishRequest{})
+	c.Check(status.Code(err), Equals, codes.InvalidArgument)
+}
+
+func (suite *ServerSuite) TestListQueues(c *C) {
+	queue := suite.connection.OpenQueue("grpc-list-q")
+	queue.PurgeReady()
+	queue.Publish("grpc-list-d1")
+
+	response, err := suite.client.ListQueues(context.Background(), &ListQueuesRequest{})
+	c.Assert(err, IsNil)
+	found := false
+	for _, listed := range response.Queues {
+		if listed.Name == "grpc-list-q" {
+			found = true
+			c.Check(listed.Ready, Equals, int64(1))
+			c.Check(listed.Paused, Equals, false)
+		}
+	}
+	c.Check(found, Equals, true)
+}
+
+func (suite *ServerSuite) TestNotFound(c *C) {
+	_, err := suite.client.PurgeQueue(context.Background(), &PurgeQueueRequest{Queue: "grpc-unknown-q"})
+	c.Check(status.Code(err), Equals, codes.NotFound)
+	_, err = suite.client.PauseQueue(context.Background(), &PauseQueueRequest{Queue: "grpc-unknown-q"})
+	c.Check(status.Code(err), Equals, codes.NotFound)
+
+	for _, name := range suite.connection.GetOpenQueues() {
+		c.Check(name, Not(Equals), "grpc-unknown-q")
+	}
+}
+
+func (suite *ServerSuite) TestPauseQueue(c *C) {
+	queue := suite.connection.OpenQueue("grpc-pause-q")
+	queue.Resume()
+
+	response, err := suite.client.PauseQueue(context.Background(), &PauseQueueRequest{Queue: "grpc-pause-q"})
+	c.Assert(err, IsNil)
+	c.Check(response.Paused, Equals, true)
+	c.Check(queue.Paused(), Equals, true)
+
+	response, err = suite.client.ResumeQueue(context.Background(), &PauseQueueRequest{Queue: "grpc-pause-q"})
+	c.Assert(err, IsNil)
+	c.Check(response.Paused, Equals, false)
+	c.Check(queue.Paused(), Equals, false)
+}
+
+func (suite *ServerSuite) TestCleanDryRun(c *C) {
+	dead := rmq.OpenConnection("grpc-dead-conn", "tcp", "localhost:6379", 1)
+	deadName := dead.Name
+	c.Assert(dead.StopHeartbeat(), Equals, true)
+
+	response, err := suite.client.Clean(context.Background(), &CleanRequest{DryRun: true})
+	c.Assert(err, IsNil)
+	c.Check(response.DryRun, Equals, true)
+	c.Check(containsString(response.Connections, deadName), Equals, true)
+	c.Check(containsString(suite.connection.GetConnections(), deadName), Equals, true)
+
+	// the dry run doesn't stick to later calls
+	response, err = suite.client.Clean(context.Background(), &CleanRequest{})
+	c.Assert(err, IsNil)
+	c.Check(response.DryRun, Equals, false)
+	c.Check(containsString(response.Connections, deadName), Equals, true)
+	c.Check(containsString(suite.connection.GetConnections(), deadName), Equals, false)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package rmq
+
+import (
+	"sync"
+	"time"
+)
+
+// scheduler runs a cleaner periodically, see Cleaner.Start
+type scheduler struct {
+	mutex       sync.Mutex
+	stopChan    chan struct{}
+	stoppedChan chan struct{} // closed when the cleaning goroutine returned
+	leading     bool          // true while this connection holds the cleaner lock
+}
+
+// Start cleans every interval until Stop is called, so worker processes can
+// clean without a dedicated cleaner deployment. All connections which started
+// a cleaner compete for a lock in Redis, only its holder cleans. The holder
+// renews the lock with every run and the others take over once it stopped or
+// its lease expired because it died. Use a lease of a few intervals. Call
+// SetDryRun before Start.
+func (cleaner *Cleaner) Start(interval, lease time.Duration) {
+	cleaner.scheduler.mutex.Lock()
+	defer cleaner.scheduler.mutex.Unlock()
+
+	if cleaner.scheduler.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	stoppedChan := make(chan struct{})
+	cleaner.scheduler.stopChan = stopChan
+	cleaner.scheduler.stoppedChan = stoppedChan
+
+	go func() {
+		defer close(stoppedChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cleaner.cleanIfLeading(lease)
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the cleaning started by Start, waits for a running clean to
+// finish and releases the lock so another connection takes over right away
+func (cleaner *Cleaner) Stop() {
+	cleaner.scheduler.mutex.Lock()
+	if cleaner.scheduler.stopChan == nil {
+		cleaner.scheduler.mutex.Unlock()
+		return
+	}
+	close(cleaner.scheduler.stopChan)
+	stoppedChan := cleaner.scheduler.stoppedChan
+	cleaner.scheduler.stopChan = nil
+	cleaner.scheduler.mutex.Unlock()
+
+	<-stoppedChan
+
+	cleaner.scheduler.mutex.Lock()
+	defer cleaner.scheduler.mutex.Unlock()
+	if cleaner.scheduler.leading {
+		cleaner.connection.redisClient.DelLease(cleanerLockKey, cleaner.connection.Name)
+		cleaner.scheduler.leading = false
+	}
+}
+
+// Leading returns true if this cleaner was started and currently holds the
+// lock, so it's the one cleaning
+func (cleaner *Cleaner) Leading() bool {
+	cleaner.scheduler.mutex.Lock()
+	defer cleaner.scheduler.mutex.Unlock()
+	return cleaner.scheduler.leading
+}
+
+// cleanIfLeading takes or renews the cleaner lock and cleans if it holds it
+func (cleaner *Cleaner) cleanIfLeading(lease time.Duration) {
+	leading := cleaner.connection.redisClient.SetLease(cleanerLockKey, cleaner.connection.Name, lease)
+	cleaner.scheduler.mutex.Lock()
+	cleaner.scheduler.leading = leading
+	cleaner.scheduler.mutex.Unlock()
+	if !leading {
+		return
+	}
+
+	if err := cleaner.Clean(); err != nil {
+		logf("rmq scheduled cleaning failed: %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestScheduledCleanerSuite(t *testing.T) {
+	TestingSuiteT(&ScheduledCleanerSuite{}, t)
+}
+
+type ScheduledCleanerSuite struct{}
+
+func (suite *ScheduledCleanerSuite) TestStart(c *C) {
+	conn := OpenConnection("scheduled-dead-conn", "tcp", "localhost:6379", 1)
+	queue := conn.OpenQueue("scheduled-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.Publish("scheduled-d1")
+	deliveries, err := queue.GetBatch(context.Background(), 1)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 1)
+	conn.StopHeartbeat() // connection is dead now
+
+	conn1 := OpenConnection("scheduled-conn1", "tcp", "localhost:6379", 1)
+	conn2 := OpenConnection("scheduled-conn2", "tcp", "localhost:6379", 1)
+	conn1.redisClient.Del(cleanerLockKey)
+	cleaner1 := NewCleaner(conn1)
+	cleaner2 := NewCleaner(conn2)
+	cleaner1.Start(10*time.Millisecond, time.Second)
+	time.Sleep(15 * time.Millisecond)
+	cleaner2.Start(10*time.Millisecond, time.Second)
+	for i := 0; i < 100 && queue.UnackedCount() > 0; i++ {
+		time.Sleep(10 * time.Millisecond) // cleaning all connections of the test db may take a while
+	}
+
+	c.Check(cleaner1.Leading(), Equals, true)
+	c.Check(cleaner2.Leading(), Equals, false)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(containsString(conn1.GetConnections(), conn.Name), Equals, false)
+
+	cleaner1.Stop()
+	c.Check(cleaner1.Leading(), Equals, false)
+	for i := 0; i < 100 && !cleaner2.Leading(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(cleaner2.Leading(), Equals, true) // took over
+
+	cleaner2.Stop()
+	cleaner2.Stop() // does nothing
+
+	// the lock was released
+	c.Check(conn1.redisClient.SetLease(cleanerLockKey, "other", time.Second), Equals, true)
+	conn1.redisClient.Del(cleanerLockKey)
+
+	conn1.StopHeartbeat()
+	conn2.StopHeartbeat()
+}
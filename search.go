@@ -0,0 +1,149 @@
+package rmq
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	searchChunkSize    = 1000 // number of deliveries fetched per LRANGE
+	defaultSearchLimit = 100
+)
+
+// SearchQuery selects deliveries for SearchReady and SearchRejected. A
+// delivery matches if its payload matches all set conditions, so an empty
+// query matches all deliveries.
+type SearchQuery struct {
+	Contains string         // substring of the payload
+	Pattern  *regexp.Regexp // regular expression matching the payload
+	Field    string         // dot separated path to a field of a JSON payload, like "customer.id"
+	Value    string         // value of Field, strings are compared without quotes, other values as JSON
+
+	Offset int // position to start at, zero is the delivery consumed next
+	Limit  int // maximum number of matches, defaults to 100
+}
+
+// SearchMatch is a delivery found by a search
+type SearchMatch struct {
+	Position int    // position in the list, zero is the delivery consumed next
+	Payload  string // decoded payload
+	ID       string // ID of the delivery, as passed to DeleteReady and MoveReady
+	Value    string // value stored in Redis
+}
+
+// SearchResult is a page of matches. Search again with Offset set to Next to
+// get the next page.
+type SearchResult struct {
+	Matches []SearchMatch
+	Next    int // offset of the next page, -1 if the whole list was searched
+}
+
+// SearchReady scans the ready deliveries in chunks, starting with the one
+// consumed next, and returns those matching query. Positions shift while
+// deliveries are consumed, so pages may overlap or skip deliveries of busy
+// queues.
+func (queue *redisQueue) SearchReady(query SearchQuery) SearchResult {
+	return queue.searchList(queue.readyKey, query)
+}
+
+// SearchRejected scans the rejected deliveries in chunks, starting with the
+// one returned next, and returns those matching query
+func (queue *redisQueue) SearchRejected(query SearchQuery) SearchResult {
+	return queue.searchList(queue.rejectedKey, query)
+}
+
+func (queue *redisQueue) searchList(key string, query SearchQuery) SearchResult {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	position := query.Offset
+	if position < 0 {
+		position = 0
+	}
+
+	options := queue.decodeOptions()
+	result := SearchResult{Matches: []SearchMatch{}}
+	for {
+		// the list is consumed from the right, so chunks are taken from there
+		values := queue.redisClient.LRange(key, -position-searchChunkSize, -position-1)
+		for i := len(values) - 1; i >= 0; i-- {
+			payload := values[i]
+			if env, ok := decodeEnvelope(payload); ok {
+				if decoded, err := env.decodePayload(options); err == nil {
+					payload = decoded
+				}
+			}
+			if query.matches(payload) {
+				result.Matches = append(result.Matches, SearchMatch{Position: position, Payload: payload, ID: deliveryID(values[i]), Value: values[i]})
+			}
+			position++
+
+			if len(result.Matches) == limit {
+				result.Next = position
+				return result
+			}
+		}
+		if len(values) < searchChunkSize {
+			result.Next = -1
+			return result
+		}
+	}
+}
+
+func (query SearchQuery) matches(payload string) bool {
+	if query.Contains != "" && !strings.Contains(payload, query.Contains) {
+		return false
+	}
+	if query.Pattern != nil && !query.Pattern.MatchString(payload) {
+		return false
+	}
+	if query.Field != "" {
+		value, ok := jsonField(payload, query.Field)
+		if !ok || value != query.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonField returns the value at the dot separated path in the JSON
+// document, strings without quotes and other values as JSON
+func jsonField(document, path string) (string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			field, ok := node[name]
+			if !ok {
+				return "", false
+			}
+			value = field
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", false
+			}
+			value = node[index]
+		default:
+			return "", false
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
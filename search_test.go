@@ -0,0 +1,82 @@
+package rmq
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestSearchSuite(t *testing.T) {
+	TestingSuiteT(&SearchSuite{}, t)
+}
+
+type SearchSuite struct{}
+
+func (suite *SearchSuite) TestSearchReady(c *C) {
+	connection := OpenConnection("search-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("search-q").(*redisQueue)
+	queue.PurgeReady()
+
+	count := searchChunkSize + 10
+	payloads := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		payloads = append(payloads, fmt.Sprintf(`{"order":{"id":%d,"customer":"c%d"}}`, i, i%3))
+		c.Assert(queue.Publish(payloads[i]), Equals, true)
+	}
+	c.Check(queue.PublishWithHeaders(`{"order":{"id":"x","customer":"c9"}}`, map[string]string{"h": "v"}), Equals, true)
+
+	result := queue.SearchReady(SearchQuery{})
+	c.Check(result.Matches, HasLen, defaultSearchLimit)
+	c.Check(result.Next, Equals, defaultSearchLimit)
+	c.Check(result.Matches[0].Position, Equals, 0)
+	c.Check(result.Matches[0].Payload, Equals, payloads[0])
+
+	// matches across chunks
+	result = queue.SearchReady(SearchQuery{Field: "order.id", Value: fmt.Sprint(searchChunkSize + 5)})
+	c.Assert(result.Matches, HasLen, 1)
+	c.Check(result.Matches[0].Position, Equals, searchChunkSize+5)
+	c.Check(result.Next, Equals, -1)
+
+	// decodes envelopes
+	result = queue.SearchReady(SearchQuery{Contains: `"c9"`})
+	c.Assert(result.Matches, HasLen, 1)
+	c.Check(result.Matches[0].Payload, Equals, `{"order":{"id":"x","customer":"c9"}}`)
+	c.Check(result.Matches[0].Value, Not(Equals), result.Matches[0].Payload)
+	c.Check(queue.DeleteReady(result.Matches[0].ID), Equals, true)
+
+	// pages
+	query := SearchQuery{Field: "order.customer", Value: "c1", Pattern: regexp.MustCompile(`"id":\d*7,`), Limit: 5}
+	result = queue.SearchReady(query)
+	c.Assert(result.Matches, HasLen, 5)
+	c.Check(result.Matches[0].Payload, Equals, payloads[7])
+	c.Check(result.Matches[1].Payload, Equals, payloads[37])
+	found := len(result.Matches)
+	for result.Next >= 0 {
+		query.Offset = result.Next
+		result = queue.SearchReady(query)
+		found += len(result.Matches)
+	}
+	c.Check(found, Equals, 34) // ids ending in 7 with id%3 == 1
+
+	c.Check(queue.SearchRejected(SearchQuery{}).Matches, HasLen, 0)
+	connection.StopHeartbeat()
+}
+
+func (suite *SearchSuite) TestJSONField(c *C) {
+	document := `{"a":{"b":[1,{"c":"d"}],"e":1.50,"f":null}}`
+	value, ok := jsonField(document, "a.b.1.c")
+	c.Check(ok, Equals, true)
+	c.Check(value, Equals, "d")
+	value, _ = jsonField(document, "a.e")
+	c.Check(value, Equals, "1.50")
+	value, _ = jsonField(document, "a.f")
+	c.Check(value, Equals, "null")
+	value, _ = jsonField(document, "a.b")
+	c.Check(value, Equals, `[1,{"c":"d"}]`)
+	_, ok = jsonField(document, "a.b.2")
+	c.Check(ok, Equals, false)
+	_, ok = jsonField("not json", "a")
+	c.Check(ok, Equals, false)
+}
@@ -0,0 +1,199 @@
+package rmq
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// virtual nodes per connection on the hash ring, more spread queues more
+// evenly
+const shardReplicas = 100
+
+// ShardedConnection spreads queues over connections to independent Redis
+// servers. Each queue lives on the server chosen by a consistent hash of its
+// name, so adding a server only moves about 1/n of the queues. Use it with
+// NewShardedQueue to spread the shards of one queue over servers.
+//
+// Every server still needs its own cleaner, see Connections.
+type ShardedConnection struct {
+	Connections []Connection
+	ring        []ringNode // sorted by hash
+}
+
+type ringNode struct {
+	hash       uint32
+	connection Connection
+}
+
+// NewShardedConnection returns a connection routing queues to connections.
+// Pass them in the same order everywhere and only ever append new ones,
+// otherwise queues move between servers.
+func NewShardedConnection(connections ...Connection) *ShardedConnection {
+	if len(connections) == 0 {
+		panic("rmq sharded connection needs at least one connection")
+	}
+
+	sharded := &ShardedConnection{Connections: connections}
+	for i, connection := range connections {
+		for replica := 0; replica < shardReplicas; replica++ {
+			sharded.ring = append(sharded.ring, ringNode{
+				hash:       ringHash(fmt.Sprintf("%d-%d", i, replica)),
+				connection: connection,
+			})
+		}
+	}
+	sort.Slice(sharded.ring, func(i, j int) bool { return sharded.ring[i].hash < sharded.ring[j].hash })
+	return sharded
+}
+
+// ConnectionFor returns the connection queueName is routed to
+func (sharded *ShardedConnection) ConnectionFor(queueName string) Connection {
+	hash := ringHash(queueName)
+	i := sort.Search(len(sharded.ring), func(i int) bool { return sharded.ring[i].hash >= hash })
+	if i == len(sharded.ring) {
+		i = 0 // wrap around
+	}
+	return sharded.ring[i].connection
+}
+
+// ringHash spreads similar keys evenly over the ring like ketama, FNV
+// clusters short keys differing in few bytes
+func ringHash(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
+
+func (sharded *ShardedConnection) OpenQueue(name string) Queue {
+	return sharded.ConnectionFor(name).OpenQueue(name)
+}
+
+// OpenTemporaryQueue opens a temporary queue on the connection its unique
+// name is routed to
+func (sharded *ShardedConnection) OpenTemporaryQueue() Queue {
+	name := temporaryQueueName()
+	connection := sharded.ConnectionFor(name)
+	if redisConnection, ok := connection.(*redisConnection); ok {
+		return redisConnection.openTemporaryQueue(name)
+	}
+	return connection.OpenQueue(name) // test connections have no lifetime
+}
+
+// CollectStats collects the stats of each queue from its server
+func (sharded *ShardedConnection) CollectStats(queueList []string) Stats {
+	queueLists := map[Connection][]string{}
+	for _, queueName := range queueList {
+		connection := sharded.ConnectionFor(queueName)
+		queueLists[connection] = append(queueLists[connection], queueName)
+	}
+
+	stats := NewStats()
+	for _, connection := range sharded.Connections {
+		if _, ok := queueLists[connection]; !ok {
+			continue
+		}
+		connectionStats := connection.CollectStats(queueLists[connection])
+		for queueName, queueStat := range connectionStats.QueueStats {
+			stats.QueueStats[queueName] = queueStat
+		}
+		for connectionName, active := range connectionStats.otherConnections {
+			stats.otherConnections[connectionName] = active
+		}
+	}
+	return stats
+}
+
+func (sharded *ShardedConnection) GetOpenQueues() []string {
+	return sharded.collectNames(Connection.GetOpenQueues)
+}
+
+func (sharded *ShardedConnection) GetConsumingQueues() []string {
+	return sharded.collectNames(Connection.GetConsumingQueues)
+}
+
+func (sharded *ShardedConnection) GetConnections() []string {
+	return sharded.collectNames(Connection.GetConnections)
+}
+
+// collectNames returns the sorted names returned by all connections
+func (sharded *ShardedConnection) collectNames(get func(Connection) []string) []string {
+	names := []string{}
+	for _, connection := range sharded.Connections {
+		names = append(names, get(connection)...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Queues returns the queues opened on all connections, sorted by name
+func (sharded *ShardedConnection) Queues() []Queue {
+	queues := []Queue{}
+	for _, connection := range sharded.Connections {
+		queues = append(queues, connection.Queues()...)
+	}
+	// queues print their name first
+	sort.Slice(queues, func(i, j int) bool { return fmt.Sprint(queues[i]) < fmt.Sprint(queues[j]) })
+	return queues
+}
+
+func (sharded *ShardedConnection) QueueInfos() []QueueInfo {
+	infos := []QueueInfo{}
+	for _, connection := range sharded.Connections {
+		infos = append(infos, connection.QueueInfos()...)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (sharded *ShardedConnection) ConnectionInfos() []ConnectionInfo {
+	infos := []ConnectionInfo{}
+	for _, connection := range sharded.Connections {
+		infos = append(infos, connection.ConnectionInfos()...)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Health combines the health reports of all connections, it's only healthy
+// if all of them are
+func (sharded *ShardedConnection) Health(ctx context.Context) HealthReport {
+	report := HealthReport{Healthy: true, RedisReachable: true, Queues: []QueueHealth{}}
+	for _, connection := range sharded.Connections {
+		connectionReport := connection.Health(ctx)
+		report.Healthy = report.Healthy && connectionReport.Healthy
+		report.RedisReachable = report.RedisReachable && connectionReport.RedisReachable
+		if connectionReport.HeartbeatAge > report.HeartbeatAge {
+			report.HeartbeatAge = connectionReport.HeartbeatAge
+		}
+		report.Queues = append(report.Queues, connectionReport.Queues...)
+		report.Problems = append(report.Problems, connectionReport.Problems...)
+	}
+	return report
+}
+
+// Shutdown shuts down all connections in parallel, the returned
+// *ShutdownError lists the goroutines of all connections still running
+func (sharded *ShardedConnection) Shutdown(ctx context.Context) error {
+	errs := make(chan error, len(sharded.Connections))
+	for _, connection := range sharded.Connections {
+		go func(connection Connection) { errs <- connection.Shutdown(ctx) }(connection)
+	}
+
+	pending := []string{}
+	for range sharded.Connections {
+		err := <-errs
+		if shutdownErr, ok := err.(*ShutdownError); ok {
+			pending = append(pending, shutdownErr.Pending...)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		return &ShutdownError{Pending: pending}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package rmq
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestShardedConnectionSuite(t *testing.T) {
+	TestingSuiteT(&ShardedConnectionSuite{}, t)
+}
+
+type ShardedConnectionSuite struct{}
+
+func (suite *ShardedConnectionSuite) TestShardedConnection(c *C) {
+	// separate databases stand in for separate servers
+	connection1 := OpenConnection("sharded-conn1", "tcp", "localhost:6379", 2)
+	connection2 := OpenConnection("sharded-conn2", "tcp", "localhost:6379", 3)
+	connection1.CloseAllQueues()
+	connection2.CloseAllQueues()
+	sharded := NewShardedConnection(connection1, connection2)
+
+	counts := map[Connection]int{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("sharded-conn-q%d", i)
+		connection := sharded.ConnectionFor(name)
+		c.Check(sharded.ConnectionFor(name), Equals, connection)
+		counts[connection]++
+
+		queue := sharded.OpenQueue(name)
+		queue.PurgeReady()
+		c.Check(queue.Publish("sharded-conn-d"), Equals, true)
+		c.Check(queue.(*redisQueue).redisClient, Equals, connection.(*redisConnection).redisClient)
+	}
+	c.Check(counts[connection1] > 0, Equals, true)
+	c.Check(counts[connection2] > 0, Equals, true)
+
+	c.Check(sharded.GetOpenQueues(), HasLen, 20)
+	c.Check(sharded.QueueInfos(), HasLen, 20)
+	stats := sharded.CollectStats(sharded.GetOpenQueues())
+	c.Check(stats.QueueStats, HasLen, 20)
+	c.Check(stats.QueueStats["sharded-conn-q7"].ReadyCount, Equals, 1)
+
+	// appending a server keeps most queues where they are
+	connection3 := OpenConnection("sharded-conn3", "tcp", "localhost:6379", 4)
+	grown := NewShardedConnection(connection1, connection2, connection3)
+	moved := 0
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("sharded-conn-q%d", i)
+		if grown.ConnectionFor(name) != sharded.ConnectionFor(name) {
+			c.Check(grown.ConnectionFor(name), Equals, Connection(connection3))
+			moved++
+		}
+	}
+	c.Check(moved < 60, Equals, true)
+
+	connection1.StopHeartbeat()
+	connection2.StopHeartbeat()
+	connection3.StopHeartbeat()
+}
@@ -0,0 +1,89 @@
+package rmq
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedQueue spreads a queue over several Redis lists, each with its own
+// consume loop, so a hot queue isn't limited by a single list
+type ShardedQueue struct {
+	Shards []Queue
+	next   uint32 // atomic, round robin counter
+}
+
+// NewShardedQueue opens a queue for each shard named like "name-shard-0"
+func NewShardedQueue(connection Connection, name string, shards int) *ShardedQueue {
+	if shards < 1 {
+		shards = 1
+	}
+
+	sharded := &ShardedQueue{}
+	for i := 0; i < shards; i++ {
+		sharded.Shards = append(sharded.Shards, connection.OpenQueue(fmt.Sprintf("%s-shard-%d", name, i)))
+	}
+	return sharded
+}
+
+// Publish publishes payload to the shards round robin
+func (sharded *ShardedQueue) Publish(payload string) bool {
+	i := atomic.AddUint32(&sharded.next, 1) - 1
+	return sharded.Shards[i%uint32(len(sharded.Shards))].Publish(payload)
+}
+
+// PublishWithKey publishes payload to the shard of key
+func (sharded *ShardedQueue) PublishWithKey(key, payload string) bool {
+	return sharded.Shard(key).Publish(payload)
+}
+
+// Shard returns the shard of key
+func (sharded *ShardedQueue) Shard(key string) Queue {
+	return sharded.Shards[keyIndex(key, len(sharded.Shards))]
+}
+
+// StartConsuming starts consuming all shards, each with its own prefetch
+// limit
+func (sharded *ShardedQueue) StartConsuming(prefetchLimit int, pollDuration time.Duration) error {
+	var firstErr error
+	for _, shard := range sharded.Shards {
+		if err := shard.StartConsuming(prefetchLimit, pollDuration); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StopConsuming stops consuming all shards
+func (sharded *ShardedQueue) StopConsuming() bool {
+	ok := true
+	for _, shard := range sharded.Shards {
+		ok = shard.StopConsuming() && ok
+	}
+	return ok
+}
+
+// AddConsumer adds consumer to all shards and returns the consumer names
+func (sharded *ShardedQueue) AddConsumer(tag string, consumer Consumer) ([]string, error) {
+	names := []string{}
+	for _, shard := range sharded.Shards {
+		name, err := shard.AddConsumer(tag, consumer)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// keyIndex hashes key to an index below n
+func keyIndex(key string, n int) int {
+	return int(keyHash(key) % uint32(n))
+}
+
+func keyHash(key string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return hash.Sum32()
+}
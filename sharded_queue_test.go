@@ -0,0 +1,48 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestShardedQueueSuite(t *testing.T) {
+	TestingSuiteT(&ShardedQueueSuite{}, t)
+}
+
+type ShardedQueueSuite struct{}
+
+func (suite *ShardedQueueSuite) TestShardedQueue(c *C) {
+	connection := OpenConnection("sharded-conn", "tcp", "localhost:6379", 1)
+	sharded := NewShardedQueue(connection, "sharded-q", 3)
+	c.Assert(sharded.Shards, HasLen, 3)
+	for _, shard := range sharded.Shards {
+		shard.PurgeReady()
+	}
+
+	for i := 0; i < 6; i++ {
+		c.Check(sharded.Publish("sharded-d"), Equals, true)
+	}
+	for _, shard := range sharded.Shards {
+		c.Check(shard.(*redisQueue).ReadyCount(), Equals, 2) // round robin
+	}
+
+	c.Check(sharded.PublishWithKey("key", "sharded-k1"), Equals, true)
+	c.Check(sharded.PublishWithKey("key", "sharded-k2"), Equals, true)
+	c.Check(sharded.Shard("key").(*redisQueue).ReadyCount(), Equals, 4)
+
+	consumer := &payloadsConsumer{}
+	c.Check(sharded.StartConsuming(10, time.Millisecond), IsNil)
+	names, err := sharded.AddConsumer("sharded-cons", consumer)
+	c.Check(err, IsNil)
+	c.Check(names, HasLen, 3)
+	time.Sleep(50 * time.Millisecond)
+
+	consumer.mutex.Lock()
+	c.Check(consumer.payloads, HasLen, 8)
+	consumer.mutex.Unlock()
+
+	sharded.StopConsuming()
+	connection.StopHeartbeat()
+}
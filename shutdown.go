@@ -0,0 +1,151 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShutdownError is returned by Shutdown if goroutines didn't stop before the
+// context was done
+type ShutdownError struct {
+	Pending []string // goroutines which are still running
+}
+
+func (err *ShutdownError) Error() string {
+	return fmt.Sprintf("rmq shutdown timed out waiting for %s", strings.Join(err.Pending, ", "))
+}
+
+// Shutdown stops all goroutines this connection started in this process:
+// the consume loops and consumers of consuming queues, the publish buffers
+// and the heartbeat. Consumers finish their current delivery, prefetched
+// deliveries are returned to ready and buffered payloads are published. It
+// waits until all goroutines returned or ctx is done, in which case a
+// *ShutdownError lists those still running. Otherwise temporary queues are
+// removed. The connection stays in the list of connections, so the cleaner
+// returns deliveries left unacked.
+func (connection *redisConnection) Shutdown(ctx context.Context) error {
+	connection.consumingMutex.Lock()
+	consumingQueues := append([]*redisQueue(nil), connection.consumingQueues...)
+	bufferedQueues := append([]*redisQueue(nil), connection.bufferedQueues...)
+	connection.consumingMutex.Unlock()
+
+	// signal everything first so it stops in parallel
+	for _, queue := range consumingQueues {
+		queue.StopConsuming()
+		queue.stopConsumers()
+	}
+	buffers := make([]*publishBuffer, len(bufferedQueues))
+	for i, queue := range bufferedQueues {
+		buffers[i] = queue.detachPublishBuffer()
+	}
+	connection.StopHeartbeat()
+
+	pending := []string{}
+	for _, queue := range consumingQueues {
+		pending = append(pending, queue.waitStopped(ctx)...)
+	}
+	for i, buffer := range buffers {
+		if buffer != nil && !waitClosed(ctx, buffer.done) {
+			pending = append(pending, fmt.Sprintf("publish buffer of %s", bufferedQueues[i].name))
+		}
+	}
+	if connection.heartbeatDone != nil && !waitClosed(ctx, connection.heartbeatDone) {
+		pending = append(pending, fmt.Sprintf("heartbeat of %s", connection.Name))
+	}
+
+	if len(pending) > 0 {
+		return &ShutdownError{Pending: pending}
+	}
+	connection.closeTemporaryQueues()
+	return nil
+}
+
+// stopConsumers makes all consumers of this process stop after their
+// current delivery
+func (queue *redisQueue) stopConsumers() {
+	queue.consumerStopsMutex.Lock()
+	defer queue.consumerStopsMutex.Unlock()
+
+	for _, stop := range queue.consumerStops {
+		stop()
+	}
+}
+
+// detachPublishBuffer removes the publish buffer and closes it in the
+// background, payloads published afterwards are pushed directly. Returns
+// nil if there is no buffer.
+func (queue *redisQueue) detachPublishBuffer() *publishBuffer {
+	queue.publishBufferMutex.Lock()
+	defer queue.publishBufferMutex.Unlock()
+
+	buffer := queue.publishBuffer
+	if buffer != nil {
+		queue.publishBuffer = nil
+		go buffer.close()
+	}
+	return buffer
+}
+
+// waitStopped waits until the consume loop, the dispatcher and all consumers
+// of a stopped queue returned and returns the prefetched deliveries left to
+// ready. Returns the goroutines still running when ctx is done.
+func (queue *redisQueue) waitStopped(ctx context.Context) (pending []string) {
+	if !waitClosed(ctx, queue.consumeDone) {
+		pending = append(pending, fmt.Sprintf("consume loop of %s", queue.name))
+	} else if !queue.fairDispatch {
+		// the dispatcher returns them itself
+		for delivery := range queue.getDeliveryChan() {
+			queue.returnToReady(delivery)
+		}
+	}
+
+	if queue.dispatchDone != nil && !waitClosed(ctx, queue.dispatchDone) {
+		pending = append(pending, fmt.Sprintf("dispatcher of %s", queue.name))
+	}
+
+	for {
+		names := queue.runningConsumers()
+		if len(names) == 0 {
+			return pending
+		}
+
+		select {
+		case <-queue.consumerExited:
+		case <-ctx.Done():
+			for _, name := range names {
+				pending = append(pending, fmt.Sprintf("consumer %s of %s", name, queue.name))
+			}
+			return pending
+		}
+	}
+}
+
+// runningConsumers returns the sorted names of consumers whose goroutines
+// didn't return yet
+func (queue *redisQueue) runningConsumers() []string {
+	queue.consumerStopsMutex.Lock()
+	defer queue.consumerStopsMutex.Unlock()
+
+	names := make([]string, 0, len(queue.consumerStops))
+	for name := range queue.consumerStops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitClosed returns true once done is closed, false if ctx is done first
+func waitClosed(ctx context.Context, done <-chan struct{}) bool {
+	if isClosed(done) {
+		return true // even if ctx is done too
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
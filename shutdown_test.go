@@ -0,0 +1,85 @@
+package rmq
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestShutdownSuite(t *testing.T) {
+	TestingSuiteT(&ShutdownSuite{}, t)
+}
+
+type ShutdownSuite struct{}
+
+func (suite *ShutdownSuite) TestShutdown(c *C) {
+	connection := OpenConnection("shutdown-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("shutdown-q").(*redisQueue)
+	queue.PurgeReady()
+	buffered := connection.OpenQueue("shutdown-buffered-q").(*redisQueue)
+	buffered.PurgeReady()
+
+	consumed := int32(0)
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	_, err := queue.AddConsumerFunc("shutdown-cons", func(delivery Delivery) {
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&consumed, 1)
+		delivery.Ack()
+	})
+	c.Assert(err, IsNil)
+	for i := 0; i < 3; i++ {
+		queue.Publish("shutdown-d")
+	}
+	time.Sleep(5 * time.Millisecond) // consumer took the first one
+
+	buffered.SetPublishBufferSize(10, OverflowBlock)
+	buffered.SetPublishLinger(time.Hour)
+	buffered.Publish("shutdown-buffered-d")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.Check(connection.Shutdown(ctx), IsNil)
+
+	// prefetched deliveries were returned
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.ReadyCount()+int(atomic.LoadInt32(&consumed)), Equals, 3)
+	c.Check(queue.GetConsumers(), HasLen, 0)
+	c.Check(queue.Publish("shutdown-d"), Equals, true)
+
+	c.Check(buffered.ReadyCount(), Equals, 1)
+	c.Check(buffered.Publish("shutdown-buffered-d"), Equals, true) // unbuffered now
+	c.Check(buffered.ReadyCount(), Equals, 2)
+
+	c.Check(connection.Check(), Equals, false) // heartbeat stopped
+	c.Check(connection.Shutdown(ctx), IsNil)   // nothing left to stop
+}
+
+func (suite *ShutdownSuite) TestTimeout(c *C) {
+	connection := OpenConnection("shutdown-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("shutdown-timeout-q").(*redisQueue)
+	queue.PurgeReady()
+
+	consumer := NewTestConsumer("shutdown-B")
+	consumer.AutoFinish = false
+	c.Assert(queue.StartConsuming(10, time.Millisecond), IsNil)
+	name, err := queue.AddConsumer("shutdown-cons", consumer)
+	c.Assert(err, IsNil)
+	queue.Publish("shutdown-d")
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = connection.Shutdown(ctx)
+	shutdownErr, ok := err.(*ShutdownError)
+	c.Assert(ok, Equals, true)
+	c.Assert(shutdownErr.Pending, Not(HasLen), 0)
+	c.Check(shutdownErr.Pending[0], Equals, "consumer "+name+" of shutdown-timeout-q")
+	c.Check(strings.HasPrefix(err.Error(), "rmq shutdown timed out waiting for consumer"), Equals, true)
+
+	consumer.Finish()
+	c.Check(connection.Shutdown(context.Background()), IsNil)
+}
@@ -0,0 +1,47 @@
+package rmq
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"sort"
+	"strconv"
+)
+
+// sign returns the HMAC-SHA256 of the envelope metadata and the payload as
+// stored, meaning compressed and encrypted but before it's put in a blob store
+func (env *envelope) sign(key []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	for _, field := range []string{env.ID, strconv.FormatInt(env.Published, 10), env.ContentType, env.Encoding, env.Key, env.Blob} {
+		writeSignedField(mac, field)
+	}
+
+	names := make([]string, 0, len(env.Headers))
+	for name := range env.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeSignedField(mac, name)
+		writeSignedField(mac, env.Headers[name])
+	}
+
+	mac.Write(payload)
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns true if the envelope has a valid signature for payload
+func (env *envelope) verify(key []byte, payload []byte) bool {
+	return env.Signature != "" && hmac.Equal([]byte(env.Signature), []byte(env.sign(key, payload)))
+}
+
+// writeSignedField writes the length before the field so that moving bytes
+// between fields changes the signature
+func writeSignedField(mac hash.Hash, field string) {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(field)))
+	mac.Write(length)
+	mac.Write([]byte(field))
+}
@@ -0,0 +1,55 @@
+package rmq
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestSigningSuite(t *testing.T) {
+	TestingSuiteT(&SigningSuite{}, t)
+}
+
+type SigningSuite struct{}
+
+func (suite *SigningSuite) TestSign(c *C) {
+	key := []byte("signing-key")
+	env := newEnvelope("")
+	env.Signature = env.sign(key, []byte("signing-p"))
+	c.Check(env.verify(key, []byte("signing-p")), Equals, true)
+	c.Check(env.verify(key, []byte("signing-x")), Equals, false)
+	c.Check(env.verify([]byte("other-key"), []byte("signing-p")), Equals, false)
+
+	env.Encoding = "gzip" // tampered metadata
+	c.Check(env.verify(key, []byte("signing-p")), Equals, false)
+}
+
+func (suite *SigningSuite) TestQueue(c *C) {
+	connection := OpenConnection("signing-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("signing-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	queue.Publish("signing-d1") // foreign, not signed
+	queue.SetSigningKey([]byte("signing-key"))
+	c.Check(queue.Publish("signing-d2"), Equals, true)
+	c.Check(queue.Publish("signing-d3"), Equals, true)
+
+	// tamper with the payload of signing-d3
+	value := queue.redisClient.LRange(queue.readyKey, 0, 0)[0]
+	queue.redisClient.LRem(queue.readyKey, 1, value)
+	queue.redisClient.LPush(queue.readyKey, strings.Replace(value, "signing-d3", "signing-dX", 1))
+
+	consumer := NewTestConsumer("signing-A")
+	queue.StartConsuming(10, time.Millisecond)
+	queue.AddConsumer("signing-cons", consumer)
+	time.Sleep(5 * time.Millisecond)
+	c.Assert(consumer.LastDeliveries, HasLen, 1)
+	c.Check(consumer.LastDeliveries[0].Payload(), Equals, "signing-d2")
+	c.Check(queue.RejectedCount(), Equals, 2)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
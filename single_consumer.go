@@ -0,0 +1,56 @@
+package rmq
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetSingleActiveConsumer makes only one connection at a time fetch
+// deliveries of this queue, for consumers which need strict ordering or
+// exclusive access. The consuming connection holds a lock in Redis which it
+// renews while consuming. The other connections stand by and take over once
+// the holder stopped consuming or its lease expired because it died. Zero
+// disables it. Call it before StartConsuming.
+//
+// A connection which lost its lock, for example after Redis was unreachable
+// for longer than lease, still hands its prefetched deliveries to its
+// consumers. Use a prefetch limit of 1 if that's a problem.
+func (queue *redisQueue) SetSingleActiveConsumer(lease time.Duration) {
+	queue.consumerLockLease = lease
+}
+
+// ActiveConsumer returns true if this connection may fetch deliveries, that
+// is if single active consumer mode is disabled or it holds the lock
+func (queue *redisQueue) ActiveConsumer() bool {
+	return queue.consumerLockLease <= 0 || atomic.LoadInt32(&queue.consumerLocked) == 1
+}
+
+// holdsConsumerLock takes or renews the consumer lock if needed and returns
+// whether this connection holds it. Only called by the consume goroutine.
+func (queue *redisQueue) holdsConsumerLock() bool {
+	if queue.consumerLockLease <= 0 {
+		return true
+	}
+
+	// renew well before the lease expires
+	locked := atomic.LoadInt32(&queue.consumerLocked) == 1
+	if locked && time.Since(queue.consumerLockRenewedAt) < queue.consumerLockLease/3 {
+		return true
+	}
+
+	locked = queue.redisClient.SetLease(queue.consumerLockKey, queue.connectionName, queue.consumerLockLease)
+	if locked {
+		queue.consumerLockRenewedAt = time.Now()
+		atomic.StoreInt32(&queue.consumerLocked, 1)
+	} else {
+		atomic.StoreInt32(&queue.consumerLocked, 0)
+	}
+	return locked
+}
+
+// releaseConsumerLock lets a standby connection take over right away
+func (queue *redisQueue) releaseConsumerLock() {
+	if atomic.SwapInt32(&queue.consumerLocked, 0) == 1 {
+		queue.redisClient.DelLease(queue.consumerLockKey, queue.connectionName)
+	}
+}
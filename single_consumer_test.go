@@ -0,0 +1,56 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestSingleConsumerSuite(t *testing.T) {
+	TestingSuiteT(&SingleConsumerSuite{}, t)
+}
+
+type SingleConsumerSuite struct{}
+
+func (suite *SingleConsumerSuite) TestSingleActiveConsumer(c *C) {
+	queues := []*redisQueue{}
+	consumers := []*TestConsumer{}
+	for i, name := range []string{"single-conn1", "single-conn2"} {
+		connection := OpenConnection(name, "tcp", "localhost:6379", 1)
+		queue := connection.OpenQueue("single-q").(*redisQueue)
+		if i == 0 {
+			queue.redisClient.Del(queue.consumerLockKey)
+			queue.PurgeReady()
+		}
+		queue.SetSingleActiveConsumer(time.Minute)
+		queue.StartConsuming(10, time.Millisecond)
+		consumer := NewTestConsumer("single-cons")
+		consumer.AutoAck = true
+		queue.AddConsumer("single-cons", consumer)
+		queues = append(queues, queue)
+		consumers = append(consumers, consumer)
+		defer connection.StopHeartbeat()
+		time.Sleep(5 * time.Millisecond) // the first one gets the lock
+	}
+
+	c.Check(queues[0].ActiveConsumer(), Equals, true)
+	c.Check(queues[1].ActiveConsumer(), Equals, false)
+
+	for i := 0; i < 5; i++ {
+		queues[0].Publish("single-d")
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Check(consumers[0].LastDeliveries, HasLen, 5)
+	c.Check(consumers[1].LastDeliveries, HasLen, 0)
+
+	// the standby takes over once the active one stopped
+	queues[0].StopConsuming()
+	time.Sleep(20 * time.Millisecond)
+	c.Check(queues[1].ActiveConsumer(), Equals, true)
+	queues[0].Publish("single-d")
+	time.Sleep(20 * time.Millisecond)
+	c.Check(consumers[1].LastDeliveries, HasLen, 1)
+
+	queues[1].StopConsuming()
+}
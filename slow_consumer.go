@@ -0,0 +1,219 @@
+package rmq
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlowConsumers returns the sorted names of consumers whose Consume() calls
+// took longer than threshold at the given percentile (between 0 and 1)
+// since they were added
+func (stat QueueStat) SlowConsumers(percentile float64, threshold time.Duration) []string {
+	names := []string{}
+	for name, consumerStat := range stat.ConsumerStats() {
+		if consumerStat.DurationPercentile(percentile) > threshold {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SlowConsumer is passed to the callback of a SlowConsumerDetector when a
+// consumer became slow and again when it got fast again or was removed
+type SlowConsumer struct {
+	Queue     string
+	Consumer  string
+	Duration  time.Duration // duration percentile since the previous check
+	Threshold time.Duration
+	Since     time.Time // when it was flagged
+	Resolved  bool
+}
+
+type consumerState struct {
+	buckets []int     // duration histogram at the previous check
+	since   time.Time // zero while not flagged
+}
+
+// SlowConsumerDetector regularly compares the processing durations of each
+// consumer since the previous check to a threshold, to find the consumer
+// which is backing up a shared queue
+type SlowConsumerDetector struct {
+	connection *redisConnection
+	percentile float64
+	threshold  time.Duration
+	callback   func(SlowConsumer)
+	mutex      sync.Mutex
+	queues     []string
+	stopChan   chan struct{}
+	checkMutex sync.Mutex                           // serializes checks which update states
+	states     map[string]map[string]*consumerState // by queue and consumer
+}
+
+// NewSlowConsumerDetector calls callback when the given percentile of a
+// consumer's processing durations exceeds threshold, like 0.95 and a second
+func NewSlowConsumerDetector(connection *redisConnection, percentile float64, threshold time.Duration, callback func(SlowConsumer)) *SlowConsumerDetector {
+	return &SlowConsumerDetector{
+		connection: connection,
+		percentile: percentile,
+		threshold:  threshold,
+		callback:   callback,
+		states:     map[string]map[string]*consumerState{},
+	}
+}
+
+// AddQueue checks the consumers of queue
+func (detector *SlowConsumerDetector) AddQueue(queue string) {
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+	detector.queues = append(detector.queues, queue)
+}
+
+// Start checks every interval until Stop is called
+func (detector *SlowConsumerDetector) Start(interval time.Duration) {
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+
+	if detector.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	detector.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				detector.Check()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the regular checks started by Start
+func (detector *SlowConsumerDetector) Stop() {
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+
+	if detector.stopChan == nil {
+		return
+	}
+	close(detector.stopChan)
+	detector.stopChan = nil
+}
+
+// Check compares the durations since the previous check and calls the
+// callback for consumers which became slow or fast again. Consumers without
+// calls since the previous check keep their state. The first check of a
+// consumer covers its durations since it was added.
+func (detector *SlowConsumerDetector) Check() {
+	detector.checkMutex.Lock()
+	defer detector.checkMutex.Unlock()
+
+	detector.mutex.Lock()
+	queues := append([]string(nil), detector.queues...)
+	detector.mutex.Unlock()
+
+	now := time.Now()
+	stats := detector.connection.CollectStats(queues)
+	for _, queue := range queues {
+		states := detector.states[queue]
+		if states == nil {
+			states = map[string]*consumerState{}
+			detector.states[queue] = states
+		}
+
+		consumerStats := stats.QueueStats[queue].ConsumerStats()
+		for name, state := range states {
+			if _, ok := consumerStats[name]; !ok {
+				delete(states, name) // removed
+				if !state.since.IsZero() {
+					detector.callback(SlowConsumer{Queue: queue, Consumer: name, Threshold: detector.threshold, Since: state.since, Resolved: true})
+				}
+			}
+		}
+
+		for name, consumerStat := range consumerStats {
+			state := states[name]
+			if state == nil {
+				state = &consumerState{}
+				states[name] = state
+			}
+			window := subtractBuckets(consumerStat.durationBuckets, state.buckets)
+			state.buckets = consumerStat.durationBuckets
+			if sumBuckets(window) == 0 {
+				continue // no calls since the previous check
+			}
+
+			slow := SlowConsumer{
+				Queue:     queue,
+				Consumer:  name,
+				Duration:  bucketPercentile(window, consumerDurationBuckets, detector.percentile),
+				Threshold: detector.threshold,
+				Since:     state.since,
+			}
+			switch {
+			case slow.Duration > detector.threshold && state.since.IsZero():
+				state.since = now
+				slow.Since = now
+				detector.callback(slow)
+			case slow.Duration <= detector.threshold && !state.since.IsZero():
+				state.since = time.Time{}
+				slow.Resolved = true
+				detector.callback(slow)
+			}
+		}
+	}
+}
+
+// SlowConsumers returns the consumers flagged by the last check
+func (detector *SlowConsumerDetector) SlowConsumers() []SlowConsumer {
+	detector.checkMutex.Lock()
+	defer detector.checkMutex.Unlock()
+
+	slow := []SlowConsumer{}
+	for queue, states := range detector.states {
+		for name, state := range states {
+			if !state.since.IsZero() {
+				slow = append(slow, SlowConsumer{Queue: queue, Consumer: name, Threshold: detector.threshold, Since: state.since})
+			}
+		}
+	}
+	sort.Slice(slow, func(i, j int) bool {
+		if slow[i].Queue != slow[j].Queue {
+			return slow[i].Queue < slow[j].Queue
+		}
+		return slow[i].Consumer < slow[j].Consumer
+	})
+	return slow
+}
+
+// subtractBuckets returns the histogram counts of a minus those of b, b may
+// be nil
+func subtractBuckets(a, b []int) []int {
+	difference := make([]int, len(a))
+	for i := range a {
+		difference[i] = a[i]
+		if i < len(b) {
+			difference[i] -= b[i]
+		}
+		if difference[i] < 0 {
+			difference[i] = 0 // metrics were reset
+		}
+	}
+	return difference
+}
+
+func sumBuckets(buckets []int) int {
+	sum := 0
+	for _, count := range buckets {
+		sum += count
+	}
+	return sum
+}
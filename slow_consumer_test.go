@@ -0,0 +1,74 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestSlowConsumerSuite(t *testing.T) {
+	TestingSuiteT(&SlowConsumerSuite{}, t)
+}
+
+type SlowConsumerSuite struct{}
+
+// recordCalls adds Consume() calls of duration to the metrics of consumer
+func recordCalls(queue *redisQueue, consumer string, duration time.Duration, calls int) {
+	queue.redisClient.SAdd(queue.consumersKey, consumer)
+	queue.redisClient.HIncrBy(queue.consumerMetricsKey(consumer), durationBucketField(durationBucket(duration)), calls)
+}
+
+func (suite *SlowConsumerSuite) TestSlowConsumers(c *C) {
+	connection := OpenConnection("slow-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("slow-q").(*redisQueue)
+	queue.StartConsuming(10, time.Millisecond)
+	queue.RemoveAllConsumers()
+
+	recordCalls(queue, "slow-fast", time.Millisecond, 100)
+	recordCalls(queue, "slow-slow", time.Millisecond, 90)
+	recordCalls(queue, "slow-slow", time.Second, 10)
+
+	queueStat := connection.CollectStats([]string{"slow-q"}).QueueStats["slow-q"]
+	c.Check(queueStat.SlowConsumers(0.95, 100*time.Millisecond), DeepEquals, []string{"slow-slow"})
+	c.Check(queueStat.SlowConsumers(0.5, 100*time.Millisecond), DeepEquals, []string{})
+
+	flagged := []SlowConsumer{}
+	detector := NewSlowConsumerDetector(connection, 0.95, 100*time.Millisecond, func(slow SlowConsumer) {
+		flagged = append(flagged, slow)
+	})
+	detector.AddQueue("slow-q")
+	detector.Check()
+	c.Assert(flagged, HasLen, 1)
+	c.Check(flagged[0].Consumer, Equals, "slow-slow")
+	c.Check(flagged[0].Duration, Equals, time.Second)
+	c.Check(flagged[0].Resolved, Equals, false)
+	c.Check(detector.SlowConsumers(), HasLen, 1)
+
+	detector.Check() // no calls since, keeps state
+	c.Check(flagged, HasLen, 1)
+
+	recordCalls(queue, "slow-slow", time.Millisecond, 100)
+	recordCalls(queue, "slow-fast", 5*time.Second, 100)
+	detector.Check() // only counts calls since the previous check
+	c.Assert(flagged, HasLen, 3)
+	for _, slow := range flagged[1:] {
+		if slow.Consumer == "slow-slow" {
+			c.Check(slow.Resolved, Equals, true)
+		} else {
+			c.Check(slow.Resolved, Equals, false)
+			c.Check(slow.Duration, Equals, 5*time.Second)
+		}
+	}
+	c.Check(detector.SlowConsumers()[0].Consumer, Equals, "slow-fast")
+
+	queue.RemoveAllConsumers()
+	detector.Check()
+	c.Assert(flagged, HasLen, 4)
+	c.Check(flagged[3].Consumer, Equals, "slow-fast")
+	c.Check(flagged[3].Resolved, Equals, true)
+	c.Check(detector.SlowConsumers(), HasLen, 0)
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,168 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adjust/uniuri"
+)
+
+// ErrSQSReceiptHandleInvalid is returned for unknown or already deleted receipt handles
+var ErrSQSReceiptHandleInvalid = errors.New("rmq sqs receipt handle is invalid")
+
+// SQSQueue provides an API similar to Amazon SQS on top of an rmq queue, so
+// services written against SQS semantics can run against Redis. Received
+// messages are invisible until their visibility timeout expires, afterwards
+// they are returned to ready unless they have been deleted.
+type SQSQueue struct {
+	queue       *redisQueue
+	inflightKey string // list of received messages
+	receiptsKey string // hash of receipt handle to "<deadline>:<payload>"
+}
+
+// SQSMessage is a message received from an SQSQueue
+type SQSMessage struct {
+	Body          string
+	ReceiptHandle string
+}
+
+// NewSQSQueue returns an SQS shim for the given queue
+func NewSQSQueue(queue Queue) (*SQSQueue, error) {
+	redisQueue, ok := queue.(*redisQueue)
+	if !ok {
+		return nil, fmt.Errorf("rmq sqs needs a redis queue, got %T", queue)
+	}
+
+	return &SQSQueue{
+		queue:       redisQueue,
+		inflightKey: strings.Replace(queueSQSInflightTemplate, phQueue, redisQueue.name, 1),
+		receiptsKey: strings.Replace(queueSQSReceiptsTemplate, phQueue, redisQueue.name, 1),
+	}, nil
+}
+
+// SendMessage publishes body to the queue
+func (sqs *SQSQueue) SendMessage(body string) error {
+	if !sqs.queue.Publish(body) {
+		return fmt.Errorf("rmq sqs failed to send message to %s", sqs.queue)
+	}
+	return nil
+}
+
+// ReceiveMessage receives up to maxMessages messages which stay invisible to
+// other receivers for visibilityTimeout. Messages whose visibility timeout
+// expired are returned to ready before receiving.
+func (sqs *SQSQueue) ReceiveMessage(maxMessages int, visibilityTimeout time.Duration) ([]SQSMessage, error) {
+	sqs.returnExpired()
+
+	messages := []SQSMessage{}
+	for i := 0; i < maxMessages; i++ {
+		value, ok := sqs.queue.redisClient.RPopLPush(sqs.queue.readyKey, sqs.inflightKey)
+		if !ok {
+			break // ready is empty
+		}
+
+		body, err := sqs.decode(value)
+		if err != nil {
+			// receivers can't handle it, consumers would reject it too
+			sqs.queue.redisClient.LRemLPush(sqs.inflightKey, sqs.queue.rejectedKey, value, value)
+			continue
+		}
+
+		// the receipt holds the value as stored to find it in inflight
+		receiptHandle := uniuri.NewLen(20)
+		if !sqs.queue.redisClient.HSet(sqs.receiptsKey, receiptHandle, encodeSQSReceipt(visibilityTimeout, value)) {
+			return messages, fmt.Errorf("rmq sqs failed to store receipt handle for %s", sqs.queue)
+		}
+		messages = append(messages, SQSMessage{Body: body, ReceiptHandle: receiptHandle})
+	}
+
+	return messages, nil
+}
+
+// decode returns the payload of value as stored in Redis, which may be an
+// envelope
+func (sqs *SQSQueue) decode(value string) (string, error) {
+	env, ok := decodeEnvelope(value)
+	if !ok {
+		if sqs.queue.signingKey != nil {
+			return "", fmt.Errorf("rmq sqs message not signed")
+		}
+		return value, nil
+	}
+	return env.decodePayload(sqs.queue.decodeOptions())
+}
+
+// DeleteMessage deletes a received message for good
+func (sqs *SQSQueue) DeleteMessage(receiptHandle string) error {
+	value, ok := sqs.queue.redisClient.HGet(sqs.receiptsKey, receiptHandle)
+	if !ok {
+		return ErrSQSReceiptHandleInvalid
+	}
+	_, payload, err := decodeSQSReceipt(value)
+	if err != nil {
+		return err
+	}
+
+	sqs.queue.redisClient.LRem(sqs.inflightKey, 1, payload)
+	sqs.queue.redisClient.HDel(sqs.receiptsKey, receiptHandle)
+	return nil
+}
+
+// ChangeMessageVisibility makes a received message invisible for
+// visibilityTimeout from now on
+func (sqs *SQSQueue) ChangeMessageVisibility(receiptHandle string, visibilityTimeout time.Duration) error {
+	value, ok := sqs.queue.redisClient.HGet(sqs.receiptsKey, receiptHandle)
+	if !ok {
+		return ErrSQSReceiptHandleInvalid
+	}
+	_, payload, err := decodeSQSReceipt(value)
+	if err != nil {
+		return err
+	}
+
+	if !sqs.queue.redisClient.HSet(sqs.receiptsKey, receiptHandle, encodeSQSReceipt(visibilityTimeout, payload)) {
+		return fmt.Errorf("rmq sqs failed to change visibility of %s", receiptHandle)
+	}
+	return nil
+}
+
+// returnExpired moves received messages whose visibility timeout expired
+// back to ready and returns the number of returned messages
+func (sqs *SQSQueue) returnExpired() int {
+	returned := 0
+	now := time.Now()
+	for receiptHandle, value := range sqs.queue.redisClient.HGetAll(sqs.receiptsKey) {
+		deadline, payload, err := decodeSQSReceipt(value)
+		if err != nil || deadline.After(now) {
+			continue
+		}
+
+		// only the receiver removing it from inflight returns it
+		if count, ok := sqs.queue.redisClient.LRem(sqs.inflightKey, 1, payload); ok && count == 1 {
+			sqs.queue.redisClient.LPush(sqs.queue.readyKey, payload)
+			returned++
+		}
+		sqs.queue.redisClient.HDel(sqs.receiptsKey, receiptHandle)
+	}
+	return returned
+}
+
+func encodeSQSReceipt(visibilityTimeout time.Duration, payload string) string {
+	deadline := time.Now().Add(visibilityTimeout).UnixNano()
+	return strconv.FormatInt(deadline, 10) + ":" + payload
+}
+
+func decodeSQSReceipt(value string) (deadline time.Time, payload string, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return deadline, "", fmt.Errorf("rmq sqs found invalid receipt %q", value)
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return deadline, "", fmt.Errorf("rmq sqs found invalid receipt %q", value)
+	}
+	return time.Unix(0, nanos), parts[1], nil
+}
@@ -0,0 +1,87 @@
+package rmq
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestSQSSuite(t *testing.T) {
+	TestingSuiteT(&SQSSuite{}, t)
+}
+
+type SQSSuite struct{}
+
+func (suite *SQSSuite) TestSQS(c *C) {
+	connection := OpenConnection("sqs-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("sqs-q").(*redisQueue)
+	queue.PurgeReady()
+
+	sqs, err := NewSQSQueue(queue)
+	c.Assert(err, IsNil)
+	queue.redisClient.Del(sqs.inflightKey)
+	queue.redisClient.Del(sqs.receiptsKey)
+
+	c.Check(sqs.SendMessage("sqs-d1"), IsNil)
+	c.Check(sqs.SendMessage("sqs-d2"), IsNil)
+
+	messages, err := sqs.ReceiveMessage(1, time.Hour)
+	c.Check(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0].Body, Equals, "sqs-d1")
+	c.Check(queue.ReadyCount(), Equals, 1)
+	c.Check(sqs.DeleteMessage(messages[0].ReceiptHandle), IsNil)
+	c.Check(sqs.DeleteMessage(messages[0].ReceiptHandle), Equals, ErrSQSReceiptHandleInvalid)
+
+	messages, err = sqs.ReceiveMessage(10, time.Millisecond)
+	c.Check(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0].Body, Equals, "sqs-d2")
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	time.Sleep(2 * time.Millisecond)
+	messages, err = sqs.ReceiveMessage(10, time.Hour)
+	c.Check(err, IsNil)
+	c.Assert(messages, HasLen, 1) // returned after visibility timeout
+	c.Check(messages[0].Body, Equals, "sqs-d2")
+	c.Check(sqs.ChangeMessageVisibility(messages[0].ReceiptHandle, time.Millisecond), IsNil)
+
+	time.Sleep(2 * time.Millisecond)
+	c.Check(sqs.returnExpired(), Equals, 1)
+	c.Check(queue.ReadyCount(), Equals, 1)
+
+	connection.StopHeartbeat()
+}
+
+func (suite *SQSSuite) TestEnvelope(c *C) {
+	connection := OpenConnection("sqs-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("sqs-envelope-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+	queue.SetEnvelope(true)
+	queue.SetCompression(GzipCompression, 1)
+
+	sqs, err := NewSQSQueue(queue)
+	c.Assert(err, IsNil)
+	queue.redisClient.Del(sqs.inflightKey)
+	queue.redisClient.Del(sqs.receiptsKey)
+
+	c.Check(sqs.SendMessage("sqs-d1"), IsNil)
+	messages, err := sqs.ReceiveMessage(1, time.Hour)
+	c.Check(err, IsNil)
+	c.Assert(messages, HasLen, 1)
+	c.Check(messages[0].Body, Equals, "sqs-d1")
+	c.Check(sqs.DeleteMessage(messages[0].ReceiptHandle), IsNil)
+	c.Check(queue.redisClient.LRange(sqs.inflightKey, 0, -1), HasLen, 0)
+
+	// unsigned messages are rejected with a signing key
+	c.Check(sqs.SendMessage("sqs-d2"), IsNil)
+	queue.SetSigningKey([]byte("secret"))
+	messages, err = sqs.ReceiveMessage(1, time.Hour)
+	c.Check(err, IsNil)
+	c.Check(messages, HasLen, 0)
+	c.Check(queue.RejectedCount(), Equals, 1)
+
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,84 @@
+package rmq
+
+import (
+	"strings"
+	"time"
+
+	"github.com/adjust/uniuri"
+)
+
+// stagedExpiration is how long prepared deliveries wait for CommitPublish
+// or DiscardPublish
+const stagedExpiration = 24 * time.Hour
+
+// PreparePublish stages payloads for publishing, like Publish would publish
+// them, and returns an ID to publish them with CommitPublish. Use it for a
+// transactional outbox: prepare the payloads, store the ID in your database
+// transaction, commit it and then call CommitPublish. On rollback call
+// DiscardPublish. Prepared payloads which are neither committed nor
+// discarded expire after a day. Returns false if a payload couldn't be
+// encoded or staged.
+func (queue *redisQueue) PreparePublish(payloads ...string) (id string, ok bool) {
+	values := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		value, ok := queue.encodeValue(payload)
+		if !ok {
+			return "", false
+		}
+		values = append(values, value)
+	}
+
+	id = uniuri.NewLen(20)
+	if len(values) == 0 {
+		return id, true
+	}
+	key := queue.stagedKey(id)
+	if !queue.redisClient.LPushBatch(key, values) {
+		return "", false
+	}
+	queue.redisClient.Expire(key, stagedExpiration)
+	queue.debugf("prepared %d deliveries %s %s", len(values), id, queue)
+	return id, true
+}
+
+// CommitPublish publishes the payloads prepared with id in order by moving
+// them to the ready list in one atomic step. Returns the number of published
+// payloads, which is zero if they were committed, discarded or expired
+// before.
+func (queue *redisQueue) CommitPublish(id string) int {
+	key := queue.stagedKey(id)
+	count, ok := queue.redisClient.LLen(key)
+	if !ok || count == 0 {
+		return 0
+	}
+
+	values := queue.redisClient.RPopLPushBatch(key, queue.readyKey, count)
+	queue.published(values)
+	queue.debugf("committed %d deliveries %s %s", len(values), id, queue)
+	return len(values)
+}
+
+// DiscardPublish removes the payloads prepared with id, returns false if
+// they were committed, discarded or expired before
+func (queue *redisQueue) DiscardPublish(id string) bool {
+	count, _ := queue.redisClient.Del(queue.stagedKey(id))
+	return count > 0
+}
+
+// encodeValue returns payload as Publish would store it in Redis
+func (queue *redisQueue) encodeValue(payload string) (string, bool) {
+	if !queue.validate(payload, "") {
+		return "", false
+	}
+	if queue.shouldEncode(len(payload)) {
+		return queue.encodePayload(queue.newEnvelope(""), []byte(payload))
+	}
+	if queue.envelope || queue.messageTTL > 0 {
+		return queue.newEnvelope(payload).encode(), true
+	}
+	return payload, true
+}
+
+func (queue *redisQueue) stagedKey(id string) string {
+	return strings.NewReplacer(phQueue, queue.name, phStaged, id).Replace(queueStagedTemplate)
+}
@@ -0,0 +1,69 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestStagedPublishSuite(t *testing.T) {
+	TestingSuiteT(&StagedPublishSuite{}, t)
+}
+
+type StagedPublishSuite struct{}
+
+func (suite *StagedPublishSuite) TestCommit(c *C) {
+	connection := OpenConnection("staged-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("staged-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetEnvelope(true)
+
+	id, ok := queue.PreparePublish("staged-d1", "staged-d2")
+	c.Assert(ok, Equals, true)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	ttl, _ := connection.redisClient.TTL(queue.stagedKey(id))
+	c.Check(ttl > 0, Equals, true)
+
+	c.Check(queue.Publish("staged-d0"), Equals, true)
+	c.Check(queue.CommitPublish(id), Equals, 2)
+	c.Check(queue.CommitPublish(id), Equals, 0)
+	c.Check(queue.DiscardPublish(id), Equals, false)
+
+	deliveries, err := queue.GetBatch(context.Background(), 3)
+	c.Assert(err, IsNil)
+	c.Check(deliveries.Payloads(), DeepEquals, []string{"staged-d0", "staged-d1", "staged-d2"})
+	c.Check(deliveries[1].(*wrapDelivery).envelope, NotNil)
+	c.Check(deliveries.Ack(), Equals, 0)
+	connection.StopHeartbeat()
+}
+
+func (suite *StagedPublishSuite) TestDiscard(c *C) {
+	connection := OpenConnection("staged-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("staged-discard-q").(*redisQueue)
+	queue.PurgeReady()
+
+	id, ok := queue.PreparePublish("staged-d1")
+	c.Assert(ok, Equals, true)
+	c.Check(queue.DiscardPublish(id), Equals, true)
+	c.Check(queue.CommitPublish(id), Equals, 0)
+	c.Check(queue.ReadyCount(), Equals, 0)
+
+	id, ok = queue.PreparePublish()
+	c.Check(ok, Equals, true)
+	c.Check(queue.CommitPublish(id), Equals, 0)
+
+	// payloads are validated like published ones
+	queue.SetValidator(ValidJSON)
+	_, ok = queue.PreparePublish("{}", "staged-invalid")
+	c.Check(ok, Equals, false)
+	connection.StopHeartbeat()
+}
+
+func (suite *StagedPublishSuite) TestTestQueue(c *C) {
+	queue := NewTestQueue("staged-test")
+	id, _ := queue.PreparePublish("staged-d1")
+	c.Check(queue.LastDeliveries, HasLen, 0)
+	c.Check(queue.CommitPublish(id), Equals, 1)
+	c.Check(queue.LastDeliveries, DeepEquals, []string{"staged-d1"})
+}
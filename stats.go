@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"time"
 )
 
 type ConnectionStat struct {
-	active       bool
-	unackedCount int
-	consumers    []string
+	active        bool
+	unackedCount  int
+	consumers     []string
+	consumerStats map[string]ConsumerStat
 }
 
 func (stat ConnectionStat) String() string {
@@ -22,8 +24,9 @@ func (stat ConnectionStat) String() string {
 type ConnectionStats map[string]ConnectionStat
 
 type QueueStat struct {
-	ReadyCount      int `json:"ready"`
-	RejectedCount   int `json:"rejected"`
+	ReadyCount      int           `json:"ready"`
+	RejectedCount   int           `json:"rejected"`
+	OldestReadyAge  time.Duration `json:"oldest_ready_age"` // -1 if unknown because the oldest delivery has no envelope
 	connectionStats ConnectionStats
 }
 
@@ -36,9 +39,10 @@ func NewQueueStat(readyCount, rejectedCount int) QueueStat {
 }
 
 func (stat QueueStat) String() string {
-	return fmt.Sprintf("[ready:%d rejected:%d conn:%s",
+	return fmt.Sprintf("[ready:%d rejected:%d oldest:%s conn:%s",
 		stat.ReadyCount,
 		stat.RejectedCount,
+		stat.OldestReadyAge,
 		stat.connectionStats,
 	)
 }
@@ -59,6 +63,26 @@ func (stat QueueStat) ConsumerCount() int {
 	return consumer
 }
 
+// ConsumerStats returns the processing metrics of all consumers of the queue by consumer name
+func (stat QueueStat) ConsumerStats() map[string]ConsumerStat {
+	consumerStats := map[string]ConsumerStat{}
+	for _, connectionStat := range stat.connectionStats {
+		for name, consumerStat := range connectionStat.consumerStats {
+			consumerStats[name] = consumerStat
+		}
+	}
+	return consumerStats
+}
+
+// ProcessingStat returns the processing metrics of all consumers of the queue combined
+func (stat QueueStat) ProcessingStat() ConsumerStat {
+	processingStat := ConsumerStat{}
+	for _, consumerStat := range stat.ConsumerStats() {
+		processingStat = processingStat.add(consumerStat)
+	}
+	return processingStat
+}
+
 func (stat QueueStat) ConnectionCount() int {
 	return len(stat.connectionStats)
 }
@@ -81,7 +105,13 @@ func CollectStats(queueList []string, mainConnection *redisConnection) Stats {
 	stats := NewStats()
 	for _, queueName := range queueList {
 		queue := mainConnection.openQueue(queueName)
-		stats.QueueStats[queueName] = NewQueueStat(queue.ReadyCount(), queue.RejectedCount())
+		queueStat := NewQueueStat(queue.ReadyCount(), queue.RejectedCount())
+		if age, ok := queue.OldestReadyAge(); ok {
+			queueStat.OldestReadyAge = age
+		} else {
+			queueStat.OldestReadyAge = -1
+		}
+		stats.QueueStats[queueName] = queueStat
 	}
 
 	connectionNames := mainConnection.GetConnections()
@@ -97,15 +127,21 @@ func CollectStats(queueList []string, mainConnection *redisConnection) Stats {
 
 		for _, queueName := range queueNames {
 			queue := connection.openQueue(queueName)
-			consumers := queue.GetConsumers()
 			openQueueStat, ok := stats.QueueStats[queueName]
 			if !ok {
 				continue
 			}
+			consumerStats := queue.GetConsumerStats()
+			consumers := make([]string, 0, len(consumerStats))
+			for consumer := range consumerStats {
+				consumers = append(consumers, consumer)
+			}
+			sort.Strings(consumers)
 			openQueueStat.connectionStats[connectionName] = ConnectionStat{
-				active:       connectionActive,
-				unackedCount: queue.UnackedCount(),
-				consumers:    consumers,
+				active:        connectionActive,
+				unackedCount:  queue.UnackedCount(),
+				consumers:     consumers,
+				consumerStats: consumerStats,
 			}
 		}
 	}
@@ -117,14 +153,20 @@ func (stats Stats) String() string {
 	var buffer bytes.Buffer
 
 	for queueName, queueStat := range stats.QueueStats {
-		buffer.WriteString(fmt.Sprintf("    queue:%s ready:%d rejected:%d unacked:%d consumers:%d\n",
-			queueName, queueStat.ReadyCount, queueStat.RejectedCount, queueStat.UnackedCount(), queueStat.ConsumerCount(),
+		buffer.WriteString(fmt.Sprintf("    queue:%s ready:%d rejected:%d unacked:%d consumers:%d oldest:%s\n",
+			queueName, queueStat.ReadyCount, queueStat.RejectedCount, queueStat.UnackedCount(), queueStat.ConsumerCount(), queueStat.OldestReadyAge,
 		))
 
 		for connectionName, connectionStat := range queueStat.connectionStats {
 			buffer.WriteString(fmt.Sprintf("        connection:%s unacked:%d consumers:%d active:%t\n",
 				connectionName, connectionStat.unackedCount, len(connectionStat.consumers), connectionStat.active,
 			))
+
+			for _, consumerName := range connectionStat.consumers {
+				buffer.WriteString(fmt.Sprintf("            consumer:%s %s\n",
+					consumerName, connectionStat.consumerStats[consumerName],
+				))
+			}
 		}
 	}
 
@@ -0,0 +1,177 @@
+package rmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsSample is a snapshot of a queue recorded by StatsHistory. Rates are
+// per second since the previous sample and zero for the first one.
+type StatsSample struct {
+	Time        time.Time `json:"time"`
+	Ready       int       `json:"ready"`
+	Rejected    int       `json:"rejected"`
+	Unacked     int       `json:"unacked"`
+	Consumers   int       `json:"consumers"`
+	ConsumeRate float64   `json:"consume_rate"`
+	AckRate     float64   `json:"ack_rate"`
+	RejectRate  float64   `json:"reject_rate"`
+}
+
+// StatsHistory regularly records stats samples of queues into capped lists
+// in Redis, so trends over the last hours can be shown and not just the
+// current values
+type StatsHistory struct {
+	connection  *redisConnection
+	maxSamples  int
+	mutex       sync.Mutex
+	queues      []string
+	previous    map[string]ConsumerStat // processing totals at the last sample
+	previousAt  time.Time
+	stopChan    chan struct{}
+	stoppedChan chan struct{} // closed when the recording goroutine returned
+	recordMutex sync.Mutex    // serializes recordings which update previous
+}
+
+// NewStatsHistory keeps the last maxSamples samples per queue, so the
+// covered time span is maxSamples times the interval passed to Start
+func NewStatsHistory(connection *redisConnection, maxSamples int) *StatsHistory {
+	return &StatsHistory{
+		connection: connection,
+		maxSamples: maxSamples,
+		previous:   map[string]ConsumerStat{},
+	}
+}
+
+// AddQueue records samples of queue
+func (history *StatsHistory) AddQueue(queue string) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	history.queues = append(history.queues, queue)
+}
+
+// Start records samples every interval until Stop is called
+func (history *StatsHistory) Start(interval time.Duration) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	if history.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	stoppedChan := make(chan struct{})
+	history.stopChan = stopChan
+	history.stoppedChan = stoppedChan
+
+	go func() {
+		defer close(stoppedChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				history.Record()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the recording started by Start and waits for a running
+// recording to finish
+func (history *StatsHistory) Stop() {
+	history.mutex.Lock()
+	if history.stopChan == nil {
+		history.mutex.Unlock()
+		return
+	}
+	close(history.stopChan)
+	stoppedChan := history.stoppedChan
+	history.stopChan = nil
+	history.mutex.Unlock()
+
+	<-stoppedChan // outside the lock, Record takes it
+}
+
+// Record records a sample of each queue now
+func (history *StatsHistory) Record() {
+	history.recordMutex.Lock()
+	defer history.recordMutex.Unlock()
+
+	history.mutex.Lock()
+	queues := append([]string(nil), history.queues...)
+	history.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(history.previousAt).Seconds()
+	stats := history.connection.CollectStats(queues)
+	for _, queue := range queues {
+		queueStat := stats.QueueStats[queue]
+		processing := queueStat.ProcessingStat()
+		sample := StatsSample{
+			Time:      now,
+			Ready:     queueStat.ReadyCount,
+			Rejected:  queueStat.RejectedCount,
+			Unacked:   queueStat.UnackedCount(),
+			Consumers: queueStat.ConsumerCount(),
+		}
+		if previous, ok := history.previous[queue]; ok && elapsed > 0 {
+			sample.ConsumeRate = rate(processing.Consumed-previous.Consumed, elapsed)
+			sample.AckRate = rate(processing.Acked-previous.Acked, elapsed)
+			sample.RejectRate = rate(processing.Rejected-previous.Rejected, elapsed)
+		}
+		history.previous[queue] = processing
+		history.store(queue, sample)
+	}
+	history.previousAt = now
+}
+
+// rate returns delta per second, totals drop when consumers are removed
+func rate(delta int, seconds float64) float64 {
+	if delta < 0 {
+		return 0
+	}
+	return float64(delta) / seconds
+}
+
+func (history *StatsHistory) store(queue string, sample StatsSample) {
+	encoded, _ := json.Marshal(sample)
+	key := queueHistoryKey(queue)
+	history.connection.redisClient.LPush(key, string(encoded))
+	history.connection.redisClient.LTrim(key, 0, history.maxSamples-1)
+}
+
+// History returns the recorded samples of queue, oldest first
+func (history *StatsHistory) History(queue string) []StatsSample {
+	values := history.connection.redisClient.LRange(queueHistoryKey(queue), 0, -1)
+	samples := make([]StatsSample, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		var sample StatsSample
+		if err := json.Unmarshal([]byte(values[i]), &sample); err == nil {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// ServeHTTP responds with the samples of the queue given by the queue query
+// parameter as JSON
+func (history *StatsHistory) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	queue := request.URL.Query().Get("queue")
+	if queue == "" {
+		http.Error(writer, "missing queue", http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(history.History(queue))
+}
+
+func queueHistoryKey(queue string) string {
+	return strings.Replace(queueHistoryTemplate, phQueue, queue, 1)
+}
@@ -0,0 +1,58 @@
+package rmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestStatsHistorySuite(t *testing.T) {
+	TestingSuiteT(&StatsHistorySuite{}, t)
+}
+
+type StatsHistorySuite struct{}
+
+func (suite *StatsHistorySuite) TestStatsHistory(c *C) {
+	connection := OpenConnection("history-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("history-q").(*redisQueue)
+	queue.PurgeReady()
+	connection.redisClient.Del(queueHistoryKey("history-q"))
+
+	history := NewStatsHistory(connection, 3)
+	history.AddQueue("history-q")
+	queue.Publish("history-d1")
+	history.Record()
+	queue.Publish("history-d2")
+	history.Record()
+
+	samples := history.History("history-q")
+	c.Assert(samples, HasLen, 2)
+	c.Check(samples[0].Ready, Equals, 1) // oldest first
+	c.Check(samples[1].Ready, Equals, 2)
+	c.Check(samples[1].Time.After(samples[0].Time), Equals, true)
+
+	history.Start(time.Millisecond)
+	for i := 0; i < 100 && len(history.History("history-q")) < 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond) // record a few more to check the cap
+	history.Stop()
+	c.Check(history.History("history-q"), HasLen, 3) // capped
+
+	recorder := httptest.NewRecorder()
+	history.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/history?queue=history-q", nil))
+	c.Check(recorder.Code, Equals, http.StatusOK)
+	var served []StatsSample
+	c.Check(json.Unmarshal(recorder.Body.Bytes(), &served), IsNil)
+	c.Check(served, HasLen, 3)
+
+	recorder = httptest.NewRecorder()
+	history.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/history", nil))
+	c.Check(recorder.Code, Equals, http.StatusBadRequest)
+
+	connection.StopHeartbeat()
+}
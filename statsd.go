@@ -0,0 +1,51 @@
+package rmq
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsDSink is a MetricsSink sending metrics over UDP in the StatsD format
+// with DogStatsD tags, as understood by the Datadog agent
+type StatsDSink struct {
+	conn net.Conn
+	tags []string // added to every metric
+}
+
+// NewStatsDSink returns a sink sending to the StatsD server at address like
+// "localhost:8125", tags are added to every metric
+func NewStatsDSink(address string, tags ...string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{conn: conn, tags: tags}, nil
+}
+
+func (sink *StatsDSink) Gauge(name string, value float64, tags ...string) {
+	sink.send(name, fmt.Sprintf("%g", value), "g", tags)
+}
+
+func (sink *StatsDSink) Count(name string, delta int64, tags ...string) {
+	sink.send(name, fmt.Sprintf("%d", delta), "c", tags)
+}
+
+func (sink *StatsDSink) Timing(name string, duration time.Duration, tags ...string) {
+	sink.send(name, fmt.Sprintf("%g", duration.Seconds()*1000), "ms", tags)
+}
+
+// send writes one metric per packet, errors are ignored like StatsD does
+func (sink *StatsDSink) send(name, value, kind string, tags []string) {
+	line := name + ":" + value + "|" + kind
+	if allTags := append(append([]string(nil), sink.tags...), tags...); len(allTags) > 0 {
+		line += "|#" + strings.Join(allTags, ",")
+	}
+	sink.conn.Write([]byte(line))
+}
+
+// Close closes the UDP socket
+func (sink *StatsDSink) Close() error {
+	return sink.conn.Close()
+}
@@ -0,0 +1,58 @@
+package rmq
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	tailDuration      = 10 * time.Second // tailing key expires after this duration unless refreshed
+	tailCheckInterval = time.Second      // publishers check at most this often whether a queue is tailed
+)
+
+// Tail returns a channel receiving all payloads published to the queue with
+// the given name from now on, without consuming them. Publishers only mirror
+// their payloads while a queue is being tailed, so it can take up to a second
+// until the first payloads arrive. Call stop to stop tailing.
+func (connection *redisConnection) Tail(name string) (payloads <-chan string, stop func()) {
+	tailingKey := strings.Replace(queueTailingTemplate, phQueue, name, 1)
+	tailChannel := strings.Replace(queueTailTemplate, phQueue, name, 1)
+
+	messages, unsubscribe := connection.redisClient.Subscribe(tailChannel)
+	connection.redisClient.Set(tailingKey, "1", tailDuration)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tailDuration / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				connection.redisClient.Set(tailingKey, "1", tailDuration)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return messages, func() {
+		close(done)
+		unsubscribe()
+	}
+}
+
+// isTailed returns true if someone is currently tailing the queue, the result
+// is cached for tailCheckInterval to not add a round trip to every publish
+func (queue *redisQueue) isTailed() bool {
+	queue.tailMutex.Lock()
+	defer queue.tailMutex.Unlock()
+
+	if time.Since(queue.tailCheckedAt) < tailCheckInterval {
+		return queue.tailing
+	}
+
+	ttl, _ := queue.redisClient.TTL(queue.tailingKey)
+	queue.tailing = ttl > 0
+	queue.tailCheckedAt = time.Now()
+	return queue.tailing
+}
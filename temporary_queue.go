@@ -0,0 +1,43 @@
+package rmq
+
+import (
+	"strings"
+
+	"github.com/adjust/uniuri"
+)
+
+// OpenTemporaryQueue opens a queue with a unique name which is bound to this
+// connection, like a reply queue or a queue for work of this process only.
+// Shutdown removes it with all its deliveries and so does the cleaner once
+// the heartbeat of the connection expired. Pass its name to other processes
+// to let them publish to it.
+func (connection *redisConnection) OpenTemporaryQueue() Queue {
+	return connection.openTemporaryQueue(temporaryQueueName())
+}
+
+func (connection *redisConnection) openTemporaryQueue(name string) Queue {
+	connection.redisClient.SAdd(connection.temporaryQueuesKey(), name)
+	return connection.OpenQueue(name)
+}
+
+func temporaryQueueName() string {
+	return "tmp-" + uniuri.NewLen(12)
+}
+
+func (connection *redisConnection) temporaryQueuesKey() string {
+	return strings.Replace(connectionTemporaryQueuesTemplate, phConnection, connection.Name, 1)
+}
+
+// closeTemporaryQueues removes the temporary queues of the connection with
+// all their deliveries and returns how many were removed
+func (connection *redisConnection) closeTemporaryQueues() int {
+	key := connection.temporaryQueuesKey()
+	names := connection.redisClient.SMembers(key)
+	for _, name := range names {
+		queue := connection.openQueue(name)
+		queue.CloseInConnection()
+		queue.expire()
+	}
+	connection.redisClient.Del(key)
+	return len(names)
+}
@@ -0,0 +1,59 @@
+package rmq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestTemporaryQueueSuite(t *testing.T) {
+	TestingSuiteT(&TemporaryQueueSuite{}, t)
+}
+
+type TemporaryQueueSuite struct{}
+
+func (suite *TemporaryQueueSuite) TestCleaner(c *C) {
+	connection := OpenConnection("temporary-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenTemporaryQueue().(*redisQueue)
+	other := connection.OpenTemporaryQueue().(*redisQueue)
+	c.Check(strings.HasPrefix(queue.name, "tmp-"), Equals, true)
+	c.Check(queue.name, Not(Equals), other.name)
+	c.Check(connection.isOpenQueue(queue.name), Equals, true)
+
+	queue.Publish("temporary-d")
+	queue.Publish("temporary-d")
+	_, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+
+	// nothing happens while the connection is alive
+	cleanerConnection := OpenConnection("temporary-cleaner-conn", "tcp", "localhost:6379", 1)
+	c.Assert(NewCleaner(cleanerConnection).Clean(), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 1)
+
+	connection.StopHeartbeat()
+	c.Assert(NewCleaner(cleanerConnection).Clean(), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(connection.isOpenQueue(queue.name), Equals, false)
+	c.Check(connection.isOpenQueue(other.name), Equals, false)
+	c.Check(connection.redisClient.SMembers(connection.temporaryQueuesKey()), HasLen, 0)
+	cleanerConnection.StopHeartbeat()
+}
+
+func (suite *TemporaryQueueSuite) TestShutdown(c *C) {
+	connection := OpenConnection("temporary-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenTemporaryQueue().(*redisQueue)
+	queue.Publish("temporary-d")
+
+	c.Check(connection.Shutdown(context.Background()), IsNil)
+	c.Check(queue.ReadyCount(), Equals, 0)
+	c.Check(connection.isOpenQueue(queue.name), Equals, false)
+}
+
+func (suite *TemporaryQueueSuite) TestSharded(c *C) {
+	sharded := NewShardedConnection(NewTestConnection(), NewTestConnection())
+	queue := sharded.OpenTemporaryQueue().(*TestQueue)
+	c.Check(sharded.OpenQueue(queue.name), Equals, queue)
+}
@@ -1,7 +1,9 @@
 package rmq
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -20,6 +22,11 @@ func (connection TestConnection) OpenQueue(name string) Queue {
 	return queue.(*TestQueue)
 }
 
+// OpenTemporaryQueue opens a test queue with a unique name
+func (connection TestConnection) OpenTemporaryQueue() Queue {
+	return connection.OpenQueue(temporaryQueueName())
+}
+
 func (connection TestConnection) CollectStats(queueList []string) Stats {
 	return Stats{}
 }
@@ -52,3 +59,49 @@ func (connection TestConnection) Reset() {
 func (connection TestConnection) GetOpenQueues() []string {
 	return []string{}
 }
+
+func (connection TestConnection) GetConsumingQueues() []string {
+	return []string{}
+}
+
+func (connection TestConnection) GetConnections() []string {
+	return []string{}
+}
+
+// QueueInfos returns the opened test queues with the number of published
+// deliveries as ready count
+func (connection TestConnection) QueueInfos() []QueueInfo {
+	infos := []QueueInfo{}
+	connection.queues.Range(func(k, v interface{}) bool {
+		infos = append(infos, QueueInfo{
+			Name:       k.(string),
+			ReadyCount: len(v.(*TestQueue).LastDeliveries),
+		})
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (connection TestConnection) ConnectionInfos() []ConnectionInfo {
+	return []ConnectionInfo{}
+}
+
+func (connection TestConnection) Health(ctx context.Context) HealthReport {
+	return HealthReport{Healthy: true, RedisReachable: true, Queues: []QueueHealth{}}
+}
+
+// Queues returns the opened test queues sorted by name
+func (connection TestConnection) Queues() []Queue {
+	queues := []Queue{}
+	connection.queues.Range(func(_, v interface{}) bool {
+		queues = append(queues, v.(*TestQueue))
+		return true
+	})
+	sort.Slice(queues, func(i, j int) bool { return queues[i].(*TestQueue).name < queues[j].(*TestQueue).name })
+	return queues
+}
+
+func (connection TestConnection) Shutdown(ctx context.Context) error {
+	return nil
+}
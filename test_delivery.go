@@ -1,10 +1,19 @@
 package rmq
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type TestDelivery struct {
-	State   State
-	payload string
+	State        State
+	RejectReason string            // set by RejectWithReason
+	Headers      map[string]string // returned by Header
+	Published    time.Time         // Latency is unknown if zero
+	Queue        string            // returned by QueueName
+	Consumer     string            // returned by ConsumerName
+	Redelivered  int               // returned by RedeliveryCount
+	payload      string
 }
 
 func NewTestDelivery(content interface{}) *TestDelivery {
@@ -30,6 +39,45 @@ func (delivery *TestDelivery) Payload() string {
 	return delivery.payload
 }
 
+func (delivery *TestDelivery) PayloadBytes() []byte {
+	return []byte(delivery.payload)
+}
+
+func (delivery *TestDelivery) ContentType() string {
+	return ""
+}
+
+func (delivery *TestDelivery) Header(name string) string {
+	return delivery.Headers[name]
+}
+
+func (delivery *TestDelivery) Latency() (time.Duration, bool) {
+	if delivery.Published.IsZero() {
+		return 0, false
+	}
+	return time.Since(delivery.Published), true
+}
+
+func (delivery *TestDelivery) QueueName() string {
+	return delivery.Queue
+}
+
+func (delivery *TestDelivery) ConsumerName() string {
+	return delivery.Consumer
+}
+
+func (delivery *TestDelivery) RedeliveryCount() (int, bool) {
+	return delivery.Redelivered, true
+}
+
+func (delivery *TestDelivery) IsRedelivered() bool {
+	return delivery.Redelivered > 0
+}
+
+func (delivery *TestDelivery) Unmarshal(object interface{}) error {
+	return JSONCodec.Unmarshal([]byte(delivery.payload), object)
+}
+
 func (delivery *TestDelivery) Ack() bool {
 	if delivery.State == Unacked {
 		delivery.State = Acked
@@ -46,6 +94,14 @@ func (delivery *TestDelivery) Reject() bool {
 	return false
 }
 
+func (delivery *TestDelivery) RejectWithReason(reason string) bool {
+	if !delivery.Reject() {
+		return false
+	}
+	delivery.RejectReason = reason
+	return true
+}
+
 func (delivery *TestDelivery) Push() bool {
 	if delivery.State == Unacked {
 		delivery.State = Pushed
@@ -53,3 +109,7 @@ func (delivery *TestDelivery) Push() bool {
 	}
 	return false
 }
+
+func (delivery *TestDelivery) Touch() bool {
+	return delivery.State == Unacked
+}
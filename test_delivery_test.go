@@ -41,3 +41,23 @@ func (suite *DeliverySuite) TestDeliveryReject(c *C) {
 	c.Check(delivery.Ack(), Equals, false)
 	c.Check(delivery.State, Equals, Rejected)
 }
+
+func (suite *DeliverySuite) TestDeliveries(c *C) {
+	deliveries := Deliveries{}
+	for _, payload := range []string{"a", "b", "c", "d", "e"} {
+		deliveries = append(deliveries, NewTestDelivery(payload))
+	}
+	c.Check(deliveries.Payloads(), DeepEquals, []string{"a", "b", "c", "d", "e"})
+
+	chunks := deliveries.Split(2)
+	c.Assert(chunks, HasLen, 3)
+	c.Check(chunks[0].Payloads(), DeepEquals, []string{"a", "b"})
+	c.Check(chunks[2].Payloads(), DeepEquals, []string{"e"})
+	c.Check(Deliveries{}.Split(2), HasLen, 0)
+
+	c.Check(chunks[0].Ack(), Equals, 0)
+	c.Check(chunks[1].Push(), Equals, 0)
+	c.Check(chunks[2].Reject(), Equals, 0)
+	c.Check(deliveries.Push(), Equals, 5) // all settled already
+	c.Check(deliveries[2].(*TestDelivery).State, Equals, Pushed)
+}
@@ -1,10 +1,18 @@
 package rmq
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"github.com/adjust/uniuri"
+)
 
 type TestQueue struct {
 	name           string
 	LastDeliveries []string
+	LastHeaders    []map[string]string // of deliveries published with headers
+	IsPaused       bool
+	staged         map[string][]string // payloads prepared by PreparePublish by ID
 }
 
 func NewTestQueue(name string) *TestQueue {
@@ -22,41 +30,330 @@ func (queue *TestQueue) Publish(payload string) bool {
 	return true
 }
 
+func (queue *TestQueue) PublishWithHeaders(payload string, headers map[string]string) bool {
+	queue.LastHeaders = append(queue.LastHeaders, headers)
+	return queue.Publish(payload)
+}
+
+func (queue *TestQueue) PublishWithTTL(payload string, ttl time.Duration) bool {
+	return queue.Publish(payload)
+}
+
+func (queue *TestQueue) PreparePublish(payloads ...string) (id string, ok bool) {
+	if queue.staged == nil {
+		queue.staged = map[string][]string{}
+	}
+	id = uniuri.NewLen(20)
+	queue.staged[id] = payloads
+	return id, true
+}
+
+// CommitPublish adds the prepared payloads to LastDeliveries
+func (queue *TestQueue) CommitPublish(id string) int {
+	payloads := queue.staged[id]
+	delete(queue.staged, id)
+	queue.LastDeliveries = append(queue.LastDeliveries, payloads...)
+	return len(payloads)
+}
+
+func (queue *TestQueue) DiscardPublish(id string) bool {
+	_, ok := queue.staged[id]
+	delete(queue.staged, id)
+	return ok
+}
+
+func (queue *TestQueue) PublishObject(object interface{}) bool {
+	return queue.PublishObjectWith(JSONCodec, object)
+}
+
+func (queue *TestQueue) PublishObjectWith(codec Codec, object interface{}) bool {
+	payload, err := codec.Marshal(object)
+	if err != nil {
+		return false
+	}
+	return queue.Publish(string(payload))
+}
+
+func (queue *TestQueue) SetCodec(codec Codec) {
+}
+
 func (queue *TestQueue) PublishBytes(payload []byte) bool {
 	return queue.Publish(string(payload))
 }
 
+func (queue *TestQueue) SetDebug(enabled bool) {
+}
+
 func (queue *TestQueue) SetPushQueue(pushQueue Queue) {
 }
 
-func (queue *TestQueue) StartConsuming(prefetchLimit int, pollDuration time.Duration) bool {
+func (queue *TestQueue) SetMaxHops(maxHops int) {
+}
+
+func (queue *TestQueue) SetAutoAck(enabled bool) {
+}
+
+func (queue *TestQueue) SetCompression(compression Compression, threshold int) {
+}
+
+func (queue *TestQueue) SetBlobStore(store BlobStore, threshold int) {
+}
+
+func (queue *TestQueue) SetEncryption(keys KeyProvider) {
+}
+
+func (queue *TestQueue) SetSigningKey(key []byte) {
+}
+
+func (queue *TestQueue) SetEnvelope(enabled bool) {
+}
+
+func (queue *TestQueue) SetPublishBufferSize(size int, policy OverflowPolicy) {
+}
+
+func (queue *TestQueue) SetPublishLinger(linger time.Duration) {
+}
+
+func (queue *TestQueue) SetPackSize(size int) {
+}
+
+func (queue *TestQueue) SetValidator(validator Validator) {
+}
+
+func (queue *TestQueue) SetIdleExpiration(expiration time.Duration) {
+}
+
+func (queue *TestQueue) SetMessageTTL(ttl time.Duration) {
+}
+
+func (queue *TestQueue) SetExpiredTrimInterval(interval time.Duration) {
+}
+
+func (queue *TestQueue) TrimExpired() int {
+	return 0
+}
+
+func (queue *TestQueue) SetCloseArchive(retention time.Duration) {
+}
+
+func (queue *TestQueue) Archives() []string {
+	return nil
+}
+
+func (queue *TestQueue) RestoreArchive(archive string) int {
+	return 0
+}
+
+func (queue *TestQueue) SetPublishJournal(path string) error {
+	return nil
+}
+
+func (queue *TestQueue) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (queue *TestQueue) PublishBufferStats() PublishBufferStats {
+	return PublishBufferStats{}
+}
+
+func (queue *TestQueue) OldestReadyAge() (time.Duration, bool) {
+	return 0, true
+}
+
+func (queue *TestQueue) SetPrefetchLimit(prefetchLimit int) bool {
+	return true
+}
+
+func (queue *TestQueue) SetReadyCountCheck(enabled bool) {
+}
+
+func (queue *TestQueue) SetVisibilityTimeout(timeout time.Duration) {
+}
+
+func (queue *TestQueue) SetProcessingTimeout(timeout time.Duration, action TimeoutAction) {
+}
+
+func (queue *TestQueue) SetPoisonQuarantine(attempts int) {
+}
+
+func (queue *TestQueue) SetUnackedLimit(limit int) {
+}
+
+func (queue *TestQueue) SetPollBackoff(maxPollDuration time.Duration) {
+}
+
+func (queue *TestQueue) SetGlobalConcurrency(limit int) {
+}
+
+func (queue *TestQueue) SetSingleActiveConsumer(lease time.Duration) {
+}
+
+func (queue *TestQueue) ActiveConsumer() bool {
+	return true
+}
+
+func (queue *TestQueue) SetFairDispatch(enabled bool) {
+}
+
+func (queue *TestQueue) EnablePrefetchAutoTune(minLimit, maxLimit int) bool {
 	return true
 }
 
+func (queue *TestQueue) EnableNotifications() bool {
+	return false
+}
+
+func (queue *TestQueue) StartConsuming(prefetchLimit int, pollDuration time.Duration) error {
+	return nil
+}
+
 func (queue *TestQueue) StopConsuming() bool {
 	return true
 }
 
-func (queue *TestQueue) AddConsumer(tag string, consumer Consumer) string {
-	return ""
+func (queue *TestQueue) Pause() bool {
+	queue.IsPaused = true
+	return true
+}
+
+func (queue *TestQueue) Resume() bool {
+	queue.IsPaused = false
+	return true
+}
+
+func (queue *TestQueue) Paused() bool {
+	return queue.IsPaused
+}
+
+func (queue *TestQueue) Get(ctx context.Context) (Delivery, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (queue *TestQueue) GetBatch(ctx context.Context, count int) (Deliveries, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
 }
 
-func (queue *TestQueue) AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) string {
-	return ""
+func (queue *TestQueue) Deliveries() (<-chan Delivery, error) {
+	return nil, nil
 }
 
-func (queue *TestQueue) AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) string {
-	return ""
+func (queue *TestQueue) AddConsumer(tag string, consumer Consumer) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddConsumerFunc(tag string, consumerFunc func(delivery Delivery)) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddConsumerWithName(name string, consumer Consumer) error {
+	return nil
+}
+
+func (queue *TestQueue) AddConsumerWithLimit(tag string, limit int, consumer Consumer) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddBatchConsumerFunc(tag string, batchSize int, consumerFunc func(batch Deliveries)) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddBatchConsumer(tag string, batchSize int, consumer BatchConsumer) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddBatchConsumerWithTimeout(tag string, batchSize int, timeout time.Duration, consumer BatchConsumer) (string, error) {
+	return "", nil
+}
+
+func (queue *TestQueue) AddBatchConsumerWithOptions(tag string, options BatchOptions, consumer BatchConsumer) (string, error) {
+	return "", nil
 }
 
 func (queue *TestQueue) ReturnRejected(count int) int {
 	return 0
 }
 
+func (queue *TestQueue) ReturnRejectedWith(count int, transform func(payload string) (transformed string, keep bool)) int {
+	return 0
+}
+
+func (queue *TestQueue) ReturnRejectedWhere(predicate func(payload string) bool, limit int) int {
+	return 0
+}
+
 func (queue *TestQueue) ReturnAllRejected() int {
 	return 0
 }
 
+func (queue *TestQueue) DeleteReady(id string) bool {
+	return false
+}
+
+func (queue *TestQueue) DeleteRejected(id string) bool {
+	return false
+}
+
+func (queue *TestQueue) MoveReady(id string, destination Queue) bool {
+	return false
+}
+
+func (queue *TestQueue) MoveTo(destination Queue, count int) int {
+	return 0
+}
+
+func (queue *TestQueue) MoveRejected(id string, destination Queue) bool {
+	return false
+}
+
+func (queue *TestQueue) PeekReady(count int) []string {
+	return []string{}
+}
+
+func (queue *TestQueue) PeekRejected(count int) []string {
+	return []string{}
+}
+
+func (queue *TestQueue) SearchReady(query SearchQuery) SearchResult {
+	return SearchResult{Matches: []SearchMatch{}, Next: -1}
+}
+
+func (queue *TestQueue) SearchRejected(query SearchQuery) SearchResult {
+	return SearchResult{Matches: []SearchMatch{}, Next: -1}
+}
+
+func (queue *TestQueue) RejectionReason(payload string) (RejectionReason, bool) {
+	return RejectionReason{}, false
+}
+
+func (queue *TestQueue) PoisonCount() int {
+	return 0
+}
+
+func (queue *TestQueue) PeekPoison(count int) []string {
+	return []string{}
+}
+
+func (queue *TestQueue) PoisonReport(payload string) (PoisonReport, bool) {
+	return PoisonReport{}, false
+}
+
+func (queue *TestQueue) ReturnPoison(count int) int {
+	return 0
+}
+
+func (queue *TestQueue) PurgePoison() int {
+	return 0
+}
+
+func (queue *TestQueue) SetRejectedRetention(retention RejectedRetention) {
+}
+
+func (queue *TestQueue) TrimRejected() int {
+	return 0
+}
+
 func (queue *TestQueue) PurgeReady() int {
 	return 0
 }
@@ -71,4 +368,6 @@ func (queue *TestQueue) Close() bool {
 
 func (queue *TestQueue) Reset() {
 	queue.LastDeliveries = []string{}
+	queue.LastHeaders = nil
+	queue.staged = nil
 }
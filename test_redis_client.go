@@ -2,6 +2,7 @@ package rmq
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -9,8 +10,10 @@ import (
 
 //TestRedisClient is a mock for redis
 type TestRedisClient struct {
-	store sync.Map
-	ttl   sync.Map
+	store       sync.Map
+	ttl         sync.Map
+	subscribers map[string][]chan string
+	pushWatches map[string][]chan struct{}
 }
 
 var lock sync.Mutex
@@ -41,6 +44,49 @@ func (client *TestRedisClient) Set(key string, value string, expiration time.Dur
 	return true
 }
 
+// SetXX is like Set, but only sets key if it already exists.
+func (client *TestRedisClient) SetXX(key string, value string, expiration time.Duration) (updated bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if deadline, found := client.ttl.Load(key); found && deadline.(int64) < time.Now().Unix() {
+		client.store.Delete(key)
+		client.ttl.Delete(key)
+	}
+	if _, found := client.store.Load(key); !found {
+		return false, true
+	}
+
+	client.store.Store(key, value)
+	client.ttl.Delete(key)
+	if expiration.Seconds() != 0.0 {
+		client.ttl.Store(key, time.Now().Add(expiration).Unix())
+	}
+	return true, true
+}
+
+// SetNX is like Set, but only sets key if it doesn't exist yet.
+func (client *TestRedisClient) SetNX(key string, value string, expiration time.Duration) (set bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if deadline, found := client.ttl.Load(key); found && deadline.(int64) < time.Now().Unix() {
+		client.store.Delete(key)
+		client.ttl.Delete(key)
+	}
+	if _, found := client.store.Load(key); found {
+		return false, true
+	}
+
+	client.store.Store(key, value)
+	if expiration.Seconds() != 0.0 {
+		client.ttl.Store(key, time.Now().Add(expiration).Unix())
+	}
+	return true, true
+}
+
 // Get the value of key.
 // If the key does not exist or isn't a string
 // the special value nil is returned.
@@ -57,6 +103,49 @@ func (client *TestRedisClient) Get(key string) string {
 	return "nil"
 }
 
+// SetLease sets key to holder with the given expiration if the key is unset,
+// expired or already set to holder.
+func (client *TestRedisClient) SetLease(key, holder string, lease time.Duration) bool {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !client.holdsLease(key, holder) {
+		return false
+	}
+
+	client.store.Store(key, holder)
+	client.ttl.Store(key, time.Now().Add(lease).Unix())
+	return true
+}
+
+// DelLease deletes key if it is set to holder.
+func (client *TestRedisClient) DelLease(key, holder string) bool {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if value, found := client.store.Load(key); !found || value != holder {
+		return false
+	}
+
+	client.store.Delete(key)
+	client.ttl.Delete(key)
+	return true
+}
+
+// holdsLease removes key if it expired and returns whether it's unset or
+// set to holder.
+func (client *TestRedisClient) holdsLease(key, holder string) bool {
+	if expiration, found := client.ttl.Load(key); found && expiration.(int64) < time.Now().Unix() {
+		client.store.Delete(key)
+		client.ttl.Delete(key)
+	}
+
+	value, found := client.store.Load(key)
+	return !found || value == holder
+}
+
 //Del removes the specified key. A key is ignored if it does not exist.
 func (client *TestRedisClient) Del(key string) (affected int, ok bool) {
 
@@ -71,6 +160,40 @@ func (client *TestRedisClient) Del(key string) (affected int, ok bool) {
 
 }
 
+// RenameNX renames key to newKey if key exists and newKey doesn't.
+func (client *TestRedisClient) RenameNX(key, newKey string) (renamed bool, ok bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	value, found := client.store.Load(key)
+	if !found {
+		return false, true
+	}
+	if _, found := client.store.Load(newKey); found {
+		return false, true
+	}
+
+	client.store.Store(newKey, value)
+	client.store.Delete(key)
+	if expiration, found := client.ttl.Load(key); found {
+		client.ttl.Store(newKey, expiration)
+		client.ttl.Delete(key)
+	}
+	return true, true
+}
+
+// Expire sets a timeout on key if it exists.
+func (client *TestRedisClient) Expire(key string, expiration time.Duration) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, found := client.store.Load(key); !found {
+		return false
+	}
+	client.ttl.Store(key, time.Now().Add(expiration).Unix())
+	return true
+}
+
 // TTL returns the remaining time to live of a key that has a timeout.
 // This introspection capability allows a Redis client to check how many seconds a given key will continue to be part of the dataset.
 // In Redis 2.6 or older the command returns -1 if the key does not exist or if the key exist but has no associated expire.
@@ -126,6 +249,47 @@ func (client *TestRedisClient) LPush(key, value string) bool {
 	}
 
 	client.storeList(key, append([]string{value}, list...))
+	client.notifyPush(key)
+	return true
+}
+
+// LPushBatch inserts all the specified values at the head of the list stored at key,
+// one after the other, so the last value ends up first.
+func (client *TestRedisClient) LPushBatch(key string, values []string) bool {
+	for _, value := range values {
+		if !client.LPush(key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// LPushMulti inserts the values of each key like LPushBatch. It pushes
+// nothing if one of the keys holds a value that is not a list.
+func (client *TestRedisClient) LPushMulti(values map[string][]string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	lists := map[string][]string{}
+	for key := range values {
+		list, err := client.findList(key)
+		if err != nil {
+			return false
+		}
+		lists[key] = list
+	}
+
+	for key, keyValues := range values {
+		if len(keyValues) == 0 {
+			continue
+		}
+		list := lists[key]
+		for _, value := range keyValues {
+			list = append([]string{value}, list...)
+		}
+		client.storeList(key, list)
+		client.notifyPush(key)
+	}
 	return true
 }
 
@@ -275,6 +439,7 @@ func (client *TestRedisClient) RPopLPush(source, destination string) (value stri
 		client.storeList(source, sourceList[0:len(sourceList)-1])
 		//Put the last element of source (tail) and prepend it to dest
 		client.storeList(destination, append([]string{sourceList[len(sourceList)-1]}, destList...))
+		client.notifyPush(destination)
 
 		return sourceList[len(sourceList)-1], true
 	}
@@ -282,6 +447,134 @@ func (client *TestRedisClient) RPopLPush(source, destination string) (value stri
 	return "", false
 }
 
+// RPopLPushReplace is like RPopLPush, but only pops the last element of source
+// if it's value and prepends replacement to destination instead.
+func (client *TestRedisClient) RPopLPushReplace(source, destination, value, replacement string) (moved bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	sourceList, sourceErr := client.findList(source)
+	destList, destErr := client.findList(destination)
+	if sourceErr != nil || destErr != nil {
+		return false, false
+	}
+	if len(sourceList) == 0 || sourceList[len(sourceList)-1] != value {
+		return false, true
+	}
+
+	client.storeList(source, sourceList[0:len(sourceList)-1])
+	client.storeList(destination, append([]string{replacement}, destList...))
+	client.notifyPush(destination)
+	return true, true
+}
+
+// LRemLPush removes the first occurrence of value from source and pushes
+// replacement to destination if it did.
+func (client *TestRedisClient) LRemLPush(source, destination, value, replacement string) (moved bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	sourceList, sourceErr := client.findList(source)
+	destList, destErr := client.findList(destination)
+	if sourceErr != nil || destErr != nil {
+		return false, false
+	}
+	for index := 0; index < len(sourceList); index++ {
+		if sourceList[index] != value {
+			continue
+		}
+		client.storeList(source, append(append([]string{}, sourceList[:index]...), sourceList[index+1:]...))
+		if source == destination {
+			destList, _ = client.findList(destination)
+		}
+		client.storeList(destination, append([]string{replacement}, destList...))
+		client.notifyPush(destination)
+		return true, true
+	}
+	return false, true
+}
+
+// RPopLPushBatch calls RPopLPush up to count times and returns the moved elements.
+// It stops early if source gets empty.
+func (client *TestRedisClient) RPopLPushBatch(source, destination string, count int) (values []string) {
+	values = []string{}
+	for i := 0; i < count; i++ {
+		value, ok := client.RPopLPush(source, destination)
+		if !ok {
+			break
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// RPopBatch removes and returns up to count elements from the tail of the
+// list stored at key, the last element first.
+func (client *TestRedisClient) RPopBatch(key string, count int) (values []string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	values = []string{}
+	list, err := client.findList(key)
+	if err != nil {
+		return values
+	}
+	for len(list) > 0 && len(values) < count {
+		values = append(values, list[len(list)-1])
+		list = list[:len(list)-1]
+	}
+	if len(values) > 0 {
+		client.storeList(key, list)
+	}
+	return values
+}
+
+// SettleBatch removes each value from source and pushes it to its
+// destination unless that's empty.
+func (client *TestRedisClient) SettleBatch(source string, values, destinations []string) (settled []bool) {
+	settled = make([]bool, len(values))
+	for i, value := range values {
+		if count, _ := client.LRem(source, 1, value); count != 1 {
+			continue
+		}
+		settled[i] = true
+		if destinations[i] != "" {
+			client.LPush(destinations[i], value)
+		}
+	}
+	return settled
+}
+
+// SettlePart pushes value to destination unless it's empty if pack is in
+// unacked and removes pack from unacked if last is set.
+func (client *TestRedisClient) SettlePart(unacked, pack, destination, value string, last bool) (settled bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	list, err := client.findList(unacked)
+	if err != nil {
+		return false, false
+	}
+	for index := 0; index < len(list); index++ {
+		if list[index] != pack {
+			continue
+		}
+		if last {
+			client.storeList(unacked, append(append([]string{}, list[:index]...), list[index+1:]...))
+		}
+		if destination != "" {
+			destList, _ := client.findList(destination)
+			client.storeList(destination, append([]string{value}, destList...))
+			client.notifyPush(destination)
+		}
+		return true, true
+	}
+	return false, true
+}
+
 // LRange returns the specified elements of the list stored at key.
 // The offsets start and stop are zero-based indexes, with 0 being
 // the first element of the list (the head of the list), 1 being
@@ -289,26 +582,32 @@ func (client *TestRedisClient) RPopLPush(source, destination string) (value stri
 // These offsets can also be negative numbers indicating offsets
 // starting at the end of the list. For example, -1 is the last
 // element of the list, -2 the penultimate, and so on.
-func (client *TestRedisClient) LRange(key string, start, end int) []string {
+// Out of range indexes will not produce an error, they are clamped
+// to the list boundaries.
+func (client *TestRedisClient) LRange(key string, start, stop int) []string {
 
 	list, err := client.findList(key)
-	if list == nil || err != nil || len(list) == 0 || end < 0 {
+	if err != nil || len(list) == 0 {
 		return []string{}
 	}
 
-	if start >= 0 {
-		if end >= len(list) {
-			end = len(list)
-		}
-		return list[start:end]
+	if start < 0 {
+		start += len(list)
 	}
-
-	if end > -start {
-		return list[len(list)+start:]
+	if stop < 0 {
+		stop += len(list)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(list) {
+		stop = len(list) - 1
+	}
+	if start > stop {
+		return []string{}
 	}
 
-	return list[len(list)+start : len(list)+start+end]
-
+	return append([]string{}, list[start:stop+1]...)
 }
 
 // SAdd adds the specified members to the set stored at key.
@@ -330,6 +629,49 @@ func (client *TestRedisClient) SAdd(key, value string) bool {
 	return true
 }
 
+// SAddIfMissing is like SAdd, but reports whether value wasn't a member yet
+func (client *TestRedisClient) SAddIfMissing(key, value string) (added bool, ok bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := client.findSet(key)
+	if err != nil {
+		return false, false
+	}
+
+	if _, ok := set[value]; ok {
+		return false, true
+	}
+	set[value] = struct{}{}
+	client.storeSet(key, set)
+	return true, true
+}
+
+// SAddLPush pushes value to the list at key if member isn't in the set at
+// set and adds it, both at once.
+func (client *TestRedisClient) SAddLPush(set, member, key, value string) (pushed bool, ok bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	members, err := client.findSet(set)
+	if err != nil {
+		return false, false
+	}
+	list, err := client.findList(key)
+	if err != nil {
+		return false, false
+	}
+	if _, found := members[member]; found {
+		return false, true
+	}
+
+	members[member] = struct{}{}
+	client.storeSet(set, members)
+	client.storeList(key, append([]string{value}, list...))
+	client.notifyPush(key)
+	return true, true
+}
+
 // SMembers returns all the members of the set value stored at key.
 // This has the same effect as running SINTER with one argument key.
 func (client *TestRedisClient) SMembers(key string) (members []string) {
@@ -368,12 +710,274 @@ func (client *TestRedisClient) SRem(key, value string) (affected int, ok bool) {
 	return 0, true
 }
 
+// HSet sets field in the hash stored at key to value.
+// If key does not exist, a new key holding a hash is created.
+// If field already exists in the hash, it is overwritten.
+func (client *TestRedisClient) HSet(key, field, value string) bool {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return false
+	}
+
+	hash[field] = value
+	client.storeHash(key, hash)
+	return true
+}
+
+// HSetXX sets field in the hash stored at key to value if the field exists.
+func (client *TestRedisClient) HSetXX(key, field, value string) (updated bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return false, false
+	}
+	if _, found := hash[field]; !found {
+		return false, true
+	}
+
+	hash[field] = value
+	client.storeHash(key, hash)
+	return true, true
+}
+
+// HGet returns the value associated with field in the hash stored at key.
+func (client *TestRedisClient) HGet(key, field string) (value string, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return "", false
+	}
+
+	value, ok = hash[field]
+	return value, ok
+}
+
+// HGetAll returns all fields and values of the hash stored at key.
+func (client *TestRedisClient) HGetAll(key string) map[string]string {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	fields := map[string]string{}
+	hash, err := client.findHash(key)
+	if err != nil {
+		return fields
+	}
+
+	for field, value := range hash {
+		fields[field] = value
+	}
+	return fields
+}
+
+// HDel removes the specified field from the hash stored at key.
+// Specified fields that do not exist within this hash are ignored.
+// If key does not exist, it is treated as an empty hash and this command returns 0.
+func (client *TestRedisClient) HDel(key, field string) (affected int, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return 0, false
+	}
+
+	if _, found := hash[field]; !found {
+		return 0, true
+	}
+
+	delete(hash, field)
+	client.storeHash(key, hash)
+	return 1, true
+}
+
+// HIncrBy increments the number stored at field in the hash stored at key by increment.
+// If key does not exist, a new key holding a hash is created.
+// If field does not exist the value is set to 0 before the operation is performed.
+func (client *TestRedisClient) HIncrBy(key, field string, increment int) (value int, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return 0, false
+	}
+
+	if current, found := hash[field]; found {
+		if value, err = strconv.Atoi(current); err != nil {
+			return 0, false
+		}
+	}
+
+	value += increment
+	hash[field] = strconv.Itoa(value)
+	client.storeHash(key, hash)
+	return value, true
+}
+
+// HIncrByLimit increments the number stored at field in the hash stored at key
+// by increment if the sum of all numbers in the hash stays within limit.
+func (client *TestRedisClient) HIncrByLimit(key, field string, increment, limit int) (incremented bool, ok bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	hash, err := client.findHash(key)
+	if err != nil {
+		return false, false
+	}
+
+	sum := 0
+	for _, current := range hash {
+		value, err := strconv.Atoi(current)
+		if err != nil {
+			return false, false
+		}
+		sum += value
+	}
+	if sum+increment > limit {
+		return false, true
+	}
+
+	value, _ := strconv.Atoi(hash[field])
+	hash[field] = strconv.Itoa(value + increment)
+	client.storeHash(key, hash)
+	return true, true
+}
+
+// Publish posts a message to the given channel.
+// Subscribers which aren't ready to receive the message miss it.
+func (client *TestRedisClient) Publish(channel, message string) bool {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, subscriber := range client.subscribers[channel] {
+		select {
+		case subscriber <- message:
+		default:
+		}
+	}
+
+	return true
+}
+
+// Subscribe subscribes the client to the specified channel.
+// Messages are received on the returned channel until unsubscribe is called.
+func (client *TestRedisClient) Subscribe(channel string) (<-chan string, func()) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if client.subscribers == nil {
+		client.subscribers = map[string][]chan string{}
+	}
+
+	messages := make(chan string, 100)
+	client.subscribers[channel] = append(client.subscribers[channel], messages)
+
+	unsubscribe := func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		subscribers := client.subscribers[channel]
+		for i, subscriber := range subscribers {
+			if subscriber == messages {
+				client.subscribers[channel] = append(subscribers[:i], subscribers[i+1:]...)
+				close(messages)
+				return
+			}
+		}
+	}
+
+	return messages, unsubscribe
+}
+
+// NotifyPush signals pushes to the list at key, like keyspace notifications
+// would on a real Redis. Notifications are coalesced.
+func (client *TestRedisClient) NotifyPush(key string) (<-chan struct{}, func(), bool) {
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if client.pushWatches == nil {
+		client.pushWatches = map[string][]chan struct{}{}
+	}
+
+	notifications := make(chan struct{}, 1)
+	client.pushWatches[key] = append(client.pushWatches[key], notifications)
+
+	stop := func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		watches := client.pushWatches[key]
+		for i, watch := range watches {
+			if watch == notifications {
+				client.pushWatches[key] = append(watches[:i], watches[i+1:]...)
+				return
+			}
+		}
+	}
+
+	return notifications, stop, true
+}
+
+//notifyPush signals a push to key to all watches, must be called with lock held
+func (client *TestRedisClient) notifyPush(key string) {
+	for _, watch := range client.pushWatches[key] {
+		select {
+		case watch <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // FlushDb delete all the keys of the currently selected DB. This command never fails.
 func (client *TestRedisClient) FlushDb() {
 	client.store = *new(sync.Map)
 	client.ttl = *new(sync.Map)
 }
 
+// LastError returns nil, the test client doesn't fail
+func (client *TestRedisClient) LastError() error {
+	return nil
+}
+
+//storeHash stores a hash
+func (client *TestRedisClient) storeHash(key string, hash map[string]string) {
+	client.store.Store(key, hash)
+}
+
+//findHash finds a hash
+func (client *TestRedisClient) findHash(key string) (map[string]string, error) {
+	storedValue, found := client.store.Load(key)
+	if found {
+		hash, casted := storedValue.(map[string]string)
+
+		if casted {
+			return hash, nil
+		}
+
+		return nil, errors.New("Stored value wasn't a hash")
+	}
+
+	//return an empty hash if not found
+	return make(map[string]string), nil
+}
+
 //storeSet stores a set
 func (client *TestRedisClient) storeSet(key string, set map[string]struct{}) {
 	client.store.Store(key, set)
@@ -153,3 +153,179 @@ func TestTestRedisClient_LPush(t *testing.T) {
 		})
 	}
 }
+
+func TestTestRedisClient_SetLease(t *testing.T) {
+	client := NewTestRedisClient()
+
+	if !client.SetLease("lease", "a", time.Minute) {
+		t.Errorf("TestRedisClient.SetLease(a) = false, want true")
+	}
+	if !client.SetLease("lease", "a", time.Minute) {
+		t.Errorf("TestRedisClient.SetLease(a) renewal = false, want true")
+	}
+	if client.SetLease("lease", "b", time.Minute) {
+		t.Errorf("TestRedisClient.SetLease(b) = true, want false")
+	}
+	if client.DelLease("lease", "b") {
+		t.Errorf("TestRedisClient.DelLease(b) = true, want false")
+	}
+	if !client.DelLease("lease", "a") {
+		t.Errorf("TestRedisClient.DelLease(a) = false, want true")
+	}
+	if !client.SetLease("lease", "b", time.Minute) {
+		t.Errorf("TestRedisClient.SetLease(b) after release = false, want true")
+	}
+}
+
+func TestTestRedisClient_SettleBatch(t *testing.T) {
+	client := NewTestRedisClient()
+	client.LPush("unacked", "a")
+	client.LPush("unacked", "b")
+
+	got := client.SettleBatch("unacked", []string{"a", "b", "c"}, []string{"", "rejected", "rejected"})
+	if len(got) != 3 || !got[0] || !got[1] || got[2] {
+		t.Errorf("TestRedisClient.SettleBatch() = %v, want [true true false]", got)
+	}
+	if got := client.LRange("rejected", 0, -1); len(got) != 1 || got[0] != "b" {
+		t.Errorf("TestRedisClient.LRange() = %v, want [b]", got)
+	}
+}
+
+func TestTestRedisClient_RPopLPushBatch(t *testing.T) {
+	client := NewTestRedisClient()
+	client.LPush("source", "a")
+	client.LPush("source", "b")
+	client.LPush("source", "c")
+
+	if got := client.RPopLPushBatch("source", "destination", 2); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("TestRedisClient.RPopLPushBatch() = %v, want [a b]", got)
+	}
+
+	if got := client.RPopLPushBatch("source", "destination", 2); len(got) != 1 || got[0] != "c" {
+		t.Errorf("TestRedisClient.RPopLPushBatch() = %v, want [c]", got)
+	}
+
+	if got := client.LRange("destination", 0, -1); len(got) != 3 || got[0] != "c" || got[2] != "a" {
+		t.Errorf("TestRedisClient.LRange() = %v, want [c b a]", got)
+	}
+}
+
+func TestTestRedisClient_RenameNX(t *testing.T) {
+	client := NewTestRedisClient()
+	client.LPush("source", "a")
+	client.LPush("taken", "b")
+
+	if renamed, ok := client.RenameNX("missing", "destination"); renamed || !ok {
+		t.Errorf("TestRedisClient.RenameNX(missing) = %v, %v want false, true", renamed, ok)
+	}
+	if renamed, ok := client.RenameNX("source", "taken"); renamed || !ok {
+		t.Errorf("TestRedisClient.RenameNX(taken) = %v, %v want false, true", renamed, ok)
+	}
+	if renamed, ok := client.RenameNX("source", "destination"); !renamed || !ok {
+		t.Errorf("TestRedisClient.RenameNX() = %v, %v want true, true", renamed, ok)
+	}
+	if got := client.LRange("destination", 0, -1); len(got) != 1 || got[0] != "a" {
+		t.Errorf("TestRedisClient.LRange() = %v, want [a]", got)
+	}
+	if got, _ := client.LLen("source"); got != 0 {
+		t.Errorf("TestRedisClient.LLen(source) = %v, want 0", got)
+	}
+}
+
+func TestTestRedisClient_Expire(t *testing.T) {
+	client := NewTestRedisClient()
+	client.LPush("list", "a")
+
+	if got := client.Expire("missing", time.Minute); got {
+		t.Errorf("TestRedisClient.Expire(missing) = %v, want false", got)
+	}
+	if got := client.Expire("list", time.Minute); !got {
+		t.Errorf("TestRedisClient.Expire() = %v, want true", got)
+	}
+	if ttl, ok := client.TTL("list"); !ok || ttl <= 0 {
+		t.Errorf("TestRedisClient.TTL() = %v, %v want > 0, true", ttl, ok)
+	}
+}
+
+func TestTestRedisClient_RPopBatch(t *testing.T) {
+	client := NewTestRedisClient()
+	client.LPush("list", "a")
+	client.LPush("list", "b")
+	client.LPush("list", "c")
+
+	if got := client.RPopBatch("list", 2); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("TestRedisClient.RPopBatch() = %v, want [a b]", got)
+	}
+	if got := client.RPopBatch("list", 2); len(got) != 1 || got[0] != "c" {
+		t.Errorf("TestRedisClient.RPopBatch() = %v, want [c]", got)
+	}
+	if got := client.RPopBatch("list", 2); len(got) != 0 {
+		t.Errorf("TestRedisClient.RPopBatch() = %v, want []", got)
+	}
+}
+
+func TestTestRedisClient_SAddLPush(t *testing.T) {
+	client := NewTestRedisClient()
+
+	if pushed, ok := client.SAddLPush("set", "a", "list", "1"); !pushed || !ok {
+		t.Errorf("TestRedisClient.SAddLPush() = %v, %v want true, true", pushed, ok)
+	}
+	if pushed, ok := client.SAddLPush("set", "a", "list", "2"); pushed || !ok {
+		t.Errorf("TestRedisClient.SAddLPush(again) = %v, %v want false, true", pushed, ok)
+	}
+	if got := client.LRange("list", 0, -1); len(got) != 1 || got[0] != "1" {
+		t.Errorf("TestRedisClient.LRange() = %v, want [1]", got)
+	}
+}
+
+func TestTestRedisClient_LPushMulti(t *testing.T) {
+	client := NewTestRedisClient()
+
+	if !client.LPushMulti(map[string][]string{"a": {"1", "2"}, "b": {"3"}}) {
+		t.Error("TestRedisClient.LPushMulti() = false, want true")
+	}
+	if got := client.LRange("a", 0, -1); len(got) != 2 || got[0] != "2" || got[1] != "1" {
+		t.Errorf("TestRedisClient.LRange(a) = %v, want [2 1]", got)
+	}
+	if got := client.LRange("b", 0, -1); len(got) != 1 || got[0] != "3" {
+		t.Errorf("TestRedisClient.LRange(b) = %v, want [3]", got)
+	}
+
+	client.SAdd("set", "x")
+	if client.LPushMulti(map[string][]string{"a": {"4"}, "set": {"5"}}) {
+		t.Error("TestRedisClient.LPushMulti(set) = true, want false")
+	}
+	if got, _ := client.LLen("a"); got != 2 {
+		t.Errorf("TestRedisClient.LLen(a) = %d, want 2", got)
+	}
+}
+
+func TestTestRedisClient_SetXX(t *testing.T) {
+	client := NewTestRedisClient()
+
+	if updated, ok := client.SetXX("key", "1", time.Minute); updated || !ok {
+		t.Errorf("TestRedisClient.SetXX(missing) = %v, %v want false, true", updated, ok)
+	}
+	client.Set("key", "1", time.Minute)
+	if updated, ok := client.SetXX("key", "2", time.Minute); !updated || !ok {
+		t.Errorf("TestRedisClient.SetXX() = %v, %v want true, true", updated, ok)
+	}
+	if got := client.Get("key"); got != "2" {
+		t.Errorf("TestRedisClient.Get() = %s, want 2", got)
+	}
+}
+
+func TestTestRedisClient_HIncrByLimit(t *testing.T) {
+	client := NewTestRedisClient()
+
+	client.HIncrBy("hash", "a", 1)
+	if incremented, ok := client.HIncrByLimit("hash", "b", 2, 2); incremented || !ok {
+		t.Errorf("TestRedisClient.HIncrByLimit(over) = %v, %v want false, true", incremented, ok)
+	}
+	if incremented, ok := client.HIncrByLimit("hash", "b", 1, 2); !incremented || !ok {
+		t.Errorf("TestRedisClient.HIncrByLimit() = %v, %v want true, true", incremented, ok)
+	}
+	if got, _ := client.HGet("hash", "b"); got != "1" {
+		t.Errorf("TestRedisClient.HGet(b) = %s, want 1", got)
+	}
+}
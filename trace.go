@@ -0,0 +1,59 @@
+package rmq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// TraceParentHeader is the header carrying the W3C trace context of a
+// delivery, see PublishWithHeaders and Delivery.Header
+const TraceParentHeader = "traceparent"
+
+// NewTraceParent returns a W3C traceparent starting a new sampled trace
+func NewTraceParent() string {
+	return "00-" + randomHex(16) + "-" + randomHex(8) + "-01"
+}
+
+// ChildTraceParent returns a traceparent continuing the trace of parent with
+// a new span ID, use it to publish follow-up deliveries while consuming. If
+// parent isn't a valid traceparent a new trace is started.
+func ChildTraceParent(parent string) string {
+	traceID, ok := TraceID(parent)
+	if !ok {
+		return NewTraceParent()
+	}
+	return "00-" + traceID + "-" + randomHex(8) + "-" + parent[53:55]
+}
+
+// TraceID returns the trace ID of traceParent to correlate logs, returns
+// false if it isn't a valid version 00 traceparent
+func TraceID(traceParent string) (string, bool) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return "", false
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", false // all zero IDs are invalid
+	}
+	return parts[1], true
+}
+
+func randomHex(bytes int) string {
+	buffer := make([]byte, bytes)
+	rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// isHex returns true if s consists of length lowercase hex digits
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestTraceSuite(t *testing.T) {
+	TestingSuiteT(&TraceSuite{}, t)
+}
+
+type TraceSuite struct{}
+
+func (suite *TraceSuite) TestTraceParent(c *C) {
+	parent := NewTraceParent()
+	c.Check(parent, Matches, "00-[0-9a-f]{32}-[0-9a-f]{16}-01")
+	traceID, ok := TraceID(parent)
+	c.Check(ok, Equals, true)
+
+	child := ChildTraceParent(parent)
+	c.Check(child, Not(Equals), parent)
+	childTraceID, ok := TraceID(child)
+	c.Check(ok, Equals, true)
+	c.Check(childTraceID, Equals, traceID)
+
+	c.Check(ChildTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"), Matches, "00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-00")
+
+	for _, invalid := range []string{"", "garbage", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"} {
+		_, ok := TraceID(invalid)
+		c.Check(ok, Equals, false, Commentf("%q", invalid))
+	}
+	_, ok = TraceID(ChildTraceParent("garbage"))
+	c.Check(ok, Equals, true)
+}
+
+func (suite *TraceSuite) TestPublishWithHeaders(c *C) {
+	connection := OpenConnection("trace-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("trace-q").(*redisQueue)
+	queue.PurgeReady()
+	pushQueue := connection.OpenQueue("trace-push-q").(*redisQueue)
+	pushQueue.PurgeReady()
+	queue.SetPushQueue(pushQueue)
+
+	parent := NewTraceParent()
+	c.Check(queue.PublishWithHeaders("trace-d1", map[string]string{TraceParentHeader: parent, "correlation-id": "c1"}), Equals, true)
+	c.Check(queue.Publish("trace-d2"), Equals, true)
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "trace-d1")
+	c.Check(delivery.Header(TraceParentHeader), Equals, parent)
+	c.Check(delivery.Header("correlation-id"), Equals, "c1")
+	c.Check(delivery.Push(), Equals, true)
+
+	pushed, err := pushQueue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(pushed.Header(TraceParentHeader), Equals, parent)
+
+	delivery, err = queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Header(TraceParentHeader), Equals, "")
+
+	testQueue := NewTestQueue("trace-test-q")
+	testQueue.PublishWithHeaders("trace-d3", map[string]string{"correlation-id": "c3"})
+	c.Check(testQueue.LastDeliveries, DeepEquals, []string{"trace-d3"})
+	c.Check(testQueue.LastHeaders, DeepEquals, []map[string]string{{"correlation-id": "c3"}})
+
+	connection.StopHeartbeat()
+}
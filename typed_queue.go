@@ -0,0 +1,111 @@
+//go:build go1.18
+// +build go1.18
+
+package rmq
+
+import "context"
+
+// Settler settles a delivery manually, see TypedQueue.AddConsumer
+type Settler interface {
+	Ack() bool
+	Reject() bool
+	RejectWithReason(reason string) bool
+	Push() bool
+	Touch() bool
+}
+
+// TypedQueue publishes and consumes objects of type T instead of payloads
+type TypedQueue[T any] struct {
+	queue Queue
+	codec Codec
+}
+
+// NewTypedQueue wraps queue to publish and consume objects of type T. They
+// are marshaled with codec, nil means JSONCodec.
+func NewTypedQueue[T any](queue Queue, codec Codec) *TypedQueue[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &TypedQueue[T]{queue: queue, codec: codec}
+}
+
+// Queue returns the wrapped queue
+func (typed *TypedQueue[T]) Queue() Queue {
+	return typed.queue
+}
+
+// Publish marshals object and publishes it, returns false if marshaling or
+// publishing failed
+func (typed *TypedQueue[T]) Publish(object T) bool {
+	return typed.queue.PublishObjectWith(typed.codec, object)
+}
+
+// AddConsumer adds a consumer which calls handler with the unmarshaled
+// object of each delivery. The delivery is acked if handler returns nil and
+// rejected with the error as reason if it returns one, unless handler settled
+// it with settler.
+// Deliveries which can't be unmarshaled are rejected without calling handler.
+// ctx is cancelled when the consumer is removed or the processing timeout of
+// the queue expired.
+func (typed *TypedQueue[T]) AddConsumer(tag string, handler func(ctx context.Context, object T, settler Settler) error) (string, error) {
+	return typed.queue.AddConsumer(tag, &typedConsumer[T]{handler: handler})
+}
+
+type typedConsumer[T any] struct {
+	handler func(ctx context.Context, object T, settler Settler) error
+}
+
+func (consumer *typedConsumer[T]) Consume(delivery Delivery) {
+	consumer.ConsumeContext(context.Background(), delivery)
+}
+
+func (consumer *typedConsumer[T]) ConsumeContext(ctx context.Context, delivery Delivery) {
+	var object T
+	if err := delivery.Unmarshal(&object); err != nil {
+		delivery.RejectWithReason(err.Error())
+		return
+	}
+
+	settler := &trackingSettler{delivery: delivery}
+	err := consumer.handler(ctx, object, settler)
+	if settler.settled {
+		return
+	}
+
+	if err != nil {
+		delivery.RejectWithReason(err.Error())
+		return
+	}
+	delivery.Ack()
+}
+
+// trackingSettler remembers if the delivery was settled
+type trackingSettler struct {
+	delivery Delivery
+	settled  bool
+}
+
+func (settler *trackingSettler) Ack() bool {
+	settler.settled = true
+	return settler.delivery.Ack()
+}
+
+func (settler *trackingSettler) Reject() bool {
+	settler.settled = true
+	return settler.delivery.Reject()
+}
+
+func (settler *trackingSettler) RejectWithReason(reason string) bool {
+	settler.settled = true
+	return settler.delivery.RejectWithReason(reason)
+}
+
+func (settler *trackingSettler) Push() bool {
+	settler.settled = true
+	return settler.delivery.Push()
+}
+
+// Touch doesn't settle the delivery
+func (settler *trackingSettler) Touch() bool {
+	return settler.delivery.Touch()
+}
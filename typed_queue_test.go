@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+package rmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestTypedQueueSuite(t *testing.T) {
+	TestingSuiteT(&TypedQueueSuite{}, t)
+}
+
+type TypedQueueSuite struct{}
+
+type typedTask struct {
+	Name string `json:"name"`
+}
+
+func (suite *TypedQueueSuite) TestQueue(c *C) {
+	connection := OpenConnection("typed-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("typed-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	typed := NewTypedQueue[typedTask](queue, nil)
+	c.Check(typed.Publish(typedTask{Name: "ok"}), Equals, true)
+	c.Check(typed.Publish(typedTask{Name: "fail"}), Equals, true)
+	c.Check(typed.Publish(typedTask{Name: "push"}), Equals, true)
+	queue.Publish("not json")
+
+	mutex := sync.Mutex{}
+	handled := []string{}
+	queue.StartConsuming(10, time.Millisecond)
+	typed.AddConsumer("typed-cons", func(ctx context.Context, task typedTask, settler Settler) error {
+		mutex.Lock()
+		handled = append(handled, task.Name)
+		mutex.Unlock()
+
+		switch task.Name {
+		case "fail":
+			return errors.New("failed")
+		case "push":
+			settler.Push() // rejected as there's no push queue
+			return nil
+		}
+		return nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	mutex.Lock()
+	c.Check(handled, DeepEquals, []string{"ok", "fail", "push"})
+	mutex.Unlock()
+	c.Check(queue.UnackedCount(), Equals, 0)
+	c.Check(queue.RejectedCount(), Equals, 3) // fail, push and not json
+
+	queue.StopConsuming()
+	connection.StopHeartbeat()
+}
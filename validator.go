@@ -0,0 +1,61 @@
+package rmq
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Validator checks payloads of a queue, see SetValidator. contentType is the
+// content type of the codec the payload was marshaled with, empty for
+// payloads which weren't published with PublishObject.
+type Validator interface {
+	Validate(payload string, contentType string) error
+}
+
+// ValidatorFunc adapts a function to a Validator, for example to check
+// payloads against a JSON schema
+type ValidatorFunc func(payload string, contentType string) error
+
+func (f ValidatorFunc) Validate(payload string, contentType string) error {
+	return f(payload, contentType)
+}
+
+// ValidJSON is a Validator which accepts payloads which are valid JSON
+var ValidJSON Validator = ValidatorFunc(func(payload string, contentType string) error {
+	if !json.Valid([]byte(payload)) {
+		return errors.New("payload is not valid JSON")
+	}
+	return nil
+})
+
+// SetValidator validates payloads when they are published and when they are
+// fetched by consumers. Publishing invalid payloads fails and invalid
+// deliveries are rejected with the validation error as reason, see
+// RejectionReason, so consumers never see them. Pass nil to stop validating.
+func (queue *redisQueue) SetValidator(validator Validator) {
+	queue.validator = validator
+}
+
+// validate returns false if a validator is set and rejects payload
+func (queue *redisQueue) validate(payload string, contentType string) bool {
+	if queue.validator == nil {
+		return true
+	}
+	if err := queue.validator.Validate(payload, contentType); err != nil {
+		queue.debugf("invalid payload %s %s %s", payload, err, queue)
+		return false
+	}
+	return true
+}
+
+// validationError returns why delivery is invalid, nil if no validator is set
+// or the delivery is valid
+func (queue *redisQueue) validationError(delivery *wrapDelivery) error {
+	if queue.validator == nil {
+		return nil
+	}
+	if err := queue.validator.Validate(delivery.payload, delivery.ContentType()); err != nil {
+		return errors.New("rmq delivery invalid: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestValidatorSuite(t *testing.T) {
+	TestingSuiteT(&ValidatorSuite{}, t)
+}
+
+type ValidatorSuite struct{}
+
+func (suite *ValidatorSuite) TestValidJSON(c *C) {
+	c.Check(ValidJSON.Validate(`{"id": 1}`, ""), IsNil)
+	c.Check(ValidJSON.Validate(`{"id": 1`, ""), ErrorMatches, "payload is not valid JSON")
+}
+
+func (suite *ValidatorSuite) TestPublish(c *C) {
+	connection := OpenConnection("validator-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("validator-publish-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.SetValidator(ValidJSON)
+
+	c.Check(queue.Publish(`{"id": 1}`), Equals, true)
+	c.Check(queue.Publish("validator-d"), Equals, false)
+	c.Check(queue.PublishBytes([]byte("validator-d")), Equals, false)
+	c.Check(queue.PublishWithHeaders("validator-d", nil), Equals, false)
+	c.Check(queue.PublishObject(map[string]int{"id": 2}), Equals, true)
+	c.Check(queue.ReadyCount(), Equals, 2)
+
+	contentTypes := []string{}
+	queue.SetValidator(ValidatorFunc(func(payload string, contentType string) error {
+		contentTypes = append(contentTypes, contentType)
+		return nil
+	}))
+	queue.PublishObject(3)
+	c.Check(contentTypes, DeepEquals, []string{"application/json"})
+
+	queue.SetValidator(nil)
+	c.Check(queue.Publish("validator-d"), Equals, true)
+	connection.StopHeartbeat()
+}
+
+func (suite *ValidatorSuite) TestConsume(c *C) {
+	connection := OpenConnection("validator-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("validator-consume-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	// published before the validator was set
+	queue.Publish("validator-invalid")
+	queue.Publish("validator-valid")
+	queue.SetValidator(ValidatorFunc(func(payload string, contentType string) error {
+		if !strings.HasSuffix(payload, "-valid") {
+			return errors.New("unknown version")
+		}
+		return nil
+	}))
+
+	delivery, err := queue.Get(context.Background())
+	c.Assert(err, IsNil)
+	c.Check(delivery.Payload(), Equals, "validator-valid")
+	c.Check(delivery.Ack(), Equals, true)
+
+	c.Check(queue.PeekRejected(1), DeepEquals, []string{"validator-invalid"})
+	reason, ok := queue.RejectionReason("validator-invalid")
+	c.Check(ok, Equals, true)
+	c.Check(reason.Reason, Equals, "rmq delivery invalid: unknown version")
+	connection.StopHeartbeat()
+}
@@ -0,0 +1,250 @@
+package rmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// types of webhook events
+const (
+	WebhookEventThreshold      = "threshold"       // an alert fired or was resolved, see NotifyAlert
+	WebhookEventConnectionDied = "connection_died" // the heartbeat of a connection expired
+	WebhookEventDeadLetter     = "dead_letter"     // deliveries of a watched queue were rejected or quarantined
+)
+
+const (
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = time.Second
+	webhookTimeout        = 10 * time.Second
+)
+
+// WebhookEvent is posted as JSON to the webhook URLs
+type WebhookEvent struct {
+	Type       string    `json:"type"` // one of the WebhookEvent constants
+	Queue      string    `json:"queue,omitempty"`
+	Connection string    `json:"connection,omitempty"`
+	Metric     string    `json:"metric,omitempty"`    // the AlertMetric of threshold events
+	Value      int64     `json:"value,omitempty"`     // metric value or number of new dead letters
+	Threshold  int64     `json:"threshold,omitempty"` // of threshold events
+	Resolved   bool      `json:"resolved,omitempty"`  // true if a threshold event was resolved
+	Time       time.Time `json:"time"`
+}
+
+// WebhookNotifier posts events to webhook URLs, so alerting works without a
+// metrics pipeline. Pass NotifyAlert as alert callback to get threshold
+// events and call Start to get events about dead connections and dead
+// letters of watched queues. Failed posts are retried with exponential
+// backoff and logged once they failed for good.
+type WebhookNotifier struct {
+	connection  *redisConnection
+	urls        []string
+	client      *http.Client
+	mutex       sync.Mutex
+	retries     int
+	backoff     time.Duration
+	queues      map[string]int  // watched queues to their dead letter count, -1 until measured
+	dead        map[string]bool // dead connections which were seen already
+	checked     bool            // false until the first check
+	stopChan    chan struct{}
+	stoppedChan chan struct{}  // closed when the checking goroutine returned
+	checkMutex  sync.Mutex     // serializes checks which update queues and dead
+	posts       sync.WaitGroup // running posts, see Stop
+}
+
+// NewWebhookNotifier returns a notifier posting events to all urls
+func NewWebhookNotifier(connection *redisConnection, urls ...string) *WebhookNotifier {
+	return &WebhookNotifier{
+		connection: connection,
+		urls:       urls,
+		client:     &http.Client{Timeout: webhookTimeout},
+		retries:    defaultWebhookRetries,
+		backoff:    defaultWebhookBackoff,
+		queues:     map[string]int{},
+		dead:       map[string]bool{},
+	}
+}
+
+// SetRetries changes how often a failed post is retried and the wait before
+// the first retry, which doubles with every retry. Three retries after one
+// second by default.
+func (notifier *WebhookNotifier) SetRetries(retries int, backoff time.Duration) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	notifier.retries = retries
+	notifier.backoff = backoff
+}
+
+// WatchDeadLetters notifies when the number of rejected or quarantined
+// deliveries of queue grows, see Check
+func (notifier *WebhookNotifier) WatchDeadLetters(queue string) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if _, ok := notifier.queues[queue]; !ok {
+		notifier.queues[queue] = -1
+	}
+}
+
+// NotifyAlert posts a threshold event for alert, pass it as callback to
+// Alerter, for example to OnReadyCount
+func (notifier *WebhookNotifier) NotifyAlert(alert Alert) {
+	notifier.Notify(WebhookEvent{
+		Type:      WebhookEventThreshold,
+		Queue:     alert.Queue,
+		Metric:    alert.Metric,
+		Value:     alert.Value,
+		Threshold: alert.Threshold,
+		Resolved:  alert.Resolved,
+	})
+}
+
+// Notify posts event to all webhook URLs in the background. Time is set to
+// now if it's zero.
+func (notifier *WebhookNotifier) Notify(event WebhookEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		logf("rmq webhook failed to encode event %s: %s", event.Type, err)
+		return
+	}
+
+	notifier.mutex.Lock()
+	retries, backoff := notifier.retries, notifier.backoff
+	notifier.mutex.Unlock()
+
+	for _, url := range notifier.urls {
+		notifier.posts.Add(1)
+		go func(url string) {
+			defer notifier.posts.Done()
+			notifier.post(url, body, retries, backoff)
+		}(url)
+	}
+}
+
+// post posts body to url and retries on errors and non 2xx responses
+func (notifier *WebhookNotifier) post(url string, body []byte, retries int, backoff time.Duration) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = notifier.postOnce(url, body); err == nil {
+			return
+		}
+		if attempt >= retries {
+			break
+		}
+		time.Sleep(backoff << uint(attempt))
+	}
+	logf("rmq webhook failed to post to %s after %d attempts: %s", url, retries+1, err)
+}
+
+func (notifier *WebhookNotifier) postOnce(url string, body []byte) error {
+	response, err := notifier.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("status %s", response.Status)
+	}
+	return nil
+}
+
+// Start checks for dead connections and dead letters every interval until
+// Stop is called
+func (notifier *WebhookNotifier) Start(interval time.Duration) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	if notifier.stopChan != nil {
+		return // already started
+	}
+
+	stopChan := make(chan struct{})
+	stoppedChan := make(chan struct{})
+	notifier.stopChan = stopChan
+	notifier.stoppedChan = stoppedChan
+
+	go func() {
+		defer close(stoppedChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				notifier.Check()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the checks started by Start and waits for running posts
+// including their retries to finish
+func (notifier *WebhookNotifier) Stop() {
+	notifier.mutex.Lock()
+	if notifier.stopChan != nil {
+		close(notifier.stopChan)
+		stoppedChan := notifier.stoppedChan
+		notifier.stopChan = nil
+		notifier.mutex.Unlock()
+		<-stoppedChan // outside the lock, Check takes it
+	} else {
+		notifier.mutex.Unlock()
+	}
+
+	notifier.posts.Wait()
+}
+
+// Check notifies about connections which died and watched queues with new
+// dead letters since the previous check. The first check only records which
+// connections are dead already and the dead letter counts.
+func (notifier *WebhookNotifier) Check() {
+	notifier.checkMutex.Lock()
+	defer notifier.checkMutex.Unlock()
+
+	connectionNames := notifier.connection.GetConnections()
+	listed := make(map[string]bool, len(connectionNames))
+	for _, connectionName := range connectionNames {
+		listed[connectionName] = true
+		if notifier.dead[connectionName] || notifier.connection.hijackConnection(connectionName).Check() {
+			continue
+		}
+		notifier.dead[connectionName] = true
+		if notifier.checked {
+			notifier.Notify(WebhookEvent{Type: WebhookEventConnectionDied, Connection: connectionName})
+		}
+	}
+	for connectionName := range notifier.dead {
+		if !listed[connectionName] {
+			delete(notifier.dead, connectionName) // cleaned
+		}
+	}
+	notifier.checked = true
+
+	notifier.mutex.Lock()
+	counts := make(map[string]int, len(notifier.queues))
+	for queueName, count := range notifier.queues {
+		counts[queueName] = count
+	}
+	notifier.mutex.Unlock()
+
+	for queueName, previous := range counts {
+		queue := notifier.connection.openQueue(queueName)
+		count := queue.RejectedCount() + queue.PoisonCount()
+		if previous >= 0 && count > previous {
+			notifier.Notify(WebhookEvent{Type: WebhookEventDeadLetter, Queue: queueName, Value: int64(count - previous)})
+		}
+		counts[queueName] = count // also lower after purging or returning
+	}
+
+	notifier.mutex.Lock()
+	for queueName, count := range counts {
+		notifier.queues[queueName] = count
+	}
+	notifier.mutex.Unlock()
+}
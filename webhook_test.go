@@ -0,0 +1,83 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/adjust/gocheck"
+)
+
+func TestWebhookSuite(t *testing.T) {
+	TestingSuiteT(&WebhookSuite{}, t)
+}
+
+type WebhookSuite struct{}
+
+func (suite *WebhookSuite) TestNotifier(c *C) {
+	var mutex sync.Mutex
+	events := []WebhookEvent{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if requests == 1 {
+			writer.WriteHeader(http.StatusInternalServerError) // retried
+			return
+		}
+		event := WebhookEvent{}
+		c.Check(json.NewDecoder(request.Body).Decode(&event), IsNil)
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	connection := OpenConnection("webhook-conn", "tcp", "localhost:6379", 1)
+	queue := connection.OpenQueue("webhook-q").(*redisQueue)
+	queue.PurgeReady()
+	queue.PurgeRejected()
+
+	notifier := NewWebhookNotifier(connection, server.URL)
+	notifier.SetRetries(1, time.Millisecond)
+	notifier.WatchDeadLetters("webhook-q")
+	notifier.Check() // only records the current state
+
+	notifier.NotifyAlert(Alert{Queue: "webhook-q", Metric: AlertMetricReady, Value: 5, Threshold: 3})
+	notifier.Stop()
+	c.Assert(events, HasLen, 1)
+	c.Check(events[0].Type, Equals, WebhookEventThreshold)
+	c.Check(events[0].Queue, Equals, "webhook-q")
+	c.Check(events[0].Value, Equals, int64(5))
+	c.Check(events[0].Threshold, Equals, int64(3))
+	c.Check(requests, Equals, 2)
+
+	queue.Publish("webhook-d1")
+	queue.Publish("webhook-d2")
+	deliveries, err := queue.GetBatch(context.Background(), 2)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	c.Check(deliveries.Reject(), Equals, 0)
+
+	deadConnection := OpenConnection("webhook-dead-conn", "tcp", "localhost:6379", 1)
+	deadConnection.StopHeartbeat()
+
+	events = events[:0]
+	notifier.Check()
+	notifier.Check() // notifies only once
+	notifier.Stop()
+	c.Assert(events, HasLen, 2)
+	types := map[string]WebhookEvent{}
+	for _, event := range events {
+		types[event.Type] = event
+	}
+	c.Check(types[WebhookEventDeadLetter].Queue, Equals, "webhook-q")
+	c.Check(types[WebhookEventDeadLetter].Value, Equals, int64(2))
+	c.Check(types[WebhookEventConnectionDied].Connection, Equals, deadConnection.Name)
+
+	queue.PurgeRejected()
+	connection.StopHeartbeat()
+}